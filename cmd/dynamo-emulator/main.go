@@ -1,8 +1,11 @@
 package main
 
 import (
+    "fmt"
     "log"
     "os"
+    "strconv"
+    "time"
 
     "go-dyn-emu/pkg/api"
     "go-dyn-emu/pkg/core"
@@ -11,12 +14,35 @@ import (
 func main() {
     log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-    db, err := core.NewDatabase()
+    opts, err := databaseOptionsFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid database configuration: %v", err)
+    }
+
+    db, err := core.NewDatabase(opts)
     if err != nil {
         log.Fatalf("Failed to initialize database: %v", err)
     }
     defer db.Close()
 
+    if os.Getenv("DYNAMO_MANUAL_CLOCK") == "true" {
+        db.SetClock(core.NewManualClock(time.Now()))
+    }
+
+    if os.Getenv("DYNAMO_EVENTUAL_CONSISTENCY") == "true" {
+        db.SetConsistencyConfig(consistencyConfigFromEnv())
+    }
+
+    if os.Getenv("DYNAMO_THROTTLE") == "true" || os.Getenv("DYNAMO_PARTITIONS") == "true" {
+        db.SetCapacityConfig(capacityConfigFromEnv())
+    }
+
+    if path := os.Getenv("DYNAMO_FAULT_RULES_FILE"); path != "" {
+        if err := db.LoadFaultRules(path); err != nil {
+            log.Fatalf("Failed to load fault rules: %v", err)
+        }
+    }
+
     server := api.NewServer(db)
 
     addr := ":8000"
@@ -25,4 +51,112 @@ func main() {
     }
 
     server.Start(addr)
-}
\ No newline at end of file
+}
+
+func databaseOptionsFromEnv() (core.DatabaseOptions, error) {
+    opts := core.DatabaseOptions{
+        DataDir: os.Getenv("DYNAMO_DATA_DIR"),
+        SnapshotDir: os.Getenv("DYNAMO_SNAPSHOT_DIR"),
+        S3Dir: os.Getenv("DYNAMO_S3_DIR"),
+        ImportLogDir: os.Getenv("DYNAMO_IMPORT_LOG_DIR"),
+        ArchiveDir: os.Getenv("DYNAMO_ARCHIVE_DIR"),
+    }
+
+    switch storage := os.Getenv("DYNAMO_STORAGE"); storage {
+    case "", "leveldb":
+    case "memory":
+        opts.InMemory = true
+    default:
+        return opts, fmt.Errorf("unknown DYNAMO_STORAGE %s, expected leveldb or memory", storage)
+    }
+
+    if v := os.Getenv("DYNAMO_LEVELDB_CACHE_SIZE"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil {
+            return opts, fmt.Errorf("invalid DYNAMO_LEVELDB_CACHE_SIZE: %w", err)
+        }
+        opts.BlockCacheCapacity = n
+    }
+    if v := os.Getenv("DYNAMO_LEVELDB_WRITE_BUFFER"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil {
+            return opts, fmt.Errorf("invalid DYNAMO_LEVELDB_WRITE_BUFFER: %w", err)
+        }
+        opts.WriteBuffer = n
+    }
+
+    return opts, nil
+}
+
+func consistencyConfigFromEnv() core.ConsistencyConfig {
+    cfg := core.ConsistencyConfig{
+        EventualConsistency: true,
+        GSIPropagationDelay: 500 * time.Millisecond,
+        StaleReadWindow: time.Second,
+        StaleReadProbability: 1.0,
+    }
+
+    if v := os.Getenv("DYNAMO_GSI_PROPAGATION_DELAY"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil {
+            cfg.GSIPropagationDelay = d
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_GSI_PROPAGATION_DELAY: %v", err)
+        }
+    }
+    if v := os.Getenv("DYNAMO_GSI_PROPAGATION_JITTER"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil {
+            cfg.GSIPropagationJitter = d
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_GSI_PROPAGATION_JITTER: %v", err)
+        }
+    }
+    if v := os.Getenv("DYNAMO_STALE_READ_WINDOW"); v != "" {
+        if d, err := time.ParseDuration(v); err == nil {
+            cfg.StaleReadWindow = d
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_STALE_READ_WINDOW: %v", err)
+        }
+    }
+    if v := os.Getenv("DYNAMO_STALE_READ_PROBABILITY"); v != "" {
+        if p, err := strconv.ParseFloat(v, 64); err == nil {
+            cfg.StaleReadProbability = p
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_STALE_READ_PROBABILITY: %v", err)
+        }
+    }
+
+    return cfg
+}
+
+func capacityConfigFromEnv() core.CapacityConfig {
+    cfg := core.CapacityConfig{
+        Throttle: os.Getenv("DYNAMO_THROTTLE") == "true",
+        Partitions: os.Getenv("DYNAMO_PARTITIONS") == "true",
+    }
+
+    if v := os.Getenv("DYNAMO_BURST_SECONDS"); v != "" {
+        if n, err := strconv.ParseFloat(v, 64); err == nil && n >= 0 {
+            cfg.BurstSeconds = n
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_BURST_SECONDS: %s", v)
+        }
+    }
+
+    if v := os.Getenv("DYNAMO_PARTITION_SPLIT_BYTES"); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+            cfg.PartitionSplitBytes = n
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_PARTITION_SPLIT_BYTES: %s", v)
+        }
+    }
+
+    if v := os.Getenv("DYNAMO_HEAT_SPLIT_SECONDS"); v != "" {
+        if n, err := strconv.ParseFloat(v, 64); err == nil && n > 0 {
+            cfg.HeatSplitAfter = time.Duration(n * float64(time.Second))
+        } else {
+            log.Printf("Ignoring invalid DYNAMO_HEAT_SPLIT_SECONDS: %s", v)
+        }
+    }
+
+    return cfg
+}
@@ -2,6 +2,9 @@ module go-dyn-emu
 
 go 1.24.2
 
-require github.com/syndtr/goleveldb v1.0.0
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/syndtr/goleveldb v1.0.0
+)
 
 require github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
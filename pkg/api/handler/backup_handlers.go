@@ -0,0 +1,451 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type IndexDefinition struct {
+	IndexName string `json:"IndexName"`
+	KeySchema []model.KeySchemaElement `json:"KeySchema"`
+	Projection *model.Projection `json:"Projection,omitempty"`
+}
+
+type BackupDetails struct {
+	BackupArn string `json:"BackupArn"`
+	BackupName string `json:"BackupName"`
+	BackupSizeBytes int64 `json:"BackupSizeBytes"`
+	BackupStatus string `json:"BackupStatus"`
+	BackupType string `json:"BackupType"`
+	BackupCreationDateTime float64 `json:"BackupCreationDateTime"`
+}
+
+type BackupSummary struct {
+	TableName string `json:"TableName"`
+	TableArn string `json:"TableArn"`
+	BackupArn string `json:"BackupArn"`
+	BackupName string `json:"BackupName"`
+	BackupCreationDateTime float64 `json:"BackupCreationDateTime"`
+	BackupStatus string `json:"BackupStatus"`
+	BackupType string `json:"BackupType"`
+	BackupSizeBytes int64 `json:"BackupSizeBytes"`
+}
+
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+func fromEpochSeconds(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(seconds * 1000))
+}
+
+func backupDetails(descriptor model.BackupDescriptor) BackupDetails {
+	return BackupDetails{
+		BackupArn: descriptor.BackupArn,
+		BackupName: descriptor.BackupName,
+		BackupSizeBytes: descriptor.SizeBytes,
+		BackupStatus: descriptor.BackupStatus,
+		BackupType: descriptor.BackupType,
+		BackupCreationDateTime: epochSeconds(descriptor.CreationTime),
+	}
+}
+
+func tableKeySchema(schema model.TableSchema) []model.KeySchemaElement {
+	keySchema := []model.KeySchemaElement{{AttributeName: schema.PartitionKey, KeyType: "HASH"}}
+	if schema.SortKey != "" {
+		keySchema = append(keySchema, model.KeySchemaElement{AttributeName: schema.SortKey, KeyType: "RANGE"})
+	}
+	return keySchema
+}
+
+func indexDefinitions(indexes map[string]model.GsiSchema) []IndexDefinition {
+	definitions := make([]IndexDefinition, 0, len(indexes))
+	for _, index := range indexes {
+		projection := index.EffectiveProjection()
+		definitions = append(definitions, IndexDefinition{
+			IndexName: index.IndexName,
+			KeySchema: tableKeySchema(model.TableSchema{PartitionKey: index.PartitionKey, SortKey: index.SortKey}),
+			Projection: &projection,
+		})
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].IndexName < definitions[j].IndexName })
+	return definitions
+}
+
+func indexSchemas(definitions []IndexDefinition) map[string]model.GsiSchema {
+	if definitions == nil {
+		return nil
+	}
+
+	indexes := make(map[string]model.GsiSchema, len(definitions))
+	for _, definition := range definitions {
+		index := model.GsiSchema{IndexName: definition.IndexName}
+		if definition.Projection != nil {
+			index.Projection = *definition.Projection
+		}
+		for _, ks := range definition.KeySchema {
+			if ks.KeyType == "HASH" {
+				index.PartitionKey = ks.AttributeName
+			} else if ks.KeyType == "RANGE" {
+				index.SortKey = ks.AttributeName
+			}
+		}
+		indexes[definition.IndexName] = index
+	}
+	return indexes
+}
+
+func backupDescription(descriptor model.BackupDescriptor) map[string]interface{} {
+	schema := descriptor.Schema
+
+	features := map[string]interface{}{
+		"StreamDescription": StreamSpecification{StreamEnabled: schema.StreamViewType != "", StreamViewType: schema.StreamViewType},
+	}
+	if len(schema.GSIs) > 0 {
+		features["GlobalSecondaryIndexes"] = indexDefinitions(schema.GSIs)
+	}
+	if len(schema.LSIs) > 0 {
+		features["LocalSecondaryIndexes"] = indexDefinitions(schema.LSIs)
+	}
+	if schema.TTLAttribute != "" {
+		features["TimeToLiveDescription"] = map[string]string{"AttributeName": schema.TTLAttribute, "TimeToLiveStatus": "ENABLED"}
+	}
+
+	return map[string]interface{}{
+		"BackupDetails": backupDetails(descriptor),
+		"SourceTableDetails": map[string]interface{}{
+			"TableName": descriptor.TableName,
+			"TableArn": descriptor.TableArn,
+			"KeySchema": tableKeySchema(schema),
+			"ItemCount": descriptor.ItemCount,
+			"TableSizeBytes": descriptor.SizeBytes,
+			"BillingMode": schema.EffectiveBillingMode(),
+		},
+		"SourceTableFeatureDetails": features,
+	}
+}
+
+type CreateBackupInput struct {
+	TableName string `json:"TableName"`
+	BackupName string `json:"BackupName"`
+}
+
+func (s *Server) handleCreateBackup(w http.ResponseWriter, body []byte) {
+	var input CreateBackupInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.CreateBackup(input.TableName, input.BackupName)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"BackupDetails": backupDetails(descriptor),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type BackupArnInput struct {
+	BackupArn string `json:"BackupArn"`
+}
+
+func (s *Server) handleDescribeBackup(w http.ResponseWriter, body []byte) {
+	var input BackupArnInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.DescribeBackup(input.BackupArn)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"BackupDescription": backupDescription(descriptor),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleDeleteBackup(w http.ResponseWriter, body []byte) {
+	var input BackupArnInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.DeleteBackup(input.BackupArn)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"BackupDescription": backupDescription(descriptor),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type ListBackupsInput struct {
+	TableName string `json:"TableName,omitempty"`
+	Limit int `json:"Limit,omitempty"`
+	ExclusiveStartBackupArn string `json:"ExclusiveStartBackupArn,omitempty"`
+	TimeRangeLowerBound float64 `json:"TimeRangeLowerBound,omitempty"`
+	TimeRangeUpperBound float64 `json:"TimeRangeUpperBound,omitempty"`
+	BackupType string `json:"BackupType,omitempty"`
+}
+
+func (s *Server) handleListBackups(w http.ResponseWriter, body []byte) {
+	var input ListBackupsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	summaries := make([]BackupSummary, 0)
+	lastEvaluated := ""
+
+	switch input.BackupType {
+	case "", model.BackupTypeUser, "ALL":
+		backups, last, err := s.Database.ListBackups(input.TableName, fromEpochSeconds(input.TimeRangeLowerBound), fromEpochSeconds(input.TimeRangeUpperBound), input.ExclusiveStartBackupArn, input.Limit)
+		if err != nil {
+			s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		lastEvaluated = last
+
+		for _, backup := range backups {
+			summaries = append(summaries, BackupSummary{
+				TableName: backup.TableName,
+				TableArn: backup.TableArn,
+				BackupArn: backup.BackupArn,
+				BackupName: backup.BackupName,
+				BackupCreationDateTime: epochSeconds(backup.CreationTime),
+				BackupStatus: backup.BackupStatus,
+				BackupType: backup.BackupType,
+				BackupSizeBytes: backup.SizeBytes,
+			})
+		}
+	case "SYSTEM", "AWS_BACKUP":
+	default:
+		s.writeDynamoDBError(w, "ValidationException", "BackupType must be one of USER, SYSTEM, AWS_BACKUP, ALL", http.StatusBadRequest)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		BackupSummaries []BackupSummary `json:"BackupSummaries"`
+		LastEvaluatedBackupArn string `json:"LastEvaluatedBackupArn,omitempty"`
+	}{
+		BackupSummaries: summaries,
+		LastEvaluatedBackupArn: lastEvaluated,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type RestoreTableFromBackupInput struct {
+	TargetTableName string `json:"TargetTableName"`
+	BackupArn string `json:"BackupArn"`
+	GlobalSecondaryIndexOverride []IndexDefinition `json:"GlobalSecondaryIndexOverride,omitempty"`
+	LocalSecondaryIndexOverride []IndexDefinition `json:"LocalSecondaryIndexOverride,omitempty"`
+}
+
+func (s *Server) handleRestoreTableFromBackup(w http.ResponseWriter, body []byte) {
+	var input RestoreTableFromBackupInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	opts := core.RestoreOptions{
+		GSIOverride: indexSchemas(input.GlobalSecondaryIndexOverride),
+		LSIOverride: indexSchemas(input.LocalSecondaryIndexOverride),
+	}
+	schema, err := s.Database.RestoreTableFromBackup(input.BackupArn, input.TargetTableName, opts)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	descriptor, _ := s.Database.DescribeBackup(input.BackupArn)
+
+	description := tableDescription(schema, "ACTIVE")
+	description["RestoreSummary"] = map[string]interface{}{
+		"SourceBackupArn": input.BackupArn,
+		"SourceTableArn": descriptor.TableArn,
+		"RestoreDateTime": epochSeconds(s.Database.Now()),
+		"RestoreInProgress": false,
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"TableDescription": description,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type PointInTimeRecoverySpecification struct {
+	PointInTimeRecoveryEnabled bool `json:"PointInTimeRecoveryEnabled"`
+	RecoveryPeriodInDays int `json:"RecoveryPeriodInDays,omitempty"`
+}
+
+type UpdateContinuousBackupsInput struct {
+	TableName string `json:"TableName"`
+	PointInTimeRecoverySpecification PointInTimeRecoverySpecification `json:"PointInTimeRecoverySpecification"`
+}
+
+func (s *Server) handleUpdateContinuousBackups(w http.ResponseWriter, body []byte) {
+	var input UpdateContinuousBackupsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	spec := input.PointInTimeRecoverySpecification
+	status, err := s.Database.UpdateContinuousBackups(input.TableName, spec.PointInTimeRecoveryEnabled, spec.RecoveryPeriodInDays)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	s.writeContinuousBackupsDescription(w, status)
+}
+
+type DescribeContinuousBackupsInput struct {
+	TableName string `json:"TableName"`
+}
+
+func (s *Server) handleDescribeContinuousBackups(w http.ResponseWriter, body []byte) {
+	var input DescribeContinuousBackupsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	status, err := s.Database.DescribeContinuousBackups(input.TableName)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	s.writeContinuousBackupsDescription(w, status)
+}
+
+func (s *Server) writeContinuousBackupsDescription(w http.ResponseWriter, status core.ContinuousBackupsStatus) {
+	pitr := map[string]interface{}{
+		"PointInTimeRecoveryStatus": "DISABLED",
+	}
+	if status.Enabled {
+		pitr["PointInTimeRecoveryStatus"] = "ENABLED"
+		pitr["EarliestRestorableDateTime"] = epochSeconds(status.EarliestRestorableTime)
+		pitr["LatestRestorableDateTime"] = epochSeconds(status.LatestRestorableTime)
+		pitr["RecoveryPeriodInDays"] = status.RecoveryPeriodInDays
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"ContinuousBackupsDescription": map[string]interface{}{
+			"ContinuousBackupsStatus": "ENABLED",
+			"PointInTimeRecoveryDescription": pitr,
+		},
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type RestoreTableToPointInTimeInput struct {
+	SourceTableName string `json:"SourceTableName,omitempty"`
+	SourceTableArn string `json:"SourceTableArn,omitempty"`
+	TargetTableName string `json:"TargetTableName"`
+	RestoreDateTime float64 `json:"RestoreDateTime,omitempty"`
+	UseLatestRestorableTime bool `json:"UseLatestRestorableTime,omitempty"`
+	GlobalSecondaryIndexOverride []IndexDefinition `json:"GlobalSecondaryIndexOverride,omitempty"`
+	LocalSecondaryIndexOverride []IndexDefinition `json:"LocalSecondaryIndexOverride,omitempty"`
+}
+
+func (s *Server) handleRestoreTableToPointInTime(w http.ResponseWriter, body []byte) {
+	var input RestoreTableToPointInTimeInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	sourceTable := input.SourceTableName
+	if sourceTable == "" {
+		sourceTable = strings.TrimPrefix(input.SourceTableArn, core.TableArn(""))
+	}
+	if input.RestoreDateTime == 0 && !input.UseLatestRestorableTime {
+		s.writeDynamoDBError(w, "ValidationException", "Either RestoreDateTime or UseLatestRestorableTime must be specified", http.StatusBadRequest)
+		return
+	}
+
+	opts := core.RestoreOptions{
+		GSIOverride: indexSchemas(input.GlobalSecondaryIndexOverride),
+		LSIOverride: indexSchemas(input.LocalSecondaryIndexOverride),
+	}
+	restoreTime := fromEpochSeconds(input.RestoreDateTime)
+	schema, err := s.Database.RestoreTableToPointInTime(sourceTable, input.TargetTableName, restoreTime, input.UseLatestRestorableTime, opts)
+	if err != nil {
+		s.writeBackupError(w, err)
+		return
+	}
+
+	if input.UseLatestRestorableTime {
+		restoreTime = s.Database.Now()
+	}
+	description := tableDescription(schema, "ACTIVE")
+	description["RestoreSummary"] = map[string]interface{}{
+		"SourceTableArn": core.TableArn(sourceTable),
+		"RestoreDateTime": epochSeconds(restoreTime),
+		"RestoreInProgress": false,
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"TableDescription": description,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) writeBackupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrTableNotFound):
+		s.writeDynamoDBError(w, "TableNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrTableAlreadyExists):
+		s.writeDynamoDBError(w, "TableAlreadyExistsException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrBackupNotFound):
+		s.writeDynamoDBError(w, "BackupNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrBackupInUse):
+		s.writeDynamoDBError(w, "BackupInUseException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrPointInTimeRecoveryUnavailable):
+		s.writeDynamoDBError(w, "PointInTimeRecoveryUnavailableException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrInvalidRestoreTime):
+		s.writeDynamoDBError(w, "InvalidRestoreTimeException", err.Error(), http.StatusBadRequest)
+	default:
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+	}
+}
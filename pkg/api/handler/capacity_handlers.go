@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const bytesPerGB = 1 << 30
+
+type DescribeCapacityUsageInput struct {
+	TableName string `json:"TableName"`
+}
+
+func (s *Server) handleDescribeCapacityUsage(w http.ResponseWriter, body []byte) {
+	var input DescribeCapacityUsageInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	table, indexes, err := s.Database.CapacityUsage(input.TableName)
+	if err != nil {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		TableName string `json:"TableName"`
+		Table core.CapacityUsage `json:"Table"`
+		GlobalSecondaryIndexes []core.CapacityUsage `json:"GlobalSecondaryIndexes,omitempty"`
+	}{
+		TableName: input.TableName,
+		Table: table,
+		GlobalSecondaryIndexes: indexes,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type DescribePartitionsInput struct {
+	TableName string `json:"TableName"`
+	IndexName string `json:"IndexName,omitempty"`
+}
+
+func (s *Server) handleDescribePartitions(w http.ResponseWriter, body []byte) {
+	var input DescribePartitionsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	partitions, err := s.Database.DescribePartitions(input.TableName, input.IndexName)
+	if errors.Is(err, core.ErrTableNotFound) {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		TableName string `json:"TableName"`
+		Partitions []core.PartitionUsage `json:"Partitions"`
+	}{
+		TableName: input.TableName,
+		Partitions: partitions,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// returnedCapacity shapes consumed capacity for ReturnConsumedCapacity: nil
+// for NONE, totals only for TOTAL and the per-table and per-index breakdown
+// for INDEXES.
+func returnedCapacity(mode string, consumed *model.ConsumedCapacity) *model.ConsumedCapacity {
+	if consumed == nil {
+		return nil
+	}
+	switch mode {
+	case "TOTAL":
+		return &model.ConsumedCapacity{
+			TableName: consumed.TableName,
+			CapacityUnits: consumed.CapacityUnits,
+			ReadCapacityUnits: consumed.ReadCapacityUnits,
+			WriteCapacityUnits: consumed.WriteCapacityUnits,
+		}
+	case "INDEXES":
+		return consumed
+	}
+	return nil
+}
+
+func returnedCapacities(mode string, consumed []*model.ConsumedCapacity) []*model.ConsumedCapacity {
+	if mode != "TOTAL" && mode != "INDEXES" {
+		return nil
+	}
+	returned := make([]*model.ConsumedCapacity, 0, len(consumed))
+	for _, c := range consumed {
+		returned = append(returned, returnedCapacity(mode, c))
+	}
+	return returned
+}
+
+// itemCollectionMetrics answers ReturnItemCollectionMetrics=SIZE for a write
+// to a table with local secondary indexes. The caller must hold the database
+// lock.
+func (s *Server) itemCollectionMetrics(mode string, schema model.TableSchema, item model.Record) *model.ItemCollectionMetrics {
+	if mode != "SIZE" || len(schema.LSIs) == 0 {
+		return nil
+	}
+	pkAV, ok := item[schema.PartitionKey]
+	if !ok {
+		return nil
+	}
+	pk, _ := model.GetAttributeValueString(pkAV)
+
+	size, err := s.Database.ItemCollectionSize(schema, pk)
+	if err != nil {
+		return nil
+	}
+	lower := math.Floor(float64(size) / bytesPerGB)
+	return &model.ItemCollectionMetrics{
+		ItemCollectionKey: map[string]model.AttributeValue{schema.PartitionKey: pkAV},
+		SizeEstimateRangeGB: []float64{lower, lower + 1},
+	}
+}
+
+// addItemCollectionMetrics groups metrics by table as BatchWriteItem and
+// TransactWriteItems return them.
+func addItemCollectionMetrics(metrics map[string][]*model.ItemCollectionMetrics, tableName string, m *model.ItemCollectionMetrics) map[string][]*model.ItemCollectionMetrics {
+	if m == nil {
+		return metrics
+	}
+	if metrics == nil {
+		metrics = make(map[string][]*model.ItemCollectionMetrics)
+	}
+	for _, existing := range metrics[tableName] {
+		if sameItemCollection(existing, m) {
+			return metrics
+		}
+	}
+	metrics[tableName] = append(metrics[tableName], m)
+	return metrics
+}
+
+func sameItemCollection(a, b *model.ItemCollectionMetrics) bool {
+	for name, av := range a.ItemCollectionKey {
+		aVal, _ := model.GetAttributeValueString(av)
+		bVal, _ := model.GetAttributeValueString(b.ItemCollectionKey[name])
+		if aVal != bVal {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type IncrementalExportSpecification struct {
+	ExportFromTime float64 `json:"ExportFromTime,omitempty"`
+	ExportToTime float64 `json:"ExportToTime,omitempty"`
+	ExportViewType string `json:"ExportViewType,omitempty"`
+}
+
+type ExportTableToPointInTimeInput struct {
+	TableArn string `json:"TableArn"`
+	ExportTime float64 `json:"ExportTime,omitempty"`
+	ClientToken string `json:"ClientToken,omitempty"`
+	S3Bucket string `json:"S3Bucket"`
+	S3BucketOwner string `json:"S3BucketOwner,omitempty"`
+	S3Prefix string `json:"S3Prefix,omitempty"`
+	S3SseAlgorithm string `json:"S3SseAlgorithm,omitempty"`
+	ExportFormat string `json:"ExportFormat,omitempty"`
+	ExportType string `json:"ExportType,omitempty"`
+	IncrementalExportSpecification *IncrementalExportSpecification `json:"IncrementalExportSpecification,omitempty"`
+}
+
+type ExportDescription struct {
+	ExportArn string `json:"ExportArn"`
+	ExportStatus string `json:"ExportStatus"`
+	StartTime float64 `json:"StartTime"`
+	EndTime float64 `json:"EndTime"`
+	ExportManifest string `json:"ExportManifest"`
+	TableArn string `json:"TableArn"`
+	TableId string `json:"TableId"`
+	ExportTime float64 `json:"ExportTime,omitempty"`
+	ClientToken string `json:"ClientToken,omitempty"`
+	S3Bucket string `json:"S3Bucket"`
+	S3BucketOwner string `json:"S3BucketOwner,omitempty"`
+	S3Prefix string `json:"S3Prefix,omitempty"`
+	S3SseAlgorithm string `json:"S3SseAlgorithm"`
+	ExportFormat string `json:"ExportFormat"`
+	BilledSizeBytes int64 `json:"BilledSizeBytes"`
+	ItemCount int64 `json:"ItemCount"`
+	ExportType string `json:"ExportType"`
+	IncrementalExportSpecification *IncrementalExportSpecification `json:"IncrementalExportSpecification,omitempty"`
+}
+
+type ExportSummary struct {
+	ExportArn string `json:"ExportArn"`
+	ExportStatus string `json:"ExportStatus"`
+	ExportType string `json:"ExportType"`
+}
+
+func exportDescription(descriptor model.ExportDescriptor) ExportDescription {
+	description := ExportDescription{
+		ExportArn: descriptor.ExportArn,
+		ExportStatus: descriptor.ExportStatus,
+		StartTime: epochSeconds(descriptor.StartTime),
+		EndTime: epochSeconds(descriptor.EndTime),
+		ExportManifest: descriptor.ExportManifest,
+		TableArn: descriptor.TableArn,
+		TableId: descriptor.TableId,
+		ClientToken: descriptor.ClientToken,
+		S3Bucket: descriptor.S3Bucket,
+		S3BucketOwner: descriptor.S3BucketOwner,
+		S3Prefix: descriptor.S3Prefix,
+		S3SseAlgorithm: descriptor.S3SseAlgorithm,
+		ExportFormat: descriptor.ExportFormat,
+		BilledSizeBytes: descriptor.BilledSizeBytes,
+		ItemCount: descriptor.ItemCount,
+		ExportType: descriptor.ExportType,
+	}
+	if descriptor.ExportType == model.ExportTypeIncremental {
+		description.IncrementalExportSpecification = &IncrementalExportSpecification{
+			ExportFromTime: epochSeconds(descriptor.ExportFromTime),
+			ExportToTime: epochSeconds(descriptor.ExportToTime),
+			ExportViewType: descriptor.ExportViewType,
+		}
+	} else {
+		description.ExportTime = epochSeconds(descriptor.ExportTime)
+	}
+	return description
+}
+
+func (s *Server) handleExportTableToPointInTime(w http.ResponseWriter, body []byte) {
+	var input ExportTableToPointInTimeInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	if input.TableArn == "" {
+		s.writeDynamoDBError(w, "ValidationException", "TableArn must be specified", http.StatusBadRequest)
+		return
+	}
+
+	opts := core.ExportOptions{
+		S3Bucket: input.S3Bucket,
+		S3BucketOwner: input.S3BucketOwner,
+		S3Prefix: input.S3Prefix,
+		S3SseAlgorithm: input.S3SseAlgorithm,
+		ExportFormat: input.ExportFormat,
+		ExportType: input.ExportType,
+		ExportTime: fromEpochSeconds(input.ExportTime),
+		ClientToken: input.ClientToken,
+	}
+	if spec := input.IncrementalExportSpecification; spec != nil {
+		opts.ExportFromTime = fromEpochSeconds(spec.ExportFromTime)
+		opts.ExportToTime = fromEpochSeconds(spec.ExportToTime)
+		opts.ExportViewType = spec.ExportViewType
+	}
+
+	tableName := strings.TrimPrefix(input.TableArn, core.TableArn(""))
+	descriptor, err := s.Database.ExportTableToPointInTime(tableName, opts)
+	if err != nil {
+		s.writeExportError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"ExportDescription": exportDescription(descriptor),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type DescribeExportInput struct {
+	ExportArn string `json:"ExportArn"`
+}
+
+func (s *Server) handleDescribeExport(w http.ResponseWriter, body []byte) {
+	var input DescribeExportInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.DescribeExport(input.ExportArn)
+	if err != nil {
+		s.writeExportError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"ExportDescription": exportDescription(descriptor),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type ListExportsInput struct {
+	TableArn string `json:"TableArn,omitempty"`
+	MaxResults int `json:"MaxResults,omitempty"`
+	NextToken string `json:"NextToken,omitempty"`
+}
+
+func (s *Server) handleListExports(w http.ResponseWriter, body []byte) {
+	var input ListExportsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	tableName := strings.TrimPrefix(input.TableArn, core.TableArn(""))
+	exports, nextToken, err := s.Database.ListExports(tableName, input.NextToken, input.MaxResults)
+	if err != nil {
+		s.writeExportError(w, err)
+		return
+	}
+
+	summaries := make([]ExportSummary, 0, len(exports))
+	for _, export := range exports {
+		summaries = append(summaries, ExportSummary{
+			ExportArn: export.ExportArn,
+			ExportStatus: export.ExportStatus,
+			ExportType: export.ExportType,
+		})
+	}
+
+	respBody, _ := json.Marshal(struct {
+		ExportSummaries []ExportSummary `json:"ExportSummaries"`
+		NextToken string `json:"NextToken,omitempty"`
+	}{
+		ExportSummaries: summaries,
+		NextToken: nextToken,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) writeExportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrTableNotFound):
+		s.writeDynamoDBError(w, "TableNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrExportNotFound):
+		s.writeDynamoDBError(w, "ExportNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrPointInTimeRecoveryUnavailable):
+		s.writeDynamoDBError(w, "PointInTimeRecoveryUnavailableException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrInvalidExportTime):
+		s.writeDynamoDBError(w, "InvalidExportTimeException", err.Error(), http.StatusBadRequest)
+	default:
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type DeleteFaultRuleInput struct {
+	Name string `json:"Name"`
+}
+
+func (s *Server) handleCreateFaultRule(w http.ResponseWriter, body []byte) {
+	var input core.FaultRule
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Database.AddFaultRule(input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"Name": "%s", "Status": "ENABLED"}`, input.Name)))
+}
+
+func (s *Server) handleDeleteFaultRule(w http.ResponseWriter, body []byte) {
+	var input DeleteFaultRuleInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Database.RemoveFaultRule(input.Name); err != nil {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"Name": "%s", "Status": "DELETED"}`, input.Name)))
+}
+
+func (s *Server) handleListFaultRules(w http.ResponseWriter) {
+	respBody, _ := json.Marshal(struct {
+		Rules []core.FaultRuleStatus `json:"Rules"`
+	}{
+		Rules: s.Database.ListFaultRules(),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// faultTarget picks out of any request body the fields fault rules match on.
+type faultTarget struct {
+	TableName string `json:"TableName"`
+	IndexName string `json:"IndexName"`
+	Key model.Record `json:"Key"`
+	Item model.Record `json:"Item"`
+	KeyConditionExpression string `json:"KeyConditionExpression"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames"`
+	ExpressionAttributeValues map[string]model.AttributeValue `json:"ExpressionAttributeValues"`
+	RequestItems map[string]json.RawMessage `json:"RequestItems"`
+	TransactItems []map[string]faultTarget `json:"TransactItems"`
+}
+
+type faultWriteRequest struct {
+	PutRequest *struct {
+		Item model.Record `json:"Item"`
+	} `json:"PutRequest"`
+	DeleteRequest *struct {
+		Key model.Record `json:"Key"`
+	} `json:"DeleteRequest"`
+}
+
+// injectFault applies the fault rules matching the request. It returns true
+// when the request has been answered with an error or its connection dropped.
+func (s *Server) injectFault(w http.ResponseWriter, operation string, body []byte) bool {
+	switch operation {
+	case "CreateFaultRule", "DeleteFaultRule", "ListFaultRules":
+		return false
+	}
+
+	decision := s.Database.InjectFault(s.faultRequest(operation, body))
+	if decision.Delay > 0 {
+		time.Sleep(decision.Delay)
+	}
+
+	if decision.DropConnection {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		// The server recognizes this panic and closes the connection without
+		// logging a stack trace.
+		panic(http.ErrAbortHandler)
+	}
+
+	if decision.Error != nil {
+		s.writeDynamoDBError(w, decision.Error.Code, decision.Error.Message, errorStatus(decision.Error.Code))
+		return true
+	}
+	return false
+}
+
+func (s *Server) faultRequest(operation string, body []byte) core.FaultRequest {
+	req := core.FaultRequest{Operation: operation}
+
+	var target faultTarget
+	if err := json.Unmarshal(body, &target); err != nil {
+		return req
+	}
+
+	req.IndexName = target.IndexName
+	s.addFaultTarget(&req, target)
+
+	for tableName, raw := range target.RequestItems {
+		req.TableNames = append(req.TableNames, tableName)
+
+		var writes []faultWriteRequest
+		if err := json.Unmarshal(raw, &writes); err == nil {
+			for _, write := range writes {
+				if write.PutRequest != nil {
+					s.addFaultKey(&req, tableName, write.PutRequest.Item)
+				}
+				if write.DeleteRequest != nil {
+					s.addFaultKey(&req, tableName, write.DeleteRequest.Key)
+				}
+			}
+			continue
+		}
+
+		var reads struct {
+			Keys []model.Record `json:"Keys"`
+		}
+		if err := json.Unmarshal(raw, &reads); err == nil {
+			for _, key := range reads.Keys {
+				s.addFaultKey(&req, tableName, key)
+			}
+		}
+	}
+
+	for _, transactItem := range target.TransactItems {
+		for _, action := range transactItem {
+			s.addFaultTarget(&req, action)
+		}
+	}
+	return req
+}
+
+func (s *Server) addFaultTarget(req *core.FaultRequest, target faultTarget) {
+	if target.TableName == "" {
+		return
+	}
+	req.TableNames = append(req.TableNames, target.TableName)
+
+	s.addFaultKey(req, target.TableName, target.Key)
+	s.addFaultKey(req, target.TableName, target.Item)
+
+	if target.KeyConditionExpression != "" {
+		schema, ok := s.Database.Tables[target.TableName]
+		if !ok {
+			return
+		}
+		pkName := schema.PartitionKey
+		if target.IndexName != "" {
+			if gsi, ok := schema.GSIs[target.IndexName]; ok {
+				pkName = gsi.PartitionKey
+			}
+		}
+		if pk, _, err := core.ParseKeyConditionPK(target.KeyConditionExpression, pkName, target.ExpressionAttributeNames, target.ExpressionAttributeValues); err == nil {
+			req.PartitionKeys = append(req.PartitionKeys, pk)
+		}
+	}
+}
+
+func (s *Server) addFaultKey(req *core.FaultRequest, tableName string, item model.Record) {
+	if item == nil {
+		return
+	}
+	schema, ok := s.Database.Tables[tableName]
+	if !ok {
+		return
+	}
+	if pk, ok := model.GetAttributeValueString(item[schema.PartitionKey]); ok {
+		req.PartitionKeys = append(req.PartitionKeys, pk)
+	}
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type S3BucketSource struct {
+	S3Bucket string `json:"S3Bucket"`
+	S3BucketOwner string `json:"S3BucketOwner,omitempty"`
+	S3KeyPrefix string `json:"S3KeyPrefix,omitempty"`
+}
+
+type CsvOptions struct {
+	Delimiter string `json:"Delimiter,omitempty"`
+	HeaderList []string `json:"HeaderList,omitempty"`
+}
+
+type InputFormatOptions struct {
+	Csv *CsvOptions `json:"Csv,omitempty"`
+}
+
+type KeySchemaElement struct {
+	AttributeName string `json:"AttributeName"`
+	KeyType string `json:"KeyType"`
+}
+
+type AttributeDefinition struct {
+	AttributeName string `json:"AttributeName"`
+	AttributeType string `json:"AttributeType"`
+}
+
+type ImportGlobalSecondaryIndex struct {
+	IndexName string `json:"IndexName"`
+	KeySchema []KeySchemaElement `json:"KeySchema"`
+	Projection model.Projection `json:"Projection"`
+}
+
+type TableCreationParameters struct {
+	TableName string `json:"TableName"`
+	AttributeDefinitions []AttributeDefinition `json:"AttributeDefinitions"`
+	KeySchema []KeySchemaElement `json:"KeySchema"`
+	BillingMode string `json:"BillingMode,omitempty"`
+	GlobalSecondaryIndexes []ImportGlobalSecondaryIndex `json:"GlobalSecondaryIndexes,omitempty"`
+}
+
+type ImportTableInput struct {
+	ClientToken string `json:"ClientToken,omitempty"`
+	S3BucketSource S3BucketSource `json:"S3BucketSource"`
+	InputFormat string `json:"InputFormat"`
+	InputFormatOptions *InputFormatOptions `json:"InputFormatOptions,omitempty"`
+	InputCompressionType string `json:"InputCompressionType,omitempty"`
+	TableCreationParameters TableCreationParameters `json:"TableCreationParameters"`
+}
+
+type ImportTableDescription struct {
+	ImportArn string `json:"ImportArn"`
+	ImportStatus string `json:"ImportStatus"`
+	TableArn string `json:"TableArn"`
+	TableId string `json:"TableId"`
+	ClientToken string `json:"ClientToken,omitempty"`
+	S3BucketSource S3BucketSource `json:"S3BucketSource"`
+	ErrorCount int64 `json:"ErrorCount"`
+	CloudWatchLogGroupArn string `json:"CloudWatchLogGroupArn"`
+	InputFormat string `json:"InputFormat"`
+	InputFormatOptions *InputFormatOptions `json:"InputFormatOptions,omitempty"`
+	InputCompressionType string `json:"InputCompressionType"`
+	TableCreationParameters TableCreationParameters `json:"TableCreationParameters"`
+	StartTime float64 `json:"StartTime"`
+	EndTime float64 `json:"EndTime"`
+	ProcessedSizeBytes int64 `json:"ProcessedSizeBytes"`
+	ProcessedItemCount int64 `json:"ProcessedItemCount"`
+	ImportedItemCount int64 `json:"ImportedItemCount"`
+	FailureCode string `json:"FailureCode,omitempty"`
+	FailureMessage string `json:"FailureMessage,omitempty"`
+}
+
+type ImportSummary struct {
+	ImportArn string `json:"ImportArn"`
+	ImportStatus string `json:"ImportStatus"`
+	TableArn string `json:"TableArn"`
+	S3BucketSource S3BucketSource `json:"S3BucketSource"`
+	CloudWatchLogGroupArn string `json:"CloudWatchLogGroupArn"`
+	InputFormat string `json:"InputFormat"`
+	StartTime float64 `json:"StartTime"`
+	EndTime float64 `json:"EndTime"`
+}
+
+func keySchemaElements(partitionKey, sortKey string) []KeySchemaElement {
+	elements := []KeySchemaElement{{AttributeName: partitionKey, KeyType: "HASH"}}
+	if sortKey != "" {
+		elements = append(elements, KeySchemaElement{AttributeName: sortKey, KeyType: "RANGE"})
+	}
+	return elements
+}
+
+func tableCreationParameters(descriptor model.ImportDescriptor) TableCreationParameters {
+	schema := descriptor.TableSchema
+	params := TableCreationParameters{
+		TableName: schema.TableName,
+		AttributeDefinitions: []AttributeDefinition{},
+		KeySchema: keySchemaElements(schema.PartitionKey, schema.SortKey),
+	}
+
+	names := make([]string, 0, len(descriptor.AttributeTypes))
+	for name := range descriptor.AttributeTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params.AttributeDefinitions = append(params.AttributeDefinitions, AttributeDefinition{AttributeName: name, AttributeType: descriptor.AttributeTypes[name]})
+	}
+
+	indexNames := make([]string, 0, len(schema.GSIs))
+	for name := range schema.GSIs {
+		indexNames = append(indexNames, name)
+	}
+	sort.Strings(indexNames)
+	for _, name := range indexNames {
+		gsi := schema.GSIs[name]
+		params.GlobalSecondaryIndexes = append(params.GlobalSecondaryIndexes, ImportGlobalSecondaryIndex{
+			IndexName: name,
+			KeySchema: keySchemaElements(gsi.PartitionKey, gsi.SortKey),
+			Projection: gsi.EffectiveProjection(),
+		})
+	}
+	return params
+}
+
+func importBucketSource(descriptor model.ImportDescriptor) S3BucketSource {
+	return S3BucketSource{
+		S3Bucket: descriptor.S3Bucket,
+		S3BucketOwner: descriptor.S3BucketOwner,
+		S3KeyPrefix: descriptor.S3KeyPrefix,
+	}
+}
+
+func importTableDescription(descriptor model.ImportDescriptor) ImportTableDescription {
+	description := ImportTableDescription{
+		ImportArn: descriptor.ImportArn,
+		ImportStatus: descriptor.ImportStatus,
+		TableArn: descriptor.TableArn,
+		TableId: descriptor.TableId,
+		ClientToken: descriptor.ClientToken,
+		S3BucketSource: importBucketSource(descriptor),
+		ErrorCount: descriptor.ErrorCount,
+		CloudWatchLogGroupArn: core.ImportLogGroupArn(),
+		InputFormat: descriptor.InputFormat,
+		InputCompressionType: descriptor.InputCompressionType,
+		TableCreationParameters: tableCreationParameters(descriptor),
+		StartTime: epochSeconds(descriptor.StartTime),
+		EndTime: epochSeconds(descriptor.EndTime),
+		ProcessedSizeBytes: descriptor.ProcessedSizeBytes,
+		ProcessedItemCount: descriptor.ProcessedItemCount,
+		ImportedItemCount: descriptor.ImportedItemCount,
+		FailureCode: descriptor.FailureCode,
+		FailureMessage: descriptor.FailureMessage,
+	}
+	if descriptor.InputFormat == model.InputFormatCSV {
+		description.InputFormatOptions = &InputFormatOptions{Csv: &CsvOptions{
+			Delimiter: descriptor.CsvDelimiter,
+			HeaderList: descriptor.CsvHeaderList,
+		}}
+	}
+	return description
+}
+
+func (s *Server) handleImportTable(w http.ResponseWriter, body []byte) {
+	var input ImportTableInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	params := input.TableCreationParameters
+	if params.TableName == "" {
+		s.writeDynamoDBError(w, "ValidationException", "TableCreationParameters.TableName must be specified", http.StatusBadRequest)
+		return
+	}
+
+	schema := model.TableSchema{
+		TableName: params.TableName,
+		GSIs: make(map[string]model.GsiSchema),
+		LSIs: make(map[string]model.GsiSchema),
+	}
+	for _, ks := range params.KeySchema {
+		if ks.KeyType == "HASH" {
+			schema.PartitionKey = ks.AttributeName
+		} else if ks.KeyType == "RANGE" {
+			schema.SortKey = ks.AttributeName
+		}
+	}
+	if schema.PartitionKey == "" {
+		s.writeDynamoDBError(w, "ValidationException", "Partition Key definition missing.", http.StatusBadRequest)
+		return
+	}
+	for _, gsiInput := range params.GlobalSecondaryIndexes {
+		if err := core.ValidateProjection(gsiInput.IndexName, gsiInput.Projection); err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		gsiSchema := model.GsiSchema{IndexName: gsiInput.IndexName, Projection: gsiInput.Projection}
+		for _, ks := range gsiInput.KeySchema {
+			if ks.KeyType == "HASH" {
+				gsiSchema.PartitionKey = ks.AttributeName
+			} else if ks.KeyType == "RANGE" {
+				gsiSchema.SortKey = ks.AttributeName
+			}
+		}
+		schema.GSIs[gsiInput.IndexName] = gsiSchema
+	}
+
+	attributeTypes := make(map[string]string, len(params.AttributeDefinitions))
+	for _, definition := range params.AttributeDefinitions {
+		attributeTypes[definition.AttributeName] = definition.AttributeType
+	}
+
+	opts := core.ImportOptions{
+		S3Bucket: input.S3BucketSource.S3Bucket,
+		S3BucketOwner: input.S3BucketSource.S3BucketOwner,
+		S3KeyPrefix: input.S3BucketSource.S3KeyPrefix,
+		InputFormat: input.InputFormat,
+		InputCompressionType: input.InputCompressionType,
+		ClientToken: input.ClientToken,
+		AttributeTypes: attributeTypes,
+	}
+	if input.InputFormatOptions != nil && input.InputFormatOptions.Csv != nil {
+		opts.CsvDelimiter = input.InputFormatOptions.Csv.Delimiter
+		opts.CsvHeaderList = input.InputFormatOptions.Csv.HeaderList
+	}
+
+	descriptor, err := s.Database.ImportTable(schema, opts)
+	if err != nil {
+		s.writeImportError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"ImportTableDescription": importTableDescription(descriptor),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type DescribeImportInput struct {
+	ImportArn string `json:"ImportArn"`
+}
+
+func (s *Server) handleDescribeImport(w http.ResponseWriter, body []byte) {
+	var input DescribeImportInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.DescribeImport(input.ImportArn)
+	if err != nil {
+		s.writeImportError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"ImportTableDescription": importTableDescription(descriptor),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type ListImportsInput struct {
+	TableArn string `json:"TableArn,omitempty"`
+	PageSize int `json:"PageSize,omitempty"`
+	NextToken string `json:"NextToken,omitempty"`
+}
+
+func (s *Server) handleListImports(w http.ResponseWriter, body []byte) {
+	var input ListImportsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	tableName := strings.TrimPrefix(input.TableArn, core.TableArn(""))
+	imports, nextToken, err := s.Database.ListImports(tableName, input.NextToken, input.PageSize)
+	if err != nil {
+		s.writeImportError(w, err)
+		return
+	}
+
+	summaries := make([]ImportSummary, 0, len(imports))
+	for _, descriptor := range imports {
+		summaries = append(summaries, ImportSummary{
+			ImportArn: descriptor.ImportArn,
+			ImportStatus: descriptor.ImportStatus,
+			TableArn: descriptor.TableArn,
+			S3BucketSource: importBucketSource(descriptor),
+			CloudWatchLogGroupArn: core.ImportLogGroupArn(),
+			InputFormat: descriptor.InputFormat,
+			StartTime: epochSeconds(descriptor.StartTime),
+			EndTime: epochSeconds(descriptor.EndTime),
+		})
+	}
+
+	respBody, _ := json.Marshal(struct {
+		ImportSummaryList []ImportSummary `json:"ImportSummaryList"`
+		NextToken string `json:"NextToken,omitempty"`
+	}{
+		ImportSummaryList: summaries,
+		NextToken: nextToken,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) writeImportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrTableAlreadyExists):
+		s.writeDynamoDBError(w, "ResourceInUseException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrImportNotFound):
+		s.writeDynamoDBError(w, "ImportNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrImportConflict):
+		s.writeDynamoDBError(w, "ImportConflictException", err.Error(), http.StatusBadRequest)
+	default:
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+	}
+}
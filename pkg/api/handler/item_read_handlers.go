@@ -2,19 +2,23 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
 )
 
 type GetItemInput struct {
 	TableName string `json:"TableName"`
 	Key model.Record `json:"Key"`
+	ConsistentRead bool `json:"ConsistentRead,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	ProjectionExpression string `json:"ProjectionExpression,omitempty"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	AttributesToGet []string `json:"AttributesToGet,omitempty"`
 }
 
 func (s *Server) handleGetItem(w http.ResponseWriter, body []byte) {
@@ -32,6 +36,22 @@ func (s *Server) handleGetItem(w http.ResponseWriter, body []byte) {
 		return
 	}
 
+	if err := core.CheckExpressionParams(
+		map[string]bool{"AttributesToGet": input.AttributesToGet != nil},
+		map[string]bool{"ProjectionExpression": input.ProjectionExpression != ""},
+		len(input.ExpressionAttributeNames) > 0, false); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.validateExpressions(w, body, input.ExpressionAttributeNames, nil, "ProjectionExpression") {
+		return
+	}
+	projection, err := readProjection(input.ProjectionExpression, input.AttributesToGet, input.ExpressionAttributeNames)
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	pkAV, ok := input.Key[schema.PartitionKey]
 	if !ok {
 		s.writeDynamoDBError(w, "ValidationException", fmt.Sprintf("Partition Key '%s' value missing", schema.PartitionKey), http.StatusBadRequest)
@@ -48,30 +68,363 @@ func (s *Server) handleGetItem(w http.ResponseWriter, body []byte) {
 
 	levelDBKey := model.BuildLevelDBKey(input.TableName, pkVal, skVal)
 
+	hookCtx := &core.HookContext{Operation: core.OpGetItem, TableName: input.TableName, Input: &input, Key: levelDBKey}
+	if !s.runHooks(w, s.Database.RunBeforeHooks, hookCtx) {
+		return
+	}
+	if err := s.Database.CheckReadCapacity(schema, "", pkVal); err != nil {
+		s.writeHookError(w, err)
+		return
+	}
+
 	s.Database.RLock()
-	value, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+	value, err := s.Database.Read([]byte(levelDBKey), input.ConsistentRead)
 	s.Database.RUnlock()
 
-	if err == leveldb.ErrNotFound {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{}`))
-		return
-	}
-	if err != nil {
+	if err != nil && err != core.ErrNotFound {
 		s.writeDynamoDBError(w, "InternalServerError", "Internal DB error", http.StatusInternalServerError)
 		return
 	}
 
 	var record model.Record
-	if err := model.UnmarshalRecord(value, &record); err != nil {
-		s.writeDynamoDBError(w, "InternalServerError", "Failed to unmarshal item", http.StatusInternalServerError)
+	if err == nil {
+		if err := model.UnmarshalRecord(value, &record); err != nil {
+			s.writeDynamoDBError(w, "InternalServerError", "Failed to unmarshal item", http.StatusInternalServerError)
+			return
+		}
+		hookCtx.OldItem = record
+		hookCtx.Items = []model.Record{record}
+	}
+	consumed := s.Database.ChargeRead(schema, "", pkVal, core.ItemSize(record), input.ConsistentRead)
+	if !s.runHooks(w, s.Database.RunAfterHooks, hookCtx) {
 		return
 	}
 
+	record = nil
+	if len(hookCtx.Items) > 0 {
+		record = hookCtx.Items[0]
+	}
+	if record != nil && projection != nil {
+		record = projection.Apply(record)
+	}
+
 	respBody, _ := json.Marshal(struct {
-		Item model.Record `json:"Item"`
+		Item model.Record `json:"Item,omitempty"`
+		ConsumedCapacity *model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
 	}{
 		Item: record,
+		ConsumedCapacity: returnedCapacity(input.ReturnConsumedCapacity, consumed),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type KeysAndAttributes struct {
+	Keys []model.Record `json:"Keys"`
+	ConsistentRead bool `json:"ConsistentRead,omitempty"`
+	ProjectionExpression string `json:"ProjectionExpression,omitempty"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	AttributesToGet []string `json:"AttributesToGet,omitempty"`
+}
+
+type BatchGetItemInput struct {
+	RequestItems map[string]KeysAndAttributes `json:"RequestItems"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+type BatchGetItemOutput struct {
+	Responses map[string][]model.Record `json:"Responses"`
+	UnprocessedKeys map[string]KeysAndAttributes `json:"UnprocessedKeys"`
+	ConsumedCapacity []*model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+type TransactGetItem struct {
+	Get *struct {
+		TableName string `json:"TableName"`
+		Key model.Record `json:"Key"`
+		ProjectionExpression string `json:"ProjectionExpression,omitempty"`
+		ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	} `json:"Get,omitempty"`
+}
+
+type TransactGetItemsInput struct {
+	TransactItems []TransactGetItem `json:"TransactItems"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+// keyRead is one validated key of a BatchGetItem or TransactGetItems request.
+type keyRead struct {
+	schema model.TableSchema
+	key model.Record
+	pk string
+	levelDBKey string
+	projection *core.Projection
+}
+
+// resolveKeyRead checks key against the table's key schema.
+func resolveKeyRead(schema model.TableSchema, key model.Record, projection *core.Projection) (keyRead, error) {
+	pkAV, ok := key[schema.PartitionKey]
+	if !ok {
+		return keyRead{}, fmt.Errorf("Partition Key '%s' value missing", schema.PartitionKey)
+	}
+	pkVal, _ := model.GetAttributeValueString(pkAV)
+
+	var skVal string
+	if schema.SortKey != "" {
+		skAV, ok := key[schema.SortKey]
+		if !ok {
+			return keyRead{}, fmt.Errorf("Sort Key '%s' value missing", schema.SortKey)
+		}
+		skVal, _ = model.GetAttributeValueString(skAV)
+	}
+
+	levelDBKey := model.BuildLevelDBKey(schema.TableName, pkVal, skVal)
+	return keyRead{schema: schema, key: key, pk: pkVal, levelDBKey: levelDBKey, projection: projection}, nil
+}
+
+func (s *Server) handleBatchGetItem(w http.ResponseWriter, body []byte) {
+	var input BatchGetItemInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	reads := make(map[string][]keyRead)
+	count := 0
+	seen := make(map[string]bool)
+	for tableName, request := range input.RequestItems {
+		s.Database.RLock()
+		schema, ok := s.Database.Tables[tableName]
+		s.Database.RUnlock()
+		if !ok {
+			s.writeDynamoDBError(w, "ResourceNotFoundException", fmt.Sprintf("Table %s not found", tableName), http.StatusBadRequest)
+			return
+		}
+
+		if err := core.CheckExpressionParams(
+			map[string]bool{"AttributesToGet": request.AttributesToGet != nil},
+			map[string]bool{"ProjectionExpression": request.ProjectionExpression != ""},
+			len(request.ExpressionAttributeNames) > 0, false); err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		projection, err := readProjection(request.ProjectionExpression, request.AttributesToGet, request.ExpressionAttributeNames)
+		if err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, key := range request.Keys {
+			read, err := resolveKeyRead(schema, key, projection)
+			if err != nil {
+				s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+				return
+			}
+			if seen[read.levelDBKey] {
+				s.writeDynamoDBError(w, "ValidationException", "Provided list of item keys contains duplicates", http.StatusBadRequest)
+				return
+			}
+			seen[read.levelDBKey] = true
+			reads[tableName] = append(reads[tableName], read)
+			count++
+		}
+	}
+	if count == 0 || count > 100 {
+		s.writeDynamoDBError(w, "ValidationException", "BatchGetItem requests between 1 and 100 keys", http.StatusBadRequest)
+		return
+	}
+
+	// Like BatchWriteItem, throttled keys come back in UnprocessedKeys and
+	// only a batch with every key throttled fails.
+	responses := make(map[string][]model.Record)
+	unprocessed := map[string]KeysAndAttributes{}
+	var consumed []*model.ConsumedCapacity
+	var throttleErr error
+	processed := 0
+
+	for tableName, tableReads := range reads {
+		request := input.RequestItems[tableName]
+		for _, read := range tableReads {
+			hookCtx := &core.HookContext{Operation: core.OpBatchGetItem, TableName: tableName, Input: &input, Key: read.levelDBKey}
+			if !s.runHooks(w, s.Database.RunBeforeHooks, hookCtx) {
+				return
+			}
+			if err := s.Database.CheckReadCapacity(read.schema, "", read.pk); err != nil {
+				var throughputErr *core.ThroughputExceededError
+				if !errors.As(err, &throughputErr) {
+					s.writeHookError(w, err)
+					return
+				}
+				throttleErr = err
+				keys := unprocessed[tableName]
+				if keys.Keys == nil {
+					keys = request
+					keys.Keys = nil
+				}
+				keys.Keys = append(keys.Keys, read.key)
+				unprocessed[tableName] = keys
+				continue
+			}
+
+			s.Database.RLock()
+			value, err := s.Database.Read([]byte(read.levelDBKey), request.ConsistentRead)
+			s.Database.RUnlock()
+			if err != nil && err != core.ErrNotFound {
+				s.writeDynamoDBError(w, "InternalServerError", "Internal DB error", http.StatusInternalServerError)
+				return
+			}
+
+			var record model.Record
+			if err == nil {
+				if err := model.UnmarshalRecord(value, &record); err != nil {
+					s.writeDynamoDBError(w, "InternalServerError", "Failed to unmarshal item", http.StatusInternalServerError)
+					return
+				}
+				hookCtx.OldItem = record
+				hookCtx.Items = []model.Record{record}
+			}
+			consumed = core.MergeConsumedCapacity(consumed, s.Database.ChargeRead(read.schema, "", read.pk, core.ItemSize(record), request.ConsistentRead))
+			processed++
+			if !s.runHooks(w, s.Database.RunAfterHooks, hookCtx) {
+				return
+			}
+
+			for _, item := range hookCtx.Items {
+				if read.projection != nil {
+					item = read.projection.Apply(item)
+				}
+				responses[tableName] = append(responses[tableName], item)
+			}
+			if _, ok := responses[tableName]; !ok {
+				responses[tableName] = []model.Record{}
+			}
+		}
+	}
+	if processed == 0 && throttleErr != nil {
+		s.writeHookError(w, throttleErr)
+		return
+	}
+
+	respBody, _ := json.Marshal(BatchGetItemOutput{
+		Responses: responses,
+		UnprocessedKeys: unprocessed,
+		ConsumedCapacity: returnedCapacities(input.ReturnConsumedCapacity, consumed),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleTransactGetItems(w http.ResponseWriter, body []byte) {
+	var input TransactGetItemsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	if len(input.TransactItems) == 0 || len(input.TransactItems) > 100 {
+		s.writeDynamoDBError(w, "ValidationException", "TransactGetItems requests between 1 and 100 items", http.StatusBadRequest)
+		return
+	}
+
+	reads := make([]keyRead, 0, len(input.TransactItems))
+	seen := make(map[string]bool)
+	for _, item := range input.TransactItems {
+		if item.Get == nil {
+			s.writeDynamoDBError(w, "ValidationException", "TransactItems can only contain Get operations", http.StatusBadRequest)
+			return
+		}
+		s.Database.RLock()
+		schema, ok := s.Database.Tables[item.Get.TableName]
+		s.Database.RUnlock()
+		if !ok {
+			s.writeDynamoDBError(w, "ResourceNotFoundException", fmt.Sprintf("Table %s not found", item.Get.TableName), http.StatusBadRequest)
+			return
+		}
+		projection, err := readProjection(item.Get.ProjectionExpression, nil, item.Get.ExpressionAttributeNames)
+		if err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		read, err := resolveKeyRead(schema, item.Get.Key, projection)
+		if err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if seen[read.levelDBKey] {
+			s.writeDynamoDBError(w, "ValidationException", "Transaction request cannot include multiple operations on one item", http.StatusBadRequest)
+			return
+		}
+		seen[read.levelDBKey] = true
+		reads = append(reads, read)
+	}
+
+	hookCtxs := make([]*core.HookContext, len(reads))
+	for i, read := range reads {
+		hookCtxs[i] = &core.HookContext{Operation: core.OpTransactGetItems, TableName: read.schema.TableName, Input: &input, Key: read.levelDBKey}
+		if !s.runHooks(w, s.Database.RunBeforeHooks, hookCtxs[i]) {
+			return
+		}
+	}
+	// A transaction is all or nothing, so one throttled item fails it.
+	for _, read := range reads {
+		if err := s.Database.CheckReadCapacity(read.schema, "", read.pk); err != nil {
+			s.writeHookError(w, err)
+			return
+		}
+	}
+
+	// Reading every item under one lock gives the transaction a consistent view.
+	records := make([]model.Record, len(reads))
+	s.Database.RLock()
+	for i, read := range reads {
+		value, err := s.Database.Read([]byte(read.levelDBKey), true)
+		if err == core.ErrNotFound {
+			continue
+		}
+		var record model.Record
+		if err == nil {
+			err = model.UnmarshalRecord(value, &record)
+		}
+		if err != nil {
+			s.Database.RUnlock()
+			s.writeDynamoDBError(w, "InternalServerError", "Internal DB error", http.StatusInternalServerError)
+			return
+		}
+		records[i] = record
+	}
+	s.Database.RUnlock()
+
+	var consumed []*model.ConsumedCapacity
+	for i, read := range reads {
+		consumed = core.MergeConsumedCapacity(consumed, s.Database.ChargeTransactionalRead(read.schema, read.pk, core.ItemSize(records[i])))
+		if records[i] != nil {
+			hookCtxs[i].OldItem = records[i]
+			hookCtxs[i].Items = []model.Record{records[i]}
+		}
+	}
+
+	responses := make([]ItemResponse, len(reads))
+	for i, read := range reads {
+		if !s.runHooks(w, s.Database.RunAfterHooks, hookCtxs[i]) {
+			return
+		}
+		if len(hookCtxs[i].Items) == 0 {
+			continue
+		}
+		record := hookCtxs[i].Items[0]
+		if read.projection != nil {
+			record = read.projection.Apply(record)
+		}
+		responses[i].Item = record
+	}
+
+	respBody, _ := json.Marshal(struct {
+		Responses []ItemResponse `json:"Responses"`
+		ConsumedCapacity []*model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+	}{
+		Responses: responses,
+		ConsumedCapacity: returnedCapacities(input.ReturnConsumedCapacity, consumed),
 	})
 
 	w.WriteHeader(http.StatusOK)
@@ -97,16 +450,62 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 	skName := schema.SortKey
 	
 	if input.IndexName != "" {
-		gsiSchema, ok := schema.GSIs[input.IndexName]
+		gsiSchema, ok := schema.SecondaryIndex(input.IndexName)
 		if !ok {
 			s.writeDynamoDBError(w, "ValidationException", fmt.Sprintf("GSI %s not found on table %s", input.IndexName, input.TableName), http.StatusBadRequest)
 			return
 		}
 		pkName = gsiSchema.PartitionKey
 		skName = gsiSchema.SortKey
+
+		if _, isGSI := schema.GSIs[input.IndexName]; isGSI && input.ConsistentRead {
+			s.writeDynamoDBError(w, "ValidationException", "Consistent reads are not supported on global secondary indexes", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := core.CheckExpressionParams(
+		map[string]bool{"KeyConditions": input.KeyConditions != nil, "QueryFilter": input.QueryFilter != nil, "ConditionalOperator": input.ConditionalOperator != "", "AttributesToGet": input.AttributesToGet != nil},
+		map[string]bool{"KeyConditionExpression": input.KeyConditionExpression != "", "FilterExpression": input.FilterExpression != "", "ProjectionExpression": input.ProjectionExpression != ""},
+		len(input.ExpressionAttributeNames) > 0, len(input.ExpressionAttributeValues) > 0); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.validateExpressions(w, body, input.ExpressionAttributeNames, input.ExpressionAttributeValues, "KeyConditionExpression", "FilterExpression", "ProjectionExpression") {
+		return
+	}
+
+	keyCondition, keyValues := input.KeyConditionExpression, input.ExpressionAttributeValues
+	if input.KeyConditions != nil {
+		var err error
+		keyCondition, keyValues, err = core.LegacyKeyCondition(input.KeyConditions, pkName, skName)
+		if err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if keyCondition == "" {
+		s.writeDynamoDBError(w, "ValidationException", "Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := core.FilterCondition(model.ConditionInput{
+		ConditionExpression: input.FilterExpression,
+		ExpressionAttributeNames: input.ExpressionAttributeNames,
+		ExpressionAttributeValues: input.ExpressionAttributeValues,
+	}, input.QueryFilter, input.ConditionalOperator)
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	pkValue, pkOp, err := core.ParseKeyConditionPK(input.KeyConditionExpression, pkName, input.ExpressionAttributeValues)
+	selectMode, projection, err := resolveSelect(schema, input.IndexName, input.Select, input.ProjectionExpression, input.AttributesToGet, input.ExpressionAttributeNames)
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pkValue, pkOp, err := core.ParseKeyConditionPK(keyCondition, pkName, input.ExpressionAttributeNames, keyValues)
 	if err != nil {
 		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
 		return
@@ -118,7 +517,7 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 
 	var skExpression string
 	if skName != "" {
-		skExpression, err = core.ExtractKeyConditionSK(input.KeyConditionExpression, skName)
+		skExpression, err = core.ExtractKeyConditionSK(keyCondition, skName, input.ExpressionAttributeNames)
 		if err != nil {
 			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
 			return
@@ -127,19 +526,31 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 	
 	var prefix []byte
 	if input.IndexName != "" {
-		prefix = []byte(model.BuildGSILevelDBKey(input.IndexName, pkValue, "", ""))
+		prefix = []byte(model.BuildGSILevelDBKey(input.TableName, input.IndexName, pkValue, "", ""))
 	} else {
 		prefix = []byte(model.BuildLevelDBKey(input.TableName, pkValue, ""))
 	}
 
+	hookCtx := &core.HookContext{Operation: core.OpQuery, TableName: input.TableName, Input: &input}
+	if !s.runHooks(w, s.Database.RunBeforeHooks, hookCtx) {
+		return
+	}
+	if err := s.Database.CheckReadCapacity(schema, input.IndexName, pkValue); err != nil {
+		s.writeHookError(w, err)
+		return
+	}
+
 	s.Database.RLock()
 	defer s.Database.RUnlock()
 
-	iter := s.Database.DB.NewIterator(iterator.Prefix(prefix), nil)
+	iter := s.Database.DB.NewIterator(core.PrefixRange(prefix))
 	defer iter.Release()
 	
 	items := make([]model.Record, 0)
+	var last model.Record
 	count := 0
+	matched := 0
+	size := 0
 	limit := int(input.Limit)
 	if limit == 0 {
 		limit = -1 
@@ -151,7 +562,7 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 	if !startKeyReached {
 		var startKeyDBKey string
 		if input.IndexName != "" {
-			gsiSchema := schema.GSIs[input.IndexName]
+			gsiSchema, _ := schema.SecondaryIndex(input.IndexName)
 			startPKAV := input.ExclusiveStartKey[gsiSchema.PartitionKey]
 			startPKVal, _ := model.GetAttributeValueString(startPKAV)
 			
@@ -164,7 +575,7 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 			basePKAV := input.ExclusiveStartKey[schema.PartitionKey]
 			basePKVal, _ := model.GetAttributeValueString(basePKAV)
 			
-			startKeyDBKey = model.BuildGSILevelDBKey(input.IndexName, startPKVal, startSKVal, basePKVal)
+			startKeyDBKey = model.BuildGSILevelDBKey(input.TableName, input.IndexName, startPKVal, startSKVal, basePKVal)
 
 		} else {
 			startPKAV := input.ExclusiveStartKey[schema.PartitionKey]
@@ -192,15 +603,25 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 			break
 		}
 		
+		value := iter.Value()
+		if input.IndexName == "" && !input.ConsistentRead {
+			if staleValue, staleExists, ok := s.Database.StaleRead(iter.Key()); ok {
+				if !staleExists {
+					continue
+				}
+				value = staleValue
+			}
+		}
+
 		var record model.Record
-		if err := model.UnmarshalRecord(iter.Value(), &record); err != nil {
+		if err := model.UnmarshalRecord(value, &record); err != nil {
 			continue
 		}
 
 		if skName != "" {
 			if skAV, ok := record[skName]; ok {
 				skVal, _ := model.GetAttributeValueString(skAV)
-				if !core.EvaluateSortKeyCondition(skVal, skExpression, input.ExpressionAttributeValues) {
+				if !core.EvaluateSortKeyCondition(skVal, skExpression, keyValues) {
 					continue
 				}
 			} else if skExpression != "" {
@@ -208,31 +629,44 @@ func (s *Server) handleQuery(w http.ResponseWriter, body []byte) {
 			}
 		}
 
-		items = append(items, record)
+		last = record
 		count++
+		size += core.ItemSize(record)
+
+		if filter.ConditionExpression != "" {
+			matches, err := core.EvaluateConditionExpression(record, filter)
+			if err != nil {
+				s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !matches {
+				continue
+			}
+		}
+		matched++
+		if selectMode != selectCount {
+			items = append(items, record)
+		}
 	}
 
 	if err := iter.Error(); err != nil {
 		s.writeDynamoDBError(w, "InternalServerError", fmt.Sprintf("Iterator error: %v", err), http.StatusInternalServerError)
 		return
 	}
+	consumed := s.Database.ChargeRead(schema, input.IndexName, pkValue, size, input.ConsistentRead)
+
+	hookCtx.Items = items
+	if !s.runHooks(w, s.Database.RunAfterHooks, hookCtx) {
+		return
+	}
+	items = hookCtx.Items
 
 	lastKey := model.Record{}
-	if limit != -1 && count >= limit && len(items) > 0 {
-		lastKey = core.ExtractKey(items[len(items)-1], schema, input.IndexName)
+	if limit != -1 && count >= limit && last != nil {
+		lastKey = core.ExtractKey(last, schema, input.IndexName)
 	}
 
-	respBody, _ := json.Marshal(struct {
-		Items []model.Record `json:"Items"`
-		Count int `json:"Count"`
-		ScannedCount int `json:"ScannedCount"`
-		LastEvaluatedKey model.Record `json:"LastEvaluatedKey,omitempty"`
-	}{
-		Items: items,
-		Count: len(items),
-		ScannedCount: len(items), 
-		LastEvaluatedKey: lastKey,
-	})
+	respBody, _ := json.Marshal(selectedItems(schema, input.IndexName, selectMode, projection, items, matched, count, lastKey, returnedCapacity(input.ReturnConsumedCapacity, consumed)))
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(respBody)
@@ -242,6 +676,37 @@ type ScanInput struct {
 	TableName string `json:"TableName"`
 	Limit int64 `json:"Limit"`
 	ExclusiveStartKey model.Record `json:"ExclusiveStartKey,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	Segment *int64 `json:"Segment,omitempty"`
+	TotalSegments *int64 `json:"TotalSegments,omitempty"`
+	Select string `json:"Select,omitempty"`
+	ProjectionExpression string `json:"ProjectionExpression,omitempty"`
+	FilterExpression string `json:"FilterExpression,omitempty"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
+	ExpressionAttributeValues map[string]model.AttributeValue `json:"ExpressionAttributeValues,omitempty"`
+	ScanFilter map[string]model.LegacyCondition `json:"ScanFilter,omitempty"`
+	ConditionalOperator string `json:"ConditionalOperator,omitempty"`
+	AttributesToGet []string `json:"AttributesToGet,omitempty"`
+}
+
+const maxScanSegments = 1000000
+
+func validateScanSegments(segment, totalSegments *int64) error {
+	switch {
+	case segment == nil && totalSegments == nil:
+		return nil
+	case totalSegments == nil:
+		return fmt.Errorf("The TotalSegments parameter is required but was not present in the request when Segment parameter is present")
+	case segment == nil:
+		return fmt.Errorf("The Segment parameter is required but was not present in the request when parameter TotalSegments is present")
+	case *totalSegments < 1 || *totalSegments > maxScanSegments:
+		return fmt.Errorf("1 validation error detected: Value '%d' at 'totalSegments' failed to satisfy constraint: Member must have value less than or equal to %d and greater than or equal to 1", *totalSegments, maxScanSegments)
+	case *segment < 0 || *segment >= maxScanSegments:
+		return fmt.Errorf("1 validation error detected: Value '%d' at 'segment' failed to satisfy constraint: Member must have value less than or equal to %d and greater than or equal to 0", *segment, maxScanSegments-1)
+	case *segment >= *totalSegments:
+		return fmt.Errorf("The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: %d is not less than TotalSegments: %d", *segment, *totalSegments)
+	}
+	return nil
 }
 
 func (s *Server) handleScan(w http.ResponseWriter, body []byte) {
@@ -251,6 +716,11 @@ func (s *Server) handleScan(w http.ResponseWriter, body []byte) {
 		return
 	}
 
+	if err := validateScanSegments(input.Segment, input.TotalSegments); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	s.Database.RLock()
 	schema, ok := s.Database.Tables[input.TableName]
 	s.Database.RUnlock()
@@ -259,54 +729,72 @@ func (s *Server) handleScan(w http.ResponseWriter, body []byte) {
 		return
 	}
 
+	if err := core.CheckExpressionParams(
+		map[string]bool{"ScanFilter": input.ScanFilter != nil, "ConditionalOperator": input.ConditionalOperator != "", "AttributesToGet": input.AttributesToGet != nil},
+		map[string]bool{"FilterExpression": input.FilterExpression != "", "ProjectionExpression": input.ProjectionExpression != ""},
+		len(input.ExpressionAttributeNames) > 0, len(input.ExpressionAttributeValues) > 0); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.validateExpressions(w, body, input.ExpressionAttributeNames, input.ExpressionAttributeValues, "FilterExpression", "ProjectionExpression") {
+		return
+	}
+
+	filter, err := core.FilterCondition(model.ConditionInput{
+		ConditionExpression: input.FilterExpression,
+		ExpressionAttributeNames: input.ExpressionAttributeNames,
+		ExpressionAttributeValues: input.ExpressionAttributeValues,
+	}, input.ScanFilter, input.ConditionalOperator)
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	selectMode, projection, err := resolveSelect(schema, "", input.Select, input.ProjectionExpression, input.AttributesToGet, input.ExpressionAttributeNames)
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hookCtx := &core.HookContext{Operation: core.OpScan, TableName: input.TableName, Input: &input}
+	if !s.runHooks(w, s.Database.RunBeforeHooks, hookCtx) {
+		return
+	}
+	if err := s.Database.CheckReadCapacity(schema, "", ""); err != nil {
+		s.writeHookError(w, err)
+		return
+	}
+
 	s.Database.RLock()
 	defer s.Database.RUnlock()
 
-	iter := s.Database.DB.NewIterator(nil, nil)
+	keyRange := core.PrefixRange([]byte(input.TableName + model.KeySeparator))
+	if len(input.ExclusiveStartKey) > 0 {
+		pkVal, _ := model.GetAttributeValueString(input.ExclusiveStartKey[schema.PartitionKey])
+
+		skVal := ""
+		if schema.SortKey != "" {
+			skVal, _ = model.GetAttributeValueString(input.ExclusiveStartKey[schema.SortKey])
+		}
+
+		// Resume at the first key after the start key.
+		keyRange.Start = append([]byte(model.BuildLevelDBKey(input.TableName, pkVal, skVal)), 0)
+	}
+
+	iter := s.Database.DB.NewIterator(keyRange)
 	defer iter.Release()
 
 	items := make([]model.Record, 0)
+	var last model.Record
 	count := 0
+	matched := 0
+	size := 0
 	limit := int(input.Limit)
 	if limit == 0 {
 		limit = -1 
 	}
-	
-	startKeyReached := true
-	if input.ExclusiveStartKey != nil && len(input.ExclusiveStartKey) > 0 {
-		startKeyReached = false
-		pkAV := input.ExclusiveStartKey[schema.PartitionKey]
-		pkVal, _ := model.GetAttributeValueString(pkAV)
-		
-		skVal := ""
-		if schema.SortKey != "" {
-			skAV := input.ExclusiveStartKey[schema.SortKey]
-			skVal, _ = model.GetAttributeValueString(skAV)
-		}
-		
-		startKeyDBKey := model.BuildLevelDBKey(input.TableName, pkVal, skVal)
-
-		if ok := iter.Seek([]byte(startKeyDBKey)); ok && string(iter.Key()) == startKeyDBKey {
-			iter.Next()
-			startKeyReached = true
-		} else if ok {
-			startKeyReached = true
-		}
-	}
-	
-	if !startKeyReached {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`{"message": "Internal error: Seek failed to find start key."}`))
-		return
-	}
 
 	for iter.Next() {
-		
-		keyStr := string(iter.Key())
-		if !strings.HasPrefix(keyStr, input.TableName+model.KeySeparator) {
-			continue 
-		}
-		
 		if limit != -1 && count >= limit {
 			break
 		}
@@ -316,32 +804,153 @@ func (s *Server) handleScan(w http.ResponseWriter, body []byte) {
 			continue
 		}
 
-		items = append(items, record)
+		if input.TotalSegments != nil {
+			pkVal, _ := model.GetAttributeValueString(record[schema.PartitionKey])
+			if core.ScanSegment(pkVal, int(*input.TotalSegments)) != int(*input.Segment) {
+				continue
+			}
+		}
+
+		last = record
 		count++
+		size += core.ItemSize(record)
+
+		if filter.ConditionExpression != "" {
+			matches, err := core.EvaluateConditionExpression(record, filter)
+			if err != nil {
+				s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !matches {
+				continue
+			}
+		}
+		matched++
+		if selectMode != selectCount {
+			items = append(items, record)
+		}
 	}
 
 	if err := iter.Error(); err != nil {
 		s.writeDynamoDBError(w, "InternalServerError", fmt.Sprintf("Iterator error: %v", err), http.StatusInternalServerError)
 		return
 	}
+	consumed := s.Database.ChargeRead(schema, "", "", size, false)
+
+	hookCtx.Items = items
+	if !s.runHooks(w, s.Database.RunAfterHooks, hookCtx) {
+		return
+	}
+	items = hookCtx.Items
 
 	lastKey := model.Record{}
-	if limit != -1 && count >= limit && len(items) > 0 {
-		lastKey = core.ExtractKey(items[len(items)-1], schema, "") 
+	if limit != -1 && count >= limit && last != nil {
+		lastKey = core.ExtractKey(last, schema, "") 
 	}
 
-	respBody, _ := json.Marshal(struct {
-		Items []model.Record `json:"Items"`
-		Count int `json:"Count"`
-		ScannedCount int `json:"ScannedCount"`
-		LastEvaluatedKey model.Record `json:"LastEvaluatedKey,omitempty"`
-	}{
-		Items: items,
-		Count: len(items),
-		ScannedCount: len(items), 
-		LastEvaluatedKey: lastKey,
-	})
+	respBody, _ := json.Marshal(selectedItems(schema, "", selectMode, projection, items, matched, count, lastKey, returnedCapacity(input.ReturnConsumedCapacity, consumed)))
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(respBody)
 }
+
+const (
+	selectAllAttributes = "ALL_ATTRIBUTES"
+	selectAllProjectedAttributes = "ALL_PROJECTED_ATTRIBUTES"
+	selectSpecificAttributes = "SPECIFIC_ATTRIBUTES"
+	selectCount = "COUNT"
+)
+
+// resolveSelect checks Select against the other parameters of a Query or
+// Scan, fills in DynamoDB's default and parses the ProjectionExpression or
+// AttributesToGet.
+func resolveSelect(schema model.TableSchema, indexName, selectMode, projectionExpression string, attributesToGet []string, names map[string]string) (string, *core.Projection, error) {
+	projectionParam := "ProjectionExpression"
+	if attributesToGet != nil {
+		projectionParam = "AttributesToGet"
+	}
+	projected := projectionExpression != "" || attributesToGet != nil
+
+	switch selectMode {
+	case "":
+		switch {
+		case projected:
+			selectMode = selectSpecificAttributes
+		case indexName != "":
+			selectMode = selectAllProjectedAttributes
+		default:
+			selectMode = selectAllAttributes
+		}
+	case selectAllAttributes, selectAllProjectedAttributes, selectSpecificAttributes, selectCount:
+	default:
+		return "", nil, fmt.Errorf("1 validation error detected: Value '%s' at 'select' failed to satisfy constraint: Member must satisfy enum value set: [SPECIFIC_ATTRIBUTES, COUNT, ALL_ATTRIBUTES, ALL_PROJECTED_ATTRIBUTES]", selectMode)
+	}
+
+	switch {
+	case projected && selectMode != selectSpecificAttributes:
+		return "", nil, fmt.Errorf("Cannot specify the %s when choosing to get %s", projectionParam, selectMode)
+	case !projected && selectMode == selectSpecificAttributes:
+		return "", nil, fmt.Errorf("Must specify the AttributesToGet or ProjectionExpression when choosing to get SPECIFIC_ATTRIBUTES")
+	case selectMode == selectAllProjectedAttributes && indexName == "":
+		return "", nil, fmt.Errorf("ALL_PROJECTED_ATTRIBUTES can be used only when Querying using an IndexName")
+	}
+	if gsi, ok := schema.GSIs[indexName]; ok && selectMode == selectAllAttributes && !gsi.ProjectsAll() {
+		return "", nil, fmt.Errorf("One or more parameter values were invalid: Select type ALL_ATTRIBUTES is not supported for global secondary index %s because its projection type is not ALL", indexName)
+	}
+
+	projection, err := readProjection(projectionExpression, attributesToGet, names)
+	if err != nil {
+		return "", nil, err
+	}
+	return selectMode, projection, nil
+}
+
+// readProjection parses the ProjectionExpression of a read, or its legacy
+// AttributesToGet. It returns nil when the read projects nothing.
+func readProjection(projectionExpression string, attributesToGet []string, names map[string]string) (*core.Projection, error) {
+	if attributesToGet != nil {
+		return core.AttributesToGetProjection(attributesToGet)
+	}
+	if projectionExpression == "" {
+		return nil, nil
+	}
+	return core.ParseProjectionExpression(projectionExpression, names)
+}
+
+type itemsOutput struct {
+	Items *[]model.Record `json:"Items,omitempty"`
+	Count int `json:"Count"`
+	ScannedCount int `json:"ScannedCount"`
+	LastEvaluatedKey model.Record `json:"LastEvaluatedKey,omitempty"`
+	ConsumedCapacity *model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+}
+
+// selectedItems builds a Query or Scan response. Items read through a global
+// secondary index, or with ALL_PROJECTED_ATTRIBUTES, only carry what the
+// index projects; items read through a local secondary index are fetched
+// whole, as DynamoDB does. COUNT leaves Items out.
+func selectedItems(schema model.TableSchema, indexName, selectMode string, projection *core.Projection, items []model.Record, matched, scanned int, lastKey model.Record, consumed *model.ConsumedCapacity) itemsOutput {
+	output := itemsOutput{
+		Count: matched,
+		ScannedCount: scanned,
+		LastEvaluatedKey: lastKey,
+		ConsumedCapacity: consumed,
+	}
+	if selectMode == selectCount {
+		return output
+	}
+
+	_, isGSI := schema.GSIs[indexName]
+	for i, item := range items {
+		if isGSI || selectMode == selectAllProjectedAttributes {
+			item = schema.ProjectIndexItem(indexName, item)
+		}
+		if projection != nil {
+			item = projection.Apply(item)
+		}
+		items[i] = item
+	}
+	output.Items = &items
+	output.Count = len(items)
+	return output
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
     
-	"github.com/syndtr/goleveldb/leveldb"
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
 )
@@ -38,7 +37,7 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 		return
 	}
 
-	batch := new(leveldb.Batch)
+	batch := core.NewOperationBatch(core.OpTransactWriteItems, &input)
 
 	s.Database.Lock()
 	defer s.Database.Unlock()
@@ -64,10 +63,10 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 
 			levelDBKey := model.BuildLevelDBKey(cc.TableName, pkVal, skVal)
 
-			oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+			oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 			var recordForEvaluation model.Record
 			
-			if err != nil && err != leveldb.ErrNotFound {
+			if err != nil && err != core.ErrNotFound {
 				http.Error(w, "Internal DB error", http.StatusInternalServerError)
 				return
 			}
@@ -138,9 +137,9 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 
 		levelDBKey := model.BuildLevelDBKey(tableName, pkVal, skVal)
 
-		oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+		oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 		var oldRecord model.Record
-		if err != leveldb.ErrNotFound && err != nil {
+		if err != core.ErrNotFound && err != nil {
 			http.Error(w, "Internal DB error", http.StatusInternalServerError)
 			return
 		}
@@ -149,19 +148,23 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 		}
 
 
-		if opType == "PUT" {
-			core.UpdateGSI(batch, schema, oldRecord, itemData)
-
-			value, _ := model.MarshalRecord(itemData)
-			batch.Put([]byte(levelDBKey), value)
-		} else if opType == "DELETE" {
-			core.UpdateGSI(batch, schema, oldRecord, nil) 
-
-			batch.Delete([]byte(levelDBKey))
+		newRecord := itemData
+		if opType == "DELETE" {
+			newRecord = nil
+		}
+		if err := s.Database.ApplyItemChange(batch, schema, levelDBKey, oldRecord, newRecord); err != nil {
+			if s.writeHookError(w, err) {
+				return
+			}
+			s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
+			return
 		}
 	}
 
-	if err := s.Database.DB.Write(batch, nil); err != nil {
+	if err := s.Database.Write(batch); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		s.writeDynamoDBError(w, "InternalServerError", "Internal DB error during transaction write.", http.StatusInternalServerError)
 		return
 	}
@@ -2,10 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
     
-	"github.com/syndtr/goleveldb/leveldb"
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
 )
@@ -25,6 +25,11 @@ func (s *Server) handlePutItem(w http.ResponseWriter, body []byte) {
         return
     }
 
+    condition, ok := s.writeCondition(w, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, input.Expected, input.ConditionalOperator, nil, nil)
+    if !ok || !s.validateExpressions(w, body, input.ExpressionAttributeNames, input.ExpressionAttributeValues, "ConditionExpression") {
+        return
+    }
+
     pkAV, ok := input.Item[schema.PartitionKey]
     if !ok {
         s.writeDynamoDBError(w, "ValidationException", fmt.Sprintf("Partition Key '%s' value missing", schema.PartitionKey), http.StatusBadRequest)
@@ -42,28 +47,22 @@ func (s *Server) handlePutItem(w http.ResponseWriter, body []byte) {
 
     levelDBKey := model.BuildLevelDBKey(input.TableName, pkVal, skVal)
 
-	batch := new(leveldb.Batch)
+	batch := core.NewOperationBatch(core.OpPutItem, &input)
 	s.Database.Lock()
 	defer s.Database.Unlock()
 
-	oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+	oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 	var oldRecord model.Record
 	recordExists := err == nil
 	if err == nil {
 		oldRecord, _ = model.UnmarshalRecord(oldValue)
 	}
 
-	if input.ConditionExpression != "" {
-		conditionInput := model.ConditionInput{
-			ConditionExpression:       input.ConditionExpression,
-			ExpressionAttributeNames:  input.ExpressionAttributeNames,
-			ExpressionAttributeValues: input.ExpressionAttributeValues,
-		}
-		
+	if condition.ConditionExpression != "" {
 		recordForEvaluation := oldRecord
 		if !recordExists { recordForEvaluation = nil }
 		
-		ok, condErr := core.EvaluateConditionExpression(recordForEvaluation, conditionInput)
+		ok, condErr := core.EvaluateConditionExpression(recordForEvaluation, condition)
 		
 		if condErr != nil {
 			s.writeDynamoDBError(w, "ValidationException", condErr.Error(), http.StatusBadRequest)
@@ -75,22 +74,26 @@ func (s *Server) handlePutItem(w http.ResponseWriter, body []byte) {
 		}
 	}
 
-	core.UpdateGSI(batch, schema, oldRecord, input.Item)
-
-	value, err := model.MarshalRecord(input.Item)
-	if err != nil {
+	if err := s.Database.ApplyItemChange(batch, schema, levelDBKey, oldRecord, input.Item); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		s.writeDynamoDBError(w, "InternalServerError", "Failed to marshal item", http.StatusInternalServerError)
 		return
 	}
-	batch.Put([]byte(levelDBKey), value)
 
-	if err := s.Database.DB.Write(batch, nil); err != nil {
+	if err := s.Database.Write(batch); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		http.Error(w, "Internal DB error", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{}`))
+	s.writeItemOutput(w, writeItemOutput{
+		ConsumedCapacity: returnedCapacity(input.ReturnConsumedCapacity, batch.ConsumedCapacity(input.TableName)),
+		ItemCollectionMetrics: s.itemCollectionMetrics(input.ReturnItemCollectionMetrics, schema, input.Item),
+	})
 }
 
 type DeleteItemInput struct {
@@ -100,6 +103,10 @@ type DeleteItemInput struct {
     ConditionExpression string `json:"ConditionExpression,omitempty"`
     ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
     ExpressionAttributeValues map[string]AttributeValue `json:"ExpressionAttributeValues,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	ReturnItemCollectionMetrics string `json:"ReturnItemCollectionMetrics,omitempty"`
+	Expected map[string]model.ExpectedAttributeValue `json:"Expected,omitempty"`
+	ConditionalOperator string `json:"ConditionalOperator,omitempty"`
 }
 
 func (s *Server) handleDeleteItem(w http.ResponseWriter, body []byte) {
@@ -117,6 +124,11 @@ func (s *Server) handleDeleteItem(w http.ResponseWriter, body []byte) {
 		return
 	}
 
+	condition, ok := s.writeCondition(w, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, input.Expected, input.ConditionalOperator, nil, nil)
+	if !ok || !s.validateExpressions(w, body, input.ExpressionAttributeNames, input.ExpressionAttributeValues, "ConditionExpression") {
+		return
+	}
+
 	pkAV, ok := input.Key[schema.PartitionKey]
 	if !ok {
 		s.writeDynamoDBError(w, "ValidationException", fmt.Sprintf("Partition Key '%s' value missing in Key", schema.PartitionKey), http.StatusBadRequest)
@@ -135,13 +147,15 @@ func (s *Server) handleDeleteItem(w http.ResponseWriter, body []byte) {
 	s.Database.Lock()
 	defer s.Database.Unlock()
 
-	oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+	oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 	recordExists := err == nil
 	var oldRecord model.Record
 	
-	if err == leveldb.ErrNotFound {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{}`))
+	if err == core.ErrNotFound {
+		s.writeItemOutput(w, writeItemOutput{
+			ConsumedCapacity: returnedCapacity(input.ReturnConsumedCapacity, s.Database.ChargeWrite(schema, pkVal, 0)),
+			ItemCollectionMetrics: s.itemCollectionMetrics(input.ReturnItemCollectionMetrics, schema, input.Key),
+		})
 		return
 	}
 	if err != nil {
@@ -154,14 +168,8 @@ func (s *Server) handleDeleteItem(w http.ResponseWriter, body []byte) {
 		return
 	}
 
-    if input.ConditionExpression != "" {
-		conditionInput := model.ConditionInput{
-			ConditionExpression:       input.ConditionExpression,
-			ExpressionAttributeNames:  input.ExpressionAttributeNames,
-			ExpressionAttributeValues: input.ExpressionAttributeValues,
-		}
-		
-		ok, condErr := core.EvaluateConditionExpression(oldRecord, conditionInput)
+    if condition.ConditionExpression != "" {
+		ok, condErr := core.EvaluateConditionExpression(oldRecord, condition)
 		
 		if condErr != nil {
 			s.writeDynamoDBError(w, "ValidationException", condErr.Error(), http.StatusBadRequest)
@@ -173,24 +181,31 @@ func (s *Server) handleDeleteItem(w http.ResponseWriter, body []byte) {
 		}
 	}
 
-	batch := new(leveldb.Batch)
-	core.UpdateGSI(batch, schema, oldRecord, nil) 
-
-	batch.Delete([]byte(levelDBKey))
-
-	if err := s.Database.DB.Write(batch, nil); err != nil {
+	batch := core.NewOperationBatch(core.OpDeleteItem, &input)
+	if err := s.Database.ApplyItemChange(batch, schema, levelDBKey, oldRecord, nil); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		http.Error(w, "Internal DB error on write", http.StatusInternalServerError)
 		return
 	}
 
-    responseBody := []byte(`{}`)
-    if input.ReturnValues == "ALL_OLD" {
-        marshaledOldRecord, _ := json.Marshal(oldRecord)
-        responseBody = []byte(fmt.Sprintf(`{"Attributes": %s}`, marshaledOldRecord))
-    }
+	if err := s.Database.Write(batch); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
+		http.Error(w, "Internal DB error on write", http.StatusInternalServerError)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(responseBody)
+	output := writeItemOutput{
+		ConsumedCapacity: returnedCapacity(input.ReturnConsumedCapacity, batch.ConsumedCapacity(input.TableName)),
+		ItemCollectionMetrics: s.itemCollectionMetrics(input.ReturnItemCollectionMetrics, schema, input.Key),
+	}
+	if input.ReturnValues == "ALL_OLD" {
+		output.Attributes = oldRecord
+	}
+	s.writeItemOutput(w, output)
 }
 
 func (s *Server) handleUpdateItem(w http.ResponseWriter, body []byte) {
@@ -208,6 +223,13 @@ func (s *Server) handleUpdateItem(w http.ResponseWriter, body []byte) {
 		return
 	}
 
+	condition, ok := s.writeCondition(w, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, input.Expected, input.ConditionalOperator,
+		map[string]bool{"AttributeUpdates": input.AttributeUpdates != nil},
+		map[string]bool{"UpdateExpression": input.UpdateExpression != ""})
+	if !ok || !s.validateExpressions(w, body, input.ExpressionAttributeNames, input.ExpressionAttributeValues, "ConditionExpression", "UpdateExpression") {
+		return
+	}
+
 	pkAV, ok := input.Key[schema.PartitionKey]
 	if !ok {
 		s.writeDynamoDBError(w, "ValidationException", fmt.Sprintf("Partition Key '%s' value missing in Key", schema.PartitionKey), http.StatusBadRequest)
@@ -226,10 +248,10 @@ func (s *Server) handleUpdateItem(w http.ResponseWriter, body []byte) {
 	s.Database.Lock()
 	defer s.Database.Unlock()
 
-	oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+	oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 	oldRecord := make(model.Record)
     recordExists := err == nil
-	if err != leveldb.ErrNotFound && err != nil {
+	if err != core.ErrNotFound && err != nil {
 		http.Error(w, "Internal DB error on retrieve", http.StatusInternalServerError)
 		return
 	}
@@ -237,17 +259,11 @@ func (s *Server) handleUpdateItem(w http.ResponseWriter, body []byte) {
 		oldRecord, _ = model.UnmarshalRecord(oldValue)
 	}
 
-    if input.ConditionExpression != "" {
-        conditionInput := model.ConditionInput{
-            ConditionExpression:       input.ConditionExpression,
-            ExpressionAttributeNames:  input.ExpressionAttributeNames,
-            ExpressionAttributeValues: input.ExpressionAttributeValues,
-        }
-        
+    if condition.ConditionExpression != "" {
         recordForEvaluation := oldRecord
         if !recordExists { recordForEvaluation = nil }
         
-        ok, condErr := core.EvaluateConditionExpression(recordForEvaluation, conditionInput)
+        ok, condErr := core.EvaluateConditionExpression(recordForEvaluation, condition)
         
         if condErr != nil {
             s.writeDynamoDBError(w, "ValidationException", condErr.Error(), http.StatusBadRequest)
@@ -259,7 +275,12 @@ func (s *Server) handleUpdateItem(w http.ResponseWriter, body []byte) {
         }
     }
     
-    actions, err := core.ParseUpdateExpression(&input) 
+    var actions *core.UpdateActions
+    if input.AttributeUpdates != nil {
+        actions, err = core.AttributeUpdateActions(input.AttributeUpdates)
+    } else {
+        actions, err = core.ParseUpdateExpression(&input)
+    }
     if err != nil {
         s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
         return
@@ -282,29 +303,31 @@ func (s *Server) handleUpdateItem(w http.ResponseWriter, body []byte) {
         }
     }
 
-	batch := new(leveldb.Batch)
-	core.UpdateGSI(batch, schema, oldRecord, newRecord)
-
-	value, err := model.MarshalRecord(newRecord)
-	if err != nil {
+	batch := core.NewOperationBatch(core.OpUpdateItem, &input)
+	if err := s.Database.ApplyItemChange(batch, schema, levelDBKey, oldRecord, newRecord); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		s.writeDynamoDBError(w, "InternalServerError", "Failed to marshal updated item", http.StatusInternalServerError)
 		return
 	}
-	batch.Put([]byte(levelDBKey), value)
 
-	if err := s.Database.DB.Write(batch, nil); err != nil {
+	if err := s.Database.Write(batch); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		http.Error(w, "Internal DB error on write", http.StatusInternalServerError)
 		return
 	}
 
-    responseBody := []byte(`{}`)
-    if input.ReturnValues == "ALL_NEW" {
-        marshaledNewRecord, _ := json.Marshal(newRecord)
-        responseBody = []byte(fmt.Sprintf(`{"Attributes": %s}`, marshaledNewRecord))
-    }
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(responseBody)
+	output := writeItemOutput{
+		ConsumedCapacity: returnedCapacity(input.ReturnConsumedCapacity, batch.ConsumedCapacity(input.TableName)),
+		ItemCollectionMetrics: s.itemCollectionMetrics(input.ReturnItemCollectionMetrics, schema, model.Record(input.Key)),
+	}
+	if input.ReturnValues == "ALL_NEW" {
+		output.Attributes = newRecord
+	}
+	s.writeItemOutput(w, output)
 }
 
 type WriteRequest struct {
@@ -318,10 +341,14 @@ type WriteRequest struct {
 
 type BatchWriteItemInput struct {
 	RequestItems map[string][]WriteRequest `json:"RequestItems"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	ReturnItemCollectionMetrics string `json:"ReturnItemCollectionMetrics,omitempty"`
 }
 
 type BatchWriteItemOutput struct {
-	UnprocessedItems map[string][]WriteRequest `json:"UnprocessedItems,omitempty"`
+	UnprocessedItems map[string][]WriteRequest `json:"UnprocessedItems"`
+	ConsumedCapacity []*model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+	ItemCollectionMetrics map[string][]*model.ItemCollectionMetrics `json:"ItemCollectionMetrics,omitempty"`
 }
 
 func (s *Server) handleBatchWriteItem(w http.ResponseWriter, body []byte) {
@@ -331,7 +358,12 @@ func (s *Server) handleBatchWriteItem(w http.ResponseWriter, body []byte) {
 		return
 	}
 
-	totalBatch := new(leveldb.Batch)
+	totalBatch := core.NewOperationBatch(core.OpBatchWriteItem, &input)
+	// Throttled writes are handed back in UnprocessedItems for the client to
+	// retry; only a batch with every write throttled fails.
+	unprocessed := map[string][]WriteRequest{}
+	written := make(map[string][]model.Record)
+	var throttleErr error
 	
 	s.Database.Lock()
 	defer s.Database.Unlock()
@@ -372,10 +404,10 @@ func (s *Server) handleBatchWriteItem(w http.ResponseWriter, body []byte) {
 
 			levelDBKey := model.BuildLevelDBKey(tableName, pkVal, skVal)
 
-			oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+			oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 			var oldRecord model.Record
 			
-			if err != nil && err != leveldb.ErrNotFound {
+			if err != nil && err != core.ErrNotFound {
 				http.Error(w, "Internal DB error", http.StatusInternalServerError)
 				return
 			}
@@ -383,24 +415,54 @@ func (s *Server) handleBatchWriteItem(w http.ResponseWriter, body []byte) {
 				oldRecord, _ = model.UnmarshalRecord(oldValue)
 			}
 			
+			newRecord := itemData
 			if isDelete {
-				core.UpdateGSI(totalBatch, schema, oldRecord, nil)
-				totalBatch.Delete([]byte(levelDBKey))
-			} else {
-				core.UpdateGSI(totalBatch, schema, oldRecord, itemData)
-				value, _ := model.MarshalRecord(itemData)
-				totalBatch.Put([]byte(levelDBKey), value)
+				newRecord = nil
 			}
+			if err := s.Database.ApplyItemChange(totalBatch, schema, levelDBKey, oldRecord, newRecord); err != nil {
+				var throughputErr *core.ThroughputExceededError
+				if errors.As(err, &throughputErr) {
+					unprocessed[tableName] = append(unprocessed[tableName], req)
+					throttleErr = err
+					continue
+				}
+				if s.writeHookError(w, err) {
+					return
+				}
+				s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
+				return
+			}
+			written[tableName] = append(written[tableName], itemData)
 		}
 	}
+
+	if len(written) == 0 && throttleErr != nil {
+		s.writeHookError(w, throttleErr)
+		return
+	}
 	
-	if err := s.Database.DB.Write(totalBatch, nil); err != nil {
+	if err := s.Database.Write(totalBatch); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		s.writeDynamoDBError(w, "InternalServerError", "Internal DB error during batch write.", http.StatusInternalServerError)
 		return
 	}
 
+	output := BatchWriteItemOutput{
+		UnprocessedItems: unprocessed,
+		ConsumedCapacity: returnedCapacities(input.ReturnConsumedCapacity, totalBatch.ConsumedCapacities()),
+	}
+	for tableName, items := range written {
+		schema := s.Database.Tables[tableName]
+		for _, item := range items {
+			output.ItemCollectionMetrics = addItemCollectionMetrics(output.ItemCollectionMetrics, tableName, s.itemCollectionMetrics(input.ReturnItemCollectionMetrics, schema, item))
+		}
+	}
+
+	respBody, _ := json.Marshal(output)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{}`))
+	w.Write(respBody)
 }
 
 // --- TransactWriteItems handler ---
@@ -420,6 +482,8 @@ type TransactWriteItem struct {
 
 type TransactWriteItemsInput struct {
 	TransactItems []TransactWriteItem `json:"TransactItems"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	ReturnItemCollectionMetrics string `json:"ReturnItemCollectionMetrics,omitempty"`
 }
 
 func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
@@ -429,7 +493,15 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 		return
 	}
 
-	totalBatch := new(leveldb.Batch)
+	for _, item := range input.TransactItems {
+		if err := transactItemExpressions(item); err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	totalBatch := core.NewOperationBatch(core.OpTransactWriteItems, &input)
+	writtenKeys := make(map[string][]model.Record)
 
 	s.Database.Lock()
 	defer s.Database.Unlock()
@@ -480,10 +552,10 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 		}
 		levelDBKey := model.BuildLevelDBKey(tableName, pkVal, skVal)
 
-		oldValue, err := s.Database.DB.Get([]byte(levelDBKey), nil)
+		oldValue, err := s.Database.DB.Get([]byte(levelDBKey))
 		var oldRecord model.Record
 		recordExists := err == nil
-		if err != nil && err != leveldb.ErrNotFound {
+		if err != nil && err != core.ErrNotFound {
 			s.writeDynamoDBError(w, "InternalServerError", "Internal DB error during read for transaction.", http.StatusInternalServerError)
 			return
 		}
@@ -558,22 +630,169 @@ func (s *Server) handleTransactWriteItems(w http.ResponseWriter, body []byte) {
 		}
 
 		if isWriteOp {
-			core.UpdateGSI(totalBatch, schema, oldRecord, newRecord)
-
-			if newRecord != nil {
-				value, _ := model.MarshalRecord(newRecord)
-				totalBatch.Put([]byte(levelDBKey), value)
-			} else {
-				totalBatch.Delete([]byte(levelDBKey))
+			if err := s.Database.ApplyItemChange(totalBatch, schema, levelDBKey, oldRecord, newRecord); err != nil {
+				if s.writeHookError(w, err) {
+					return
+				}
+				s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
+				return
 			}
+			writtenKeys[tableName] = append(writtenKeys[tableName], key)
 		}
 	}
 
-	if err := s.Database.DB.Write(totalBatch, nil); err != nil {
+	if err := s.Database.Write(totalBatch); err != nil {
+		if s.writeHookError(w, err) {
+			return
+		}
 		s.writeDynamoDBError(w, "InternalServerError", "Internal DB error during transaction write.", http.StatusInternalServerError)
 		return
 	}
 
+	var metrics map[string][]*model.ItemCollectionMetrics
+	for tableName, keys := range writtenKeys {
+		for _, key := range keys {
+			metrics = addItemCollectionMetrics(metrics, tableName, s.itemCollectionMetrics(input.ReturnItemCollectionMetrics, s.Database.Tables[tableName], key))
+		}
+	}
+
+	respBody, _ := json.Marshal(struct {
+		ConsumedCapacity []*model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+		ItemCollectionMetrics map[string][]*model.ItemCollectionMetrics `json:"ItemCollectionMetrics,omitempty"`
+	}{
+		ConsumedCapacity: returnedCapacities(input.ReturnConsumedCapacity, totalBatch.ConsumedCapacities()),
+		ItemCollectionMetrics: metrics,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type writeItemOutput struct {
+	Attributes model.Record `json:"Attributes,omitempty"`
+	ConsumedCapacity *model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+	ItemCollectionMetrics *model.ItemCollectionMetrics `json:"ItemCollectionMetrics,omitempty"`
+}
+
+func (s *Server) writeItemOutput(w http.ResponseWriter, output writeItemOutput) {
+	respBody, _ := json.Marshal(output)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{}`))
+	w.Write(respBody)
+}
+
+// writeCondition checks the condition parameters of a single-item write and
+// returns the condition to evaluate, translating the legacy Expected parameter
+// when the request uses it. legacy and expressions name any further legacy and
+// expression parameters of the request. It writes the error response itself.
+func (s *Server) writeCondition(w http.ResponseWriter, expression string, names map[string]string, values map[string]model.AttributeValue, expected map[string]model.ExpectedAttributeValue, conditionalOperator string, legacy, expressions map[string]bool) (model.ConditionInput, bool) {
+	if legacy == nil {
+		legacy = make(map[string]bool)
+	}
+	if expressions == nil {
+		expressions = make(map[string]bool)
+	}
+	legacy["Expected"] = expected != nil
+	legacy["ConditionalOperator"] = conditionalOperator != ""
+	expressions["ConditionExpression"] = expression != ""
+
+	if err := core.CheckExpressionParams(legacy, expressions, len(names) > 0, len(values) > 0); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return model.ConditionInput{}, false
+	}
+	condition, err := core.ExpectedCondition(model.ConditionInput{
+		ConditionExpression: expression,
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: values,
+	}, expected, conditionalOperator)
+	if err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return model.ConditionInput{}, false
+	}
+	return condition, true
+}
+
+// validateExpressions runs the shared expression validation over the named
+// expression parameters of body. They are read from the raw body so that an
+// expression sent as an empty string is not mistaken for a missing one.
+func (s *Server) validateExpressions(w http.ResponseWriter, body []byte, names map[string]string, values map[string]model.AttributeValue, params ...string) bool {
+	var raw map[string]json.RawMessage
+	json.Unmarshal(body, &raw)
+
+	expressions := make(map[string]string)
+	for _, param := range params {
+		var expression string
+		if value, ok := raw[param]; ok && string(value) != "null" && json.Unmarshal(value, &expression) == nil {
+			expressions[param] = expression
+		}
+	}
+
+	if err := core.ValidateExpressions(expressions, names, values); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// transactItemExpressions validates the expressions of one TransactWriteItems
+// entry.
+func transactItemExpressions(item TransactWriteItem) error {
+	expressions := make(map[string]string)
+	add := func(param, expression string) {
+		if expression != "" {
+			expressions[param] = expression
+		}
+	}
+
+	switch {
+	case item.Put != nil:
+		add("ConditionExpression", item.Put.ConditionExpression)
+		return core.ValidateExpressions(expressions, item.Put.ExpressionAttributeNames, item.Put.ExpressionAttributeValues)
+	case item.Update != nil:
+		add("ConditionExpression", item.Update.ConditionExpression)
+		add("UpdateExpression", item.Update.UpdateExpression)
+		return core.ValidateExpressions(expressions, item.Update.ExpressionAttributeNames, item.Update.ExpressionAttributeValues)
+	case item.Delete != nil:
+		add("ConditionExpression", item.Delete.ConditionExpression)
+		return core.ValidateExpressions(expressions, item.Delete.ExpressionAttributeNames, item.Delete.ExpressionAttributeValues)
+	case item.ConditionCheck != nil:
+		add("ConditionExpression", item.ConditionCheck.ConditionExpression)
+		return core.ValidateExpressions(expressions, item.ConditionCheck.ExpressionAttributeNames, item.ConditionCheck.ExpressionAttributeValues)
+	}
+	return nil
+}
+
+// writeHookError reports err if a hook vetoed the operation with a DynamoDB
+// error or the table ran out of capacity, and tells the caller whether it did.
+func (s *Server) writeHookError(w http.ResponseWriter, err error) bool {
+	var hookErr *core.HookError
+	var throughputErr *core.ThroughputExceededError
+	switch {
+	case errors.As(err, &hookErr):
+		s.writeDynamoDBError(w, hookErr.Code, hookErr.Message, errorStatus(hookErr.Code))
+	case errors.As(err, &throughputErr):
+		s.writeDynamoDBError(w, "ProvisionedThroughputExceededException", throughputErr.Error(), http.StatusBadRequest)
+	default:
+		return false
+	}
+	return true
+}
+
+// errorStatus is the HTTP status DynamoDB answers an error code with: 500 for
+// server side errors, 400 for everything else.
+func errorStatus(code string) int {
+	switch code {
+	case "InternalServerError", "ServiceUnavailable":
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func (s *Server) runHooks(w http.ResponseWriter, run func(*core.HookContext) error, ctx *core.HookContext) bool {
+	if err := run(ctx); err != nil {
+		if !s.writeHookError(w, err) {
+			s.writeDynamoDBError(w, "InternalServerError", "Operation hook failed", http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
 }
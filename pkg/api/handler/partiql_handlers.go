@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type ExecuteStatementInput struct {
+	Statement string `json:"Statement"`
+	Parameters []model.AttributeValue `json:"Parameters,omitempty"`
+	ConsistentRead bool `json:"ConsistentRead,omitempty"`
+	Limit int `json:"Limit,omitempty"`
+	NextToken string `json:"NextToken,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+func (s *Server) handleExecuteStatement(w http.ResponseWriter, body []byte) {
+	var input ExecuteStatementInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.Database.ExecuteStatement(core.PartiQLStatementInput{
+		Statement: input.Statement,
+		Parameters: input.Parameters,
+		ConsistentRead: input.ConsistentRead,
+	}, input.Limit, input.NextToken)
+	if err != nil {
+		s.writePartiQLError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		Items []model.Record `json:"Items"`
+		NextToken string `json:"NextToken,omitempty"`
+		ConsumedCapacity *model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+	}{
+		Items: result.Items,
+		NextToken: result.NextToken,
+		ConsumedCapacity: returnedCapacity(input.ReturnConsumedCapacity, result.ConsumedCapacity),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type BatchStatementRequest struct {
+	Statement string `json:"Statement"`
+	Parameters []model.AttributeValue `json:"Parameters,omitempty"`
+	ConsistentRead bool `json:"ConsistentRead,omitempty"`
+}
+
+type BatchExecuteStatementInput struct {
+	Statements []BatchStatementRequest `json:"Statements"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+type BatchStatementError struct {
+	Code string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+type BatchStatementResponse struct {
+	TableName string `json:"TableName,omitempty"`
+	Item model.Record `json:"Item,omitempty"`
+	Error *BatchStatementError `json:"Error,omitempty"`
+}
+
+func (s *Server) handleBatchExecuteStatement(w http.ResponseWriter, body []byte) {
+	var input BatchExecuteStatementInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	statements := make([]core.PartiQLStatementInput, len(input.Statements))
+	for i, stmt := range input.Statements {
+		statements[i] = core.PartiQLStatementInput{
+			Statement: stmt.Statement,
+			Parameters: stmt.Parameters,
+			ConsistentRead: stmt.ConsistentRead,
+		}
+	}
+
+	results, err := s.Database.BatchExecuteStatement(statements)
+	if err != nil {
+		s.writePartiQLError(w, err)
+		return
+	}
+
+	responses := make([]BatchStatementResponse, len(results))
+	var consumed []*model.ConsumedCapacity
+	for i, result := range results {
+		consumed = core.MergeConsumedCapacity(consumed, result.ConsumedCapacity)
+		responses[i] = BatchStatementResponse{TableName: result.TableName, Item: result.Item}
+		if result.Err != nil {
+			responses[i].Item = nil
+			responses[i].Error = &BatchStatementError{
+				Code: partiqlBatchErrorCode(result.Err),
+				Message: result.Err.Error(),
+			}
+		}
+	}
+
+	respBody, _ := json.Marshal(struct {
+		Responses []BatchStatementResponse `json:"Responses"`
+		ConsumedCapacity []*model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+	}{
+		Responses: responses,
+		ConsumedCapacity: returnedCapacities(input.ReturnConsumedCapacity, consumed),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type ParameterizedStatement struct {
+	Statement string `json:"Statement"`
+	Parameters []model.AttributeValue `json:"Parameters,omitempty"`
+}
+
+type ExecuteTransactionInput struct {
+	TransactStatements []ParameterizedStatement `json:"TransactStatements"`
+	ClientRequestToken string `json:"ClientRequestToken,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+}
+
+type ItemResponse struct {
+	Item model.Record `json:"Item,omitempty"`
+}
+
+func (s *Server) handleExecuteTransaction(w http.ResponseWriter, body []byte) {
+	var input ExecuteTransactionInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	statements := make([]core.PartiQLStatementInput, len(input.TransactStatements))
+	for i, stmt := range input.TransactStatements {
+		statements[i] = core.PartiQLStatementInput{
+			Statement: stmt.Statement,
+			Parameters: stmt.Parameters,
+		}
+	}
+
+	items, consumed, err := s.Database.ExecuteTransaction(statements)
+	if err != nil {
+		s.writePartiQLError(w, err)
+		return
+	}
+
+	var responses []ItemResponse
+	if items != nil {
+		responses = make([]ItemResponse, len(items))
+		for i, item := range items {
+			responses[i] = ItemResponse{Item: item}
+		}
+	}
+
+	respBody, _ := json.Marshal(struct {
+		Responses []ItemResponse `json:"Responses,omitempty"`
+		ConsumedCapacity []*model.ConsumedCapacity `json:"ConsumedCapacity,omitempty"`
+	}{
+		Responses: responses,
+		ConsumedCapacity: returnedCapacities(input.ReturnConsumedCapacity, consumed),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func partiqlBatchErrorCode(err error) string {
+	var hookErr *core.HookError
+	var throughputErr *core.ThroughputExceededError
+	switch {
+	case errors.As(err, &hookErr):
+		return strings.TrimSuffix(hookErr.Code, "Exception")
+	case errors.As(err, &throughputErr):
+		return "ProvisionedThroughputExceeded"
+	case errors.Is(err, core.ErrResourceNotFound):
+		return "ResourceNotFound"
+	case errors.Is(err, core.ErrConditionalCheckFailed):
+		return "ConditionalCheckFailed"
+	case errors.Is(err, core.ErrDuplicateItem):
+		return "DuplicateItem"
+	}
+	return "ValidationError"
+}
+
+func (s *Server) writePartiQLError(w http.ResponseWriter, err error) {
+	var canceled *core.TransactionCanceledError
+	var hookErr *core.HookError
+	var throughputErr *core.ThroughputExceededError
+	switch {
+	case errors.As(err, &canceled):
+		respBody, _ := json.Marshal(struct {
+			Type string `json:"__type"`
+			Message string `json:"message"`
+			CancellationReasons []core.CancellationReason `json:"CancellationReasons"`
+		}{
+			Type: "com.amazonaws.dynamodb.TransactionCanceledException",
+			Message: canceled.Error(),
+			CancellationReasons: canceled.Reasons,
+		})
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(respBody)
+	case errors.As(err, &hookErr), errors.As(err, &throughputErr):
+		s.writeHookError(w, err)
+	case errors.Is(err, core.ErrResourceNotFound):
+		s.writeDynamoDBError(w, "ResourceNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrConditionalCheckFailed):
+		s.writeDynamoDBError(w, "ConditionalCheckFailedException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrDuplicateItem):
+		s.writeDynamoDBError(w, "DuplicateItemException", err.Error(), http.StatusBadRequest)
+	default:
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type SnapshotDescription struct {
+	SnapshotName string `json:"SnapshotName"`
+	CreationDateTime float64 `json:"CreationDateTime"`
+	SizeBytes int64 `json:"SizeBytes"`
+	TableNames []string `json:"TableNames"`
+	Partial bool `json:"Partial"`
+}
+
+type RestoreTablesFromSnapshotInput struct {
+	SnapshotName string `json:"SnapshotName"`
+	TableMappings map[string]string `json:"TableMappings,omitempty"`
+}
+
+type SnapshotArchiveInput struct {
+	SnapshotName string `json:"SnapshotName"`
+	ArchivePath string `json:"ArchivePath"`
+}
+
+func snapshotDescription(descriptor model.SnapshotDescriptor) SnapshotDescription {
+	tableNames := descriptor.TableNames
+	if tableNames == nil {
+		tableNames = []string{}
+	}
+	return SnapshotDescription{
+		SnapshotName: descriptor.SnapshotName,
+		CreationDateTime: epochSeconds(descriptor.CreationTime),
+		SizeBytes: descriptor.SizeBytes,
+		TableNames: tableNames,
+		Partial: descriptor.Partial,
+	}
+}
+
+func (s *Server) handleListSnapshots(w http.ResponseWriter) {
+	snapshots, err := s.Database.ListSnapshots()
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	descriptions := make([]SnapshotDescription, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		descriptions = append(descriptions, snapshotDescription(snapshot))
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{"Snapshots": descriptions})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleDescribeSnapshot(w http.ResponseWriter, body []byte) {
+	var input SnapshotInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.DescribeSnapshot(input.SnapshotName)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{"SnapshotDescription": snapshotDescription(descriptor)})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleDeleteSnapshot(w http.ResponseWriter, body []byte) {
+	var input SnapshotInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.DeleteSnapshot(input.SnapshotName)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"SnapshotDescription": snapshotDescription(descriptor),
+		"Status": "DELETED",
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleExportSnapshot(w http.ResponseWriter, body []byte) {
+	var input SnapshotArchiveInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := s.Database.ExportSnapshot(input.SnapshotName, input.ArchivePath)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"SnapshotDescription": snapshotDescription(manifest.Snapshot),
+		"ArchivePath": input.ArchivePath,
+		"Files": manifest.Files,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleImportSnapshot(w http.ResponseWriter, body []byte) {
+	var input SnapshotArchiveInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	if input.ArchivePath == "" {
+		s.writeDynamoDBError(w, "ValidationException", "ArchivePath must be specified", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := s.Database.ImportSnapshot(input.ArchivePath, input.SnapshotName)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{"SnapshotDescription": snapshotDescription(descriptor)})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) handleRestoreTablesFromSnapshot(w http.ResponseWriter, body []byte) {
+	var input RestoreTablesFromSnapshotInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	schemas, err := s.Database.RestoreTablesFromSnapshot(input.SnapshotName, input.TableMappings)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	descriptions := make([]map[string]interface{}, 0, len(schemas))
+	for _, schema := range schemas {
+		descriptions = append(descriptions, tableDescription(schema, "ACTIVE"))
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{"TableDescriptions": descriptions})
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) writeSnapshotError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrSnapshotNotFound), errors.Is(err, core.ErrTableNotFound):
+		s.writeDynamoDBError(w, "ResourceNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrSnapshotAlreadyExists), errors.Is(err, core.ErrTableAlreadyExists):
+		s.writeDynamoDBError(w, "ResourceInUseException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrInvalidSnapshotName), errors.Is(err, core.ErrInvalidSnapshotArchive), errors.Is(err, core.ErrInvalidArchivePath):
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+	default:
+		s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type ListStreamsInput struct {
+	TableName string `json:"TableName,omitempty"`
+	Limit int `json:"Limit,omitempty"`
+	ExclusiveStartStreamArn string `json:"ExclusiveStartStreamArn,omitempty"`
+}
+
+type StreamSummary struct {
+	StreamArn string `json:"StreamArn"`
+	StreamLabel string `json:"StreamLabel"`
+	TableName string `json:"TableName"`
+}
+
+func (s *Server) handleListStreams(w http.ResponseWriter, body []byte) {
+	var input ListStreamsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	streams, lastEvaluated, err := s.Database.ListStreams(input.TableName, input.ExclusiveStartStreamArn, input.Limit)
+	if err != nil {
+		s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]StreamSummary, 0, len(streams))
+	for _, stream := range streams {
+		summaries = append(summaries, StreamSummary{
+			StreamArn: stream.StreamArn,
+			StreamLabel: stream.StreamLabel,
+			TableName: stream.TableName,
+		})
+	}
+
+	respBody, _ := json.Marshal(struct {
+		Streams []StreamSummary `json:"Streams"`
+		LastEvaluatedStreamArn string `json:"LastEvaluatedStreamArn,omitempty"`
+	}{
+		Streams: summaries,
+		LastEvaluatedStreamArn: lastEvaluated,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type DescribeStreamInput struct {
+	StreamArn string `json:"StreamArn"`
+	Limit int `json:"Limit,omitempty"`
+	ExclusiveStartShardId string `json:"ExclusiveStartShardId,omitempty"`
+}
+
+type SequenceNumberRange struct {
+	StartingSequenceNumber string `json:"StartingSequenceNumber,omitempty"`
+	EndingSequenceNumber string `json:"EndingSequenceNumber,omitempty"`
+}
+
+type Shard struct {
+	ShardId string `json:"ShardId"`
+	SequenceNumberRange SequenceNumberRange `json:"SequenceNumberRange"`
+}
+
+func (s *Server) handleDescribeStream(w http.ResponseWriter, body []byte) {
+	var input DescribeStreamInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, startingSeq, endingSeq, err := s.Database.DescribeStream(input.StreamArn)
+	if err != nil {
+		s.writeStreamError(w, err)
+		return
+	}
+
+	shards := make([]Shard, 0, 1)
+	if input.ExclusiveStartShardId != descriptor.ShardId {
+		shards = append(shards, Shard{
+			ShardId: descriptor.ShardId,
+			SequenceNumberRange: SequenceNumberRange{
+				StartingSequenceNumber: startingSeq,
+				EndingSequenceNumber: endingSeq,
+			},
+		})
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"StreamDescription": map[string]interface{}{
+			"StreamArn": descriptor.StreamArn,
+			"StreamLabel": descriptor.StreamLabel,
+			"StreamStatus": descriptor.StreamStatus,
+			"StreamViewType": descriptor.StreamViewType,
+			"CreationRequestDateTime": descriptor.CreationTime,
+			"TableName": descriptor.TableName,
+			"KeySchema": descriptor.KeySchema,
+			"Shards": shards,
+		},
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type GetShardIteratorInput struct {
+	StreamArn string `json:"StreamArn"`
+	ShardId string `json:"ShardId"`
+	ShardIteratorType string `json:"ShardIteratorType"`
+	SequenceNumber string `json:"SequenceNumber,omitempty"`
+}
+
+func (s *Server) handleGetShardIterator(w http.ResponseWriter, body []byte) {
+	var input GetShardIteratorInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	iterator, err := s.Database.GetShardIterator(input.StreamArn, input.ShardId, input.ShardIteratorType, input.SequenceNumber)
+	if err != nil {
+		s.writeStreamError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		ShardIterator string `json:"ShardIterator"`
+	}{
+		ShardIterator: iterator,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type GetRecordsInput struct {
+	ShardIterator string `json:"ShardIterator"`
+	Limit int `json:"Limit,omitempty"`
+}
+
+func (s *Server) handleGetRecords(w http.ResponseWriter, body []byte) {
+	var input GetRecordsInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	records, next, err := s.Database.GetRecords(input.ShardIterator, input.Limit)
+	if err != nil {
+		s.writeStreamError(w, err)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		Records []model.StreamRecord `json:"Records"`
+		NextShardIterator string `json:"NextShardIterator,omitempty"`
+	}{
+		Records: records,
+		NextShardIterator: next,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type CreateStreamTriggerInput struct {
+	Name string `json:"Name"`
+	TableName string `json:"TableName"`
+	Endpoint string `json:"Endpoint"`
+	BatchSize int `json:"BatchSize,omitempty"`
+	MaximumBatchingWindowInSeconds int `json:"MaximumBatchingWindowInSeconds,omitempty"`
+	MaximumRetryAttempts *int `json:"MaximumRetryAttempts,omitempty"`
+	BisectBatchOnFunctionError bool `json:"BisectBatchOnFunctionError,omitempty"`
+	DeadLetterFile string `json:"DeadLetterFile,omitempty"`
+	StartingPosition string `json:"StartingPosition,omitempty"`
+}
+
+func (s *Server) handleCreateStreamTrigger(w http.ResponseWriter, body []byte) {
+	var input CreateStreamTriggerInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	if input.Endpoint == "" {
+		s.writeDynamoDBError(w, "ValidationException", "Endpoint must be specified", http.StatusBadRequest)
+		return
+	}
+
+	retries := -1
+	if input.MaximumRetryAttempts != nil {
+		retries = *input.MaximumRetryAttempts
+	}
+
+	cfg := core.StreamTriggerConfig{
+		Name: input.Name,
+		TableName: input.TableName,
+		Endpoint: input.Endpoint,
+		Handler: endpointStreamHandler(input.Endpoint),
+		BatchSize: input.BatchSize,
+		BatchingWindow: time.Duration(input.MaximumBatchingWindowInSeconds) * time.Second,
+		MaximumRetryAttempts: retries,
+		BisectBatchOnFunctionError: input.BisectBatchOnFunctionError,
+		DeadLetterFile: input.DeadLetterFile,
+		StartingPosition: input.StartingPosition,
+	}
+	if err := s.Database.AddStreamTrigger(cfg); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"Name": "%s", "Status": "ENABLED"}`, input.Name)))
+}
+
+var streamTriggerClient = &http.Client{Timeout: 30 * time.Second}
+
+// endpointStreamHandler POSTs each batch of stream records to endpoint, the
+// way Lambda receives a DynamoDB event. Any non-2xx response counts as a
+// function error.
+func endpointStreamHandler(endpoint string) core.StreamHandlerFunc {
+	return func(ctx context.Context, event model.StreamEvent) error {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal stream event: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := streamTriggerClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+type DeleteStreamTriggerInput struct {
+	Name string `json:"Name"`
+}
+
+func (s *Server) handleDeleteStreamTrigger(w http.ResponseWriter, body []byte) {
+	var input DeleteStreamTriggerInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Database.RemoveStreamTrigger(input.Name); err != nil {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"Name": "%s", "Status": "DELETED"}`, input.Name)))
+}
+
+func (s *Server) handleListStreamTriggers(w http.ResponseWriter) {
+	respBody, _ := json.Marshal(struct {
+		Triggers []core.StreamTriggerStatus `json:"Triggers"`
+	}{
+		Triggers: s.Database.ListStreamTriggers(),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+func (s *Server) writeStreamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrStreamNotFound):
+		s.writeDynamoDBError(w, "ResourceNotFoundException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrExpiredIterator):
+		s.writeDynamoDBError(w, "ExpiredIteratorException", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrTrimmedData):
+		s.writeDynamoDBError(w, "TrimmedDataAccessException", err.Error(), http.StatusBadRequest)
+	default:
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+	}
+}
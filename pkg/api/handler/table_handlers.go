@@ -2,9 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
 )
 
@@ -24,8 +27,25 @@ type CreateTableInput struct {
 			AttributeName string `json:"AttributeName"`
 			KeyType string `json:"KeyType"`
 		} `json:"KeySchema"`
+		Projection model.Projection `json:"Projection"`
+		ProvisionedThroughput *model.ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
 	} `json:"GlobalSecondaryIndexes,omitempty"`
-	ProvisionedThroughput struct{} `json:"ProvisionedThroughput"`
+	LocalSecondaryIndexes []struct {
+		IndexName string `json:"IndexName"`
+		KeySchema []struct {
+			AttributeName string `json:"AttributeName"`
+			KeyType string `json:"KeyType"`
+		} `json:"KeySchema"`
+		Projection model.Projection `json:"Projection"`
+	} `json:"LocalSecondaryIndexes,omitempty"`
+	BillingMode string `json:"BillingMode,omitempty"`
+	ProvisionedThroughput *model.ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
+	StreamSpecification *StreamSpecification `json:"StreamSpecification,omitempty"`
+}
+
+type StreamSpecification struct {
+	StreamEnabled bool `json:"StreamEnabled"`
+	StreamViewType string `json:"StreamViewType,omitempty"`
 }
 
 func (s *Server) handleCreateTable(w http.ResponseWriter, body []byte) {
@@ -38,6 +58,16 @@ func (s *Server) handleCreateTable(w http.ResponseWriter, body []byte) {
 	schema := model.TableSchema{
 		TableName: input.TableName,
 		GSIs: make(map[string]model.GsiSchema),
+		LSIs: make(map[string]model.GsiSchema),
+		BillingMode: input.BillingMode,
+	}
+	// DynamoDB defaults to PROVISIONED; tables created without throughput
+	// stay on-demand so they keep working as before.
+	if schema.BillingMode == "" && input.ProvisionedThroughput != nil {
+		schema.BillingMode = model.BillingModeProvisioned
+	}
+	if input.ProvisionedThroughput != nil {
+		schema.ProvisionedThroughput = *input.ProvisionedThroughput
 	}
 
 	for _, ks := range input.KeySchema {
@@ -56,6 +86,14 @@ func (s *Server) handleCreateTable(w http.ResponseWriter, body []byte) {
 	for _, gsiInput := range input.GlobalSecondaryIndexes {
 		gsiSchema := model.GsiSchema{
 			IndexName: gsiInput.IndexName,
+			Projection: gsiInput.Projection,
+		}
+		if err := core.ValidateProjection(gsiInput.IndexName, gsiInput.Projection); err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if gsiInput.ProvisionedThroughput != nil {
+			gsiSchema.ProvisionedThroughput = *gsiInput.ProvisionedThroughput
 		}
 		for _, ks := range gsiInput.KeySchema {
 			if ks.KeyType == "HASH" {
@@ -67,13 +105,158 @@ func (s *Server) handleCreateTable(w http.ResponseWriter, body []byte) {
 		schema.GSIs[gsiInput.IndexName] = gsiSchema
 	}
 
+	for _, lsiInput := range input.LocalSecondaryIndexes {
+		lsiSchema := model.GsiSchema{
+			IndexName: lsiInput.IndexName,
+			Projection: lsiInput.Projection,
+		}
+		if err := core.ValidateProjection(lsiInput.IndexName, lsiInput.Projection); err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, ks := range lsiInput.KeySchema {
+			if ks.KeyType == "HASH" {
+				lsiSchema.PartitionKey = ks.AttributeName
+			} else if ks.KeyType == "RANGE" {
+				lsiSchema.SortKey = ks.AttributeName
+			}
+		}
+		if lsiSchema.PartitionKey != schema.PartitionKey || lsiSchema.SortKey == "" {
+			s.writeDynamoDBError(w, "ValidationException", fmt.Sprintf("Local secondary index %s must use the table partition key and a sort key", lsiInput.IndexName), http.StatusBadRequest)
+			return
+		}
+		schema.LSIs[lsiInput.IndexName] = lsiSchema
+	}
+
+	if err := core.ValidateThroughput(schema); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if spec := input.StreamSpecification; spec != nil && spec.StreamEnabled {
+		if !model.IsValidStreamViewType(spec.StreamViewType) {
+			s.writeDynamoDBError(w, "ValidationException", "StreamViewType must be one of KEYS_ONLY, NEW_IMAGE, OLD_IMAGE, NEW_AND_OLD_IMAGES", http.StatusBadRequest)
+			return
+		}
+		schema.StreamViewType = spec.StreamViewType
+	}
+
 	if err := s.Database.CreateTable(schema); err != nil {
 		s.writeDynamoDBError(w, "ResourceInUseException", err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	s.Database.RLock()
+	schema = s.Database.Tables[input.TableName]
+	s.Database.RUnlock()
+
+	s.writeTableDescription(w, schema, "ACTIVE")
+}
+
+func (s *Server) writeTableDescription(w http.ResponseWriter, schema model.TableSchema, status string) {
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"TableDescription": tableDescription(schema, status),
+	})
+
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf(`{"TableDescription": {"TableName": "%s", "TableStatus": "ACTIVE"}}`, input.TableName)))
+	w.Write(respBody)
+}
+
+func tableDescription(schema model.TableSchema, status string) map[string]interface{} {
+	description := map[string]interface{}{
+		"TableName": schema.TableName,
+		"TableStatus": status,
+	}
+	if schema.StreamLabel != "" {
+		description["LatestStreamLabel"] = schema.StreamLabel
+		description["LatestStreamArn"] = core.StreamArn(schema.TableName, schema.StreamLabel)
+	}
+	if schema.StreamViewType != "" {
+		description["StreamSpecification"] = StreamSpecification{StreamEnabled: true, StreamViewType: schema.StreamViewType}
+	}
+
+	description["BillingModeSummary"] = map[string]interface{}{"BillingMode": schema.EffectiveBillingMode()}
+	description["ProvisionedThroughput"] = provisionedThroughputDescription(schema.ProvisionedThroughput)
+	if len(schema.GSIs) > 0 {
+		indexes := make([]map[string]interface{}, 0, len(schema.GSIs))
+		for _, index := range indexDefinitions(schema.GSIs) {
+			indexes = append(indexes, map[string]interface{}{
+				"IndexName": index.IndexName,
+				"IndexStatus": "ACTIVE",
+				"KeySchema": index.KeySchema,
+				"Projection": index.Projection,
+				"ProvisionedThroughput": provisionedThroughputDescription(schema.GSIs[index.IndexName].ProvisionedThroughput),
+			})
+		}
+		description["GlobalSecondaryIndexes"] = indexes
+	}
+	if len(schema.LSIs) > 0 {
+		description["LocalSecondaryIndexes"] = indexDefinitions(schema.LSIs)
+	}
+	return description
+}
+
+func provisionedThroughputDescription(throughput model.ProvisionedThroughput) map[string]interface{} {
+	return map[string]interface{}{
+		"ReadCapacityUnits": throughput.ReadCapacityUnits,
+		"WriteCapacityUnits": throughput.WriteCapacityUnits,
+		"NumberOfDecreasesToday": 0,
+	}
+}
+
+type UpdateTableInput struct {
+	TableName string `json:"TableName"`
+	StreamSpecification *StreamSpecification `json:"StreamSpecification,omitempty"`
+	BillingMode string `json:"BillingMode,omitempty"`
+	ProvisionedThroughput *model.ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
+	GlobalSecondaryIndexUpdates []struct {
+		Update *struct {
+			IndexName string `json:"IndexName"`
+			ProvisionedThroughput model.ProvisionedThroughput `json:"ProvisionedThroughput"`
+		} `json:"Update,omitempty"`
+	} `json:"GlobalSecondaryIndexUpdates,omitempty"`
+}
+
+func (s *Server) handleUpdateTable(w http.ResponseWriter, body []byte) {
+	var input UpdateTableInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	s.Database.RLock()
+	schema, ok := s.Database.Tables[input.TableName]
+	s.Database.RUnlock()
+	if !ok {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+		return
+	}
+
+	if spec := input.StreamSpecification; spec != nil {
+		updated, err := s.Database.UpdateStreamSpecification(input.TableName, spec.StreamEnabled, spec.StreamViewType)
+		if err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		schema = updated
+	}
+
+	gsiThroughput := make(map[string]model.ProvisionedThroughput)
+	for _, update := range input.GlobalSecondaryIndexUpdates {
+		if update.Update != nil {
+			gsiThroughput[update.Update.IndexName] = update.Update.ProvisionedThroughput
+		}
+	}
+	if input.BillingMode != "" || input.ProvisionedThroughput != nil || len(gsiThroughput) > 0 {
+		updated, err := s.Database.UpdateTableThroughput(input.TableName, input.BillingMode, input.ProvisionedThroughput, gsiThroughput)
+		if err != nil {
+			s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+			return
+		}
+		schema = updated
+	}
+
+	s.writeTableDescription(w, schema, "ACTIVE")
 }
 
 type DeleteTableInput struct {
@@ -87,18 +270,17 @@ func (s *Server) handleDeleteTable(w http.ResponseWriter, body []byte) {
 		return
 	}
 
-	s.Database.Lock()
-	defer s.Database.Unlock()
-	
-	if _, ok := s.Database.Tables[input.TableName]; !ok {
-		s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+	schema, err := s.Database.DeleteTable(input.TableName)
+	if err != nil {
+		if errors.Is(err, core.ErrTableNotFound) {
+			s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+			return
+		}
+		s.writeDynamoDBError(w, "InternalServerError", err.Error(), http.StatusInternalServerError)
 		return
 	}
-	
-	delete(s.Database.Tables, input.TableName)
-	
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf(`{"TableDescription": {"TableName": "%s", "TableStatus": "DELETING"}}`, input.TableName)))
+
+	s.writeTableDescription(w, schema, "DELETING")
 }
 
 func (s *Server) handleListTables(w http.ResponseWriter) {
@@ -121,8 +303,122 @@ func (s *Server) handleListTables(w http.ResponseWriter) {
 	w.Write(respBody)
 }
 
+type TimeToLiveSpecification struct {
+	AttributeName string `json:"AttributeName"`
+	Enabled bool `json:"Enabled"`
+}
+
+type UpdateTimeToLiveInput struct {
+	TableName string `json:"TableName"`
+	TimeToLiveSpecification TimeToLiveSpecification `json:"TimeToLiveSpecification"`
+}
+
+func (s *Server) handleUpdateTimeToLive(w http.ResponseWriter, body []byte) {
+	var input UpdateTimeToLiveInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	s.Database.RLock()
+	_, ok := s.Database.Tables[input.TableName]
+	s.Database.RUnlock()
+	if !ok {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+		return
+	}
+
+	spec := input.TimeToLiveSpecification
+	if _, err := s.Database.UpdateTimeToLive(input.TableName, spec.AttributeName, spec.Enabled); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respBody, _ := json.Marshal(struct {
+		TimeToLiveSpecification TimeToLiveSpecification `json:"TimeToLiveSpecification"`
+	}{
+		TimeToLiveSpecification: spec,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type DescribeTimeToLiveInput struct {
+	TableName string `json:"TableName"`
+}
+
+func (s *Server) handleDescribeTimeToLive(w http.ResponseWriter, body []byte) {
+	var input DescribeTimeToLiveInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	s.Database.RLock()
+	schema, ok := s.Database.Tables[input.TableName]
+	s.Database.RUnlock()
+	if !ok {
+		s.writeDynamoDBError(w, "ResourceNotFoundException", "Table not found", http.StatusBadRequest)
+		return
+	}
+
+	description := struct {
+		TimeToLiveStatus string `json:"TimeToLiveStatus"`
+		AttributeName string `json:"AttributeName,omitempty"`
+	}{
+		TimeToLiveStatus: "DISABLED",
+	}
+	if schema.TTLAttribute != "" {
+		description.TimeToLiveStatus = "ENABLED"
+		description.AttributeName = schema.TTLAttribute
+	}
+
+	respBody, _ := json.Marshal(map[string]interface{}{
+		"TimeToLiveDescription": description,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+type AdvanceClockInput struct {
+	Seconds int64 `json:"Seconds"`
+}
+
+func (s *Server) handleAdvanceClock(w http.ResponseWriter, body []byte) {
+	var input AdvanceClockInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		s.writeDynamoDBError(w, "ValidationException", "Invalid JSON input", http.StatusBadRequest)
+		return
+	}
+
+	clock, ok := s.Database.Clock.(*core.ManualClock)
+	if !ok {
+		s.writeDynamoDBError(w, "ValidationException", "The emulator clock is not controllable; start it with DYNAMO_MANUAL_CLOCK=true", http.StatusBadRequest)
+		return
+	}
+	if input.Seconds < 0 {
+		s.writeDynamoDBError(w, "ValidationException", "Seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	now := clock.Advance(time.Duration(input.Seconds) * time.Second)
+	s.Database.PropagateGSIUpdates()
+
+	deleted, err := s.Database.ReapExpiredItems()
+	if err != nil {
+		s.writeDynamoDBError(w, "InternalServerError", fmt.Sprintf("Failed to reap expired items: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf(`{"CurrentTime": %d, "ExpiredItemsDeleted": %d}`, now.Unix(), deleted)))
+}
+
 type SnapshotInput struct {
 	SnapshotName string `json:"SnapshotName"`
+	TableNames []string `json:"TableNames,omitempty"`
 }
 
 func (s *Server) handleCreateSnapshot(w http.ResponseWriter, body []byte) {
@@ -132,8 +428,8 @@ func (s *Server) handleCreateSnapshot(w http.ResponseWriter, body []byte) {
 		return
 	}
 
-	if err := s.Database.CreateSnapshot(input.SnapshotName); err != nil {
-		s.writeDynamoDBError(w, "InternalServerError", fmt.Sprintf("Failed to create snapshot: %v", err), http.StatusInternalServerError)
+	if err := s.Database.CreateSnapshot(input.SnapshotName, input.TableNames...); err != nil {
+		s.writeSnapshotError(w, err)
 		return
 	}
 
@@ -149,7 +445,7 @@ func (s *Server) handleLoadSnapshot(w http.ResponseWriter, body []byte) {
 	}
 
 	if err := s.Database.LoadSnapshot(input.SnapshotName); err != nil {
-		s.writeDynamoDBError(w, "ResourceNotFoundException", fmt.Sprintf("Failed to load snapshot: %v", err), http.StatusBadRequest)
+		s.writeSnapshotError(w, err)
 		return
 	}
 
@@ -24,7 +24,7 @@ func NewServer(db *core.Database) *Server {
 
 func (s *Server) registerRoutes() {
 	
-	s.Mux.HandleFunc("/dynamodb", func(w http.ResponseWriter, r *http.Request) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
 		target := r.Header.Get("X-Amz-Target")
 		
 		if target == "" {
@@ -45,6 +45,15 @@ func (s *Server) registerRoutes() {
 		}
 		operation := parts[1]
 
+		if s.injectFault(w, operation, body) {
+			return
+		}
+
+		if parts[0] == "DynamoDBStreams_20120810" {
+			s.routeStreamsOperation(w, operation, body)
+			return
+		}
+
 		switch operation {
 		case "CreateTable":
 			s.handleCreateTable(w, body)
@@ -52,10 +61,16 @@ func (s *Server) registerRoutes() {
 			s.handleListTables(w)
 		case "DeleteTable":
 			s.handleDeleteTable(w, body)
+		case "UpdateTable":
+			s.handleUpdateTable(w, body)
 		case "PutItem":
 			s.handlePutItem(w, body)
 		case "GetItem":
 			s.handleGetItem(w, body)
+		case "BatchGetItem":
+			s.handleBatchGetItem(w, body)
+		case "TransactGetItems":
+			s.handleTransactGetItems(w, body)
 		case "Query":
 			s.handleQuery(w, body)
 		case "Scan":
@@ -68,16 +83,103 @@ func (s *Server) registerRoutes() {
 			s.handleBatchWriteItem(w, body)
 		case "TransactWriteItems":
 			s.handleTransactWriteItems(w, body)
+		case "ExecuteStatement":
+			s.handleExecuteStatement(w, body)
+		case "BatchExecuteStatement":
+			s.handleBatchExecuteStatement(w, body)
+		case "ExecuteTransaction":
+			s.handleExecuteTransaction(w, body)
+		case "CreateBackup":
+			s.handleCreateBackup(w, body)
+		case "DescribeBackup":
+			s.handleDescribeBackup(w, body)
+		case "ListBackups":
+			s.handleListBackups(w, body)
+		case "DeleteBackup":
+			s.handleDeleteBackup(w, body)
+		case "RestoreTableFromBackup":
+			s.handleRestoreTableFromBackup(w, body)
+		case "UpdateContinuousBackups":
+			s.handleUpdateContinuousBackups(w, body)
+		case "DescribeContinuousBackups":
+			s.handleDescribeContinuousBackups(w, body)
+		case "RestoreTableToPointInTime":
+			s.handleRestoreTableToPointInTime(w, body)
+		case "ExportTableToPointInTime":
+			s.handleExportTableToPointInTime(w, body)
+		case "DescribeExport":
+			s.handleDescribeExport(w, body)
+		case "ListExports":
+			s.handleListExports(w, body)
+		case "ImportTable":
+			s.handleImportTable(w, body)
+		case "DescribeImport":
+			s.handleDescribeImport(w, body)
+		case "ListImports":
+			s.handleListImports(w, body)
+		case "UpdateTimeToLive":
+			s.handleUpdateTimeToLive(w, body)
+		case "DescribeTimeToLive":
+			s.handleDescribeTimeToLive(w, body)
 		case "CreateSnapshot":
 			s.handleCreateSnapshot(w, body)
 		case "LoadSnapshot":
 			s.handleLoadSnapshot(w, body)
+		case "ListSnapshots":
+			s.handleListSnapshots(w)
+		case "DescribeSnapshot":
+			s.handleDescribeSnapshot(w, body)
+		case "DeleteSnapshot":
+			s.handleDeleteSnapshot(w, body)
+		case "ExportSnapshot":
+			s.handleExportSnapshot(w, body)
+		case "ImportSnapshot":
+			s.handleImportSnapshot(w, body)
+		case "RestoreTablesFromSnapshot":
+			s.handleRestoreTablesFromSnapshot(w, body)
 		case "DeleteAllData":
 			s.handleDeleteAllData(w)
+		case "AdvanceClock":
+			s.handleAdvanceClock(w, body)
+		case "CreateStreamTrigger":
+			s.handleCreateStreamTrigger(w, body)
+		case "DeleteStreamTrigger":
+			s.handleDeleteStreamTrigger(w, body)
+		case "ListStreamTriggers":
+			s.handleListStreamTriggers(w)
+		case "CreateFaultRule":
+			s.handleCreateFaultRule(w, body)
+		case "DeleteFaultRule":
+			s.handleDeleteFaultRule(w, body)
+		case "ListFaultRules":
+			s.handleListFaultRules(w)
+		case "DescribeCapacityUsage":
+			s.handleDescribeCapacityUsage(w, body)
+		case "DescribePartitions":
+			s.handleDescribePartitions(w, body)
 		default:
 			s.writeDynamoDBError(w, "UnknownOperationException", "The requested operation is not supported.", http.StatusBadRequest)
 		}
-	})
+	}
+
+	s.Mux.HandleFunc("/dynamodb", handler)
+	// AWS SDKs and the CLI post to the root of the endpoint.
+	s.Mux.HandleFunc("/", handler)
+}
+
+func (s *Server) routeStreamsOperation(w http.ResponseWriter, operation string, body []byte) {
+	switch operation {
+	case "ListStreams":
+		s.handleListStreams(w, body)
+	case "DescribeStream":
+		s.handleDescribeStream(w, body)
+	case "GetShardIterator":
+		s.handleGetShardIterator(w, body)
+	case "GetRecords":
+		s.handleGetRecords(w, body)
+	default:
+		s.writeDynamoDBError(w, "UnknownOperationException", "The requested operation is not supported.", http.StatusBadRequest)
+	}
 }
 
 func (s *Server) writeDynamoDBError(w http.ResponseWriter, code, message string, status int) {
@@ -0,0 +1,339 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	backupMetaPrefix = "__BACKUP__" + model.KeySeparator
+	backupItemPrefix = "__BACKUPITEM__" + model.KeySeparator
+
+	backupCopyBatchSize = 1000
+)
+
+var (
+	ErrTableNotFound = errors.New("table not found")
+	ErrTableAlreadyExists = errors.New("table already exists")
+	ErrBackupNotFound = errors.New("backup not found")
+	ErrBackupInUse = errors.New("backup in use")
+)
+
+type RestoreOptions struct {
+	GSIOverride map[string]model.GsiSchema
+	LSIOverride map[string]model.GsiSchema
+}
+
+func TableArn(tableName string) string {
+	return fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s", StreamRegion, StreamAccountID, tableName)
+}
+
+func buildBackupItemPrefix(backupArn string) string {
+	return backupItemPrefix + backupArn + model.KeySeparator
+}
+
+func (d *Database) CreateBackup(tableName string, backupName string) (model.BackupDescriptor, error) {
+	if backupName == "" {
+		return model.BackupDescriptor{}, fmt.Errorf("BackupName must be specified")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return model.BackupDescriptor{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	now := d.Now()
+	descriptor := model.BackupDescriptor{
+		BackupArn: fmt.Sprintf("%s/backup/%014d-%08x", TableArn(tableName), now.UnixMilli(), rand.Uint32()),
+		BackupName: backupName,
+		BackupStatus: model.BackupStatusCreating,
+		BackupType: model.BackupTypeUser,
+		CreationTime: now,
+		TableName: tableName,
+		TableArn: TableArn(tableName),
+		Schema: schema,
+	}
+
+	// The descriptor goes first so that items copied before a failure always
+	// belong to a listed backup, which DeleteBackup can remove.
+	batch := new(Batch)
+	if err := d.putBackupDescriptor(batch, descriptor); err != nil {
+		return model.BackupDescriptor{}, err
+	}
+	if err := d.DB.Write(batch); err != nil {
+		return model.BackupDescriptor{}, fmt.Errorf("failed to write backup: %w", err)
+	}
+	batch.Reset()
+
+	if err := d.copyBackupItems(&descriptor, batch); err != nil {
+		if cleanupErr := d.deleteBackupData(descriptor.BackupArn); cleanupErr != nil {
+			log.Printf("Failed to remove partial backup %s: %v", descriptor.BackupArn, cleanupErr)
+		}
+		return model.BackupDescriptor{}, err
+	}
+
+	descriptor.BackupStatus = model.BackupStatusAvailable
+	if err := d.putBackupDescriptor(batch, descriptor); err != nil {
+		return model.BackupDescriptor{}, err
+	}
+	if err := d.DB.Write(batch); err != nil {
+		return model.BackupDescriptor{}, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return descriptor, nil
+}
+
+// copyBackupItems copies the items of the backed up table under the backup's
+// item prefix, counting them into descriptor. The last chunk is left in batch.
+func (d *Database) copyBackupItems(descriptor *model.BackupDescriptor, batch *Batch) error {
+	itemPrefix := buildBackupItemPrefix(descriptor.BackupArn)
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(descriptor.TableName+model.KeySeparator)))
+	defer iter.Release()
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			continue
+		}
+		batch.Put([]byte(itemPrefix+string(iter.Key())), append([]byte(nil), iter.Value()...))
+		descriptor.ItemCount++
+		descriptor.SizeBytes += int64(ItemSize(record))
+
+		if batch.Len() >= backupCopyBatchSize {
+			if err := d.DB.Write(batch); err != nil {
+				return fmt.Errorf("failed to write backup items: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	return iter.Error()
+}
+
+func (d *Database) DescribeBackup(backupArn string) (model.BackupDescriptor, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.getBackupDescriptor(backupArn)
+}
+
+func (d *Database) ListBackups(tableName string, lowerBound, upperBound time.Time, exclusiveStartArn string, limit int) ([]model.BackupDescriptor, string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var backups []model.BackupDescriptor
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(backupMetaPrefix)))
+	for iter.Next() {
+		var descriptor model.BackupDescriptor
+		if err := json.Unmarshal(iter.Value(), &descriptor); err != nil {
+			continue
+		}
+		if tableName != "" && descriptor.TableName != tableName {
+			continue
+		}
+		if !lowerBound.IsZero() && descriptor.CreationTime.Before(lowerBound) {
+			continue
+		}
+		if !upperBound.IsZero() && !descriptor.CreationTime.Before(upperBound) {
+			continue
+		}
+		backups = append(backups, descriptor)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, "", err
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].CreationTime.Equal(backups[j].CreationTime) {
+			return backups[i].BackupArn < backups[j].BackupArn
+		}
+		return backups[i].CreationTime.Before(backups[j].CreationTime)
+	})
+
+	if exclusiveStartArn != "" {
+		for i, backup := range backups {
+			if backup.BackupArn == exclusiveStartArn {
+				backups = backups[i+1:]
+				break
+			}
+		}
+	}
+
+	lastEvaluated := ""
+	if limit > 0 && len(backups) > limit {
+		backups = backups[:limit]
+		lastEvaluated = backups[limit-1].BackupArn
+	}
+	return backups, lastEvaluated, nil
+}
+
+func (d *Database) DeleteBackup(backupArn string) (model.BackupDescriptor, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	descriptor, err := d.getBackupDescriptor(backupArn)
+	if err != nil {
+		return model.BackupDescriptor{}, err
+	}
+
+	if err := d.deleteBackupData(backupArn); err != nil {
+		return model.BackupDescriptor{}, err
+	}
+
+	descriptor.BackupStatus = model.BackupStatusDeleted
+	return descriptor, nil
+}
+
+func (d *Database) deleteBackupData(backupArn string) error {
+	batch := new(Batch)
+	iter := d.DB.NewIterator(PrefixRange([]byte(buildBackupItemPrefix(backupArn))))
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch.Delete([]byte(backupMetaPrefix + backupArn))
+	if err := d.DB.Write(batch); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) RestoreTableFromBackup(backupArn string, targetTableName string, opts RestoreOptions) (model.TableSchema, error) {
+	if targetTableName == "" {
+		return model.TableSchema{}, fmt.Errorf("TargetTableName must be specified")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	descriptor, err := d.getBackupDescriptor(backupArn)
+	if err != nil {
+		return model.TableSchema{}, err
+	}
+	if descriptor.BackupStatus != model.BackupStatusAvailable {
+		return model.TableSchema{}, fmt.Errorf("%w: %s is %s", ErrBackupInUse, backupArn, descriptor.BackupStatus)
+	}
+	if _, exists := d.Tables[targetTableName]; exists {
+		return model.TableSchema{}, fmt.Errorf("%w: %s", ErrTableAlreadyExists, targetTableName)
+	}
+
+	schema, err := restoredSchema(descriptor.Schema, targetTableName, opts)
+	if err != nil {
+		return model.TableSchema{}, err
+	}
+
+	if err := d.restoreItems(schema, buildBackupItemPrefix(backupArn)); err != nil {
+		return model.TableSchema{}, err
+	}
+
+	if err := d.putTableSchema(schema); err != nil {
+		return model.TableSchema{}, err
+	}
+	return schema, nil
+}
+
+func restoredSchema(source model.TableSchema, targetTableName string, opts RestoreOptions) (model.TableSchema, error) {
+	schema := model.TableSchema{
+		TableName: targetTableName,
+		PartitionKey: source.PartitionKey,
+		SortKey: source.SortKey,
+		GSIs: source.GSIs,
+		LSIs: source.LSIs,
+		TTLAttribute: source.TTLAttribute,
+		BillingMode: source.BillingMode,
+		ProvisionedThroughput: source.ProvisionedThroughput,
+	}
+
+	if opts.GSIOverride != nil {
+		// Overridden indexes have no throughput of their own, so on a
+		// provisioned table they take the table's.
+		schema.GSIs = make(map[string]model.GsiSchema, len(opts.GSIOverride))
+		for name, gsi := range opts.GSIOverride {
+			if schema.BillingMode == model.BillingModeProvisioned && gsi.ProvisionedThroughput == (model.ProvisionedThroughput{}) {
+				gsi.ProvisionedThroughput = schema.ProvisionedThroughput
+			}
+			schema.GSIs[name] = gsi
+		}
+	}
+	if opts.LSIOverride != nil {
+		for name, lsi := range opts.LSIOverride {
+			if lsi.PartitionKey != schema.PartitionKey || lsi.SortKey == "" {
+				return model.TableSchema{}, fmt.Errorf("Local secondary index %s must use the table partition key and a sort key", name)
+			}
+		}
+		schema.LSIs = opts.LSIOverride
+	}
+	if schema.GSIs == nil {
+		schema.GSIs = make(map[string]model.GsiSchema)
+	}
+	if err := ValidateThroughput(schema); err != nil {
+		return model.TableSchema{}, err
+	}
+	return schema, nil
+}
+
+func (d *Database) restoreItems(schema model.TableSchema, prefix string) error {
+	writer := newRestoreWriter(d, schema)
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(prefix)))
+	defer iter.Release()
+
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			return fmt.Errorf("failed to decode backup item: %w", err)
+		}
+		if err := writer.add(record); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return writer.flush()
+}
+
+func (d *Database) putBackupDescriptor(batch *Batch, descriptor model.BackupDescriptor) error {
+	value, err := json.Marshal(descriptor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup descriptor: %w", err)
+	}
+	batch.Put([]byte(backupMetaPrefix+descriptor.BackupArn), value)
+	return nil
+}
+
+func (d *Database) getBackupDescriptor(backupArn string) (model.BackupDescriptor, error) {
+	if !strings.Contains(backupArn, "/backup/") {
+		return model.BackupDescriptor{}, fmt.Errorf("%w: %s", ErrBackupNotFound, backupArn)
+	}
+
+	value, err := d.DB.Get([]byte(backupMetaPrefix+backupArn))
+	if err == ErrNotFound {
+		return model.BackupDescriptor{}, fmt.Errorf("%w: %s", ErrBackupNotFound, backupArn)
+	}
+	if err != nil {
+		return model.BackupDescriptor{}, err
+	}
+
+	var descriptor model.BackupDescriptor
+	if err := json.Unmarshal(value, &descriptor); err != nil {
+		return model.BackupDescriptor{}, fmt.Errorf("failed to unmarshal backup descriptor: %w", err)
+	}
+	return descriptor, nil
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func TestRestoreKeepsTableSettings(t *testing.T) {
+	db, err := NewDatabase(DatabaseOptions{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	throughput := model.ProvisionedThroughput{ReadCapacityUnits: 5, WriteCapacityUnits: 3}
+	source := model.TableSchema{
+		TableName: "Source",
+		PartitionKey: "pk",
+		SortKey: "sk",
+		GSIs: map[string]model.GsiSchema{
+			"ByN": {IndexName: "ByN", PartitionKey: "n", ProvisionedThroughput: model.ProvisionedThroughput{ReadCapacityUnits: 2, WriteCapacityUnits: 1}, Projection: model.Projection{ProjectionType: "ALL"}},
+		},
+		LSIs: map[string]model.GsiSchema{},
+		BillingMode: model.BillingModeProvisioned,
+		ProvisionedThroughput: throughput,
+	}
+	if err := db.CreateTable(source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateTimeToLive("Source", "expires", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateContinuousBackups("Source", true, 0); err != nil {
+		t.Fatal(err)
+	}
+	source = db.Tables["Source"]
+
+	backup, err := db.CreateBackup("Source", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restores := map[string]func(target string, opts RestoreOptions) (model.TableSchema, error){
+		"backup": func(target string, opts RestoreOptions) (model.TableSchema, error) {
+			return db.RestoreTableFromBackup(backup.BackupArn, target, opts)
+		},
+		"point in time": func(target string, opts RestoreOptions) (model.TableSchema, error) {
+			return db.RestoreTableToPointInTime("Source", target, time.Time{}, true, opts)
+		},
+	}
+
+	for name, restore := range restores {
+		t.Run(name, func(t *testing.T) {
+			target := "Restored " + name
+			restored, err := restore(target, RestoreOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(db.Tables[target], restored) {
+				t.Errorf("stored schema %+v differs from the returned %+v", db.Tables[target], restored)
+			}
+
+			want := source
+			want.TableName = target
+			want.PITREnabled, want.PITREnabledAt, want.PITRRecoveryPeriodDays = false, 0, 0
+			if !reflect.DeepEqual(restored, want) {
+				t.Errorf("got %+v, want %+v", restored, want)
+			}
+			if err := ValidateThroughput(restored); err != nil {
+				t.Error(err)
+			}
+
+			override := map[string]model.GsiSchema{
+				"ByS": {IndexName: "ByS", PartitionKey: "s", Projection: model.Projection{ProjectionType: "KEYS_ONLY"}},
+			}
+			restored, err = restore(target+" with override", RestoreOptions{GSIOverride: override})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := restored.GSIs["ByS"].ProvisionedThroughput; got != throughput {
+				t.Errorf("overridden index got throughput %+v, want %+v", got, throughput)
+			}
+			if len(restored.GSIs) != 1 || restored.BillingMode != model.BillingModeProvisioned {
+				t.Errorf("got %+v", restored)
+			}
+		})
+	}
+}
@@ -0,0 +1,670 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	readUnitBytes = 4096
+	writeUnitBytes = 1024
+
+	defaultBurstSeconds = 300
+
+	// A new on-demand table serves up to 12,000 reads and 4,000 writes per
+	// second, i.e. twice a previous peak of half that.
+	onDemandInitialReadPeak = 6000
+	onDemandInitialWritePeak = 2000
+	// On-demand capacity only grows to twice a new peak once that peak is
+	// this old.
+	onDemandPeakDelay = 30 * time.Minute
+)
+
+// CapacityConfig controls throttling. Consumed capacity is tracked whether or
+// not Throttle is set.
+type CapacityConfig struct {
+	Throttle bool
+	// BurstSeconds is how many seconds of unused provisioned capacity a table
+	// or index can bank; zero means DynamoDB's 300.
+	BurstSeconds float64
+
+	// Partitions hashes partition keys into simulated physical partitions
+	// limited to 3000 read and 1000 write units per second each.
+	Partitions bool
+	// PartitionSplitBytes is the size past which a partition splits; zero
+	// means 10 GB.
+	PartitionSplitBytes int64
+	// HeatSplitAfter is how long a partition must stay hot before it splits;
+	// zero means 10 minutes.
+	HeatSplitAfter time.Duration
+}
+
+// ThroughputExceededError is returned when a table or one of its indexes has
+// run out of capacity.
+type ThroughputExceededError struct {
+	TableName string
+	IndexName string
+	OnDemand bool
+}
+
+func (e *ThroughputExceededError) Error() string {
+	switch {
+	case e.OnDemand:
+		return "Throughput exceeds the current capacity of your table or index. DynamoDB is automatically scaling your table or index so please try again shortly. If exceptions persist, check if you have a hot key: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/bp-partition-key-design.html"
+	case e.IndexName != "":
+		return "The level of configured provisioned throughput for one or more global secondary indexes of the table was exceeded. Consider increasing your provisioning level for the under-provisioned global secondary indexes with the UpdateTable API"
+	default:
+		return "The level of configured provisioned throughput for the table was exceeded. Consider increasing your provisioning level with the UpdateTable API."
+	}
+}
+
+// CapacityUsage summarizes what a table or index has consumed so far.
+type CapacityUsage struct {
+	IndexName string `json:"IndexName,omitempty"`
+	ConsumedReadCapacityUnits float64 `json:"ConsumedReadCapacityUnits"`
+	ConsumedWriteCapacityUnits float64 `json:"ConsumedWriteCapacityUnits"`
+	PeakReadCapacityUnitsPerSecond float64 `json:"PeakReadCapacityUnitsPerSecond"`
+	PeakWriteCapacityUnitsPerSecond float64 `json:"PeakWriteCapacityUnitsPerSecond"`
+	ThrottledReadRequests int `json:"ThrottledReadRequests"`
+	ThrottledWriteRequests int `json:"ThrottledWriteRequests"`
+}
+
+type capacityKey struct {
+	tableName string
+	indexName string
+}
+
+type capacityTracker struct {
+	read throughputMeter
+	write throughputMeter
+}
+
+// throughputMeter is a token bucket for provisioned capacity and a per-second
+// window for on-demand capacity.
+type throughputMeter struct {
+	tokens float64
+	refilledAt time.Time
+
+	second time.Time
+	secondUnits float64
+	peak float64
+	pendingPeak float64
+	pendingSince time.Time
+
+	consumed float64
+	maxPerSecond float64
+	throttled int
+}
+
+func (m *throughputMeter) roll(now time.Time) {
+	second := now.Truncate(time.Second)
+	if second.Equal(m.second) {
+		return
+	}
+	if m.secondUnits > m.maxPerSecond {
+		m.maxPerSecond = m.secondUnits
+	}
+	if m.secondUnits > m.peak && m.secondUnits > m.pendingPeak {
+		if m.pendingPeak == 0 {
+			m.pendingSince = m.second
+		}
+		m.pendingPeak = m.secondUnits
+	}
+	if m.pendingPeak > 0 && now.Sub(m.pendingSince) >= onDemandPeakDelay {
+		m.peak = math.Max(m.peak, m.pendingPeak)
+		m.pendingPeak = 0
+	}
+	m.second = second
+	m.secondUnits = 0
+}
+
+func (m *throughputMeter) refill(now time.Time, rate, burstSeconds float64) {
+	if m.refilledAt.IsZero() {
+		m.tokens = rate
+	} else if elapsed := now.Sub(m.refilledAt).Seconds(); elapsed > 0 {
+		m.tokens += elapsed * rate
+	}
+	m.tokens = math.Min(m.tokens, rate*math.Max(burstSeconds, 1))
+	m.refilledAt = now
+}
+
+// allow reports whether a request may start, given pending units staged but
+// not yet consumed. Provisioned capacity may be overdrawn by the request that
+// empties it, as in DynamoDB, and later requests wait for the bucket to
+// refill.
+func (m *throughputMeter) allow(now time.Time, provisioned bool, rate, initialPeak, burstSeconds, pending float64) bool {
+	m.roll(now)
+	if provisioned {
+		m.refill(now, rate, burstSeconds)
+		return m.tokens-pending > 0
+	}
+	return m.secondUnits+pending < 2*math.Max(m.peak, initialPeak)
+}
+
+func (m *throughputMeter) consume(now time.Time, provisioned bool, rate, burstSeconds, units float64) {
+	m.roll(now)
+	if provisioned {
+		m.refill(now, rate, burstSeconds)
+		m.tokens -= units
+	}
+	m.secondUnits += units
+	m.consumed += units
+}
+
+func (m *throughputMeter) usage() (consumed, peak float64, throttled int) {
+	return m.consumed, math.Max(m.maxPerSecond, m.secondUnits), m.throttled
+}
+
+// ReadCapacityUnits is what reading size bytes costs: one unit per started
+// 4 KB for a strongly consistent read, half that for an eventually consistent
+// one and twice that inside a transaction.
+func ReadCapacityUnits(size int, consistent bool, transactional bool) float64 {
+	units := math.Max(1, math.Ceil(float64(size)/readUnitBytes))
+	switch {
+	case transactional:
+		return 2 * units
+	case !consistent:
+		return units / 2
+	}
+	return units
+}
+
+// WriteCapacityUnits is what writing size bytes costs: one unit per started
+// 1 KB, twice that inside a transaction.
+func WriteCapacityUnits(size int, transactional bool) float64 {
+	units := math.Max(1, math.Ceil(float64(size)/writeUnitBytes))
+	if transactional {
+		return 2 * units
+	}
+	return units
+}
+
+// ValidateThroughput checks that a table and its global secondary indexes
+// carry provisioned throughput exactly when the table is provisioned.
+func ValidateThroughput(schema model.TableSchema) error {
+	switch schema.BillingMode {
+	case "", model.BillingModePayPerRequest:
+		if schema.ProvisionedThroughput != (model.ProvisionedThroughput{}) {
+			return fmt.Errorf("One or more parameter values were invalid: Neither ReadCapacityUnits nor WriteCapacityUnits can be specified when BillingMode is PAY_PER_REQUEST")
+		}
+		for _, gsi := range schema.GSIs {
+			if gsi.ProvisionedThroughput != (model.ProvisionedThroughput{}) {
+				return fmt.Errorf("One or more parameter values were invalid: ProvisionedThroughput should not be specified for index: %s when BillingMode is PAY_PER_REQUEST", gsi.IndexName)
+			}
+		}
+	case model.BillingModeProvisioned:
+		if err := validateProvisionedThroughput(schema.ProvisionedThroughput); err != nil {
+			return err
+		}
+		for _, gsi := range schema.GSIs {
+			if gsi.ProvisionedThroughput == (model.ProvisionedThroughput{}) {
+				return fmt.Errorf("One or more parameter values were invalid: ProvisionedThroughput must be specified for index: %s", gsi.IndexName)
+			}
+			if err := validateProvisionedThroughput(gsi.ProvisionedThroughput); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("1 validation error detected: Value '%s' at 'billingMode' failed to satisfy constraint: Member must satisfy enum value set: [PROVISIONED, PAY_PER_REQUEST]", schema.BillingMode)
+	}
+	return nil
+}
+
+func validateProvisionedThroughput(throughput model.ProvisionedThroughput) error {
+	if throughput.ReadCapacityUnits < 1 || throughput.WriteCapacityUnits < 1 {
+		return fmt.Errorf("One or more parameter values were invalid: ReadCapacityUnits and WriteCapacityUnits must both be specified and at least 1 when BillingMode is PROVISIONED")
+	}
+	return nil
+}
+
+// UpdateTableThroughput changes the billing mode and provisioned throughput of
+// a table and its global secondary indexes. An empty billingMode keeps the
+// current one.
+func (d *Database) UpdateTableThroughput(tableName string, billingMode string, throughput *model.ProvisionedThroughput, gsiThroughput map[string]model.ProvisionedThroughput) (model.TableSchema, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return model.TableSchema{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	updated := schema
+	updated.GSIs = make(map[string]model.GsiSchema, len(schema.GSIs))
+	for name, gsi := range schema.GSIs {
+		updated.GSIs[name] = gsi
+	}
+
+	if billingMode != "" && billingMode != schema.EffectiveBillingMode() {
+		updated.BillingMode = billingMode
+		if billingMode == model.BillingModePayPerRequest {
+			updated.ProvisionedThroughput = model.ProvisionedThroughput{}
+			for name, gsi := range updated.GSIs {
+				gsi.ProvisionedThroughput = model.ProvisionedThroughput{}
+				updated.GSIs[name] = gsi
+			}
+		}
+	}
+	if throughput != nil {
+		updated.ProvisionedThroughput = *throughput
+	}
+	for indexName, indexThroughput := range gsiThroughput {
+		gsi, ok := updated.GSIs[indexName]
+		if !ok {
+			return model.TableSchema{}, fmt.Errorf("Requested resource not found: Index %s does not exist on table %s", indexName, tableName)
+		}
+		gsi.ProvisionedThroughput = indexThroughput
+		updated.GSIs[indexName] = gsi
+	}
+
+	if err := ValidateThroughput(updated); err != nil {
+		return model.TableSchema{}, err
+	}
+	if err := d.putTableSchema(updated); err != nil {
+		return model.TableSchema{}, err
+	}
+	return updated, nil
+}
+
+func (d *Database) SetCapacityConfig(cfg CapacityConfig) {
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+	d.Capacity = cfg
+}
+
+// CheckReadCapacity fails with a *ThroughputExceededError when a read from
+// the table, or from indexName, would be throttled. pk is the partition key
+// read, or empty for reads spanning partitions.
+func (d *Database) CheckReadCapacity(schema model.TableSchema, indexName string, pk string) error {
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+	if err := d.checkCapacity(schema, capacityIndex(schema, indexName), false, 0); err != nil {
+		return err
+	}
+	return d.checkPartition(schema, capacityIndex(schema, indexName), pk, false, 0)
+}
+
+// ChargeRead records a read of size bytes from the table, or from indexName,
+// and returns what it consumed.
+func (d *Database) ChargeRead(schema model.TableSchema, indexName string, pk string, size int, consistent bool) *model.ConsumedCapacity {
+	return d.chargeRead(schema, indexName, pk, ReadCapacityUnits(size, consistent, false))
+}
+
+// ChargeTransactionalRead records a read of size bytes from the table inside
+// TransactGetItems.
+func (d *Database) ChargeTransactionalRead(schema model.TableSchema, pk string, size int) *model.ConsumedCapacity {
+	return d.chargeRead(schema, "", pk, ReadCapacityUnits(size, true, true))
+}
+
+func (d *Database) chargeRead(schema model.TableSchema, indexName string, pk string, units float64) *model.ConsumedCapacity {
+	consumed := &model.ConsumedCapacity{TableName: schema.TableName}
+	_, local := schema.LSIs[indexName]
+	consumed.Add(indexName, local, units, 0)
+
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+	d.consumeCapacity(schema, capacityIndex(schema, indexName), false, units)
+	d.consumePartition(schema, capacityIndex(schema, indexName), pk, false, units, 0)
+	return consumed
+}
+
+// CapacityUsage reports what the table and each of its global secondary
+// indexes have consumed since the table was created or the emulator started.
+func (d *Database) CapacityUsage(tableName string) (CapacityUsage, []CapacityUsage, error) {
+	d.mu.RLock()
+	schema, ok := d.Tables[tableName]
+	d.mu.RUnlock()
+	if !ok {
+		return CapacityUsage{}, nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+
+	now := d.Clock.Now()
+	usage := func(indexName string) CapacityUsage {
+		u := CapacityUsage{IndexName: indexName}
+		tracker := d.capacityTrackers[capacityKey{tableName, indexName}]
+		if tracker == nil {
+			return u
+		}
+		tracker.read.roll(now)
+		tracker.write.roll(now)
+		u.ConsumedReadCapacityUnits, u.PeakReadCapacityUnitsPerSecond, u.ThrottledReadRequests = tracker.read.usage()
+		u.ConsumedWriteCapacityUnits, u.PeakWriteCapacityUnitsPerSecond, u.ThrottledWriteRequests = tracker.write.usage()
+		return u
+	}
+
+	indexNames := make([]string, 0, len(schema.GSIs))
+	for name := range schema.GSIs {
+		indexNames = append(indexNames, name)
+	}
+	sort.Strings(indexNames)
+
+	indexes := make([]CapacityUsage, 0, len(indexNames))
+	for _, name := range indexNames {
+		indexes = append(indexes, usage(name))
+	}
+	return usage(""), indexes, nil
+}
+
+// stageWriteCapacity works out what an item change costs the table and its
+// indexes, adds it to the batch and refuses the change when the table, an
+// affected global secondary index or one of their partitions is out of
+// capacity.
+func (d *Database) stageWriteCapacity(batch *Batch, schema model.TableSchema, oldRecord model.Record, newRecord model.Record) error {
+	if batch.operation == "" {
+		return nil
+	}
+	if batch.operation == OpTimeToLive {
+		// Expiring items costs nothing, but frees space in their partitions.
+		d.capacityMu.Lock()
+		defer d.capacityMu.Unlock()
+		if d.Capacity.Partitions {
+			var charges []capacityCharge
+			for indexName := range schema.GSIs {
+				charges = append(charges, capacityCharge{indexName: indexName})
+			}
+			staged := batch.stagedCapacity(schema)
+			staged.partitions = append(staged.partitions, partitionWriteCharges(schema, oldRecord, newRecord, charges)...)
+		}
+		return nil
+	}
+	transactional := batch.operation == OpTransactWriteItems || batch.operation == OpExecuteTransaction
+
+	size := int(math.Max(float64(ItemSize(oldRecord)), float64(ItemSize(newRecord))))
+	charges := []capacityCharge{{units: WriteCapacityUnits(size, transactional)}}
+	for _, indexes := range []map[string]model.GsiSchema{schema.GSIs, schema.LSIs} {
+		for _, index := range indexes {
+			if units := indexWriteUnits(index, oldRecord, newRecord, transactional); units > 0 {
+				_, local := schema.LSIs[index.IndexName]
+				charges = append(charges, capacityCharge{indexName: index.IndexName, local: local, units: units})
+			}
+		}
+	}
+
+	partitions := partitionWriteCharges(schema, oldRecord, newRecord, charges)
+
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+
+	// Each item of a BatchWriteItem is a request of its own, so what the
+	// earlier items staged counts against the later ones.
+	var pending *stagedCapacity
+	if batch.operation == OpBatchWriteItem {
+		pending = batch.capacity[schema.TableName]
+	}
+	for _, charge := range charges {
+		index := capacityIndex(schema, charge.indexName)
+		if err := d.checkCapacity(schema, index, true, pending.writeUnits(index)); err != nil {
+			return err
+		}
+	}
+	for _, charge := range partitions {
+		if err := d.checkPartition(schema, charge.indexName, charge.pk, true, pending.partitionWriteUnits(charge.indexName, charge.pk)); err != nil {
+			return err
+		}
+	}
+
+	staged := batch.stagedCapacity(schema)
+	for _, charge := range charges {
+		staged.consumed.Add(charge.indexName, charge.local, 0, charge.units)
+	}
+	staged.partitions = append(staged.partitions, partitions...)
+	return nil
+}
+
+type stagedCapacity struct {
+	schema model.TableSchema
+	consumed *model.ConsumedCapacity
+	partitions []partitionCharge
+}
+
+// writeUnits is what has been staged against the write capacity of indexName,
+// as mapped by capacityIndex. A nil stagedCapacity has staged nothing.
+func (s *stagedCapacity) writeUnits(indexName string) float64 {
+	if s == nil {
+		return 0
+	}
+	if indexName != "" {
+		if c := s.consumed.GlobalSecondaryIndexes[indexName]; c != nil {
+			return c.WriteCapacityUnits
+		}
+		return 0
+	}
+	var units float64
+	if s.consumed.Table != nil {
+		units += s.consumed.Table.WriteCapacityUnits
+	}
+	for _, c := range s.consumed.LocalSecondaryIndexes {
+		units += c.WriteCapacityUnits
+	}
+	return units
+}
+
+func (s *stagedCapacity) partitionWriteUnits(indexName string, pk string) float64 {
+	if s == nil {
+		return 0
+	}
+	var units float64
+	for _, charge := range s.partitions {
+		if charge.indexName == indexName && charge.pk == pk {
+			units += charge.units
+		}
+	}
+	return units
+}
+
+func (b *Batch) stagedCapacity(schema model.TableSchema) *stagedCapacity {
+	staged := b.capacity[schema.TableName]
+	if staged == nil {
+		if b.capacity == nil {
+			b.capacity = make(map[string]*stagedCapacity)
+		}
+		staged = &stagedCapacity{schema: schema, consumed: &model.ConsumedCapacity{TableName: schema.TableName}}
+		b.capacity[schema.TableName] = staged
+	}
+	return staged
+}
+
+type capacityCharge struct {
+	indexName string
+	local bool
+	units float64
+}
+
+// indexWriteUnits is what an item change costs one index: nothing when the
+// item is in the index neither before nor after, a delete and a put when its
+// index key changes, and a single write otherwise.
+func indexWriteUnits(index model.GsiSchema, oldRecord model.Record, newRecord model.Record, transactional bool) float64 {
+	oldPK, oldSK, oldExists := getGSIKeyValues(oldRecord, index)
+	newPK, newSK, newExists := getGSIKeyValues(newRecord, index)
+
+	switch {
+	case oldExists && newExists && (oldPK != newPK || oldSK != newSK):
+		return WriteCapacityUnits(ItemSize(oldRecord), transactional) + WriteCapacityUnits(ItemSize(newRecord), transactional)
+	case newExists:
+		return WriteCapacityUnits(ItemSize(newRecord), transactional)
+	case oldExists:
+		return WriteCapacityUnits(ItemSize(oldRecord), transactional)
+	}
+	return 0
+}
+
+// chargeBatchCapacity consumes what a written batch staged.
+func (d *Database) chargeBatchCapacity(batch *Batch) {
+	if len(batch.capacity) == 0 {
+		return
+	}
+
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+
+	for _, staged := range batch.capacity {
+		consumed := staged.consumed
+		if consumed.Table != nil {
+			d.consumeCapacity(staged.schema, "", true, consumed.Table.WriteCapacityUnits)
+		}
+		for indexName, c := range consumed.GlobalSecondaryIndexes {
+			d.consumeCapacity(staged.schema, indexName, true, c.WriteCapacityUnits)
+		}
+		// Local secondary indexes share the table's capacity.
+		for _, c := range consumed.LocalSecondaryIndexes {
+			d.consumeCapacity(staged.schema, "", true, c.WriteCapacityUnits)
+		}
+		for _, charge := range staged.partitions {
+			d.consumePartition(staged.schema, charge.indexName, charge.pk, true, charge.units, charge.sizeDelta)
+		}
+	}
+}
+
+// capacityIndex maps an index to the capacity it draws on: its own for a
+// global secondary index, the table's for a local one.
+func capacityIndex(schema model.TableSchema, indexName string) string {
+	if _, ok := schema.GSIs[indexName]; ok {
+		return indexName
+	}
+	return ""
+}
+
+func (d *Database) capacityTracker(tableName, indexName string) *capacityTracker {
+	key := capacityKey{tableName, indexName}
+	tracker := d.capacityTrackers[key]
+	if tracker == nil {
+		tracker = &capacityTracker{}
+		d.capacityTrackers[key] = tracker
+	}
+	return tracker
+}
+
+func (d *Database) meter(schema model.TableSchema, indexName string, write bool) (*throughputMeter, float64, float64) {
+	tracker := d.capacityTracker(schema.TableName, indexName)
+	throughput := schema.ProvisionedThroughput
+	if indexName != "" {
+		throughput = schema.GSIs[indexName].ProvisionedThroughput
+	}
+	if write {
+		return &tracker.write, float64(throughput.WriteCapacityUnits), onDemandInitialWritePeak
+	}
+	return &tracker.read, float64(throughput.ReadCapacityUnits), onDemandInitialReadPeak
+}
+
+func (d *Database) burstSeconds() float64 {
+	if d.Capacity.BurstSeconds > 0 {
+		return d.Capacity.BurstSeconds
+	}
+	return defaultBurstSeconds
+}
+
+func (d *Database) checkCapacity(schema model.TableSchema, indexName string, write bool, pending float64) error {
+	if !d.Capacity.Throttle {
+		return nil
+	}
+	meter, rate, initialPeak := d.meter(schema, indexName, write)
+	if meter.allow(d.Clock.Now(), schema.IsProvisioned(), rate, initialPeak, d.burstSeconds(), pending) {
+		return nil
+	}
+	meter.throttled++
+	return &ThroughputExceededError{TableName: schema.TableName, IndexName: indexName, OnDemand: !schema.IsProvisioned()}
+}
+
+func (d *Database) consumeCapacity(schema model.TableSchema, indexName string, write bool, units float64) {
+	meter, rate, _ := d.meter(schema, indexName, write)
+	meter.consume(d.Clock.Now(), schema.IsProvisioned(), rate, d.burstSeconds(), units)
+}
+
+func (d *Database) resetCapacity(tableName string) {
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+	for key := range d.capacityTrackers {
+		if key.tableName == tableName {
+			delete(d.capacityTrackers, key)
+		}
+	}
+	for key := range d.partitionSets {
+		if key.tableName == tableName {
+			delete(d.partitionSets, key)
+		}
+	}
+}
+
+// ChargeWrite records a write of size bytes to the table alone, for writes
+// that change nothing, such as deleting a missing item.
+func (d *Database) ChargeWrite(schema model.TableSchema, pk string, size int) *model.ConsumedCapacity {
+	units := WriteCapacityUnits(size, false)
+	consumed := &model.ConsumedCapacity{TableName: schema.TableName}
+	consumed.Add("", false, 0, units)
+
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+	d.consumeCapacity(schema, "", true, units)
+	d.consumePartition(schema, "", pk, true, units, 0)
+	return consumed
+}
+
+// ConsumedCapacity is what the batch's item changes consumed from tableName,
+// or nil if it changed nothing there.
+func (b *Batch) ConsumedCapacity(tableName string) *model.ConsumedCapacity {
+	if staged := b.capacity[tableName]; staged != nil {
+		return staged.consumed
+	}
+	return nil
+}
+
+// ConsumedCapacities lists what the batch consumed per table, by table name.
+func (b *Batch) ConsumedCapacities() []*model.ConsumedCapacity {
+	consumed := make([]*model.ConsumedCapacity, 0, len(b.capacity))
+	for _, staged := range b.capacity {
+		consumed = append(consumed, staged.consumed)
+	}
+	sort.Slice(consumed, func(i, j int) bool { return consumed[i].TableName < consumed[j].TableName })
+	return consumed
+}
+
+// MergeConsumedCapacity folds c into the entry for its table in list.
+func MergeConsumedCapacity(list []*model.ConsumedCapacity, c *model.ConsumedCapacity) []*model.ConsumedCapacity {
+	if c == nil {
+		return list
+	}
+	for _, existing := range list {
+		if existing.TableName == c.TableName {
+			existing.Merge(c)
+			return list
+		}
+	}
+	merged := &model.ConsumedCapacity{TableName: c.TableName}
+	merged.Merge(c)
+	return append(list, merged)
+}
+
+// ItemCollectionSize is the size in bytes of the items with partition key pk
+// plus their local secondary index entries. The caller must hold the
+// database lock.
+func (d *Database) ItemCollectionSize(schema model.TableSchema, pk string) (int64, error) {
+	// Only tables with a sort key have local secondary indexes.
+	prefixes := []string{model.BuildLevelDBKey(schema.TableName, pk, "") + model.KeySeparator}
+	for indexName := range schema.LSIs {
+		prefixes = append(prefixes, model.BuildGSILevelDBKey(schema.TableName, indexName, pk, "", ""))
+	}
+
+	var size int64
+	for _, prefix := range prefixes {
+		iter := d.DB.NewIterator(PrefixRange([]byte(prefix)))
+		for iter.Next() {
+			record, err := model.UnmarshalRecord(iter.Value())
+			if err != nil {
+				continue
+			}
+			size += int64(ItemSize(record))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func TestBatchWriteItemThrottlesPerItem(t *testing.T) {
+	db, err := NewDatabase(DatabaseOptions{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	clock := NewManualClock(time.Unix(1700000000, 0))
+	db.SetClock(clock)
+	db.SetCapacityConfig(CapacityConfig{Throttle: true, BurstSeconds: 1})
+
+	schema := model.TableSchema{
+		TableName: "T",
+		PartitionKey: "pk",
+		GSIs: map[string]model.GsiSchema{},
+		BillingMode: model.BillingModeProvisioned,
+		ProvisionedThroughput: model.ProvisionedThroughput{ReadCapacityUnits: 1, WriteCapacityUnits: 2},
+	}
+	if err := db.CreateTable(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	var written []string
+	db.Hooks.After(OpBatchWriteItem, "T", func(ctx *HookContext) error {
+		written = append(written, ctx.Key)
+		return nil
+	})
+
+	put := func(batch *Batch, pk string) error {
+		item := model.Record{"pk": {"S": pk}}
+		return db.ApplyItemChange(batch, schema, model.BuildLevelDBKey("T", pk, ""), nil, item)
+	}
+
+	// Two units cover the first two items; the third must wait.
+	batch := NewOperationBatch(OpBatchWriteItem, nil)
+	var throttled []string
+	for _, pk := range []string{"a", "b", "c"} {
+		err := put(batch, pk)
+		var throughputErr *ThroughputExceededError
+		switch {
+		case errors.As(err, &throughputErr):
+			throttled = append(throttled, pk)
+		case err != nil:
+			t.Fatal(err)
+		}
+	}
+	if len(throttled) != 1 || throttled[0] != "c" {
+		t.Fatalf("throttled %v, want [c]", throttled)
+	}
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 {
+		t.Errorf("After hooks ran for %v, want only the two written items", written)
+	}
+	if _, err := db.DB.Get([]byte(model.BuildLevelDBKey("T", "c", ""))); err != ErrNotFound {
+		t.Errorf("throttled item was written: %v", err)
+	}
+
+	// Outside BatchWriteItem the items of one request are charged together,
+	// so a transaction may overdraw the bucket once it has refilled.
+	clock.Advance(time.Second)
+	batch = NewOperationBatch(OpTransactWriteItems, nil)
+	for _, pk := range []string{"d", "e", "f"} {
+		if err := put(batch, pk); err != nil {
+			t.Fatalf("%s: %v", pk, err)
+		}
+	}
+}
+
+func TestChargeTransactionalRead(t *testing.T) {
+	db, err := NewDatabase(DatabaseOptions{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	schema := model.TableSchema{TableName: "T", PartitionKey: "pk", GSIs: map[string]model.GsiSchema{}}
+	if err := db.CreateTable(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// 5 KB takes two 4 KB units, doubled inside a transaction.
+	consumed := db.ChargeTransactionalRead(schema, "a", 5*1024)
+	if consumed.TableName != "T" || consumed.CapacityUnits != 4 || consumed.ReadCapacityUnits != 4 {
+		t.Errorf("got %+v, want 4 read units on T", consumed)
+	}
+	if plain := db.ChargeRead(schema, "", "a", 5*1024, true); plain.CapacityUnits != 2 {
+		t.Errorf("strongly consistent read charged %v, want 2", plain.CapacityUnits)
+	}
+}
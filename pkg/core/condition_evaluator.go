@@ -11,9 +11,33 @@ type Condition struct {
 	Operand1 string 
 	Operator string 
 	Operand2 string 
+	Operands []string // the IN list, or the two BETWEEN bounds
+	Negated  bool
 }
 
 func evaluateSingleCondition(record model.Record, cond Condition, input model.ConditionInput) (bool, error) {
+    result, err := evaluateUnnegatedCondition(record, cond, input)
+    if err != nil {
+        return false, err
+    }
+    return result != cond.Negated, nil
+}
+
+func evaluateUnnegatedCondition(record model.Record, cond Condition, input model.ConditionInput) (bool, error) {
+    if cond.Type == "FUNCTION" && (cond.Operator == "begins_with" || cond.Operator == "contains") {
+        attrName, ok := input.ExpressionAttributeNames[cond.Operand1]
+        if !ok { attrName = cond.Operand1 }
+
+        valAV, ok := input.ExpressionAttributeValues[cond.Operand2]
+        if !ok { return false, fmt.Errorf("ExpressionAttributeValue %s not found", cond.Operand2) }
+
+        fn := &partiqlFunc{name: cond.Operator, args: []interface{}{
+            partiqlPath{elems: []partiqlPathElem{{name: attrName}}},
+            &partiqlLiteral{value: valAV},
+        }}
+        return evalPartiQLFunction(fn, record, nil)
+    }
+
     if cond.Type == "FUNCTION" {
         attrPlaceholder := cond.Operand1
         attrName, ok := input.ExpressionAttributeNames[attrPlaceholder]
@@ -30,6 +54,34 @@ func evaluateSingleCondition(record model.Record, cond Condition, input model.Co
         return false, fmt.Errorf("internal: unknown function operator: %s", cond.Operator)
     }
 
+    if cond.Type == "BETWEEN" || cond.Type == "IN" {
+        attrName, ok := input.ExpressionAttributeNames[cond.Operand1]
+        if !ok { attrName = cond.Operand1 }
+
+        operands := make([]model.AttributeValue, len(cond.Operands))
+        for i, placeholder := range cond.Operands {
+            operands[i], ok = input.ExpressionAttributeValues[placeholder]
+            if !ok { return false, fmt.Errorf("ExpressionAttributeValue %s not found", placeholder) }
+        }
+
+        recordAV, exists := record[attrName]
+        if !exists {
+            return false, nil
+        }
+
+        if cond.Type == "BETWEEN" {
+            low, ok1 := comparePartiQLValues(recordAV, operands[0])
+            high, ok2 := comparePartiQLValues(recordAV, operands[1])
+            return ok1 && ok2 && low >= 0 && high <= 0, nil
+        }
+        for _, operand := range operands {
+            if partiqlValuesEqual(recordAV, operand) {
+                return true, nil
+            }
+        }
+        return false, nil
+    }
+
     if cond.Type == "COMPARISON" {
         attrPlaceholder := cond.Operand1
         valPlaceholder := cond.Operand2
@@ -43,10 +95,29 @@ func evaluateSingleCondition(record model.Record, cond Condition, input model.Co
 
         recordAV, exists := record[attrName]
         if !exists { 
-            return false, nil 
+            return op == "<>", nil 
         } 
 
-        return model.CompareAttributeValuesByOperator(recordAV, valAV, op)
+        switch op {
+        case "=":
+            return partiqlValuesEqual(recordAV, valAV), nil
+        case "<>":
+            return !partiqlValuesEqual(recordAV, valAV), nil
+        }
+        cmp, ok := comparePartiQLValues(recordAV, valAV)
+        if !ok {
+            return false, nil
+        }
+        switch op {
+        case "<":
+            return cmp < 0, nil
+        case "<=":
+            return cmp <= 0, nil
+        case ">":
+            return cmp > 0, nil
+        default:
+            return cmp >= 0, nil
+        }
     }
 
     return false, fmt.Errorf("internal: unsupported condition type: %s", cond.Type)
@@ -63,7 +134,7 @@ func EvaluateConditionExpression(record model.Record, input model.ConditionInput
     orResult := false
     for _, orClause := range orClauses {
 
-        andClauses := strings.Split(orClause, " AND ")
+        andClauses := splitAndClauses(orClause)
 
         andResult := true
         for _, andClause := range andClauses {
@@ -73,11 +144,6 @@ func EvaluateConditionExpression(record model.Record, input model.ConditionInput
                 return false, err
             }
 
-            if record == nil && cond.Operator != "attribute_not_exists" {
-                andResult = false
-                break
-            }
-
             result, err := evaluateSingleCondition(record, cond, input)
             if err != nil {
                 return false, err
@@ -98,20 +164,70 @@ func EvaluateConditionExpression(record model.Record, input model.ConditionInput
     return orResult, nil
 }
 
+// splitAndClauses splits expr on AND, keeping the AND between the bounds of a
+// BETWEEN inside its clause.
+func splitAndClauses(expr string) []string {
+    var clauses []string
+    for _, part := range strings.Split(expr, " AND ") {
+        if n := len(clauses); n > 0 && strings.Contains(clauses[n-1], " BETWEEN ") && !strings.Contains(clauses[n-1], " AND ") {
+            clauses[n-1] += " AND " + part
+            continue
+        }
+        clauses = append(clauses, part)
+    }
+    return clauses
+}
+
 func parseCondition(expr string) (Condition, error) {
     expr = strings.TrimSpace(expr)
 
+    if strings.HasPrefix(expr, "NOT ") {
+        cond, err := parseCondition(strings.TrimPrefix(expr, "NOT "))
+        cond.Negated = !cond.Negated
+        return cond, err
+    }
+
+    if parts := strings.SplitN(expr, " BETWEEN ", 2); len(parts) == 2 {
+        bounds := strings.SplitN(parts[1], " AND ", 2)
+        if len(bounds) != 2 {
+            return Condition{}, fmt.Errorf("unsupported condition expression format: %s", expr)
+        }
+        return Condition{
+            Type: "BETWEEN",
+            Operand1: strings.TrimSpace(parts[0]),
+            Operands: []string{strings.TrimSpace(bounds[0]), strings.TrimSpace(bounds[1])},
+        }, nil
+    }
+
+    if parts := strings.SplitN(expr, " IN ", 2); len(parts) == 2 {
+        list := strings.TrimSpace(parts[1])
+        if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+            return Condition{}, fmt.Errorf("unsupported condition expression format: %s", expr)
+        }
+        cond := Condition{Type: "IN", Operand1: strings.TrimSpace(parts[0])}
+        for _, operand := range strings.Split(list[1:len(list)-1], ",") {
+            cond.Operands = append(cond.Operands, strings.TrimSpace(operand))
+        }
+        return cond, nil
+    }
+
     if strings.Contains(expr, "(") {
-        if strings.HasPrefix(expr, "attribute_exists(") && strings.HasSuffix(expr, ")") {
-            return Condition{Type: "FUNCTION", Operator: "attribute_exists", Operand1: strings.TrimSuffix(strings.TrimPrefix(expr, "attribute_exists("), ")")}, nil
+        open := strings.IndexByte(expr, '(')
+        name := strings.TrimSpace(expr[:open])
+        if !strings.HasSuffix(expr, ")") {
+            return Condition{}, fmt.Errorf("unsupported condition function: %s", expr)
         }
-        if strings.HasPrefix(expr, "attribute_not_exists(") && strings.HasSuffix(expr, ")") {
-            return Condition{Type: "FUNCTION", Operator: "attribute_not_exists", Operand1: strings.TrimSuffix(strings.TrimPrefix(expr, "attribute_not_exists("), ")")}, nil
+        args := strings.Split(expr[open+1:len(expr)-1], ",")
+        switch {
+        case (name == "attribute_exists" || name == "attribute_not_exists") && len(args) == 1:
+            return Condition{Type: "FUNCTION", Operator: name, Operand1: strings.TrimSpace(args[0])}, nil
+        case (name == "begins_with" || name == "contains") && len(args) == 2:
+            return Condition{Type: "FUNCTION", Operator: name, Operand1: strings.TrimSpace(args[0]), Operand2: strings.TrimSpace(args[1])}, nil
         }
         return Condition{}, fmt.Errorf("unsupported condition function: %s", expr)
     }
 
-    operators := []string{"<=", ">=", "=", "<", ">"}
+    operators := []string{"<>", "<=", ">=", "=", "<", ">"}
 
     for _, op := range operators {
         parts := strings.SplitN(expr, " " + op + " ", 2)
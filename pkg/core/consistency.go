@@ -0,0 +1,315 @@
+package core
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type ConsistencyConfig struct {
+	EventualConsistency bool
+	GSIPropagationDelay time.Duration
+	GSIPropagationJitter time.Duration
+	StaleReadWindow time.Duration
+	StaleReadProbability float64
+}
+
+type staleVersion struct {
+	value []byte
+	exists bool
+	expiresAt time.Time
+}
+
+type gsiUpdate struct {
+	batch *Batch
+	applyAt time.Time
+}
+
+type gsiPropagator struct {
+	db *Database
+	// applyMu keeps updates applied in queue order when AdvanceClock and the
+	// background loop apply them at the same time.
+	applyMu sync.Mutex
+	mu sync.Mutex
+	queue []gsiUpdate
+	lastApplyAt time.Time
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newGSIPropagator(db *Database) *gsiPropagator {
+	p := &gsiPropagator{
+		db: db,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *gsiPropagator) enqueue(batch *Batch, delay time.Duration, jitter time.Duration) {
+	applyAt := p.db.Now().Add(delay)
+	if jitter > 0 {
+		applyAt = applyAt.Add(time.Duration(rand.Int63n(int64(jitter))))
+	}
+
+	p.mu.Lock()
+	// Index updates are applied in write order, so a later write never lands before an earlier one.
+	if applyAt.Before(p.lastApplyAt) {
+		applyAt = p.lastApplyAt
+	}
+	p.lastApplyAt = applyAt
+	p.queue = append(p.queue, gsiUpdate{batch: batch, applyAt: applyAt})
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *gsiPropagator) run() {
+	defer close(p.done)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		if p.applyNext() {
+			continue
+		}
+
+		p.mu.Lock()
+		wait := time.Hour
+		if len(p.queue) > 0 {
+			wait = p.queue[0].applyAt.Sub(p.db.Now())
+		}
+		p.mu.Unlock()
+		// A manual clock only moves through AdvanceClock, which applies the
+		// updates that became due itself.
+		if _, manual := p.db.clock().(*ManualClock); manual {
+			wait = time.Hour
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-p.stop:
+			return
+		case <-p.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// applyNext writes the oldest queued update if it is due by the database
+// clock and reports whether it did.
+func (p *gsiPropagator) applyNext() bool {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+
+	p.mu.Lock()
+	if len(p.queue) == 0 || p.queue[0].applyAt.After(p.db.Now()) {
+		p.mu.Unlock()
+		return false
+	}
+	update := p.queue[0]
+	p.queue = p.queue[1:]
+	p.mu.Unlock()
+
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	if err := p.db.DB.Write(update.batch); err != nil {
+		log.Printf("Failed to propagate GSI update: %v", err)
+	}
+	return true
+}
+
+func (p *gsiPropagator) pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+func (p *gsiPropagator) drain() []gsiUpdate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queue := p.queue
+	p.queue = nil
+	p.lastApplyAt = time.Time{}
+	return queue
+}
+
+func (p *gsiPropagator) close() {
+	close(p.stop)
+	<-p.done
+}
+
+func (d *Database) SetConsistencyConfig(cfg ConsistencyConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Consistency.EventualConsistency && !cfg.EventualConsistency {
+		d.flushGSIQueue()
+	}
+	d.Consistency = cfg
+
+	d.staleMu.Lock()
+	d.staleVersions = make(map[string]staleVersion)
+	d.staleMu.Unlock()
+}
+
+func (d *Database) UpdateGSI(batch *Batch, schema model.TableSchema, oldRecord model.Record, newRecord model.Record) {
+	UpdateLSI(batch, schema, oldRecord, newRecord)
+
+	if !d.Consistency.EventualConsistency {
+		UpdateGSI(batch, schema, oldRecord, newRecord)
+		return
+	}
+
+	gsiBatch := new(Batch)
+	UpdateGSI(gsiBatch, schema, oldRecord, newRecord)
+	if gsiBatch.Len() == 0 {
+		return
+	}
+	// Queued by Write once the base batch has committed, so that index
+	// entries are never propagated for a write that failed.
+	batch.gsiUpdates = append(batch.gsiUpdates, gsiBatch)
+}
+
+func (d *Database) Write(batch *Batch) error {
+	if err := d.write(batch); err != nil {
+		return err
+	}
+	for _, gsiBatch := range batch.gsiUpdates {
+		d.gsiQueue.enqueue(gsiBatch, d.Consistency.GSIPropagationDelay, d.Consistency.GSIPropagationJitter)
+	}
+	batch.gsiUpdates = nil
+	d.chargeBatchCapacity(batch)
+	return d.runBatchAfterHooks(batch)
+}
+
+func (d *Database) write(batch *Batch) error {
+	if !d.Consistency.EventualConsistency || d.Consistency.StaleReadWindow <= 0 {
+		return d.DB.Write(batch)
+	}
+
+	collector := &batchKeyCollector{}
+	batch.Replay(collector)
+
+	previous := make(map[string]staleVersion, len(collector.keys))
+	for _, key := range collector.keys {
+		value, err := d.DB.Get([]byte(key))
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		previous[key] = staleVersion{value: value, exists: err == nil}
+	}
+
+	if err := d.DB.Write(batch); err != nil {
+		return err
+	}
+
+	expiresAt := d.Now().Add(d.Consistency.StaleReadWindow)
+	d.staleMu.Lock()
+	for key, version := range previous {
+		version.expiresAt = expiresAt
+		d.staleVersions[key] = version
+	}
+	d.staleMu.Unlock()
+
+	return nil
+}
+
+func (d *Database) Read(key []byte, consistentRead bool) ([]byte, error) {
+	if !consistentRead {
+		if version, ok := d.staleVersion(string(key)); ok {
+			if !version.exists {
+				return nil, ErrNotFound
+			}
+			return version.value, nil
+		}
+	}
+	return d.DB.Get(key)
+}
+
+func (d *Database) StaleRead(key []byte) ([]byte, bool, bool) {
+	version, ok := d.staleVersion(string(key))
+	if !ok {
+		return nil, false, false
+	}
+	return version.value, version.exists, true
+}
+
+func (d *Database) staleVersion(key string) (staleVersion, bool) {
+	if !d.Consistency.EventualConsistency {
+		return staleVersion{}, false
+	}
+
+	d.staleMu.Lock()
+	defer d.staleMu.Unlock()
+
+	version, ok := d.staleVersions[key]
+	if !ok {
+		return staleVersion{}, false
+	}
+	if d.Now().After(version.expiresAt) {
+		delete(d.staleVersions, key)
+		return staleVersion{}, false
+	}
+	if d.Consistency.StaleReadProbability < 1 && rand.Float64() >= d.Consistency.StaleReadProbability {
+		return staleVersion{}, false
+	}
+	return version, true
+}
+
+func (d *Database) PendingGSIUpdates() int {
+	return d.gsiQueue.pending()
+}
+
+// PropagateGSIUpdates applies the queued index updates that are due by the
+// database clock. The caller must not hold the database lock.
+func (d *Database) PropagateGSIUpdates() {
+	for d.gsiQueue.applyNext() {
+	}
+}
+
+func (d *Database) flushGSIQueue() {
+	for _, update := range d.gsiQueue.drain() {
+		if err := d.DB.Write(update.batch); err != nil {
+			log.Printf("Failed to flush GSI update: %v", err)
+		}
+	}
+}
+
+func (d *Database) resetConsistencyState() {
+	d.gsiQueue.drain()
+
+	d.staleMu.Lock()
+	d.staleVersions = make(map[string]staleVersion)
+	d.staleMu.Unlock()
+}
+
+type batchKeyCollector struct {
+	keys []string
+}
+
+func (c *batchKeyCollector) Put(key, value []byte) {
+	c.keys = append(c.keys, string(key))
+}
+
+func (c *batchKeyCollector) Delete(key []byte) {
+	c.keys = append(c.keys, string(key))
+}
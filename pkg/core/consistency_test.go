@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func TestEventualConsistencyFollowsClock(t *testing.T) {
+	db := newPartiQLTestDatabase(t)
+	clock := NewManualClock(time.Unix(1700000000, 0))
+	db.SetClock(clock)
+	db.SetConsistencyConfig(ConsistencyConfig{
+		EventualConsistency: true,
+		GSIPropagationDelay: time.Minute,
+		StaleReadWindow: time.Minute,
+		StaleReadProbability: 1,
+	})
+
+	execPartiQL(t, db, `INSERT INTO T VALUE {'pk': 'a', 'sk': 1, 'n': 10}`)
+	execPartiQL(t, db, `UPDATE T SET s = 'x' WHERE pk = 'a' AND sk = 1`)
+	key := []byte(model.BuildLevelDBKey("T", "a", "1"))
+
+	queryIndex := func() []model.Record {
+		return execPartiQL(t, db, `SELECT pk FROM "T"."ByN" WHERE n = 10`)
+	}
+	staleRead := func() model.Record {
+		value, err := db.Read(key, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := model.UnmarshalRecord(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	// Real time passing must not matter, only the database clock.
+	time.Sleep(10 * time.Millisecond)
+	clock.Advance(time.Minute - time.Second)
+	db.PropagateGSIUpdates()
+	if got := queryIndex(); len(got) != 0 {
+		t.Errorf("index updated before the propagation delay: %v", got)
+	}
+	if _, ok := staleRead()["s"]; ok {
+		t.Error("stale version expired before the window")
+	}
+
+	clock.Advance(2 * time.Second)
+	db.PropagateGSIUpdates()
+	if got := queryIndex(); len(got) != 1 {
+		t.Errorf("index returned %v after the propagation delay, want the item", got)
+	}
+	if db.PendingGSIUpdates() != 0 {
+		t.Errorf("%d GSI updates still pending", db.PendingGSIUpdates())
+	}
+	if _, ok := staleRead()["s"]; !ok {
+		t.Error("read the stale version after the window")
+	}
+}
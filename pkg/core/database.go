@@ -5,49 +5,159 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
-const databasePath = "dynamodb_emulator_data"
+const (
+	databasePath = "dynamodb_emulator_data"
+	stagingDirSuffix = ".staging"
+	previousDirSuffix = ".previous"
+)
 
 type Database struct {
-	DB *leveldb.DB
+	DB Storage
 	Tables map[string]model.TableSchema
+	Consistency ConsistencyConfig
+	Clock Clock
+	Hooks *HookRegistry
+	Capacity CapacityConfig
 	mu sync.RWMutex
+
+	options DatabaseOptions
+	gsiQueue *gsiPropagator
+	reaper *backgroundReaper
+	streamSeq uint64
+	changeSeq uint64
+	triggers map[string]*streamTrigger
+	triggersMu sync.Mutex
+	faultRules []*faultRuleState
+	faultRand *rand.Rand
+	faultsMu sync.Mutex
+	capacityTrackers map[capacityKey]*capacityTracker
+	partitionSets map[capacityKey]*partitionSet
+	capacityMu sync.Mutex
+	staleVersions map[string]staleVersion
+	staleMu sync.Mutex
+	// clockMu guards Clock against SetClock while the GSI propagator reads it.
+	clockMu sync.RWMutex
+	snapshotMu sync.Mutex
 }
 
-func NewDatabase() (*Database, error) {
-	opts := &opt.Options{
-		ErrorIfExist: false,
-		Strict: opt.StrictAll,
+// DatabaseOptions configures where a Database keeps its files. Empty
+// directories fall back to the defaults under the working directory, so
+// instances running side by side each need their own directories.
+type DatabaseOptions struct {
+	DataDir string
+	SnapshotDir string
+	S3Dir string
+	ImportLogDir string
+	ArchiveDir string
+	InMemory bool
+
+	// LevelDB tuning in bytes; zero keeps the goleveldb defaults.
+	BlockCacheCapacity int
+	WriteBuffer int
+}
+
+func (o DatabaseOptions) withDefaults() DatabaseOptions {
+	if o.DataDir == "" {
+		o.DataDir = databasePath
+	}
+	if o.SnapshotDir == "" {
+		o.SnapshotDir = model.SnapshotDir
+	}
+	if o.S3Dir == "" {
+		o.S3Dir = model.S3Dir
+	}
+	if o.ImportLogDir == "" {
+		o.ImportLogDir = model.ImportLogDir
+	}
+	if o.ArchiveDir == "" {
+		o.ArchiveDir = model.ArchiveDir
+	}
+	return o
+}
+
+func NewDatabase(options DatabaseOptions) (*Database, error) {
+	options = options.withDefaults()
+	if options.InMemory {
+		return NewDatabaseWithStorage(NewMemoryStorage(), options)
 	}
 
-	db, err := leveldb.OpenFile(databasePath, opts)
+	storage, err := openLevelDBStorage(options.DataDir, &opt.Options{
+		ErrorIfExist: false,
+		Strict: opt.StrictAll,
+		BlockCacheCapacity: options.BlockCacheCapacity,
+		WriteBuffer: options.WriteBuffer,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	return NewDatabaseWithStorage(storage, options)
+}
 
+// NewDatabaseWithStorage builds a database on an already opened store, which
+// the database then owns and closes. DataDir and InMemory are ignored.
+func NewDatabaseWithStorage(storage Storage, options DatabaseOptions) (*Database, error) {
 	dbInstance := &Database{
-		DB: db,
+		DB: storage,
 		Tables: make(map[string]model.TableSchema),
+		Clock: systemClock{},
+		Hooks: newHookRegistry(),
+		options: options.withDefaults(),
+		staleVersions: make(map[string]staleVersion),
+		triggers: make(map[string]*streamTrigger),
+		capacityTrackers: make(map[capacityKey]*capacityTracker),
+		partitionSets: make(map[capacityKey]*partitionSet),
+		faultRand: rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
+	dbInstance.gsiQueue = newGSIPropagator(dbInstance)
 
 	if err := dbInstance.loadTableSchemas(); err != nil {
-		db.Close()
+		dbInstance.gsiQueue.close()
+		storage.Close()
 		return nil, fmt.Errorf("failed to load table schemas: %w", err)
 	}
 
+	if err := dbInstance.migrateIndexKeys(); err != nil {
+		dbInstance.gsiQueue.close()
+		storage.Close()
+		return nil, err
+	}
+
+	if err := dbInstance.loadStreamSequence(); err != nil {
+		dbInstance.gsiQueue.close()
+		storage.Close()
+		return nil, fmt.Errorf("failed to load stream sequence: %w", err)
+	}
+
+	dbInstance.reaper = newBackgroundReaper(dbInstance, reaperInterval)
+
 	return dbInstance, nil
 }
 
+func (d *Database) Options() DatabaseOptions {
+	return d.options
+}
+
 func (d *Database) Close() error {
+	d.stopStreamTriggers()
+	d.reaper.close()
+	d.gsiQueue.close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushGSIQueue()
+
 	return d.DB.Close()
 }
 
@@ -59,13 +169,83 @@ func (d *Database) CreateTable(schema model.TableSchema) error {
 		return fmt.Errorf("table already exists: %s", schema.TableName)
 	}
 
+	if schema.StreamViewType != "" {
+		if err := d.enableStream(&schema, schema.StreamViewType); err != nil {
+			return err
+		}
+	}
+
+	return d.putTableSchema(schema)
+}
+
+func (d *Database) DeleteTable(tableName string) (model.TableSchema, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.deleteTable(tableName)
+}
+
+func (d *Database) deleteTable(tableName string) (model.TableSchema, error) {
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return model.TableSchema{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	d.flushGSIQueue()
+
+	batch := new(Batch)
+	if err := d.stageTableDelete(batch, schema); err != nil {
+		return model.TableSchema{}, err
+	}
+
+	if schema.StreamViewType != "" {
+		if err := d.disableStream(&schema); err != nil {
+			return model.TableSchema{}, err
+		}
+	}
+
+	if err := d.DB.Write(batch); err != nil {
+		return model.TableSchema{}, fmt.Errorf("failed to delete table data: %w", err)
+	}
+
+	if err := d.deleteChangeLog(tableName); err != nil {
+		return model.TableSchema{}, err
+	}
+
+	delete(d.Tables, tableName)
+	d.resetCapacity(tableName)
+	return schema, nil
+}
+
+// stageTableDelete adds the deletion of every item and index entry of a table,
+// and of its schema, to batch.
+func (d *Database) stageTableDelete(batch *Batch, schema model.TableSchema) error {
+	iter := d.DB.NewIterator(PrefixRange([]byte(schema.TableName+model.KeySeparator)))
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err == nil {
+			UpdateGSI(batch, schema, record, nil)
+			UpdateLSI(batch, schema, record, nil)
+		}
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch.Delete([]byte(d.buildSchemaKey(schema.TableName)))
+	return nil
+}
+
+func (d *Database) putTableSchema(schema model.TableSchema) error {
 	schemaBytes, err := json.Marshal(schema)
 	if err != nil {
 		return fmt.Errorf("failed to marshal schema: %w", err)
 	}
 
 	schemaKey := d.buildSchemaKey(schema.TableName)
-	if err := d.DB.Put([]byte(schemaKey), schemaBytes, nil); err != nil {
+	if err := d.DB.Put([]byte(schemaKey), schemaBytes); err != nil {
 		return fmt.Errorf("failed to save schema to DB: %w", err)
 	}
 
@@ -74,26 +254,32 @@ func (d *Database) CreateTable(schema model.TableSchema) error {
 }
 
 func (d *Database) loadTableSchemas() error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	schemas, err := readTableSchemas(d.DB)
+	if err != nil {
+		return err
+	}
+	d.Tables = schemas
+	return nil
+}
+
+func readTableSchemas(db storageReader) (map[string]model.TableSchema, error) {
+	schemas := make(map[string]model.TableSchema)
 
-	prefix := []byte(schemaPrefix)
-	iter := d.DB.NewIterator(iterator.Prefix(prefix), nil)
+	iter := db.NewIterator(PrefixRange([]byte(schemaPrefix)))
 	defer iter.Release()
 
 	for iter.Next() {
 		var schema model.TableSchema
 		if err := json.Unmarshal(iter.Value(), &schema); err != nil {
-			log.Printf("Error unmarshaling schema: %v", err)
-			continue
+			return nil, fmt.Errorf("failed to read schema %s: %w", strings.TrimPrefix(string(iter.Key()), schemaPrefix), err)
 		}
-		d.Tables[schema.TableName] = schema
+		schemas[schema.TableName] = schema
 	}
 
 	if err := iter.Error(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return schemas, nil
 }
 
 const schemaPrefix = "__SCHEMA__" + model.KeySeparator
@@ -106,104 +292,324 @@ func (d *Database) DeleteAllData() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	d.DB.Close()
-	
-	if err := os.RemoveAll(databasePath); err != nil {
-		return err
+	live, ok := d.DB.(*levelDBStorage)
+	if !ok {
+		return d.replaceStorageContents(nil)
+	}
+
+	stagingDir := live.path + stagingDirSuffix
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return fmt.Errorf("failed to clear staging directory: %w", err)
 	}
 
-	newDB, err := leveldb.OpenFile(databasePath, &opt.Options{Strict: opt.StrictAll})
+	empty, err := leveldb.OpenFile(stagingDir, &opt.Options{Strict: opt.StrictAll})
 	if err != nil {
-		log.Fatalf("Failed to re-initialize database after deletion: %v", err)
+		os.RemoveAll(stagingDir)
+		return fmt.Errorf("failed to create empty database: %w", err)
 	}
-	d.DB = newDB
-	d.Tables = make(map[string]model.TableSchema) 
-	
-	return nil
+	if err := empty.Close(); err != nil {
+		os.RemoveAll(stagingDir)
+		return fmt.Errorf("failed to create empty database: %w", err)
+	}
+
+	return d.swapDatabaseDir(live, stagingDir)
 }
 
-func (d *Database) CreateSnapshot(snapshotName string) error {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+func (d *Database) CreateSnapshot(snapshotName string, tableNames ...string) error {
+	if err := validateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	for _, tableName := range tableNames {
+		if _, ok := d.Tables[tableName]; !ok {
+			return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		}
+	}
+
+	d.flushGSIQueue()
 
-	sourceDir := databasePath
-	destDir := filepath.Join(model.SnapshotDir, snapshotName)
+	destDir := d.snapshotPath(snapshotName)
+	stagingDir := destDir + snapshotStagingSuffix
 
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return fmt.Errorf("failed to clear snapshot staging directory: %w", err)
 	}
 
-	files, err := os.ReadDir(sourceDir)
+	metadata := model.SnapshotDescriptor{SnapshotName: snapshotName, CreationTime: d.Now(), TableNames: d.tableNames()}
+	var err error
+	if len(tableNames) > 0 {
+		metadata.TableNames = uniqueSortedNames(tableNames)
+		metadata.Partial = true
+		err = d.writeTableSnapshot(stagingDir, metadata.TableNames)
+	} else if live, ok := d.DB.(*levelDBStorage); ok {
+		err = cloneLiveDatabase(live, stagingDir)
+	} else {
+		err = d.writeStorageSnapshot(stagingDir)
+	}
+	if err == nil {
+		err = writeSnapshotMetadata(stagingDir, metadata)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read database directory: %w", err)
+		os.RemoveAll(stagingDir)
+		return err
 	}
 
-	for _, file := range files {
-		srcPath := filepath.Join(sourceDir, file.Name())
-		dstPath := filepath.Join(destDir, file.Name())
+	if err := os.RemoveAll(destDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return fmt.Errorf("failed to replace snapshot %s: %w", snapshotName, err)
+	}
+	if err := os.Rename(stagingDir, destDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return fmt.Errorf("failed to finalize snapshot %s: %w", snapshotName, err)
+	}
+	return nil
+}
 
-		if file.IsDir() {
-			continue
-		}
+func cloneLiveDatabase(live *levelDBStorage, dir string) error {
+	// An open transaction flushes the memtable, waits for compaction and
+	// blocks writes, so the table files and manifest stay put while we link them.
+	tr, err := live.db.OpenTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to quiesce database: %w", err)
+	}
+	defer tr.Discard()
 
-		if err := copyFile(srcPath, dstPath); err != nil {
-			return fmt.Errorf("failed to copy file %s: %w", file.Name(), err)
-		}
+	if err := cloneDatabaseDir(live.path, dir); err != nil {
+		return err
+	}
+	return verifyDatabaseDir(dir)
+}
+
+// verifyDatabaseDir opens the copied database in dir read-only, which checks
+// its manifest against the table files, and reads the schemas back.
+func verifyDatabaseDir(dir string) error {
+	copied, err := openLevelDBStorage(dir, &opt.Options{ReadOnly: true, ErrorIfMissing: true, Strict: opt.StrictAll})
+	if err != nil {
+		return fmt.Errorf("failed to open copied database: %w", err)
+	}
+	defer copied.Close()
+
+	if _, err := readTableSchemas(copied); err != nil {
+		return fmt.Errorf("failed to read copied database: %w", err)
 	}
 	return nil
 }
 
 func (d *Database) LoadSnapshot(snapshotName string) error {
+	if err := validateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
 
-	snapshotDir := filepath.Join(model.SnapshotDir, snapshotName)
-	if _, err := os.Stat(snapshotDir); os.IsNotExist(err) {
-		return fmt.Errorf("snapshot not found: %s", snapshotName)
+	descriptor, err := d.describeSnapshotDir(snapshotName)
+	if err != nil {
+		return err
+	}
+	if descriptor.Partial {
+		_, err := d.restoreTablesFromSnapshot(snapshotName, nil)
+		return err
 	}
 
-	d.DB.Close()
+	live, ok := d.DB.(*levelDBStorage)
+	if !ok {
+		snapshotDB, err := d.openSnapshotStorage(snapshotName)
+		if err != nil {
+			return err
+		}
+		defer snapshotDB.Close()
+		return d.replaceStorageContents(snapshotDB)
+	}
 
-	if err := os.RemoveAll(databasePath); err != nil {
-		return fmt.Errorf("failed to remove current database: %w", err)
+	stagingDir := live.path + stagingDirSuffix
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return fmt.Errorf("failed to clear staging directory: %w", err)
 	}
-	
-	if err := os.Mkdir(databasePath, 0755); err != nil {
-		return fmt.Errorf("failed to create new database directory: %w", err)
+	if err := cloneDatabaseDir(d.snapshotPath(snapshotName), stagingDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return err
+	}
+
+	return d.swapDatabaseDir(live, stagingDir)
+}
+
+// swapDatabaseDir makes stagingDir the live database. The staged copy is
+// opened and its schemas read before the live database is closed, and the
+// previous directory is kept until the new one has opened, so a bad snapshot
+// leaves the current data in place.
+func (d *Database) swapDatabaseDir(live *levelDBStorage, stagingDir string) error {
+	if err := verifyDatabaseDir(stagingDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return err
+	}
+
+	previousDir := live.path + previousDirSuffix
+	if err := os.RemoveAll(previousDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return fmt.Errorf("failed to clear previous database directory: %w", err)
+	}
+
+	d.flushGSIQueue()
+	if err := live.Close(); err != nil {
+		log.Printf("Failed to close database before swap: %v", err)
+	}
+
+	if err := os.Rename(live.path, previousDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return d.reopenDatabase(live, fmt.Errorf("failed to move current database aside: %w", err))
+	}
+	if err := os.Rename(stagingDir, live.path); err != nil {
+		os.RemoveAll(stagingDir)
+		return d.rollbackDatabaseDir(live, previousDir, fmt.Errorf("failed to move staged database into place: %w", err))
 	}
 
-	files, err := os.ReadDir(snapshotDir)
+	newDB, err := openLevelDBStorage(live.path, live.options)
 	if err != nil {
-		return fmt.Errorf("failed to read snapshot directory: %w", err)
+		return d.rollbackDatabaseDir(live, previousDir, fmt.Errorf("failed to open new database: %w", err))
+	}
+	d.DB = newDB
+	if err := d.reloadDatabaseState(); err != nil {
+		newDB.Close()
+		return d.rollbackDatabaseDir(live, previousDir, err)
 	}
 
-	for _, file := range files {
-		srcPath := filepath.Join(snapshotDir, file.Name())
-		dstPath := filepath.Join(databasePath, file.Name())
-		
-		if file.IsDir() {
-			continue
+	d.resetConsistencyState()
+	if err := os.RemoveAll(previousDir); err != nil {
+		log.Printf("Failed to remove previous database directory: %v", err)
+	}
+	return nil
+}
+
+func (d *Database) rollbackDatabaseDir(live *levelDBStorage, previousDir string, cause error) error {
+	if err := os.RemoveAll(live.path); err != nil {
+		return fmt.Errorf("%v; previous database left in %s: %w", cause, previousDir, err)
+	}
+	if err := os.Rename(previousDir, live.path); err != nil {
+		return fmt.Errorf("%v; previous database left in %s: %w", cause, previousDir, err)
+	}
+	return d.reopenDatabase(live, cause)
+}
+
+func (d *Database) reopenDatabase(live *levelDBStorage, cause error) error {
+	db, err := openLevelDBStorage(live.path, live.options)
+	if err != nil {
+		return fmt.Errorf("%v; failed to reopen previous database: %w", cause, err)
+	}
+	d.DB = db
+	if err := d.reloadDatabaseState(); err != nil {
+		return fmt.Errorf("%v; failed to reload previous database: %w", cause, err)
+	}
+	return cause
+}
+
+// replaceStorageContents does for stores without a directory of their own
+// what swapDatabaseDir does for LevelDB: everything is replaced by the
+// contents of source, or removed when source is nil, in one atomic batch.
+func (d *Database) replaceStorageContents(source storageReader) error {
+	if source != nil {
+		if _, err := readTableSchemas(source); err != nil {
+			return fmt.Errorf("failed to read staged database: %w", err)
 		}
+	}
 
-		if err := copyFile(srcPath, dstPath); err != nil {
-			return fmt.Errorf("failed to copy file %s from snapshot: %w", file.Name(), err)
+	d.flushGSIQueue()
+
+	batch := new(Batch)
+	iter := d.DB.NewIterator(nil)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	if source != nil {
+		iter := source.NewIterator(nil)
+		for iter.Next() {
+			batch.Put(iter.Key(), iter.Value())
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return fmt.Errorf("failed to read staged database: %w", err)
 		}
 	}
 
-	newDB, err := leveldb.OpenFile(databasePath, &opt.Options{Strict: opt.StrictAll})
-	if err != nil {
-		log.Fatalf("Failed to re-initialize database after loading snapshot: %v", err)
+	if err := d.DB.Write(batch); err != nil {
+		return fmt.Errorf("failed to replace database contents: %w", err)
 	}
-	d.DB = newDB
-	
-	d.Tables = make(map[string]model.TableSchema) 
+	if err := d.reloadDatabaseState(); err != nil {
+		return err
+	}
+	d.resetConsistencyState()
+	return nil
+}
+
+func (d *Database) reloadDatabaseState() error {
 	if err := d.loadTableSchemas(); err != nil {
-		return fmt.Errorf("failed to reload table schemas after snapshot load: %w", err)
+		return fmt.Errorf("failed to load table schemas: %w", err)
 	}
+	// Snapshots taken before index keys were scoped by table still hold the
+	// old keys.
+	if err := d.migrateIndexKeys(); err != nil {
+		return err
+	}
+	if err := d.loadStreamSequence(); err != nil {
+		return fmt.Errorf("failed to load stream sequence: %w", err)
+	}
+	d.resetPartitions()
+	return nil
+}
+
+// LevelDB never rewrites a table file once it is written, so table files are
+// hard linked and only the manifest and journal are copied.
+func cloneDatabaseDir(srcDir, dstDir string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dstDir, err)
+	}
+
+	files, err := os.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", srcDir, err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || isLevelDBRuntimeFile(file.Name()) || file.Name() == snapshotMetadataFile {
+			continue
+		}
+
+		srcPath := filepath.Join(srcDir, file.Name())
+		dstPath := filepath.Join(dstDir, file.Name())
 
+		if isTableFile(file.Name()) {
+			if err := os.Link(srcPath, dstPath); err == nil {
+				continue
+			}
+		}
+		if err := copyFile(srcPath, dstPath); err != nil {
+			return fmt.Errorf("failed to copy file %s: %w", file.Name(), err)
+		}
+	}
 	return nil
 }
 
+func isLevelDBRuntimeFile(name string) bool {
+	return name == "LOCK" || strings.HasPrefix(name, "LOG")
+}
+
+func isTableFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".ldb" || ext == ".sst"
+}
+
 func copyFile(src, dst string) error {
 	in, err := os.Open(src)
 	if err != nil {
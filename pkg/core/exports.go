@@ -0,0 +1,598 @@
+package core
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	exportMetaPrefix = "__EXPORT__" + model.KeySeparator
+
+	exportItemsPerFile = 10000
+	exportManifestVersion = "2020-06-30"
+	exportTimeLayout = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrInvalidExportTime = errors.New("export time is outside the restorable window")
+)
+
+type ExportOptions struct {
+	S3Bucket string
+	S3BucketOwner string
+	S3Prefix string
+	S3SseAlgorithm string
+	ExportFormat string
+	ExportType string
+	ExportTime time.Time
+	ExportFromTime time.Time
+	ExportToTime time.Time
+	ExportViewType string
+	ClientToken string
+}
+
+// ExportTableToPointInTime writes the table as of a point in its change log
+// to <S3Dir>/<bucket>/<prefix>/AWSDynamoDB/<export id>, using the same
+// manifest and data file layout as an export to S3.
+func (d *Database) ExportTableToPointInTime(tableName string, opts ExportOptions) (model.ExportDescriptor, error) {
+	if err := validateS3Location(opts.S3Bucket, opts.S3Prefix); err != nil {
+		return model.ExportDescriptor{}, err
+	}
+	opts.S3Prefix = strings.Trim(opts.S3Prefix, "/")
+
+	if opts.ExportFormat == "" {
+		opts.ExportFormat = model.ExportFormatDynamoDBJSON
+	}
+	if opts.ExportFormat != model.ExportFormatDynamoDBJSON && opts.ExportFormat != model.ExportFormatIon {
+		return model.ExportDescriptor{}, fmt.Errorf("ExportFormat must be one of DYNAMODB_JSON, ION")
+	}
+	if opts.ExportType == "" {
+		opts.ExportType = model.ExportTypeFull
+	}
+	if opts.S3SseAlgorithm == "" {
+		opts.S3SseAlgorithm = "AES256"
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if opts.ClientToken != "" {
+		existing, found, err := d.findExportByClientToken(opts.ClientToken)
+		if err != nil {
+			return model.ExportDescriptor{}, err
+		}
+		if found {
+			return existing, nil
+		}
+	}
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return model.ExportDescriptor{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	if !schema.PITREnabled {
+		return model.ExportDescriptor{}, fmt.Errorf("%w: %s", ErrPointInTimeRecoveryUnavailable, tableName)
+	}
+
+	status := d.continuousBackupsStatus(schema)
+	now := d.Now()
+	descriptor := model.ExportDescriptor{
+		ExportArn: fmt.Sprintf("%s/export/%014d-%08x", TableArn(tableName), now.UnixMilli(), mathrand.Uint32()),
+		ExportStatus: model.ExportStatusCompleted,
+		ExportType: opts.ExportType,
+		ExportFormat: opts.ExportFormat,
+		TableName: tableName,
+		TableArn: TableArn(tableName),
+		TableId: tableID(tableName),
+		ClientToken: opts.ClientToken,
+		S3Bucket: opts.S3Bucket,
+		S3BucketOwner: opts.S3BucketOwner,
+		S3Prefix: opts.S3Prefix,
+		S3SseAlgorithm: opts.S3SseAlgorithm,
+		StartTime: now,
+	}
+
+	switch opts.ExportType {
+	case model.ExportTypeFull:
+		descriptor.ExportTime = opts.ExportTime
+		if descriptor.ExportTime.IsZero() {
+			descriptor.ExportTime = status.LatestRestorableTime
+		}
+		if err := checkExportWindow(status, descriptor.ExportTime, descriptor.ExportTime); err != nil {
+			return model.ExportDescriptor{}, err
+		}
+	case model.ExportTypeIncremental:
+		if opts.ExportFromTime.IsZero() || opts.ExportToTime.IsZero() {
+			return model.ExportDescriptor{}, fmt.Errorf("ExportFromTime and ExportToTime must be specified for an incremental export")
+		}
+		if !opts.ExportToTime.After(opts.ExportFromTime) {
+			return model.ExportDescriptor{}, fmt.Errorf("ExportToTime must be after ExportFromTime")
+		}
+		if err := checkExportWindow(status, opts.ExportFromTime, opts.ExportToTime); err != nil {
+			return model.ExportDescriptor{}, err
+		}
+		if opts.ExportViewType == "" {
+			opts.ExportViewType = model.ExportViewNewAndOldImages
+		}
+		if opts.ExportViewType != model.ExportViewNewAndOldImages && opts.ExportViewType != model.ExportViewNewImage {
+			return model.ExportDescriptor{}, fmt.Errorf("ExportViewType must be one of NEW_AND_OLD_IMAGES, NEW_IMAGE")
+		}
+		descriptor.ExportFromTime = opts.ExportFromTime
+		descriptor.ExportToTime = opts.ExportToTime
+		descriptor.ExportViewType = opts.ExportViewType
+	default:
+		return model.ExportDescriptor{}, fmt.Errorf("ExportType must be one of FULL_EXPORT, INCREMENTAL_EXPORT")
+	}
+
+	exportID := descriptor.ExportArn[strings.LastIndex(descriptor.ExportArn, "/")+1:]
+	keyPrefix := path.Join(opts.S3Prefix, "AWSDynamoDB", exportID)
+	writer := newExportWriter(d.options.S3Dir, opts.S3Bucket, keyPrefix, descriptor.ExportFormat)
+
+	var err error
+	if descriptor.ExportType == model.ExportTypeFull {
+		asOf := descriptor.ExportTime.UnixNano()
+		err = d.forEachItemHistory(tableName, func(versions []itemVersion) error {
+			if version := versionAsOf(versions, asOf); version != nil && version.Record != nil {
+				return writer.writeItem(version.Record)
+			}
+			return nil
+		})
+	} else {
+		from, to := descriptor.ExportFromTime.UnixNano(), descriptor.ExportToTime.UnixNano()
+		err = d.forEachItemHistory(tableName, func(versions []itemVersion) error {
+			newVersion := versionAsOf(versions, to)
+			if newVersion == nil || newVersion.Time <= from {
+				return nil
+			}
+			var oldImage model.Record
+			if oldVersion := versionAsOf(versions, from); oldVersion != nil {
+				oldImage = oldVersion.Record
+			}
+			if newVersion.Record == nil && oldImage == nil {
+				return nil
+			}
+			return writer.writeChange(schema, newVersion.Time, oldImage, newVersion.Record, descriptor.ExportViewType == model.ExportViewNewAndOldImages)
+		})
+	}
+	if err != nil {
+		writer.abort()
+		return model.ExportDescriptor{}, err
+	}
+
+	descriptor.EndTime = d.Now()
+	descriptor.ItemCount = writer.itemCount
+	descriptor.BilledSizeBytes = writer.billedSizeBytes
+	descriptor.ExportManifest = path.Join(keyPrefix, "manifest-summary.json")
+	if err := writer.finish(descriptor); err != nil {
+		writer.abort()
+		return model.ExportDescriptor{}, err
+	}
+
+	value, err := json.Marshal(descriptor)
+	if err != nil {
+		return model.ExportDescriptor{}, fmt.Errorf("failed to marshal export descriptor: %w", err)
+	}
+	if err := d.DB.Put([]byte(exportMetaPrefix+descriptor.ExportArn), value); err != nil {
+		return model.ExportDescriptor{}, fmt.Errorf("failed to save export descriptor: %w", err)
+	}
+	return descriptor, nil
+}
+
+func (d *Database) DescribeExport(exportArn string) (model.ExportDescriptor, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	value, err := d.DB.Get([]byte(exportMetaPrefix+exportArn))
+	if err == ErrNotFound {
+		return model.ExportDescriptor{}, fmt.Errorf("%w: %s", ErrExportNotFound, exportArn)
+	}
+	if err != nil {
+		return model.ExportDescriptor{}, err
+	}
+
+	var descriptor model.ExportDescriptor
+	if err := json.Unmarshal(value, &descriptor); err != nil {
+		return model.ExportDescriptor{}, fmt.Errorf("failed to unmarshal export descriptor: %w", err)
+	}
+	return descriptor, nil
+}
+
+func (d *Database) ListExports(tableName string, exclusiveStartArn string, limit int) ([]model.ExportDescriptor, string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	exports, err := d.allExports()
+	if err != nil {
+		return nil, "", err
+	}
+
+	filtered := exports[:0]
+	for _, export := range exports {
+		if tableName == "" || export.TableName == tableName {
+			filtered = append(filtered, export)
+		}
+	}
+	exports = filtered
+
+	if exclusiveStartArn != "" {
+		for i, export := range exports {
+			if export.ExportArn == exclusiveStartArn {
+				exports = exports[i+1:]
+				break
+			}
+		}
+	}
+
+	lastEvaluated := ""
+	if limit > 0 && len(exports) > limit {
+		exports = exports[:limit]
+		lastEvaluated = exports[limit-1].ExportArn
+	}
+	return exports, lastEvaluated, nil
+}
+
+func (d *Database) allExports() ([]model.ExportDescriptor, error) {
+	var exports []model.ExportDescriptor
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(exportMetaPrefix)))
+	defer iter.Release()
+
+	for iter.Next() {
+		var descriptor model.ExportDescriptor
+		if err := json.Unmarshal(iter.Value(), &descriptor); err != nil {
+			continue
+		}
+		exports = append(exports, descriptor)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(exports, func(i, j int) bool {
+		if exports[i].StartTime.Equal(exports[j].StartTime) {
+			return exports[i].ExportArn < exports[j].ExportArn
+		}
+		return exports[i].StartTime.Before(exports[j].StartTime)
+	})
+	return exports, nil
+}
+
+func (d *Database) findExportByClientToken(clientToken string) (model.ExportDescriptor, bool, error) {
+	exports, err := d.allExports()
+	if err != nil {
+		return model.ExportDescriptor{}, false, err
+	}
+	for _, export := range exports {
+		if export.ClientToken == clientToken {
+			return export, true, nil
+		}
+	}
+	return model.ExportDescriptor{}, false, nil
+}
+
+func checkExportWindow(status ContinuousBackupsStatus, from, to time.Time) error {
+	if from.Before(status.EarliestRestorableTime) || to.After(status.LatestRestorableTime) {
+		return fmt.Errorf("%w: %s is not between %s and %s", ErrInvalidExportTime,
+			from.UTC().Format(time.RFC3339), status.EarliestRestorableTime.UTC().Format(time.RFC3339), status.LatestRestorableTime.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func validateS3Location(bucket, prefix string) error {
+	if bucket == "" {
+		return fmt.Errorf("S3Bucket must be specified")
+	}
+	if bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `/\`) {
+		return fmt.Errorf("invalid S3Bucket: %s", bucket)
+	}
+	if strings.Contains(prefix, `\`) {
+		return fmt.Errorf("invalid S3Prefix: %s", prefix)
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == ".." {
+			return fmt.Errorf("invalid S3Prefix: %s", prefix)
+		}
+	}
+	return nil
+}
+
+func s3ObjectPath(s3Dir, bucket, key string) string {
+	return filepath.Join(s3Dir, bucket, filepath.FromSlash(key))
+}
+
+func tableID(tableName string) string {
+	sum := md5.Sum([]byte(TableArn(tableName)))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+type exportDataFile struct {
+	ItemCount int64 `json:"itemCount"`
+	MD5Checksum string `json:"md5Checksum"`
+	ETag string `json:"etag"`
+	DataFileS3Key string `json:"dataFileS3Key"`
+}
+
+type exportManifestSummary struct {
+	Version string `json:"version"`
+	ExportArn string `json:"exportArn"`
+	StartTime string `json:"startTime"`
+	EndTime string `json:"endTime"`
+	TableArn string `json:"tableArn"`
+	TableId string `json:"tableId"`
+	ExportTime string `json:"exportTime,omitempty"`
+	ExportFromTime string `json:"exportFromTime,omitempty"`
+	ExportToTime string `json:"exportToTime,omitempty"`
+	S3Bucket string `json:"s3Bucket"`
+	S3Prefix *string `json:"s3Prefix"`
+	S3SseAlgorithm string `json:"s3SseAlgorithm"`
+	S3SseKmsKeyId *string `json:"s3SseKmsKeyId"`
+	ManifestFilesS3Key string `json:"manifestFilesS3Key"`
+	BilledSizeBytes int64 `json:"billedSizeBytes"`
+	ItemCount int64 `json:"itemCount"`
+	OutputFormat string `json:"outputFormat"`
+	OutputView string `json:"outputView,omitempty"`
+	ExportType string `json:"exportType"`
+}
+
+type exportWriter struct {
+	s3Dir string
+	bucket string
+	keyPrefix string
+	format string
+
+	file *os.File
+	gz *gzip.Writer
+	hash hash.Hash
+	fileKey string
+	fileItems int64
+
+	dataFiles []exportDataFile
+	itemCount int64
+	billedSizeBytes int64
+}
+
+func newExportWriter(s3Dir, bucket, keyPrefix, format string) *exportWriter {
+	return &exportWriter{s3Dir: s3Dir, bucket: bucket, keyPrefix: keyPrefix, format: format}
+}
+
+func (w *exportWriter) writeItem(record model.Record) error {
+	var line string
+	if w.format == model.ExportFormatIon {
+		item, err := marshalIonRecord(record)
+		if err != nil {
+			return err
+		}
+		line = "{Item:" + item + "}"
+	} else {
+		value, err := json.Marshal(struct {
+			Item model.Record `json:"Item"`
+		}{record})
+		if err != nil {
+			return err
+		}
+		line = string(value)
+	}
+	return w.writeLine(line, ItemSize(record))
+}
+
+func (w *exportWriter) writeChange(schema model.TableSchema, writeTime int64, oldImage, newImage model.Record, includeOldImage bool) error {
+	image := newImage
+	if image == nil {
+		image = oldImage
+	}
+	keys := model.Record(GetItemKey(image, schema))
+	if !includeOldImage {
+		oldImage = nil
+	}
+	micros := writeTime / int64(time.Microsecond)
+
+	var line string
+	if w.format == model.ExportFormatIon {
+		var b strings.Builder
+		b.WriteString("{Metadata:{WriteTimestampMicros:" + strconv.FormatInt(micros, 10) + "},Keys:")
+		if err := writeIonStruct(&b, recordFields(keys)); err != nil {
+			return err
+		}
+		if newImage != nil {
+			b.WriteString(",NewImage:")
+			if err := writeIonStruct(&b, recordFields(newImage)); err != nil {
+				return err
+			}
+		}
+		if oldImage != nil {
+			b.WriteString(",OldImage:")
+			if err := writeIonStruct(&b, recordFields(oldImage)); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+		line = b.String()
+	} else {
+		value, err := json.Marshal(struct {
+			Metadata map[string]model.AttributeValue `json:"Metadata"`
+			Keys model.Record `json:"Keys"`
+			NewImage model.Record `json:"NewImage,omitempty"`
+			OldImage model.Record `json:"OldImage,omitempty"`
+		}{
+			Metadata: map[string]model.AttributeValue{"WriteTimestampMicros": {"N": strconv.FormatInt(micros, 10)}},
+			Keys: keys,
+			NewImage: newImage,
+			OldImage: oldImage,
+		})
+		if err != nil {
+			return err
+		}
+		line = string(value)
+	}
+	return w.writeLine(line, ItemSize(image))
+}
+
+func (w *exportWriter) writeLine(line string, size int) error {
+	if w.file == nil {
+		if err := w.openFile(); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w.gz, line+"\n"); err != nil {
+		return fmt.Errorf("failed to write export data: %w", err)
+	}
+	w.fileItems++
+	w.itemCount++
+	w.billedSizeBytes += int64(size)
+
+	if w.fileItems >= exportItemsPerFile {
+		return w.closeFile()
+	}
+	return nil
+}
+
+func (w *exportWriter) openFile() error {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return err
+	}
+	name := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random[:]))
+	w.fileKey = path.Join(w.keyPrefix, "data", name+".json.gz")
+
+	filePath := s3ObjectPath(w.s3Dir, w.bucket, w.fileKey)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create export data file: %w", err)
+	}
+
+	w.file = file
+	w.hash = md5.New()
+	w.gz = gzip.NewWriter(io.MultiWriter(file, w.hash))
+	w.fileItems = 0
+
+	if w.format == model.ExportFormatIon {
+		if _, err := io.WriteString(w.gz, ionVersionMarker+" "); err != nil {
+			return fmt.Errorf("failed to write export data: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *exportWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.gz.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to finish export data file: %w", err)
+	}
+
+	sum := w.hash.Sum(nil)
+	w.dataFiles = append(w.dataFiles, exportDataFile{
+		ItemCount: w.fileItems,
+		MD5Checksum: base64.StdEncoding.EncodeToString(sum),
+		ETag: hex.EncodeToString(sum),
+		DataFileS3Key: w.fileKey,
+	})
+	return nil
+}
+
+func (w *exportWriter) finish(descriptor model.ExportDescriptor) error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	var files strings.Builder
+	for _, dataFile := range w.dataFiles {
+		line, err := json.Marshal(dataFile)
+		if err != nil {
+			return err
+		}
+		files.Write(line)
+		files.WriteByte('\n')
+	}
+	manifestFilesKey := path.Join(w.keyPrefix, "manifest-files.json")
+	if err := w.writeObject(manifestFilesKey, []byte(files.String())); err != nil {
+		return err
+	}
+
+	summary := exportManifestSummary{
+		Version: exportManifestVersion,
+		ExportArn: descriptor.ExportArn,
+		StartTime: descriptor.StartTime.UTC().Format(exportTimeLayout),
+		EndTime: descriptor.EndTime.UTC().Format(exportTimeLayout),
+		TableArn: descriptor.TableArn,
+		TableId: descriptor.TableId,
+		S3Bucket: descriptor.S3Bucket,
+		S3SseAlgorithm: descriptor.S3SseAlgorithm,
+		ManifestFilesS3Key: manifestFilesKey,
+		BilledSizeBytes: descriptor.BilledSizeBytes,
+		ItemCount: descriptor.ItemCount,
+		OutputFormat: descriptor.ExportFormat,
+		OutputView: descriptor.ExportViewType,
+		ExportType: descriptor.ExportType,
+	}
+	if descriptor.S3Prefix != "" {
+		summary.S3Prefix = &descriptor.S3Prefix
+	}
+	if descriptor.ExportType == model.ExportTypeFull {
+		summary.ExportTime = descriptor.ExportTime.UTC().Format(exportTimeLayout)
+	} else {
+		summary.ExportFromTime = descriptor.ExportFromTime.UTC().Format(exportTimeLayout)
+		summary.ExportToTime = descriptor.ExportToTime.UTC().Format(exportTimeLayout)
+	}
+
+	summaryBytes, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return w.writeObject(descriptor.ExportManifest, summaryBytes)
+}
+
+func (w *exportWriter) writeObject(key string, data []byte) error {
+	objectPath := s3ObjectPath(w.s3Dir, w.bucket, key)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	if err := os.WriteFile(objectPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	sum := md5.Sum(data)
+	md5Path := strings.TrimSuffix(objectPath, ".json") + ".md5"
+	if err := os.WriteFile(md5Path, []byte(hex.EncodeToString(sum[:])), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum for %s: %w", key, err)
+	}
+	return nil
+}
+
+func (w *exportWriter) abort() {
+	if w.file != nil {
+		w.gz.Close()
+		w.file.Close()
+		w.file = nil
+	}
+	os.RemoveAll(s3ObjectPath(w.s3Dir, w.bucket, w.keyPrefix))
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	maxExpressionBytes = 4096
+	maxExpressionOperators = 300
+)
+
+// expressionParams is the order expressions of one request are validated in.
+var expressionParams = []string{"KeyConditionExpression", "ConditionExpression", "UpdateExpression", "FilterExpression", "ProjectionExpression"}
+
+// expressionKeywords are the words of each expression grammar that are not
+// attribute names, and so not subject to the reserved word check.
+var expressionKeywords = map[string]map[string]bool{
+	"KeyConditionExpression": {"AND": true, "BETWEEN": true},
+	"ConditionExpression": {"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "IN": true},
+	"FilterExpression": {"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "IN": true},
+	"UpdateExpression": {"SET": true, "REMOVE": true, "ADD": true, "DELETE": true},
+	"ProjectionExpression": {},
+}
+
+// ValidateExpressions checks the expressions of one request, keyed by
+// parameter name, against the placeholders the request defines, the way
+// DynamoDB does before evaluating anything: no empty or oversized
+// expressions, no undefined placeholders, no reserved words as bare
+// attribute names, at most 300 operators, and no unused placeholders.
+func ValidateExpressions(expressions map[string]string, names map[string]string, values map[string]model.AttributeValue) error {
+	usedNames := make(map[string]bool)
+	usedValues := make(map[string]bool)
+
+	for _, param := range expressionParams {
+		expression, ok := expressions[param]
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(expression) == "" {
+			return fmt.Errorf("Invalid %s: The expression can not be empty;", param)
+		}
+		if len(expression) > maxExpressionBytes {
+			return fmt.Errorf("Invalid %s: Expression size has exceeded the maximum allowed size; expression size: %d", param, len(expression))
+		}
+
+		operators := 0
+		for _, token := range expressionTokens(expression) {
+			switch {
+			case token.kind == expressionNamePlaceholder:
+				if _, ok := names[token.text]; !ok {
+					return fmt.Errorf("Invalid %s: An expression attribute name used in the document path is not defined; attribute name: %s", param, token.text)
+				}
+				usedNames[token.text] = true
+			case token.kind == expressionValuePlaceholder:
+				if _, ok := values[token.text]; !ok {
+					return fmt.Errorf("Invalid %s: An expression attribute value used in expression is not defined; attribute value: %s", param, token.text)
+				}
+				usedValues[token.text] = true
+			case token.kind == expressionFunction || token.kind == expressionOperator:
+				operators++
+			case expressionKeywords[param][strings.ToUpper(token.text)]:
+				// Clause keywords of an UpdateExpression are not operators.
+				if param != "UpdateExpression" {
+					operators++
+				}
+			case isReservedWord(token.text):
+				return fmt.Errorf("Invalid %s: Attribute name is a reserved keyword; reserved keyword: %s", param, token.text)
+			}
+		}
+		if operators > maxExpressionOperators {
+			return fmt.Errorf("Invalid %s: The expression contains too many operators; operator count: %d", param, operators)
+		}
+	}
+
+	if unused := unusedPlaceholders(names, usedNames); unused != "" {
+		return fmt.Errorf("Value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", unused)
+	}
+	valueKeys := make(map[string]string, len(values))
+	for placeholder := range values {
+		valueKeys[placeholder] = ""
+	}
+	if unused := unusedPlaceholders(valueKeys, usedValues); unused != "" {
+		return fmt.Errorf("Value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", unused)
+	}
+	return nil
+}
+
+func unusedPlaceholders(defined map[string]string, used map[string]bool) string {
+	var unused []string
+	for placeholder := range defined {
+		if !used[placeholder] {
+			unused = append(unused, placeholder)
+		}
+	}
+	sort.Strings(unused)
+	return strings.Join(unused, ", ")
+}
+
+type expressionTokenKind int
+
+const (
+	expressionIdentifier expressionTokenKind = iota
+	expressionNamePlaceholder
+	expressionValuePlaceholder
+	expressionFunction
+	expressionOperator
+)
+
+type expressionToken struct {
+	kind expressionTokenKind
+	text string
+}
+
+// expressionTokens splits an expression into the tokens validation looks at:
+// identifiers, placeholders, function names and comparison or arithmetic
+// operators. Punctuation and list indexes are dropped.
+func expressionTokens(expression string) []expressionToken {
+	var tokens []expressionToken
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == '#' || c == ':' || isPathNameRune(rune(c)):
+			start := i
+			i++
+			for i < len(expression) && isPathNameRune(rune(expression[i])) {
+				i++
+			}
+			text := expression[start:i]
+			switch {
+			case c == '#':
+				tokens = append(tokens, expressionToken{expressionNamePlaceholder, text})
+			case c == ':':
+				tokens = append(tokens, expressionToken{expressionValuePlaceholder, text})
+			case c >= '0' && c <= '9':
+			case strings.HasPrefix(strings.TrimLeft(expression[i:], " "), "("):
+				tokens = append(tokens, expressionToken{expressionFunction, text})
+			default:
+				tokens = append(tokens, expressionToken{expressionIdentifier, text})
+			}
+		case c == '<' || c == '>':
+			if i+1 < len(expression) && (expression[i+1] == '=' || c == '<' && expression[i+1] == '>') {
+				i++
+			}
+			i++
+			tokens = append(tokens, expressionToken{kind: expressionOperator})
+		case c == '=' || c == '+' || c == '-':
+			i++
+			tokens = append(tokens, expressionToken{kind: expressionOperator})
+		default:
+			i++
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,338 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrFaultRuleNotFound = errors.New("fault rule not found")
+
+// FaultRule makes matching requests fail, slow down or lose their connection.
+// Empty match fields match everything. A rule fires on every match, on the
+// NthCall-th match only, or on every NthCall-th match when Repeat is set, and
+// then only with Probability when that is set.
+type FaultRule struct {
+	Name string `json:"Name"`
+	Operations []string `json:"Operations,omitempty"`
+	TableName string `json:"TableName,omitempty"`
+	IndexName string `json:"IndexName,omitempty"`
+	KeyPrefix string `json:"KeyPrefix,omitempty"`
+
+	Probability float64 `json:"Probability,omitempty"`
+	NthCall int `json:"NthCall,omitempty"`
+	Repeat bool `json:"Repeat,omitempty"`
+
+	ErrorCode string `json:"ErrorCode,omitempty"`
+	ErrorMessage string `json:"ErrorMessage,omitempty"`
+	Latency *FaultLatency `json:"Latency,omitempty"`
+	DropConnection bool `json:"DropConnection,omitempty"`
+}
+
+// FaultLatency describes the delay added by a rule, in milliseconds.
+// Distribution is FIXED (Millis), UNIFORM (MinMillis to MaxMillis), NORMAL
+// (mean Millis, StdDevMillis) or EXPONENTIAL (mean Millis). Samples are
+// clamped to MinMillis and, when set, MaxMillis.
+type FaultLatency struct {
+	Distribution string `json:"Distribution,omitempty"`
+	Millis float64 `json:"Millis,omitempty"`
+	MinMillis float64 `json:"MinMillis,omitempty"`
+	MaxMillis float64 `json:"MaxMillis,omitempty"`
+	StdDevMillis float64 `json:"StdDevMillis,omitempty"`
+}
+
+type FaultRuleStatus struct {
+	FaultRule
+	MatchedCount int `json:"MatchedCount"`
+	InjectedCount int `json:"InjectedCount"`
+}
+
+// FaultRequest is what rules are matched against. PartitionKeys holds the
+// partition key values the request touches, as strings.
+type FaultRequest struct {
+	Operation string
+	TableNames []string
+	IndexName string
+	PartitionKeys []string
+}
+
+type FaultError struct {
+	Code string
+	Message string
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+type FaultDecision struct {
+	Delay time.Duration
+	Error *FaultError
+	DropConnection bool
+}
+
+type faultConfigFile struct {
+	Seed *int64 `json:"Seed,omitempty"`
+	Rules []FaultRule `json:"Rules"`
+}
+
+type faultRuleState struct {
+	rule FaultRule
+	matched int
+	injected int
+}
+
+var faultErrors = map[string]FaultError{
+	"ProvisionedThroughputExceededException": {
+		Message: "The level of configured provisioned throughput for the table was exceeded. Consider increasing your provisioning level with the UpdateTable API.",
+	},
+	"ThrottlingException": {
+		Message: "Rate of requests exceeds the allowed throughput.",
+	},
+	"RequestLimitExceeded": {
+		Message: "Throughput exceeds the current throughput limit for your account. Please contact AWS Support at https://aws.amazon.com/support request a limit increase",
+	},
+	"TransactionConflictException": {
+		Message: "Transaction is ongoing for the item",
+	},
+	"InternalServerError": {
+		Message: "Internal server error",
+	},
+}
+
+func validateFaultRule(rule FaultRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("fault rule name must be specified")
+	}
+	if rule.ErrorCode == "" && rule.Latency == nil && !rule.DropConnection {
+		return fmt.Errorf("fault rule %s must set ErrorCode, Latency or DropConnection", rule.Name)
+	}
+	if rule.ErrorCode != "" {
+		if _, ok := faultErrors[rule.ErrorCode]; !ok {
+			return fmt.Errorf("unsupported fault ErrorCode %s", rule.ErrorCode)
+		}
+		if rule.DropConnection {
+			return fmt.Errorf("fault rule %s cannot both return an error and drop the connection", rule.Name)
+		}
+	}
+	if rule.Probability < 0 || rule.Probability > 1 {
+		return fmt.Errorf("fault Probability must be between 0 and 1")
+	}
+	if rule.NthCall < 0 {
+		return fmt.Errorf("fault NthCall must not be negative")
+	}
+	if rule.Repeat && rule.NthCall == 0 {
+		return fmt.Errorf("fault Repeat requires NthCall")
+	}
+	if l := rule.Latency; l != nil {
+		switch strings.ToUpper(l.Distribution) {
+		case "", "FIXED", "NORMAL", "EXPONENTIAL":
+			if l.Millis < 0 || l.StdDevMillis < 0 {
+				return fmt.Errorf("fault latency must not be negative")
+			}
+		case "UNIFORM":
+			if l.MinMillis < 0 || l.MaxMillis < l.MinMillis {
+				return fmt.Errorf("fault latency needs 0 <= MinMillis <= MaxMillis")
+			}
+		default:
+			return fmt.Errorf("unsupported fault latency Distribution %s", l.Distribution)
+		}
+	}
+	return nil
+}
+
+// AddFaultRule adds a rule, replacing any rule of the same name and resetting
+// its counters.
+func (d *Database) AddFaultRule(rule FaultRule) error {
+	if err := validateFaultRule(rule); err != nil {
+		return err
+	}
+
+	d.faultsMu.Lock()
+	defer d.faultsMu.Unlock()
+
+	for i, state := range d.faultRules {
+		if state.rule.Name == rule.Name {
+			d.faultRules[i] = &faultRuleState{rule: rule}
+			return nil
+		}
+	}
+	d.faultRules = append(d.faultRules, &faultRuleState{rule: rule})
+	return nil
+}
+
+func (d *Database) RemoveFaultRule(name string) error {
+	d.faultsMu.Lock()
+	defer d.faultsMu.Unlock()
+
+	for i, state := range d.faultRules {
+		if state.rule.Name == name {
+			d.faultRules = append(d.faultRules[:i:i], d.faultRules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrFaultRuleNotFound, name)
+}
+
+func (d *Database) ClearFaultRules() {
+	d.faultsMu.Lock()
+	defer d.faultsMu.Unlock()
+	d.faultRules = nil
+}
+
+func (d *Database) ListFaultRules() []FaultRuleStatus {
+	d.faultsMu.Lock()
+	defer d.faultsMu.Unlock()
+
+	statuses := make([]FaultRuleStatus, 0, len(d.faultRules))
+	for _, state := range d.faultRules {
+		statuses = append(statuses, FaultRuleStatus{FaultRule: state.rule, MatchedCount: state.matched, InjectedCount: state.injected})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// LoadFaultRules replaces the rules with those in a JSON file of the form
+// {"Seed": 1, "Rules": [...]}. Seed makes probabilities and latencies
+// repeatable.
+func (d *Database) LoadFaultRules(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fault rules: %w", err)
+	}
+	var config faultConfigFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse fault rules: %w", err)
+	}
+
+	states := make([]*faultRuleState, 0, len(config.Rules))
+	seen := make(map[string]bool)
+	for _, rule := range config.Rules {
+		if err := validateFaultRule(rule); err != nil {
+			return err
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("duplicate fault rule %s", rule.Name)
+		}
+		seen[rule.Name] = true
+		states = append(states, &faultRuleState{rule: rule})
+	}
+
+	d.faultsMu.Lock()
+	defer d.faultsMu.Unlock()
+	d.faultRules = states
+	if config.Seed != nil {
+		d.faultRand = rand.New(rand.NewSource(*config.Seed))
+	}
+	return nil
+}
+
+// InjectFault matches req against the rules in order. Delays of all firing
+// rules add up; the first firing error or dropped connection wins.
+func (d *Database) InjectFault(req FaultRequest) FaultDecision {
+	d.faultsMu.Lock()
+	defer d.faultsMu.Unlock()
+
+	var decision FaultDecision
+	for _, state := range d.faultRules {
+		if !state.rule.matches(req) {
+			continue
+		}
+		state.matched++
+		if !d.faultFires(state) {
+			continue
+		}
+		state.injected++
+
+		rule := state.rule
+		if rule.Latency != nil {
+			decision.Delay += d.sampleFaultLatency(*rule.Latency)
+		}
+		if decision.Error != nil || decision.DropConnection {
+			continue
+		}
+		if rule.DropConnection {
+			decision.DropConnection = true
+		} else if rule.ErrorCode != "" {
+			faultErr := faultErrors[rule.ErrorCode]
+			faultErr.Code = rule.ErrorCode
+			if rule.ErrorMessage != "" {
+				faultErr.Message = rule.ErrorMessage
+			}
+			decision.Error = &faultErr
+		}
+	}
+	return decision
+}
+
+func (r FaultRule) matches(req FaultRequest) bool {
+	if len(r.Operations) > 0 && !containsString(r.Operations, req.Operation) {
+		return false
+	}
+	if r.TableName != "" && !containsString(req.TableNames, r.TableName) {
+		return false
+	}
+	if r.IndexName != "" && r.IndexName != req.IndexName {
+		return false
+	}
+	if r.KeyPrefix != "" {
+		for _, key := range req.PartitionKeys {
+			if strings.HasPrefix(key, r.KeyPrefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (d *Database) faultFires(state *faultRuleState) bool {
+	rule := state.rule
+	if rule.NthCall > 0 {
+		if rule.Repeat {
+			if state.matched%rule.NthCall != 0 {
+				return false
+			}
+		} else if state.matched != rule.NthCall {
+			return false
+		}
+	}
+	if rule.Probability > 0 {
+		return d.faultRand.Float64() < rule.Probability
+	}
+	return true
+}
+
+func (d *Database) sampleFaultLatency(l FaultLatency) time.Duration {
+	var millis float64
+	switch strings.ToUpper(l.Distribution) {
+	case "UNIFORM":
+		millis = l.MinMillis + d.faultRand.Float64()*(l.MaxMillis-l.MinMillis)
+	case "NORMAL":
+		millis = l.Millis + d.faultRand.NormFloat64()*l.StdDevMillis
+	case "EXPONENTIAL":
+		millis = d.faultRand.ExpFloat64() * l.Millis
+	default:
+		millis = l.Millis
+	}
+	millis = math.Max(millis, l.MinMillis)
+	if l.MaxMillis > 0 {
+		millis = math.Min(millis, l.MaxMillis)
+	}
+	return time.Duration(millis * float64(time.Millisecond))
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
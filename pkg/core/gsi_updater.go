@@ -2,16 +2,105 @@ package core
 
 import (
 	"fmt"
+
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
-func UpdateGSI(batch *leveldb.Batch, schema model.TableSchema, oldRecord model.Record, newRecord model.Record) {
-	if len(schema.GSIs) == 0 {
+// migrateIndexKeys rewrites index entries stored under the old unscoped
+// IndexName$... keys, which tables sharing an index name used to share, into
+// per-table entries rebuilt from the base items.
+func (d *Database) migrateIndexKeys() error {
+	batch := new(Batch)
+	flush := func() error {
+		if batch.Len() < backupCopyBatchSize {
+			return nil
+		}
+		if err := d.DB.Write(batch); err != nil {
+			return fmt.Errorf("failed to migrate index entries: %w", err)
+		}
+		batch.Reset()
+		return nil
+	}
+
+	indexNames := make(map[string]bool)
+	for _, schema := range d.Tables {
+		for _, indexes := range []map[string]model.GsiSchema{schema.GSIs, schema.LSIs} {
+			for indexName := range indexes {
+				indexNames[indexName] = true
+			}
+		}
+	}
+
+	legacy := make(map[string]bool)
+	for indexName := range indexNames {
+		iter := d.DB.NewIterator(PrefixRange([]byte(indexName + model.GSIKeySeparator)))
+		for iter.Next() {
+			legacy[indexName] = true
+			batch.Delete(append([]byte(nil), iter.Key()...))
+			if err := flush(); err != nil {
+				iter.Release()
+				return err
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+
+	for _, schema := range d.Tables {
+		rebuild := false
+		for _, indexes := range []map[string]model.GsiSchema{schema.GSIs, schema.LSIs} {
+			for indexName := range indexes {
+				rebuild = rebuild || legacy[indexName]
+			}
+		}
+		if !rebuild {
+			continue
+		}
+
+		iter := d.DB.NewIterator(PrefixRange([]byte(schema.TableName + model.KeySeparator)))
+		for iter.Next() {
+			record, err := model.UnmarshalRecord(iter.Value())
+			if err != nil {
+				continue
+			}
+			UpdateGSI(batch, schema, nil, record)
+			UpdateLSI(batch, schema, nil, record)
+			if err := flush(); err != nil {
+				iter.Release()
+				return err
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+	if err := d.DB.Write(batch); err != nil {
+		return fmt.Errorf("failed to migrate index entries: %w", err)
+	}
+	return nil
+}
+
+func UpdateGSI(batch *Batch, schema model.TableSchema, oldRecord model.Record, newRecord model.Record) {
+	updateIndexes(batch, schema, schema.GSIs, oldRecord, newRecord)
+}
+
+func UpdateLSI(batch *Batch, schema model.TableSchema, oldRecord model.Record, newRecord model.Record) {
+	updateIndexes(batch, schema, schema.LSIs, oldRecord, newRecord)
+}
+
+func updateIndexes(batch *Batch, schema model.TableSchema, indexes map[string]model.GsiSchema, oldRecord model.Record, newRecord model.Record) {
+	if len(indexes) == 0 {
 		return
 	}
 
-	for _, gsiSchema := range schema.GSIs {
+	for _, gsiSchema := range indexes {
 		oldPKVal, oldSKVal, oldGSIExists := getGSIKeyValues(oldRecord, gsiSchema)
 		newPKVal, newSKVal, newGSIExists := getGSIKeyValues(newRecord, gsiSchema)
 		
@@ -35,14 +124,14 @@ func UpdateGSI(batch *leveldb.Batch, schema model.TableSchema, oldRecord model.R
 		if oldGSIExists {
 			
 			if !newGSIExists || oldPKVal != newPKVal || oldSKVal != newSKVal {
-				oldGSIKey := model.BuildGSILevelDBKey(gsiSchema.IndexName, oldPKVal, oldSKVal, basePKVal)
+				oldGSIKey := model.BuildGSILevelDBKey(schema.TableName, gsiSchema.IndexName, oldPKVal, oldSKVal, basePKVal)
 				batch.Delete([]byte(oldGSIKey))
 			}
 		}
 
 		
 		if newGSIExists {
-			newGSIKey := model.BuildGSILevelDBKey(gsiSchema.IndexName, newPKVal, newSKVal, basePKVal)
+			newGSIKey := model.BuildGSILevelDBKey(schema.TableName, gsiSchema.IndexName, newPKVal, newSKVal, basePKVal)
 			
 			
 			gsiValue, err := model.MarshalRecord(newRecord)
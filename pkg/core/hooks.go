@@ -0,0 +1,211 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type Operation string
+
+const (
+	OpGetItem Operation = "GetItem"
+	OpBatchGetItem Operation = "BatchGetItem"
+	OpTransactGetItems Operation = "TransactGetItems"
+	OpQuery Operation = "Query"
+	OpScan Operation = "Scan"
+	OpPutItem Operation = "PutItem"
+	OpUpdateItem Operation = "UpdateItem"
+	OpDeleteItem Operation = "DeleteItem"
+	OpBatchWriteItem Operation = "BatchWriteItem"
+	OpTransactWriteItems Operation = "TransactWriteItems"
+	OpExecuteStatement Operation = "ExecuteStatement"
+	OpBatchExecuteStatement Operation = "BatchExecuteStatement"
+	OpExecuteTransaction Operation = "ExecuteTransaction"
+	OpTimeToLive Operation = "TimeToLive"
+)
+
+// HookContext is what a hook sees. Input is the parsed request of the
+// operation (e.g. *model.PutItemInput for PutItem). For writes there is one
+// context per changed item: Before hooks run before the change is staged and
+// may modify NewItem but not its key attributes (nil deletes the item), After
+// hooks run once the batch is written and can inspect everything it held,
+// index entries included. For reads, After hooks get the items read in
+// Items; BatchGetItem and TransactGetItems run them once per key.
+type HookContext struct {
+	Operation Operation
+	TableName string
+	Input interface{}
+	Key string
+	OldItem model.Record
+	NewItem model.Record
+	Items []model.Record
+	Batch *Batch
+}
+
+type Hook func(ctx *HookContext) error
+
+// HookError makes a hook fail the operation with the DynamoDB error Code
+// instead of an internal server error.
+type HookError struct {
+	Code string
+	Message string
+}
+
+func NewHookError(code, message string) *HookError {
+	return &HookError{Code: code, Message: message}
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+type hookPhase int
+
+const (
+	hookBefore hookPhase = iota
+	hookAfter
+)
+
+type registeredHook struct {
+	id int
+	phase hookPhase
+	operation Operation
+	tableName string
+	fn Hook
+}
+
+// HookRegistry holds the hooks of one Database. An empty operation or table
+// name matches every operation or table. Hooks run in registration order,
+// mostly while the database lock is held, so they must not call back into
+// the Database.
+type HookRegistry struct {
+	mu sync.RWMutex
+	nextID int
+	hooks []registeredHook
+}
+
+func newHookRegistry() *HookRegistry {
+	return &HookRegistry{}
+}
+
+// Before registers a hook that runs before each matching item change or read.
+// Returning an error aborts the whole operation. The returned func removes
+// the hook.
+func (r *HookRegistry) Before(operation Operation, tableName string, hook Hook) func() {
+	return r.add(hookBefore, operation, tableName, hook)
+}
+
+// After registers a hook that runs once a matching operation has been
+// applied. Returning an error makes the request fail although its writes
+// stay in place, which is how a lost response looks to a client.
+func (r *HookRegistry) After(operation Operation, tableName string, hook Hook) func() {
+	return r.add(hookAfter, operation, tableName, hook)
+}
+
+func (r *HookRegistry) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = nil
+}
+
+func (r *HookRegistry) add(phase hookPhase, operation Operation, tableName string, hook Hook) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	id := r.nextID
+	r.hooks = append(r.hooks, registeredHook{id: id, phase: phase, operation: operation, tableName: tableName, fn: hook})
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, h := range r.hooks {
+			if h.id == id {
+				r.hooks = append(r.hooks[:i:i], r.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (r *HookRegistry) run(phase hookPhase, ctx *HookContext) error {
+	r.mu.RLock()
+	var matched []Hook
+	for _, h := range r.hooks {
+		if h.phase != phase {
+			continue
+		}
+		if h.operation != "" && h.operation != ctx.Operation {
+			continue
+		}
+		if h.tableName != "" && h.tableName != ctx.TableName {
+			continue
+		}
+		matched = append(matched, h.fn)
+	}
+	r.mu.RUnlock()
+
+	for _, hook := range matched {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewOperationBatch returns a batch whose item changes run the hooks of
+// operation. Changes staged in a plain Batch, such as restores and imports,
+// run no hooks.
+func NewOperationBatch(operation Operation, input interface{}) *Batch {
+	return &Batch{operation: operation, input: input}
+}
+
+// RunBeforeHooks and RunAfterHooks run the hooks of an operation that does not
+// stage item changes in a batch, such as a read.
+func (d *Database) RunBeforeHooks(ctx *HookContext) error {
+	return d.Hooks.run(hookBefore, ctx)
+}
+
+func (d *Database) RunAfterHooks(ctx *HookContext) error {
+	return d.Hooks.run(hookAfter, ctx)
+}
+
+func (d *Database) runItemChangeHooks(batch *Batch, schema model.TableSchema, levelDBKey string, oldRecord model.Record, newRecord model.Record) (model.Record, error) {
+	if batch.operation == "" {
+		return newRecord, nil
+	}
+
+	ctx := &HookContext{
+		Operation: batch.operation,
+		TableName: schema.TableName,
+		Input: batch.input,
+		Key: levelDBKey,
+		OldItem: oldRecord,
+		NewItem: newRecord,
+		Batch: batch,
+	}
+	if err := d.Hooks.run(hookBefore, ctx); err != nil {
+		return nil, err
+	}
+	// The storage key was computed from the item the request sent, so a hook
+	// that moved the item to another key would leave it stored under a key
+	// that no longer matches its attributes.
+	if ctx.NewItem != nil {
+		if key, err := itemLevelDBKey(schema, ctx.NewItem); err != nil || key != levelDBKey {
+			return nil, fmt.Errorf("a Before hook changed the key attributes of the item stored at %s", levelDBKey)
+		}
+	}
+	batch.changes = append(batch.changes, ctx)
+	return ctx.NewItem, nil
+}
+
+func (d *Database) runBatchAfterHooks(batch *Batch) error {
+	for _, ctx := range batch.changes {
+		if err := d.Hooks.run(hookAfter, ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
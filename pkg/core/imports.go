@@ -0,0 +1,669 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	importMetaPrefix = "__IMPORT__" + model.KeySeparator
+
+	importMaxLoggedErrors = 10000
+	importCsvDelimiters = ",\t:;| "
+	importLogGroupName = "/aws-dynamodb/imports"
+)
+
+var (
+	ErrImportNotFound = errors.New("import not found")
+	ErrImportConflict = errors.New("client token was already used for a different import")
+)
+
+// zstdDecoder is shared by all imports; DecodeAll is safe for concurrent use.
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+
+type ImportOptions struct {
+	S3Bucket string
+	S3BucketOwner string
+	S3KeyPrefix string
+	InputFormat string
+	CsvDelimiter string
+	CsvHeaderList []string
+	InputCompressionType string
+	ClientToken string
+	AttributeTypes map[string]string
+}
+
+// ImportTable creates a table and loads it from the objects under
+// <S3Dir>/<bucket>/<key prefix>. Items that cannot be read are skipped,
+// counted and logged to <ImportLogDir>/<import id>.log.
+func (d *Database) ImportTable(schema model.TableSchema, opts ImportOptions) (model.ImportDescriptor, error) {
+	if err := validateS3Location(opts.S3Bucket, opts.S3KeyPrefix); err != nil {
+		return model.ImportDescriptor{}, err
+	}
+
+	switch opts.InputFormat {
+	case model.InputFormatDynamoDBJSON, model.InputFormatIon:
+		if opts.CsvDelimiter != "" || len(opts.CsvHeaderList) > 0 {
+			return model.ImportDescriptor{}, fmt.Errorf("InputFormatOptions are only supported for the CSV input format")
+		}
+	case model.InputFormatCSV:
+		if opts.CsvDelimiter == "" {
+			opts.CsvDelimiter = ","
+		}
+		if len(opts.CsvDelimiter) != 1 || !strings.Contains(importCsvDelimiters, opts.CsvDelimiter) {
+			return model.ImportDescriptor{}, fmt.Errorf("CSV delimiter must be one of comma, tab, colon, semicolon, pipe or space")
+		}
+	default:
+		return model.ImportDescriptor{}, fmt.Errorf("InputFormat must be one of DYNAMODB_JSON, ION, CSV")
+	}
+
+	if opts.InputCompressionType == "" {
+		opts.InputCompressionType = model.InputCompressionNone
+	}
+	switch opts.InputCompressionType {
+	case model.InputCompressionNone, model.InputCompressionGzip, model.InputCompressionZstd:
+	default:
+		return model.ImportDescriptor{}, fmt.Errorf("InputCompressionType must be one of GZIP, ZSTD, NONE")
+	}
+
+	for _, attribute := range schemaKeyAttributes(schema) {
+		switch opts.AttributeTypes[attribute] {
+		case "S", "N", "B":
+		default:
+			return model.ImportDescriptor{}, fmt.Errorf("AttributeDefinitions must define key attribute %s as S, N or B", attribute)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if opts.ClientToken != "" {
+		existing, found, err := d.findImportByClientToken(opts.ClientToken)
+		if err != nil {
+			return model.ImportDescriptor{}, err
+		}
+		if found {
+			if existing.TableName != schema.TableName || existing.S3Bucket != opts.S3Bucket || existing.S3KeyPrefix != opts.S3KeyPrefix {
+				return model.ImportDescriptor{}, fmt.Errorf("%w: %s", ErrImportConflict, opts.ClientToken)
+			}
+			return existing, nil
+		}
+	}
+
+	if _, exists := d.Tables[schema.TableName]; exists {
+		return model.ImportDescriptor{}, fmt.Errorf("%w: %s", ErrTableAlreadyExists, schema.TableName)
+	}
+
+	now := d.Now()
+	descriptor := model.ImportDescriptor{
+		ImportArn: fmt.Sprintf("%s/import/%014d-%08x", TableArn(schema.TableName), now.UnixMilli(), mathrand.Uint32()),
+		ImportStatus: model.ImportStatusCompleted,
+		TableName: schema.TableName,
+		TableArn: TableArn(schema.TableName),
+		TableId: tableID(schema.TableName),
+		ClientToken: opts.ClientToken,
+		S3Bucket: opts.S3Bucket,
+		S3BucketOwner: opts.S3BucketOwner,
+		S3KeyPrefix: opts.S3KeyPrefix,
+		InputFormat: opts.InputFormat,
+		CsvDelimiter: opts.CsvDelimiter,
+		CsvHeaderList: opts.CsvHeaderList,
+		InputCompressionType: opts.InputCompressionType,
+		TableSchema: schema,
+		AttributeTypes: opts.AttributeTypes,
+		StartTime: now,
+	}
+
+	objectKeys, err := listS3Objects(d.options.S3Dir, opts.S3Bucket, opts.S3KeyPrefix)
+	switch {
+	case os.IsNotExist(err):
+		descriptor.ImportStatus = model.ImportStatusFailed
+		descriptor.FailureCode = "S3NoSuchBucket"
+		descriptor.FailureMessage = fmt.Sprintf("The specified bucket does not exist: %s", opts.S3Bucket)
+	case err != nil:
+		return model.ImportDescriptor{}, err
+	case len(objectKeys) == 0:
+		descriptor.ImportStatus = model.ImportStatusFailed
+		descriptor.FailureCode = "S3NoSuchKey"
+		descriptor.FailureMessage = fmt.Sprintf("No objects found under s3://%s/%s", opts.S3Bucket, opts.S3KeyPrefix)
+	}
+
+	if descriptor.ImportStatus == model.ImportStatusCompleted {
+		if err := d.putTableSchema(schema); err != nil {
+			return model.ImportDescriptor{}, err
+		}
+		if err := d.importObjects(&descriptor, objectKeys); err != nil {
+			if _, deleteErr := d.deleteTable(schema.TableName); deleteErr != nil {
+				return model.ImportDescriptor{}, fmt.Errorf("%v (cleanup failed: %v)", err, deleteErr)
+			}
+			return model.ImportDescriptor{}, err
+		}
+	}
+	descriptor.EndTime = d.Now()
+
+	value, err := json.Marshal(descriptor)
+	if err != nil {
+		return model.ImportDescriptor{}, fmt.Errorf("failed to marshal import descriptor: %w", err)
+	}
+	if err := d.DB.Put([]byte(importMetaPrefix+descriptor.ImportArn), value); err != nil {
+		return model.ImportDescriptor{}, fmt.Errorf("failed to save import descriptor: %w", err)
+	}
+	return descriptor, nil
+}
+
+func ImportLogGroupArn() string {
+	return fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", StreamRegion, StreamAccountID, importLogGroupName)
+}
+
+func (d *Database) DescribeImport(importArn string) (model.ImportDescriptor, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	value, err := d.DB.Get([]byte(importMetaPrefix+importArn))
+	if err == ErrNotFound {
+		return model.ImportDescriptor{}, fmt.Errorf("%w: %s", ErrImportNotFound, importArn)
+	}
+	if err != nil {
+		return model.ImportDescriptor{}, err
+	}
+
+	var descriptor model.ImportDescriptor
+	if err := json.Unmarshal(value, &descriptor); err != nil {
+		return model.ImportDescriptor{}, fmt.Errorf("failed to unmarshal import descriptor: %w", err)
+	}
+	return descriptor, nil
+}
+
+func (d *Database) ListImports(tableName string, exclusiveStartArn string, limit int) ([]model.ImportDescriptor, string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	imports, err := d.allImports()
+	if err != nil {
+		return nil, "", err
+	}
+
+	filtered := imports[:0]
+	for _, descriptor := range imports {
+		if tableName == "" || descriptor.TableName == tableName {
+			filtered = append(filtered, descriptor)
+		}
+	}
+	imports = filtered
+
+	if exclusiveStartArn != "" {
+		for i, descriptor := range imports {
+			if descriptor.ImportArn == exclusiveStartArn {
+				imports = imports[i+1:]
+				break
+			}
+		}
+	}
+
+	lastEvaluated := ""
+	if limit > 0 && len(imports) > limit {
+		imports = imports[:limit]
+		lastEvaluated = imports[limit-1].ImportArn
+	}
+	return imports, lastEvaluated, nil
+}
+
+func (d *Database) allImports() ([]model.ImportDescriptor, error) {
+	var imports []model.ImportDescriptor
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(importMetaPrefix)))
+	defer iter.Release()
+
+	for iter.Next() {
+		var descriptor model.ImportDescriptor
+		if err := json.Unmarshal(iter.Value(), &descriptor); err != nil {
+			continue
+		}
+		imports = append(imports, descriptor)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(imports, func(i, j int) bool {
+		if imports[i].StartTime.Equal(imports[j].StartTime) {
+			return imports[i].ImportArn < imports[j].ImportArn
+		}
+		return imports[i].StartTime.Before(imports[j].StartTime)
+	})
+	return imports, nil
+}
+
+func (d *Database) findImportByClientToken(clientToken string) (model.ImportDescriptor, bool, error) {
+	imports, err := d.allImports()
+	if err != nil {
+		return model.ImportDescriptor{}, false, err
+	}
+	for _, descriptor := range imports {
+		if descriptor.ClientToken == clientToken {
+			return descriptor, true, nil
+		}
+	}
+	return model.ImportDescriptor{}, false, nil
+}
+
+func (d *Database) importObjects(descriptor *model.ImportDescriptor, objectKeys []string) error {
+	writer := newImportWriter(d, descriptor.TableSchema)
+	errorLog := &importErrorLog{
+		path: filepath.Join(d.options.ImportLogDir, descriptor.ImportArn[strings.LastIndex(descriptor.ImportArn, "/")+1:]+".log"),
+		importArn: descriptor.ImportArn,
+		bucket: descriptor.S3Bucket,
+	}
+	defer errorLog.close()
+
+	for _, key := range objectKeys {
+		errorLog.key = key
+		size, err := readImportObject(d.options.S3Dir, *descriptor, key, func(index int64, record model.Record, itemErr error) error {
+			descriptor.ProcessedItemCount++
+			if itemErr == nil {
+				itemErr = checkImportedItem(descriptor.TableSchema, descriptor.AttributeTypes, record)
+			}
+			if itemErr != nil {
+				descriptor.ErrorCount++
+				return errorLog.write(index, itemErr)
+			}
+			if err := writer.put(record); err != nil {
+				return err
+			}
+			descriptor.ImportedItemCount++
+			return nil
+		})
+		descriptor.ProcessedSizeBytes += size
+
+		var objectErr *importObjectError
+		if errors.As(err, &objectErr) {
+			descriptor.ErrorCount++
+			if err := errorLog.write(-1, objectErr.err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writer.flush(); err != nil {
+		return err
+	}
+	if errorLog.file != nil {
+		descriptor.ErrorLog = errorLog.path
+	}
+	return nil
+}
+
+// importObjectError marks a source object that could not be read past some
+// point, as opposed to a single bad item or a failure to write the table.
+type importObjectError struct {
+	err error
+}
+
+func (e *importObjectError) Error() string {
+	return e.err.Error()
+}
+
+func readImportObject(s3Dir string, descriptor model.ImportDescriptor, key string, fn func(index int64, record model.Record, itemErr error) error) (int64, error) {
+	file, err := os.Open(s3ObjectPath(s3Dir, descriptor.S3Bucket, key))
+	if err != nil {
+		return 0, &importObjectError{err}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, &importObjectError{err}
+	}
+
+	var reader io.Reader = file
+	switch descriptor.InputCompressionType {
+	case model.InputCompressionGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return info.Size(), &importObjectError{fmt.Errorf("invalid gzip data: %w", err)}
+		}
+		defer gz.Close()
+		reader = gz
+	case model.InputCompressionZstd:
+		// Decoded in full first so that a corrupt object, caught by the frame
+		// checksums, is rejected before any of its items are imported.
+		compressed, err := io.ReadAll(file)
+		if err != nil {
+			return info.Size(), &importObjectError{err}
+		}
+		data, err := zstdDecoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return info.Size(), &importObjectError{fmt.Errorf("invalid zstd data: %w", err)}
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	switch descriptor.InputFormat {
+	case model.InputFormatIon:
+		err = readIonItems(reader, fn)
+	case model.InputFormatCSV:
+		err = readCsvItems(reader, descriptor, fn)
+	default:
+		err = readDynamoDBJSONItems(reader, fn)
+	}
+	return info.Size(), err
+}
+
+func readDynamoDBJSONItems(r io.Reader, fn func(int64, model.Record, error) error) error {
+	reader := bufio.NewReader(r)
+	for index := int64(0); ; {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return &importObjectError{err}
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var item struct {
+				Item model.Record `json:"Item"`
+			}
+			itemErr := json.Unmarshal(trimmed, &item)
+			if itemErr == nil && item.Item == nil {
+				itemErr = fmt.Errorf("missing Item")
+			}
+			if err := fn(index, item.Item, itemErr); err != nil {
+				return err
+			}
+			index++
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func readIonItems(r io.Reader, fn func(int64, model.Record, error) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return &importObjectError{err}
+	}
+	parser, err := newIonParser(string(data))
+	if err != nil {
+		return &importObjectError{err}
+	}
+
+	for index := int64(0); ; index++ {
+		value, ok, err := parser.next()
+		if err != nil {
+			return &importObjectError{err}
+		}
+		if !ok {
+			return nil
+		}
+
+		var record model.Record
+		item, found := ionStructField(value, "Item")
+		if value.kind != ionKindStruct || !found {
+			err = fmt.Errorf("missing Item")
+		} else {
+			record, err = ionRecord(item)
+		}
+		if err := fn(index, record, err); err != nil {
+			return err
+		}
+	}
+}
+
+// CSV values are imported as strings, except for key attributes which take
+// the type from the table's attribute definitions.
+func readCsvItems(r io.Reader, descriptor model.ImportDescriptor, fn func(int64, model.Record, error) error) error {
+	reader := csv.NewReader(r)
+	reader.Comma = rune(descriptor.CsvDelimiter[0])
+	reader.FieldsPerRecord = -1
+
+	header := descriptor.CsvHeaderList
+	if len(header) == 0 {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &importObjectError{fmt.Errorf("invalid CSV header: %w", err)}
+		}
+		header = row
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	for index := int64(0); ; index++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &importObjectError{err}
+		}
+
+		if len(row) != len(header) {
+			err = fmt.Errorf("row has %d fields, expected %d", len(row), len(header))
+			if err := fn(index, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		record := make(model.Record, len(row))
+		for i, value := range row {
+			typ := descriptor.AttributeTypes[header[i]]
+			if typ == "" || !isKeyAttribute(descriptor.TableSchema, header[i]) {
+				typ = "S"
+			}
+			record[header[i]] = model.AttributeValue{typ: value}
+		}
+		if err := fn(index, record, nil); err != nil {
+			return err
+		}
+	}
+}
+
+func checkImportedItem(schema model.TableSchema, attributeTypes map[string]string, record model.Record) error {
+	for name, av := range record {
+		if len(av) != 1 {
+			return fmt.Errorf("invalid attribute value for %s", name)
+		}
+	}
+	for _, attribute := range schemaKeyAttributes(schema) {
+		av, ok := record[attribute]
+		if !ok {
+			if attribute == schema.PartitionKey || attribute == schema.SortKey {
+				return fmt.Errorf("One or more parameter values were invalid: Missing the key %s in the item", attribute)
+			}
+			continue
+		}
+		typ := attributeTypes[attribute]
+		value, ok := av[typ].(string)
+		if !ok {
+			return fmt.Errorf("One or more parameter values were invalid: Type mismatch for key %s expected: %s", attribute, typ)
+		}
+		if value == "" {
+			return fmt.Errorf("One or more parameter values were invalid: An AttributeValue may not contain an empty string for key %s", attribute)
+		}
+		switch typ {
+		case "N":
+			if _, err := model.ParseNumber(value); err != nil {
+				return err
+			}
+		case "B":
+			if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+				return fmt.Errorf("invalid binary value for key %s", attribute)
+			}
+		}
+	}
+	if size := ItemSize(record); size > 400*1024 {
+		return fmt.Errorf("Item size of %d bytes has exceeded the maximum allowed size", size)
+	}
+	return nil
+}
+
+func schemaKeyAttributes(schema model.TableSchema) []string {
+	attributes := []string{schema.PartitionKey}
+	if schema.SortKey != "" {
+		attributes = append(attributes, schema.SortKey)
+	}
+	for _, indexes := range []map[string]model.GsiSchema{schema.GSIs, schema.LSIs} {
+		for _, index := range indexes {
+			attributes = append(attributes, index.PartitionKey)
+			if index.SortKey != "" {
+				attributes = append(attributes, index.SortKey)
+			}
+		}
+	}
+	return uniqueSortedNames(attributes)
+}
+
+func isKeyAttribute(schema model.TableSchema, name string) bool {
+	for _, attribute := range schemaKeyAttributes(schema) {
+		if attribute == name {
+			return true
+		}
+	}
+	return false
+}
+
+// listS3Objects returns the keys in the bucket directory that start with
+// prefix, in S3 listing order.
+func listS3Objects(s3Dir, bucket, prefix string) ([]string, error) {
+	root := filepath.Join(s3Dir, bucket)
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// importWriter is a restoreWriter that tolerates repeated keys: a later item
+// replaces the earlier one, including its index entries.
+type importWriter struct {
+	*restoreWriter
+	pending map[string]model.Record
+}
+
+func newImportWriter(db *Database, schema model.TableSchema) *importWriter {
+	return &importWriter{restoreWriter: newRestoreWriter(db, schema), pending: make(map[string]model.Record)}
+}
+
+func (w *importWriter) put(record model.Record) error {
+	key, err := itemLevelDBKey(w.schema, record)
+	if err != nil {
+		return err
+	}
+
+	old, ok := w.pending[key]
+	if !ok {
+		value, err := w.db.DB.Get([]byte(key))
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err == nil {
+			if old, err = model.UnmarshalRecord(value); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.db.ApplyItemChange(w.batch, w.schema, key, old, record); err != nil {
+		return err
+	}
+	w.pending[key] = record
+
+	if w.batch.Len() >= backupCopyBatchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *importWriter) flush() error {
+	if err := w.restoreWriter.flush(); err != nil {
+		return err
+	}
+	w.pending = make(map[string]model.Record)
+	return nil
+}
+
+type importErrorLog struct {
+	path string
+	importArn string
+	bucket string
+	key string
+
+	file *os.File
+	logged int
+}
+
+// Entries follow the CloudWatch records written by DynamoDB imports; an
+// itemIndex of -1 refers to the object as a whole.
+func (l *importErrorLog) write(index int64, itemErr error) error {
+	if l.logged >= importMaxLoggedErrors {
+		return nil
+	}
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			return fmt.Errorf("failed to create import log directory: %w", err)
+		}
+		file, err := os.Create(l.path)
+		if err != nil {
+			return fmt.Errorf("failed to create import log: %w", err)
+		}
+		l.file = file
+	}
+
+	entry := map[string]interface{}{
+		"itemS3Pointer": map[string]interface{}{"bucket": l.bucket, "key": l.key, "itemIndex": index},
+		"importArn": l.importArn,
+		"errorMessages": []string{itemErr.Error()},
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write import log: %w", err)
+	}
+	l.logged++
+	return nil
+}
+
+func (l *importErrorLog) close() {
+	if l.file != nil {
+		l.file.Close()
+	}
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+// The fixtures under testdata/imports hold the same three items in every
+// format; the compressed ones were written by the gzip and zstd command line
+// tools, with zstd content checksums enabled.
+var importFixtureItems = []model.Record{
+	{
+		"pk": {"S": "a"},
+		"n": {"N": "1"},
+		"tags": {"SS": []interface{}{"x", "y"}},
+	},
+	{
+		"pk": {"S": "b"},
+		"m": {"M": map[string]interface{}{
+			"flag": map[string]interface{}{"BOOL": true},
+			"none": map[string]interface{}{"NULL": true},
+		}},
+		"l": {"L": []interface{}{
+			map[string]interface{}{"N": "2.5"},
+			map[string]interface{}{"S": "s"},
+		}},
+	},
+	{
+		"pk": {"S": "c"},
+		"bin": {"B": "aGVsbG8="},
+		"ns": {"NS": []interface{}{"1", "2"}},
+	},
+}
+
+func readImportFixture(t *testing.T, s3Dir, key, format, compression string) ([]model.Record, error) {
+	t.Helper()
+	descriptor := model.ImportDescriptor{
+		S3Bucket: "imports",
+		InputFormat: format,
+		InputCompressionType: compression,
+	}
+	var records []model.Record
+	_, err := readImportObject(s3Dir, descriptor, key, func(index int64, record model.Record, itemErr error) error {
+		if itemErr != nil {
+			t.Errorf("item %d: %v", index, itemErr)
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func TestReadImportObject(t *testing.T) {
+	tests := []struct {
+		key string
+		format string
+		compression string
+	}{
+		{"items.json", model.InputFormatDynamoDBJSON, model.InputCompressionNone},
+		{"items.json.gz", model.InputFormatDynamoDBJSON, model.InputCompressionGzip},
+		{"items.json.zst", model.InputFormatDynamoDBJSON, model.InputCompressionZstd},
+		{"items.ion", model.InputFormatIon, model.InputCompressionNone},
+		{"items.ion.zst", model.InputFormatIon, model.InputCompressionZstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			records, err := readImportFixture(t, "testdata", tt.key, tt.format, tt.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, importFixtureItems) {
+				t.Errorf("got %v, want %v", records, importFixtureItems)
+			}
+		})
+	}
+}
+
+func TestReadImportObjectZstdFrames(t *testing.T) {
+	compressed, err := os.ReadFile(filepath.Join("testdata", "imports", "items.json.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A skippable frame between two data frames, as concatenated or
+	// seekable zstd files have.
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 1, 2, 3}
+	multi := append(append(append([]byte(nil), compressed...), skippable...), compressed...)
+
+	truncated := compressed[:len(compressed)-5]
+
+	payload := append([]byte(nil), compressed...)
+	payload[len(payload)/2] ^= 0xff
+
+	checksum := append([]byte(nil), compressed...)
+	checksum[len(checksum)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want []model.Record
+		wantErr bool
+	}{
+		{"concatenated frames", multi, append(append([]model.Record(nil), importFixtureItems...), importFixtureItems...), false},
+		{"truncated", truncated, nil, true},
+		{"corrupt payload", payload, nil, true},
+		{"corrupt checksum", checksum, nil, true},
+		{"not zstd", []byte(`{"Item":{"pk":{"S":"a"}}}`), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(s3Dir, "imports"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(s3Dir, "imports", "object.zst"), tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := readImportFixture(t, s3Dir, "object.zst", model.InputFormatDynamoDBJSON, model.InputCompressionZstd)
+			if tt.wantErr {
+				var objectErr *importObjectError
+				if !errors.As(err, &objectErr) {
+					t.Fatalf("got error %v, want an object error", err)
+				}
+				if len(records) != 0 {
+					t.Errorf("imported %d items from a corrupt object", len(records))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, tt.want) {
+				t.Errorf("got %v, want %v", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportTable(t *testing.T) {
+	s3Dir := t.TempDir()
+	bucket := filepath.Join(s3Dir, "bucket", "export")
+	if err := os.MkdirAll(bucket, 0755); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := os.ReadFile(filepath.Join("testdata", "imports", "items.json.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte(nil), compressed...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	objects := map[string][]byte{
+		"data-1.json.zst": compressed,
+		"data-2.json.zst": corrupt,
+	}
+	for name, data := range objects {
+		if err := os.WriteFile(filepath.Join(bucket, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := NewDatabase(DatabaseOptions{InMemory: true, S3Dir: s3Dir, ImportLogDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := model.TableSchema{TableName: "Imported", PartitionKey: "pk", GSIs: map[string]model.GsiSchema{}}
+	descriptor, err := db.ImportTable(schema, ImportOptions{
+		S3Bucket: "bucket",
+		S3KeyPrefix: "export/",
+		InputFormat: model.InputFormatDynamoDBJSON,
+		InputCompressionType: model.InputCompressionZstd,
+		AttributeTypes: map[string]string{"pk": "S"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if descriptor.ImportStatus != model.ImportStatusCompleted {
+		t.Errorf("status %s", descriptor.ImportStatus)
+	}
+	if descriptor.ImportedItemCount != 3 || descriptor.ErrorCount != 1 {
+		t.Errorf("imported %d items with %d errors, want 3 and 1", descriptor.ImportedItemCount, descriptor.ErrorCount)
+	}
+	if descriptor.ErrorLog == "" {
+		t.Error("the corrupt object was not logged")
+	}
+	for _, want := range importFixtureItems {
+		pk := want["pk"]["S"].(string)
+		value, err := db.DB.Get([]byte(model.BuildLevelDBKey("Imported", pk, "")))
+		if err != nil {
+			t.Fatalf("item %s: %v", pk, err)
+		}
+		got, err := model.UnmarshalRecord(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("item %s: got %v, want %v", pk, got, want)
+		}
+	}
+}
+
+func TestImportTableOptions(t *testing.T) {
+	db, err := NewDatabase(DatabaseOptions{InMemory: true, S3Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := model.TableSchema{TableName: "T", PartitionKey: "pk"}
+	keyTypes := map[string]string{"pk": "S"}
+	tests := []struct {
+		name string
+		opts ImportOptions
+	}{
+		{"missing bucket", ImportOptions{InputFormat: model.InputFormatDynamoDBJSON, AttributeTypes: keyTypes}},
+		{"bucket path", ImportOptions{S3Bucket: "../b", InputFormat: model.InputFormatDynamoDBJSON, AttributeTypes: keyTypes}},
+		{"prefix escapes bucket", ImportOptions{S3Bucket: "b", S3KeyPrefix: "../x", InputFormat: model.InputFormatDynamoDBJSON, AttributeTypes: keyTypes}},
+		{"unknown format", ImportOptions{S3Bucket: "b", InputFormat: "XML", AttributeTypes: keyTypes}},
+		{"csv options for json", ImportOptions{S3Bucket: "b", InputFormat: model.InputFormatDynamoDBJSON, CsvDelimiter: ",", AttributeTypes: keyTypes}},
+		{"csv delimiter", ImportOptions{S3Bucket: "b", InputFormat: model.InputFormatCSV, CsvDelimiter: "x", AttributeTypes: keyTypes}},
+		{"unknown compression", ImportOptions{S3Bucket: "b", InputFormat: model.InputFormatIon, InputCompressionType: "BZIP2", AttributeTypes: keyTypes}},
+		{"undefined key type", ImportOptions{S3Bucket: "b", InputFormat: model.InputFormatIon}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.ImportTable(schema, tt.opts); err == nil {
+				t.Error("expected an error")
+			}
+			if _, exists := db.Tables["T"]; exists {
+				t.Error("table created by an invalid import")
+			}
+		})
+	}
+}
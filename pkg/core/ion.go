@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+// Ion text encoding of DynamoDB items as used by table exports: numbers are
+// decimals, binaries are blobs and sets are lists annotated with $dynamodb_SS,
+// $dynamodb_NS or $dynamodb_BS.
+
+const ionVersionMarker = "$ion_1_0"
+
+var ionIdentifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func marshalIonRecord(record model.Record) (string, error) {
+	var b strings.Builder
+	if err := writeIonStruct(&b, recordFields(record)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func recordFields(record model.Record) map[string]interface{} {
+	fields := make(map[string]interface{}, len(record))
+	for name, av := range record {
+		fields[name] = map[string]interface{}(av)
+	}
+	return fields
+}
+
+func writeIonStruct(b *strings.Builder, fields map[string]interface{}) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(ionFieldName(name))
+		b.WriteByte(':')
+		if err := writeIonAttributeValue(b, fields[name]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+func writeIonAttributeValue(b *strings.Builder, raw interface{}) error {
+	av, ok := asAttributeMap(raw)
+	if !ok || len(av) != 1 {
+		return fmt.Errorf("invalid attribute value %v", raw)
+	}
+
+	for typ, value := range av {
+		switch typ {
+		case "S":
+			s, _ := value.(string)
+			b.WriteString(strconv.Quote(s))
+		case "N":
+			s, _ := value.(string)
+			b.WriteString(ionDecimal(s))
+		case "B":
+			s, _ := value.(string)
+			b.WriteString("{{" + s + "}}")
+		case "BOOL":
+			v, _ := value.(bool)
+			b.WriteString(strconv.FormatBool(v))
+		case "NULL":
+			b.WriteString("null")
+		case "M":
+			fields, _ := asAttributeMap(value)
+			return writeIonStruct(b, fields)
+		case "L":
+			b.WriteByte('[')
+			for i, element := range asList(value) {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				if err := writeIonAttributeValue(b, element); err != nil {
+					return err
+				}
+			}
+			b.WriteByte(']')
+		case "SS", "NS", "BS":
+			b.WriteString("$dynamodb_" + typ + "::[")
+			for i, element := range asList(value) {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				s, _ := element.(string)
+				switch typ {
+				case "SS":
+					b.WriteString(strconv.Quote(s))
+				case "NS":
+					b.WriteString(ionDecimal(s))
+				case "BS":
+					b.WriteString("{{" + s + "}}")
+				}
+			}
+			b.WriteByte(']')
+		default:
+			return fmt.Errorf("unsupported attribute type %s", typ)
+		}
+	}
+	return nil
+}
+
+func asAttributeMap(raw interface{}) (map[string]interface{}, bool) {
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		return v, true
+	case model.AttributeValue:
+		return map[string]interface{}(v), true
+	case model.Record:
+		return recordFields(v), true
+	}
+	return nil, false
+}
+
+func asList(raw interface{}) []interface{} {
+	switch v := raw.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	}
+	return nil
+}
+
+func ionFieldName(name string) string {
+	switch name {
+	case "true", "false", "null", "nan":
+		return strconv.Quote(name)
+	}
+	if ionIdentifierPattern.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// DynamoDB numbers become Ion decimals, so integers get a trailing dot and
+// exponents use d instead of e.
+func ionDecimal(number string) string {
+	if i := strings.IndexAny(number, "eE"); i >= 0 {
+		return number[:i] + "d" + number[i+1:]
+	}
+	if !strings.Contains(number, ".") {
+		return number + "."
+	}
+	return number
+}
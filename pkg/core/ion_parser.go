@@ -0,0 +1,593 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+// Ion text parsing for table imports. Values are parsed into a small tree and
+// then mapped back to attribute values the same way exports encode them.
+
+type ionKind int
+
+const (
+	ionKindNull ionKind = iota
+	ionKindBool
+	ionKindInt
+	ionKindDecimal
+	ionKindFloat
+	ionKindTimestamp
+	ionKindString
+	ionKindSymbol
+	ionKindBlob
+	ionKindClob
+	ionKindStruct
+	ionKindList
+)
+
+type ionValue struct {
+	annotations []string
+	kind ionKind
+	text string
+	fields []ionField
+	elements []ionValue
+}
+
+type ionField struct {
+	name string
+	value ionValue
+}
+
+type ionParser struct {
+	input string
+	pos int
+}
+
+var ionBinaryVersionMarker = string([]byte{0xE0, 0x01, 0x00, 0xEA})
+
+func newIonParser(input string) (*ionParser, error) {
+	if strings.HasPrefix(input, ionBinaryVersionMarker) {
+		return nil, fmt.Errorf("binary Ion is not supported")
+	}
+	return &ionParser{input: input}, nil
+}
+
+// next returns the next top-level value, skipping version markers and local
+// symbol tables.
+func (p *ionParser) next() (ionValue, bool, error) {
+	for {
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, false, err
+		}
+		if p.pos >= len(p.input) {
+			return ionValue{}, false, nil
+		}
+
+		value, err := p.value()
+		if err != nil {
+			return ionValue{}, false, err
+		}
+		if value.kind == ionKindSymbol && len(value.annotations) == 0 && strings.HasPrefix(value.text, "$ion_") {
+			continue
+		}
+		if len(value.annotations) > 0 && value.annotations[0] == "$ion_symbol_table" {
+			continue
+		}
+		return value, true, nil
+	}
+}
+
+func (p *ionParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.input[:p.pos], "\n") + 1
+	return fmt.Errorf("invalid Ion at line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *ionParser) skipSpace() error {
+	for p.pos < len(p.input) {
+		switch {
+		case strings.ContainsRune(" \t\n\r\f\v", rune(p.input[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.input[p.pos:], "//"):
+			end := strings.IndexByte(p.input[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.input)
+			} else {
+				p.pos += end + 1
+			}
+		case strings.HasPrefix(p.input[p.pos:], "/*"):
+			end := strings.Index(p.input[p.pos+2:], "*/")
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *ionParser) peekByte() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *ionParser) value() (ionValue, error) {
+	var annotations []string
+	for {
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		start := p.pos
+		symbol, ok, err := p.symbolToken()
+		if err != nil {
+			return ionValue{}, err
+		}
+		if !ok {
+			break
+		}
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		if !strings.HasPrefix(p.input[p.pos:], "::") {
+			p.pos = start
+			break
+		}
+		p.pos += 2
+		annotations = append(annotations, symbol)
+	}
+
+	value, err := p.unannotatedValue()
+	if err != nil {
+		return ionValue{}, err
+	}
+	value.annotations = annotations
+	return value, nil
+}
+
+func (p *ionParser) unannotatedValue() (ionValue, error) {
+	if p.pos >= len(p.input) {
+		return ionValue{}, p.errorf("unexpected end of input")
+	}
+
+	c := p.input[p.pos]
+	switch {
+	case strings.HasPrefix(p.input[p.pos:], "{{"):
+		return p.lob()
+	case c == '{':
+		return p.structValue()
+	case c == '[':
+		return p.listValue()
+	case c == '(':
+		return ionValue{}, p.errorf("s-expressions are not supported")
+	case c == '"' || strings.HasPrefix(p.input[p.pos:], "'''"):
+		text, err := p.stringToken()
+		return ionValue{kind: ionKindString, text: text}, err
+	case c == '\'':
+		text, _, err := p.symbolToken()
+		return ionValue{kind: ionKindSymbol, text: text}, err
+	case isIonIdentifierStart(c):
+		return p.keywordOrSymbol()
+	case c >= '0' && c <= '9' || c == '-' || c == '+':
+		return p.numberOrTimestamp()
+	}
+	return ionValue{}, p.errorf("unexpected character %s", strconv.QuoteRune(rune(c)))
+}
+
+func (p *ionParser) structValue() (ionValue, error) {
+	p.pos++
+	value := ionValue{kind: ionKindStruct}
+	for {
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		if p.peekByte() == '}' {
+			p.pos++
+			return value, nil
+		}
+
+		var name string
+		var err error
+		if p.peekByte() == '"' || strings.HasPrefix(p.input[p.pos:], "'''") {
+			name, err = p.stringToken()
+		} else {
+			var ok bool
+			name, ok, err = p.symbolToken()
+			if err == nil && !ok {
+				err = p.errorf("expected field name")
+			}
+		}
+		if err != nil {
+			return ionValue{}, err
+		}
+
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		if p.peekByte() != ':' {
+			return ionValue{}, p.errorf("expected : after field %s", name)
+		}
+		p.pos++
+
+		field, err := p.value()
+		if err != nil {
+			return ionValue{}, err
+		}
+		value.fields = append(value.fields, ionField{name: name, value: field})
+
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		switch p.peekByte() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return ionValue{}, p.errorf("expected , or } in struct")
+		}
+	}
+}
+
+func (p *ionParser) listValue() (ionValue, error) {
+	p.pos++
+	value := ionValue{kind: ionKindList, elements: []ionValue{}}
+	for {
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		if p.peekByte() == ']' {
+			p.pos++
+			return value, nil
+		}
+
+		element, err := p.value()
+		if err != nil {
+			return ionValue{}, err
+		}
+		value.elements = append(value.elements, element)
+
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+		switch p.peekByte() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return ionValue{}, p.errorf("expected , or ] in list")
+		}
+	}
+}
+
+func (p *ionParser) lob() (ionValue, error) {
+	p.pos += 2
+	if err := p.skipSpace(); err != nil {
+		return ionValue{}, err
+	}
+
+	value := ionValue{kind: ionKindBlob}
+	if p.peekByte() == '"' || strings.HasPrefix(p.input[p.pos:], "'''") {
+		text, err := p.stringToken()
+		if err != nil {
+			return ionValue{}, err
+		}
+		value = ionValue{kind: ionKindClob, text: text}
+		if err := p.skipSpace(); err != nil {
+			return ionValue{}, err
+		}
+	} else {
+		end := strings.Index(p.input[p.pos:], "}}")
+		if end < 0 {
+			return ionValue{}, p.errorf("unterminated blob")
+		}
+		value.text = strings.Join(strings.Fields(p.input[p.pos:p.pos+end]), "")
+		p.pos += end
+	}
+
+	if !strings.HasPrefix(p.input[p.pos:], "}}") {
+		return ionValue{}, p.errorf("expected }} after lob")
+	}
+	p.pos += 2
+	return value, nil
+}
+
+// stringToken reads a quoted string, concatenating adjacent long strings.
+func (p *ionParser) stringToken() (string, error) {
+	if p.peekByte() == '"' {
+		p.pos++
+		return p.quoted('"', false)
+	}
+
+	var b strings.Builder
+	for {
+		p.pos += 3
+		text, err := p.quoted('\'', true)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(text)
+
+		start := p.pos
+		if err := p.skipSpace(); err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(p.input[p.pos:], "'''") {
+			p.pos = start
+			return b.String(), nil
+		}
+	}
+}
+
+func (p *ionParser) quoted(quote byte, long bool) (string, error) {
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.input) {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.input[p.pos]
+		switch {
+		case long && strings.HasPrefix(p.input[p.pos:], "'''"):
+			p.pos += 3
+			return b.String(), nil
+		case !long && c == quote:
+			p.pos++
+			return b.String(), nil
+		case !long && c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *ionParser) escape(b *strings.Builder) error {
+	p.pos++
+	if p.pos >= len(p.input) {
+		return p.errorf("unterminated escape")
+	}
+	c := p.input[p.pos]
+	p.pos++
+
+	simple := map[byte]string{
+		'a': "\a", 'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", 'v': "\v",
+		'?': "?", '0': "\x00", '\'': "'", '"': "\"", '/': "/", '\\': "\\", '\n': "",
+	}
+	if s, ok := simple[c]; ok {
+		b.WriteString(s)
+		return nil
+	}
+	if c == '\r' {
+		if p.peekByte() == '\n' {
+			p.pos++
+		}
+		return nil
+	}
+
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+	if digits == 0 || p.pos+digits > len(p.input) {
+		return p.errorf("invalid escape \\%c", c)
+	}
+	code, err := strconv.ParseUint(p.input[p.pos:p.pos+digits], 16, 32)
+	if err != nil {
+		return p.errorf("invalid escape \\%c%s", c, p.input[p.pos:p.pos+digits])
+	}
+	p.pos += digits
+	if c == 'x' {
+		b.WriteByte(byte(code))
+	} else {
+		b.WriteRune(rune(code))
+	}
+	return nil
+}
+
+// symbolToken reads an identifier or a quoted symbol.
+func (p *ionParser) symbolToken() (string, bool, error) {
+	if p.pos >= len(p.input) {
+		return "", false, nil
+	}
+	c := p.input[p.pos]
+	if c == '\'' && !strings.HasPrefix(p.input[p.pos:], "'''") {
+		p.pos++
+		text, err := p.quoted('\'', false)
+		return text, err == nil, err
+	}
+	if !isIonIdentifierStart(c) {
+		return "", false, nil
+	}
+	start := p.pos
+	for p.pos < len(p.input) && (isIonIdentifierStart(p.input[p.pos]) || p.input[p.pos] >= '0' && p.input[p.pos] <= '9') {
+		p.pos++
+	}
+	return p.input[start:p.pos], true, nil
+}
+
+func (p *ionParser) keywordOrSymbol() (ionValue, error) {
+	text, _, _ := p.symbolToken()
+	switch text {
+	case "null":
+		if p.peekByte() == '.' {
+			p.pos++
+			if _, ok, _ := p.symbolToken(); !ok {
+				return ionValue{}, p.errorf("invalid typed null")
+			}
+		}
+		return ionValue{kind: ionKindNull}, nil
+	case "true", "false":
+		return ionValue{kind: ionKindBool, text: text}, nil
+	case "nan":
+		return ionValue{kind: ionKindFloat, text: text}, nil
+	}
+	return ionValue{kind: ionKindSymbol, text: text}, nil
+}
+
+func (p *ionParser) numberOrTimestamp() (ionValue, error) {
+	start := p.pos
+	for p.pos < len(p.input) && !isIonDelimiter(p.input[p.pos]) && !strings.HasPrefix(p.input[p.pos:], "//") && !strings.HasPrefix(p.input[p.pos:], "/*") {
+		p.pos++
+	}
+	text := p.input[start:p.pos]
+	lower := strings.ToLower(text)
+
+	switch {
+	case text == "+inf" || text == "-inf":
+		return ionValue{kind: ionKindFloat, text: text}, nil
+	case strings.HasPrefix(lower, "0x") || strings.HasPrefix(lower, "-0x") || strings.HasPrefix(lower, "0b") || strings.HasPrefix(lower, "-0b"):
+		return ionValue{kind: ionKindInt, text: text}, nil
+	case len(text) >= 5 && strings.Trim(text[:4], "0123456789") == "" && (text[4] == '-' || text[4] == 'T'):
+		return ionValue{kind: ionKindTimestamp, text: text}, nil
+	case strings.ContainsAny(lower, "e"):
+		return ionValue{kind: ionKindFloat, text: text}, nil
+	case strings.ContainsAny(lower, "d."):
+		return ionValue{kind: ionKindDecimal, text: text}, nil
+	case text == "" || text == "-" || text == "+":
+		return ionValue{}, p.errorf("invalid number")
+	}
+	return ionValue{kind: ionKindInt, text: text}, nil
+}
+
+func isIonIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
+
+func isIonDelimiter(c byte) bool {
+	return strings.IndexByte(" \t\n\r\f\v,]}){[(\"'", c) >= 0
+}
+
+func ionStructField(value ionValue, name string) (ionValue, bool) {
+	for _, field := range value.fields {
+		if field.name == name {
+			return field.value, true
+		}
+	}
+	return ionValue{}, false
+}
+
+func ionRecord(value ionValue) (model.Record, error) {
+	if value.kind != ionKindStruct {
+		return nil, fmt.Errorf("expected a struct")
+	}
+	record := make(model.Record, len(value.fields))
+	for _, field := range value.fields {
+		av, err := ionAttributeValue(field.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.name, err)
+		}
+		record[field.name] = av
+	}
+	return record, nil
+}
+
+func ionAttributeValue(value ionValue) (model.AttributeValue, error) {
+	if len(value.annotations) > 0 && strings.HasPrefix(value.annotations[0], "$dynamodb_") {
+		return ionSetValue(value)
+	}
+
+	switch value.kind {
+	case ionKindNull:
+		return model.AttributeValue{"NULL": true}, nil
+	case ionKindBool:
+		return model.AttributeValue{"BOOL": value.text == "true"}, nil
+	case ionKindInt, ionKindDecimal, ionKindFloat:
+		number, err := ionNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		return model.AttributeValue{"N": number}, nil
+	case ionKindString, ionKindSymbol, ionKindTimestamp:
+		return model.AttributeValue{"S": value.text}, nil
+	case ionKindBlob:
+		if _, err := base64.StdEncoding.DecodeString(value.text); err != nil {
+			return nil, fmt.Errorf("invalid blob: %w", err)
+		}
+		return model.AttributeValue{"B": value.text}, nil
+	case ionKindClob:
+		return model.AttributeValue{"B": base64.StdEncoding.EncodeToString([]byte(value.text))}, nil
+	case ionKindStruct:
+		record, err := ionRecord(value)
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]interface{}, len(record))
+		for name, av := range record {
+			fields[name] = map[string]interface{}(av)
+		}
+		return model.AttributeValue{"M": fields}, nil
+	case ionKindList:
+		elements := make([]interface{}, 0, len(value.elements))
+		for _, element := range value.elements {
+			av, err := ionAttributeValue(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, map[string]interface{}(av))
+		}
+		return model.AttributeValue{"L": elements}, nil
+	}
+	return nil, fmt.Errorf("unsupported Ion value")
+}
+
+func ionSetValue(value ionValue) (model.AttributeValue, error) {
+	typ := strings.TrimPrefix(value.annotations[0], "$dynamodb_")
+	if value.kind != ionKindList || (typ != "SS" && typ != "NS" && typ != "BS") {
+		return nil, fmt.Errorf("invalid %s annotation", value.annotations[0])
+	}
+	if len(value.elements) == 0 {
+		return nil, fmt.Errorf("sets may not be empty")
+	}
+
+	members := make([]interface{}, 0, len(value.elements))
+	for _, element := range value.elements {
+		av, err := ionAttributeValue(element)
+		if err != nil {
+			return nil, err
+		}
+		member, ok := av[typ[:1]]
+		if !ok {
+			return nil, fmt.Errorf("invalid member in %s set", typ)
+		}
+		members = append(members, member)
+	}
+	return model.AttributeValue{typ: members}, nil
+}
+
+// ionNumber converts an Ion int, decimal or float to DynamoDB number text.
+func ionNumber(value ionValue) (string, error) {
+	text := strings.ReplaceAll(value.text, "_", "")
+
+	if value.kind == ionKindFloat && (text == "nan" || text == "+inf" || text == "-inf") {
+		return "", fmt.Errorf("%s is not a valid number", text)
+	}
+	if value.kind == ionKindInt {
+		n, ok := new(big.Int).SetString(text, 0)
+		if !ok {
+			return "", fmt.Errorf("invalid number %s", value.text)
+		}
+		return n.String(), nil
+	}
+
+	mantissa, exponent := text, ""
+	if i := strings.IndexAny(text, "dDeE"); i >= 0 {
+		mantissa, exponent = text[:i], text[i+1:]
+	}
+	mantissa = strings.TrimSuffix(mantissa, ".")
+	number := mantissa
+	if exponent != "" {
+		number += "E" + exponent
+	}
+	if _, err := model.ParseNumber(number); err != nil {
+		return "", fmt.Errorf("invalid number %s", value.text)
+	}
+	return number, nil
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func TestIonAttributeValue(t *testing.T) {
+	tests := []struct {
+		ion string
+		want model.AttributeValue
+	}{
+		{`null`, model.AttributeValue{"NULL": true}},
+		{`null.string`, model.AttributeValue{"NULL": true}},
+		{`true`, model.AttributeValue{"BOOL": true}},
+		{`false`, model.AttributeValue{"BOOL": false}},
+		{`42`, model.AttributeValue{"N": "42"}},
+		{`-1_000`, model.AttributeValue{"N": "-1000"}},
+		{`0x1F`, model.AttributeValue{"N": "31"}},
+		{`0b101`, model.AttributeValue{"N": "5"}},
+		{`12.50`, model.AttributeValue{"N": "12.50"}},
+		{`12.`, model.AttributeValue{"N": "12"}},
+		{`1.5d2`, model.AttributeValue{"N": "1.5E2"}},
+		{`2.5e-3`, model.AttributeValue{"N": "2.5E-3"}},
+		{`"a \"b\"\né"`, model.AttributeValue{"S": "a \"b\"\né"}},
+		{`'''long ''' /* c */ '''string'''`, model.AttributeValue{"S": "long string"}},
+		{`symbol`, model.AttributeValue{"S": "symbol"}},
+		{`'quoted symbol'`, model.AttributeValue{"S": "quoted symbol"}},
+		{`2020-01-02T03:04:05Z`, model.AttributeValue{"S": "2020-01-02T03:04:05Z"}},
+		{`{{ aGVs bG8= }}`, model.AttributeValue{"B": "aGVsbG8="}},
+		{`{{"hello"}}`, model.AttributeValue{"B": "aGVsbG8="}},
+		{`[1, "a", [] ]`, model.AttributeValue{"L": []interface{}{
+			map[string]interface{}{"N": "1"},
+			map[string]interface{}{"S": "a"},
+			map[string]interface{}{"L": []interface{}{}},
+		}}},
+		{`{a: 1, "b c": {d: null}}`, model.AttributeValue{"M": map[string]interface{}{
+			"a": map[string]interface{}{"N": "1"},
+			"b c": map[string]interface{}{"M": map[string]interface{}{
+				"d": map[string]interface{}{"NULL": true},
+			}},
+		}}},
+		{`$dynamodb_SS::["x", "y"]`, model.AttributeValue{"SS": []interface{}{"x", "y"}}},
+		{`$dynamodb_NS::[1, 2.5]`, model.AttributeValue{"NS": []interface{}{"1", "2.5"}}},
+		{`$dynamodb_BS::[{{aGk=}}]`, model.AttributeValue{"BS": []interface{}{"aGk="}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ion, func(t *testing.T) {
+			record, err := parseIonItem(t, `{Item: {v: `+tt.ion+`}}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := record["v"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIonAttributeValueErrors(t *testing.T) {
+	tests := []string{
+		`nan`,
+		`+inf`,
+		`-inf`,
+		`{{not base64}}`,
+		`$dynamodb_SS::[]`,
+		`$dynamodb_SS::[1]`,
+		`$dynamodb_XS::["x"]`,
+		`$dynamodb_NS::"1"`,
+		`1.2.3`,
+	}
+
+	for _, ion := range tests {
+		t.Run(ion, func(t *testing.T) {
+			if _, err := parseIonItem(t, `{Item: {v: `+ion+`}}`); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadIonItems(t *testing.T) {
+	input := `$ion_1_0
+$ion_symbol_table::{symbols: ["x"]}
+// comment
+{Item: {pk: "a"}}
+{Other: {pk: "b"}}
+[1]
+{Item: {pk: "c"}}`
+
+	var records []model.Record
+	var itemErrs []error
+	err := readIonItems(strings.NewReader(input), func(index int64, record model.Record, itemErr error) error {
+		records = append(records, record)
+		itemErrs = append(itemErrs, itemErr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []model.Record{{"pk": {"S": "a"}}, nil, nil, {"pk": {"S": "c"}}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %v, want %v", records, want)
+	}
+	for i, itemErr := range itemErrs {
+		if (itemErr != nil) != (want[i] == nil) {
+			t.Errorf("item %d: unexpected error %v", i, itemErr)
+		}
+	}
+}
+
+func TestReadIonItemsSyntaxErrors(t *testing.T) {
+	tests := []string{
+		`{Item: {pk: "a}}`,
+		`{Item: {pk: "a" pk2: "b"}}`,
+		`{Item: {pk "a"}}`,
+		`{Item: [1 2]}`,
+		`{Item: {v: {{aGk=}}}`,
+		`{Item: {v: "\q"}}`,
+		`{Item: {v: (a b)}}`,
+		`/* unterminated`,
+		`{Item: {v: null.}}`,
+		"\xE0\x01\x00\xEA",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			err := readIonItems(strings.NewReader(input), func(index int64, record model.Record, itemErr error) error {
+				t.Errorf("unexpected item %d", index)
+				return nil
+			})
+			var objectErr *importObjectError
+			if !errors.As(err, &objectErr) {
+				t.Errorf("got error %v, want an object error", err)
+			}
+		})
+	}
+}
+
+func parseIonItem(t *testing.T, input string) (model.Record, error) {
+	t.Helper()
+	var got model.Record
+	var gotErr error
+	err := readIonItems(strings.NewReader(input), func(index int64, record model.Record, itemErr error) error {
+		got, gotErr = record, itemErr
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got, gotErr
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"fmt"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func (d *Database) ApplyItemChange(batch *Batch, schema model.TableSchema, levelDBKey string, oldRecord model.Record, newRecord model.Record) error {
+	return d.applyItemChange(batch, schema, levelDBKey, oldRecord, newRecord, nil)
+}
+
+func (d *Database) applyItemChange(batch *Batch, schema model.TableSchema, levelDBKey string, oldRecord model.Record, newRecord model.Record, identity *model.StreamUserIdentity) error {
+	if len(oldRecord) == 0 {
+		oldRecord = nil
+	}
+
+	changes := len(batch.changes)
+	newRecord, err := d.runItemChangeHooks(batch, schema, levelDBKey, oldRecord, newRecord)
+	if err != nil {
+		return err
+	}
+
+	if err := d.stageWriteCapacity(batch, schema, oldRecord, newRecord); err != nil {
+		// The change is not staged, so its After hooks must not run.
+		batch.changes = batch.changes[:changes]
+		return err
+	}
+
+	d.UpdateGSI(batch, schema, oldRecord, newRecord)
+
+	if newRecord != nil {
+		value, err := model.MarshalRecord(newRecord)
+		if err != nil {
+			return fmt.Errorf("failed to marshal item: %w", err)
+		}
+		batch.Put([]byte(levelDBKey), value)
+	} else {
+		batch.Delete([]byte(levelDBKey))
+	}
+
+	if err := d.appendItemVersion(batch, schema, levelDBKey, newRecord); err != nil {
+		return err
+	}
+
+	return d.appendStreamRecord(batch, schema, oldRecord, newRecord, identity)
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func ItemSize(record model.Record) int {
+	size := 0
+	for name, av := range record {
+		size += len(name) + attributeValueSize(av)
+	}
+	return size
+}
+
+func attributeValueSize(av model.AttributeValue) int {
+	for typ, raw := range av {
+		switch typ {
+		case "S":
+			s, _ := raw.(string)
+			return len(s)
+		case "N":
+			s, _ := raw.(string)
+			return numberSize(s)
+		case "B":
+			s, _ := raw.(string)
+			return binarySize(s)
+		case "BOOL", "NULL":
+			return 1
+		case "SS", "NS", "BS":
+			values, _ := raw.([]interface{})
+			size := 0
+			for _, v := range values {
+				s, _ := v.(string)
+				switch typ {
+				case "SS":
+					size += len(s)
+				case "NS":
+					size += numberSize(s)
+				case "BS":
+					size += binarySize(s)
+				}
+			}
+			return size
+		case "L":
+			values, _ := raw.([]interface{})
+			size := 3
+			for _, v := range values {
+				size++
+				if m, ok := v.(map[string]interface{}); ok {
+					size += attributeValueSize(model.AttributeValue(m))
+				}
+			}
+			return size
+		case "M":
+			values, _ := raw.(map[string]interface{})
+			size := 3
+			for name, v := range values {
+				size += len(name) + 1
+				if m, ok := v.(map[string]interface{}); ok {
+					size += attributeValueSize(model.AttributeValue(m))
+				}
+			}
+			return size
+		}
+	}
+	return 0
+}
+
+func numberSize(s string) int {
+	digits := strings.TrimLeft(strings.TrimPrefix(s, "-"), "0")
+	digits = strings.Replace(digits, ".", "", 1)
+	if digits == "" {
+		return 1
+	}
+	return (len(digits)+1)/2 + 1
+}
+
+func binarySize(s string) int {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return len(s)
+	}
+	return len(decoded)
+}
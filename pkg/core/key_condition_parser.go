@@ -7,7 +7,7 @@ import (
 	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
 )
 
-func ParseKeyConditionPK(expression, pkName string, values map[string]model.AttributeValue) (string, string, error) {
+func ParseKeyConditionPK(expression, pkName string, names map[string]string, values map[string]model.AttributeValue) (string, string, error) {
 	parts := strings.Split(expression, " AND ")
 	for _, part := range parts {
 		part = strings.TrimSpace(part)
@@ -19,14 +19,8 @@ func ParseKeyConditionPK(expression, pkName string, values map[string]model.Attr
 				attrPlaceholder := strings.TrimSpace(clause[0])
 				valPlaceholder := strings.TrimSpace(clause[1])
 				
-				isPlaceholder := strings.HasPrefix(attrPlaceholder, "#")
-				
-				var attrName string
-				
-				if isPlaceholder {
-					
-					return "", "", fmt.Errorf("Partition Key expression must use actual attribute name, not placeholder.")
-				} else {
+				attrName, ok := names[attrPlaceholder]
+				if !ok {
 					attrName = attrPlaceholder
 				}
 
@@ -52,27 +46,28 @@ func ParseKeyConditionPK(expression, pkName string, values map[string]model.Attr
 	return "", "", fmt.Errorf("Partition key condition not found or invalid format.")
 }
 
-func ExtractKeyConditionSK(expression, skName string) (string, error) {
-	parts := strings.Split(expression, " AND ")
-	for _, part := range parts {
+func ExtractKeyConditionSK(expression, skName string, names map[string]string) (string, error) {
+	for _, part := range splitAndClauses(expression) {
 		part = strings.TrimSpace(part)
-		
-		operators := []string{"=", "<=", ">=", "<", ">", "begins_with"}
-		for _, op := range operators {
-			if strings.Contains(part, op) {
-				attrPlaceholder := strings.Split(part, op)[0] 
-				attrPlaceholder = strings.TrimSpace(attrPlaceholder)
-				
-				if strings.Contains(attrPlaceholder, "(") { 
-					if strings.HasPrefix(attrPlaceholder, "begins_with(") {
-						attrPlaceholder = strings.TrimSuffix(strings.TrimPrefix(attrPlaceholder, "begins_with("), ",")
-					}
-				}
-				
-				if attrPlaceholder == skName {
-					return part, nil
-				}
+
+		var attrPlaceholder string
+		if strings.HasPrefix(part, "begins_with(") {
+			attrPlaceholder = strings.TrimPrefix(part, "begins_with(")
+			if i := strings.IndexByte(attrPlaceholder, ','); i >= 0 {
+				attrPlaceholder = attrPlaceholder[:i]
 			}
+		} else if i := strings.Index(part, " BETWEEN "); i >= 0 {
+			attrPlaceholder = part[:i]
+		} else if i := strings.IndexAny(part, "=<>"); i >= 0 {
+			attrPlaceholder = part[:i]
+		}
+
+		attrPlaceholder = strings.TrimSpace(attrPlaceholder)
+		if attrName, ok := names[attrPlaceholder]; ok {
+			attrPlaceholder = attrName
+		}
+		if attrPlaceholder == skName {
+			return part, nil
 		}
 	}
 	return "", nil
@@ -82,6 +77,26 @@ func EvaluateSortKeyCondition(skVal string, skExpression string, values map[stri
 	if skExpression == "" {
 		return true
 	}
+
+	if i := strings.Index(skExpression, " BETWEEN "); i >= 0 {
+		bounds := strings.SplitN(skExpression[i+len(" BETWEEN "):], " AND ", 2)
+		if len(bounds) != 2 {
+			return false
+		}
+		var limits [2]string
+		for j, bound := range bounds {
+			valAV, ok := values[strings.TrimSpace(bound)]
+			if !ok {
+				return false
+			}
+			if limits[j], ok = model.GetAttributeValueString(valAV); !ok {
+				return false
+			}
+		}
+		low, _ := model.CompareStringValues(skVal, limits[0], ">=")
+		high, _ := model.CompareStringValues(skVal, limits[1], "<=")
+		return low && high
+	}
 	
 	operators := []string{"=", "<=", ">=", "<", ">"}
 	
@@ -140,7 +155,7 @@ func ExtractKey(record model.Record, schema model.TableSchema, indexName string)
 	skName := schema.SortKey
 
 	if indexName != "" {
-		gsiSchema := schema.GSIs[indexName]
+		gsiSchema, _ := schema.SecondaryIndex(indexName)
 		pkName = gsiSchema.PartitionKey
 		skName = gsiSchema.SortKey
 		
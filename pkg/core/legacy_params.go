@@ -0,0 +1,279 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+// CheckExpressionParams rejects a request that mixes legacy parameters with
+// expression parameters, or that sends expression placeholders without any
+// expression. legacy and expression map a parameter name to whether the
+// request sets it.
+func CheckExpressionParams(legacy, expression map[string]bool, hasNames, hasValues bool) error {
+	legacyUsed, expressionUsed := setParams(legacy), setParams(expression)
+	if len(legacyUsed) > 0 && len(expressionUsed) > 0 {
+		return fmt.Errorf("Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {%s} Expression parameters: {%s}", strings.Join(legacyUsed, ", "), strings.Join(expressionUsed, ", "))
+	}
+	if len(expressionUsed) == 0 {
+		if hasNames {
+			return fmt.Errorf("ExpressionAttributeNames can only be specified when using expressions")
+		}
+		if hasValues {
+			return fmt.Errorf("ExpressionAttributeValues can only be specified when using expressions")
+		}
+	}
+	return nil
+}
+
+func setParams(params map[string]bool) []string {
+	var names []string
+	for name, set := range params {
+		if set {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// legacyExpression builds expression text out of legacy conditions, naming
+// every attribute and value through generated placeholders.
+type legacyExpression struct {
+	clauses []string
+	names map[string]string
+	values map[string]model.AttributeValue
+}
+
+func newLegacyExpression() *legacyExpression {
+	return &legacyExpression{names: make(map[string]string), values: make(map[string]model.AttributeValue)}
+}
+
+func (e *legacyExpression) name(attr string) string {
+	placeholder := fmt.Sprintf("#legacy%d", len(e.names))
+	e.names[placeholder] = attr
+	return placeholder
+}
+
+func (e *legacyExpression) value(av model.AttributeValue) string {
+	placeholder := fmt.Sprintf(":legacy%d", len(e.values))
+	e.values[placeholder] = av
+	return placeholder
+}
+
+// add appends the clause for attr compared to args with a legacy
+// ComparisonOperator. name turns the attribute into expression text.
+func (e *legacyExpression) add(attr, operator string, args []model.AttributeValue, name func(string) string) error {
+	arity := map[string]int{
+		model.ComparisonEQ: 1, model.ComparisonNE: 1, model.ComparisonLE: 1, model.ComparisonLT: 1,
+		model.ComparisonGE: 1, model.ComparisonGT: 1, model.ComparisonNotNull: 0, model.ComparisonNull: 0,
+		model.ComparisonContains: 1, model.ComparisonNotContains: 1, model.ComparisonBeginsWith: 1,
+		model.ComparisonIn: -1, model.ComparisonBetween: 2,
+	}
+	want, ok := arity[operator]
+	if !ok {
+		return fmt.Errorf("1 validation error detected: Value '%s' at 'comparisonOperator' failed to satisfy constraint: Member must satisfy enum value set: [IN, NULL, BETWEEN, LT, NOT_CONTAINS, EQ, GT, NOT_NULL, NE, LE, BEGINS_WITH, GE, CONTAINS]", operator)
+	}
+	if want >= 0 && len(args) != want || want < 0 && len(args) == 0 {
+		return fmt.Errorf("One or more parameter values were invalid: Invalid number of argument(s) for the %s ComparisonOperator", operator)
+	}
+
+	path := name(attr)
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = e.value(arg)
+	}
+
+	comparisons := map[string]string{
+		model.ComparisonEQ: "=", model.ComparisonNE: "<>", model.ComparisonLE: "<=",
+		model.ComparisonLT: "<", model.ComparisonGE: ">=", model.ComparisonGT: ">",
+	}
+	var clause string
+	switch operator {
+	case model.ComparisonNotNull:
+		clause = fmt.Sprintf("attribute_exists(%s)", path)
+	case model.ComparisonNull:
+		clause = fmt.Sprintf("attribute_not_exists(%s)", path)
+	case model.ComparisonContains:
+		clause = fmt.Sprintf("contains(%s, %s)", path, values[0])
+	case model.ComparisonNotContains:
+		clause = fmt.Sprintf("NOT contains(%s, %s)", path, values[0])
+	case model.ComparisonBeginsWith:
+		clause = fmt.Sprintf("begins_with(%s, %s)", path, values[0])
+	case model.ComparisonIn:
+		clause = fmt.Sprintf("%s IN (%s)", path, strings.Join(values, ", "))
+	case model.ComparisonBetween:
+		clause = fmt.Sprintf("%s BETWEEN %s AND %s", path, values[0], values[1])
+	default:
+		clause = fmt.Sprintf("%s %s %s", path, comparisons[operator], values[0])
+	}
+	e.clauses = append(e.clauses, clause)
+	return nil
+}
+
+func (e *legacyExpression) conditionInput(conditionalOperator string) (model.ConditionInput, error) {
+	switch conditionalOperator {
+	case "":
+		conditionalOperator = "AND"
+	case "AND", "OR":
+	default:
+		return model.ConditionInput{}, fmt.Errorf("1 validation error detected: Value '%s' at 'conditionalOperator' failed to satisfy constraint: Member must satisfy enum value set: [AND, OR]", conditionalOperator)
+	}
+	return model.ConditionInput{
+		ConditionExpression: strings.Join(e.clauses, " "+conditionalOperator+" "),
+		ExpressionAttributeNames: e.names,
+		ExpressionAttributeValues: e.values,
+	}, nil
+}
+
+// ExpectedCondition returns the condition a write is checked against: input
+// itself, or the translation of the legacy Expected parameter when it is set.
+func ExpectedCondition(input model.ConditionInput, expected map[string]model.ExpectedAttributeValue, conditionalOperator string) (model.ConditionInput, error) {
+	if expected == nil {
+		return input, nil
+	}
+
+	// Sorted so that the generated expression does not depend on map order.
+	attrs := make([]string, 0, len(expected))
+	for attr := range expected {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	e := newLegacyExpression()
+	for _, attr := range attrs {
+		exp := expected[attr]
+		if exp.ComparisonOperator != "" {
+			if exp.Value != nil || exp.Exists != nil {
+				return model.ConditionInput{}, fmt.Errorf("One or more parameter values were invalid: Value or Exists parameter cannot be used with ComparisonOperator for Attribute: %s", attr)
+			}
+			if err := e.add(attr, exp.ComparisonOperator, exp.AttributeValueList, e.name); err != nil {
+				return model.ConditionInput{}, err
+			}
+			continue
+		}
+
+		switch {
+		case exp.Exists != nil && !*exp.Exists && exp.Value != nil:
+			return model.ConditionInput{}, fmt.Errorf("One or more parameter values were invalid: Value cannot be used when Exists is false for Attribute: %s", attr)
+		case exp.Exists != nil && !*exp.Exists:
+			e.add(attr, model.ComparisonNull, nil, e.name)
+		case exp.Value == nil:
+			return model.ConditionInput{}, fmt.Errorf("One or more parameter values were invalid: Value must be provided when Exists is true for Attribute: %s", attr)
+		default:
+			e.add(attr, model.ComparisonEQ, []model.AttributeValue{exp.Value}, e.name)
+		}
+	}
+	return e.conditionInput(conditionalOperator)
+}
+
+// FilterCondition returns the filter of a Query or Scan: input itself, or the
+// translation of the legacy QueryFilter or ScanFilter when it is set.
+func FilterCondition(input model.ConditionInput, filter map[string]model.LegacyCondition, conditionalOperator string) (model.ConditionInput, error) {
+	if filter == nil {
+		return input, nil
+	}
+
+	attrs := make([]string, 0, len(filter))
+	for attr := range filter {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	e := newLegacyExpression()
+	for _, attr := range attrs {
+		if err := e.add(attr, filter[attr].ComparisonOperator, filter[attr].AttributeValueList, e.name); err != nil {
+			return model.ConditionInput{}, err
+		}
+	}
+	return e.conditionInput(conditionalOperator)
+}
+
+// LegacyKeyCondition translates the KeyConditions of a Query into a
+// KeyConditionExpression and its values. Key names are written out literally,
+// as the key condition parser expects.
+func LegacyKeyCondition(conditions map[string]model.LegacyCondition, pkName, skName string) (string, map[string]model.AttributeValue, error) {
+	if _, ok := conditions[pkName]; !ok {
+		return "", nil, fmt.Errorf("Query condition missed key schema element: %s", pkName)
+	}
+
+	e := newLegacyExpression()
+	literal := func(attr string) string { return attr }
+	for _, attr := range []string{pkName, skName} {
+		cond, ok := conditions[attr]
+		if attr == "" || !ok {
+			continue
+		}
+		switch cond.ComparisonOperator {
+		case model.ComparisonEQ:
+		case model.ComparisonLE, model.ComparisonLT, model.ComparisonGE, model.ComparisonGT, model.ComparisonBeginsWith, model.ComparisonBetween:
+			if attr == pkName {
+				return "", nil, fmt.Errorf("Query key condition not supported")
+			}
+		default:
+			return "", nil, fmt.Errorf("Query key condition not supported")
+		}
+		if err := e.add(attr, cond.ComparisonOperator, cond.AttributeValueList, literal); err != nil {
+			return "", nil, err
+		}
+	}
+	if len(e.clauses) != len(conditions) {
+		return "", nil, fmt.Errorf("Query key condition not supported")
+	}
+	return strings.Join(e.clauses, " AND "), e.values, nil
+}
+
+// AttributeUpdateActions translates the legacy AttributeUpdates of an
+// UpdateItem into the actions an UpdateExpression would produce.
+func AttributeUpdateActions(updates map[string]model.AttributeValueUpdate) (*UpdateActions, error) {
+	actions := &UpdateActions{
+		Set: make(map[string]model.AttributeValue),
+		Add: make(map[string]model.AttributeValue),
+		Remove: make(map[string]struct{}),
+		Delete: make(map[string]model.AttributeValue),
+	}
+
+	for attr, update := range updates {
+		switch update.Action {
+		case "", model.AttributeActionPut:
+			if update.Value == nil {
+				return nil, fmt.Errorf("One or more parameter values were invalid: Only DELETE action is allowed when no attribute value is specified")
+			}
+			actions.Set[attr] = update.Value
+		case model.AttributeActionAdd:
+			if update.Value == nil {
+				return nil, fmt.Errorf("One or more parameter values were invalid: Only DELETE action is allowed when no attribute value is specified")
+			}
+			actions.Add[attr] = update.Value
+		case model.AttributeActionDelete:
+			if update.Value == nil {
+				actions.Remove[attr] = struct{}{}
+				continue
+			}
+			if update.Value["SS"] == nil && update.Value["NS"] == nil && update.Value["BS"] == nil {
+				return nil, fmt.Errorf("One or more parameter values were invalid: DELETE action with value is not supported for the type")
+			}
+			actions.Delete[attr] = update.Value
+		default:
+			return nil, fmt.Errorf("1 validation error detected: Value '%s' at 'attributeUpdates.%s.member.action' failed to satisfy constraint: Member must satisfy enum value set: [ADD, PUT, DELETE]", update.Action, attr)
+		}
+	}
+	return actions, nil
+}
+
+// AttributesToGetProjection turns the legacy AttributesToGet list into the
+// projection a ProjectionExpression naming the same attributes would give.
+func AttributesToGetProjection(attrs []string) (*Projection, error) {
+	projection := &Projection{}
+	seen := make(map[string]bool, len(attrs))
+	for _, attr := range attrs {
+		if seen[attr] {
+			return nil, fmt.Errorf("One or more parameter values were invalid: Duplicate value in attribute name: %s", attr)
+		}
+		seen[attr] = true
+		projection.paths = append(projection.paths, partiqlPath{elems: []partiqlPathElem{{name: attr}}})
+	}
+	return projection, nil
+}
@@ -0,0 +1,358 @@
+package core
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+)
+
+// memoryStorage keeps everything in a persistent treap. Writes copy the path
+// they touch and publish a new root, so snapshots and iterators simply hold
+// on to the root they started from.
+type memoryStorage struct {
+	mu sync.RWMutex
+	root *memoryNode
+	closed bool
+}
+
+type memoryNode struct {
+	key []byte
+	value []byte
+	priority uint32
+	left *memoryNode
+	right *memoryNode
+}
+
+func NewMemoryStorage() Storage {
+	return &memoryStorage{}
+}
+
+func (s *memoryStorage) current() (*memoryNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrStorageClosed
+	}
+	return s.root, nil
+}
+
+func (s *memoryStorage) Get(key []byte) ([]byte, error) {
+	root, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return memoryGet(root, key)
+}
+
+func (s *memoryStorage) Put(key, value []byte) error {
+	batch := new(Batch)
+	batch.Put(key, value)
+	return s.Write(batch)
+}
+
+func (s *memoryStorage) Write(batch *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStorageClosed
+	}
+
+	root := s.root
+	for _, op := range batch.ops {
+		if op.delete {
+			root = memoryDelete(root, op.key)
+		} else {
+			root = memoryInsert(root, op.key, op.value, rand.Uint32())
+		}
+	}
+	s.root = root
+	return nil
+}
+
+func (s *memoryStorage) NewIterator(keyRange *KeyRange) Iterator {
+	root, err := s.current()
+	if err != nil {
+		return &memoryIterator{err: err}
+	}
+	return newMemoryIterator(root, keyRange)
+}
+
+func (s *memoryStorage) GetSnapshot() (StorageSnapshot, error) {
+	root, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	return &memorySnapshot{root: root}, nil
+}
+
+func (s *memoryStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStorageClosed
+	}
+	s.closed = true
+	s.root = nil
+	return nil
+}
+
+type memorySnapshot struct {
+	root *memoryNode
+}
+
+func (s *memorySnapshot) Get(key []byte) ([]byte, error) {
+	return memoryGet(s.root, key)
+}
+
+func (s *memorySnapshot) NewIterator(keyRange *KeyRange) Iterator {
+	return newMemoryIterator(s.root, keyRange)
+}
+
+func (s *memorySnapshot) Release() {
+	s.root = nil
+}
+
+func memoryGet(n *memoryNode, key []byte) ([]byte, error) {
+	for n != nil {
+		switch c := bytes.Compare(key, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return append([]byte(nil), n.value...), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Nodes reachable from a published root are never modified; every change
+// works on fresh copies, which are safe to rotate in place.
+func memoryInsert(n *memoryNode, key, value []byte, priority uint32) *memoryNode {
+	if n == nil {
+		return &memoryNode{key: key, value: value, priority: priority}
+	}
+
+	copied := *n
+	switch c := bytes.Compare(key, n.key); {
+	case c == 0:
+		copied.value = value
+	case c < 0:
+		copied.left = memoryInsert(n.left, key, value, priority)
+		if copied.left.priority > copied.priority {
+			left := copied.left
+			copied.left = left.right
+			left.right = &copied
+			return left
+		}
+	default:
+		copied.right = memoryInsert(n.right, key, value, priority)
+		if copied.right.priority > copied.priority {
+			right := copied.right
+			copied.right = right.left
+			right.left = &copied
+			return right
+		}
+	}
+	return &copied
+}
+
+func memoryDelete(n *memoryNode, key []byte) *memoryNode {
+	if n == nil {
+		return nil
+	}
+
+	switch c := bytes.Compare(key, n.key); {
+	case c < 0:
+		left := memoryDelete(n.left, key)
+		if left == n.left {
+			return n
+		}
+		copied := *n
+		copied.left = left
+		return &copied
+	case c > 0:
+		right := memoryDelete(n.right, key)
+		if right == n.right {
+			return n
+		}
+		copied := *n
+		copied.right = right
+		return &copied
+	default:
+		return memoryMerge(n.left, n.right)
+	}
+}
+
+func memoryMerge(left, right *memoryNode) *memoryNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority > right.priority {
+		copied := *left
+		copied.right = memoryMerge(left.right, right)
+		return &copied
+	}
+	copied := *right
+	copied.left = memoryMerge(left, right.left)
+	return &copied
+}
+
+// memoryCeiling returns the smallest node with a key >= key, or > key when
+// strict is set.
+func memoryCeiling(n *memoryNode, key []byte, strict bool) *memoryNode {
+	var found *memoryNode
+	for n != nil {
+		c := bytes.Compare(n.key, key)
+		if c > 0 || (c == 0 && !strict) {
+			found = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return found
+}
+
+// memoryFloor returns the largest node with a key < key. A nil key means the
+// largest node overall.
+func memoryFloor(n *memoryNode, key []byte) *memoryNode {
+	var found *memoryNode
+	for n != nil {
+		if key == nil || bytes.Compare(n.key, key) < 0 {
+			found = n
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return found
+}
+
+const (
+	memoryIterBeforeFirst = iota
+	memoryIterValid
+	memoryIterAfterLast
+	memoryIterReleased
+)
+
+type memoryIterator struct {
+	root *memoryNode
+	start []byte
+	limit []byte
+	node *memoryNode
+	state int
+	err error
+}
+
+func newMemoryIterator(root *memoryNode, keyRange *KeyRange) *memoryIterator {
+	iter := &memoryIterator{root: root}
+	if keyRange != nil {
+		iter.start = keyRange.Start
+		iter.limit = keyRange.Limit
+	}
+	return iter
+}
+
+func (it *memoryIterator) usable() bool {
+	return it.err == nil && it.state != memoryIterReleased
+}
+
+func (it *memoryIterator) moveForward(n *memoryNode) bool {
+	if n == nil || (it.limit != nil && bytes.Compare(n.key, it.limit) >= 0) {
+		it.node = nil
+		it.state = memoryIterAfterLast
+		return false
+	}
+	it.node = n
+	it.state = memoryIterValid
+	return true
+}
+
+func (it *memoryIterator) moveBackward(n *memoryNode) bool {
+	if n == nil || (it.start != nil && bytes.Compare(n.key, it.start) < 0) {
+		it.node = nil
+		it.state = memoryIterBeforeFirst
+		return false
+	}
+	it.node = n
+	it.state = memoryIterValid
+	return true
+}
+
+func (it *memoryIterator) First() bool {
+	if !it.usable() {
+		return false
+	}
+	return it.moveForward(memoryCeiling(it.root, it.start, false))
+}
+
+func (it *memoryIterator) Last() bool {
+	if !it.usable() {
+		return false
+	}
+	return it.moveBackward(memoryFloor(it.root, it.limit))
+}
+
+func (it *memoryIterator) Seek(key []byte) bool {
+	if !it.usable() {
+		return false
+	}
+	if it.start != nil && bytes.Compare(key, it.start) < 0 {
+		key = it.start
+	}
+	return it.moveForward(memoryCeiling(it.root, key, false))
+}
+
+func (it *memoryIterator) Next() bool {
+	if !it.usable() {
+		return false
+	}
+	switch it.state {
+	case memoryIterBeforeFirst:
+		return it.First()
+	case memoryIterAfterLast:
+		return false
+	}
+	return it.moveForward(memoryCeiling(it.root, it.node.key, true))
+}
+
+func (it *memoryIterator) Prev() bool {
+	if !it.usable() {
+		return false
+	}
+	switch it.state {
+	case memoryIterAfterLast:
+		return it.Last()
+	case memoryIterBeforeFirst:
+		return false
+	}
+	return it.moveBackward(memoryFloor(it.root, it.node.key))
+}
+
+func (it *memoryIterator) Key() []byte {
+	if it.node == nil || it.state != memoryIterValid {
+		return nil
+	}
+	return it.node.key
+}
+
+func (it *memoryIterator) Value() []byte {
+	if it.node == nil || it.state != memoryIterValid {
+		return nil
+	}
+	return it.node.value
+}
+
+func (it *memoryIterator) Release() {
+	it.root = nil
+	it.node = nil
+	it.state = memoryIterReleased
+}
+
+func (it *memoryIterator) Error() error {
+	return it.err
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// storageTrace records what an operation returned, so the same steps can be
+// compared across Storage implementations.
+type storageTrace []string
+
+func (tr *storageTrace) get(r storageReader, key string) {
+	value, err := r.Get([]byte(key))
+	switch {
+	case err == ErrNotFound:
+		*tr = append(*tr, "get "+key+": not found")
+	case err != nil:
+		*tr = append(*tr, "get "+key+": error")
+	default:
+		*tr = append(*tr, "get "+key+": "+string(value))
+	}
+}
+
+// walk moves it through moves, e.g. "next", "prev", "first", "last" or
+// "seek b", recording where each move lands.
+func (tr *storageTrace) walk(it Iterator, moves ...string) {
+	defer it.Release()
+	for _, move := range moves {
+		var ok bool
+		switch {
+		case move == "next":
+			ok = it.Next()
+		case move == "prev":
+			ok = it.Prev()
+		case move == "first":
+			ok = it.First()
+		case move == "last":
+			ok = it.Last()
+		case strings.HasPrefix(move, "seek "):
+			ok = it.Seek([]byte(strings.TrimPrefix(move, "seek ")))
+		default:
+			panic("unknown move " + move)
+		}
+		if ok {
+			*tr = append(*tr, fmt.Sprintf("%s: %s=%s", move, it.Key(), it.Value()))
+		} else {
+			*tr = append(*tr, move+": -")
+		}
+	}
+	if err := it.Error(); err != nil {
+		*tr = append(*tr, "iterator error")
+	}
+}
+
+// walkAll lists every key from First on.
+func (tr *storageTrace) walkAll(it Iterator) {
+	defer it.Release()
+	var keys []string
+	for ok := it.First(); ok; ok = it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	*tr = append(*tr, "keys: "+strings.Join(keys, ","))
+}
+
+type replayRecorder struct {
+	ops []string
+}
+
+func (r *replayRecorder) Put(key, value []byte) {
+	r.ops = append(r.ops, fmt.Sprintf("put %s=%s", key, value))
+}
+
+func (r *replayRecorder) Delete(key []byte) {
+	r.ops = append(r.ops, fmt.Sprintf("delete %s", key))
+}
+
+func TestStorageImplementationsAgree(t *testing.T) {
+	open := map[string]func(t *testing.T) Storage{
+		"leveldb": func(t *testing.T) Storage {
+			s, err := OpenLevelDBStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"memory": func(t *testing.T) Storage { return NewMemoryStorage() },
+	}
+
+	tests := []struct {
+		name string
+		run func(t *testing.T, s Storage, tr *storageTrace)
+		want storageTrace
+	}{
+		{
+			name: "get and overwrite",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				tr.get(s, "a")
+				tr.get(s, "a0")
+				if err := s.Put([]byte("a"), []byte("new")); err != nil {
+					t.Fatal(err)
+				}
+				tr.get(s, "a")
+			},
+			want: storageTrace{"get a: va", "get a0: not found", "get a: new"},
+		},
+		{
+			name: "iterate both ways",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				tr.walk(s.NewIterator(nil), "next", "next", "prev", "prev", "next", "last", "next", "prev")
+				tr.walk(s.NewIterator(nil), "prev", "prev")
+				tr.walk(s.NewIterator(nil), "first", "prev", "next")
+			},
+			want: storageTrace{
+				"next: a=va", "next: b=vb", "prev: a=va", "prev: -", "next: a=va", "last: d=vd", "next: -", "prev: d=vd",
+				"prev: -", "prev: -",
+				"first: a=va", "prev: -", "next: a=va",
+			},
+		},
+		{
+			name: "seek",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				tr.walk(s.NewIterator(nil), "seek b", "seek b0", "prev", "seek a", "prev", "seek e", "prev")
+				tr.walk(s.NewIterator(nil), "seek e", "next")
+				tr.walk(s.NewIterator(nil), "seek ", "next")
+			},
+			want: storageTrace{
+				"seek b: b=vb", "seek b0: b1=vb1", "prev: b=vb", "seek a: a=va", "prev: -", "seek e: -", "prev: d=vd",
+				"seek e: -", "next: -",
+				"seek : a=va", "next: b=vb",
+			},
+		},
+		{
+			name: "range bounds",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				tr.walkAll(s.NewIterator(PrefixRange([]byte("b"))))
+				tr.walkAll(s.NewIterator(&KeyRange{Start: []byte("b1"), Limit: []byte("d")}))
+				tr.walkAll(s.NewIterator(&KeyRange{Limit: []byte("b1")}))
+				tr.walkAll(s.NewIterator(&KeyRange{Start: []byte("c")}))
+				tr.walkAll(s.NewIterator(&KeyRange{Start: []byte("x"), Limit: []byte("z")}))
+				r := &KeyRange{Start: []byte("b1"), Limit: []byte("d")}
+				tr.walk(s.NewIterator(r), "last", "next", "prev", "seek a", "prev", "seek d", "prev")
+				tr.walk(s.NewIterator(r), "prev", "first", "prev")
+			},
+			want: storageTrace{
+				"keys: b,b1",
+				"keys: b1,c",
+				"keys: a,b",
+				"keys: c,d",
+				"keys: ",
+				"last: c=vc", "next: -", "prev: c=vc", "seek a: b1=vb1", "prev: -", "seek d: -", "prev: c=vc",
+				"prev: -", "first: b1=vb1", "prev: -",
+			},
+		},
+		{
+			name: "snapshot isolation",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				snapshot, err := s.GetSnapshot()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer snapshot.Release()
+				it := s.NewIterator(nil)
+
+				batch := new(Batch)
+				batch.Delete([]byte("a"))
+				batch.Put([]byte("b"), []byte("changed"))
+				batch.Put([]byte("bb"), []byte("added"))
+				if err := s.Write(batch); err != nil {
+					t.Fatal(err)
+				}
+
+				tr.get(snapshot, "a")
+				tr.get(snapshot, "b")
+				tr.get(snapshot, "bb")
+				tr.walkAll(snapshot.NewIterator(nil))
+				tr.walk(snapshot.NewIterator(PrefixRange([]byte("b"))), "last", "prev", "prev")
+				// An iterator opened before the write keeps its own view too.
+				tr.walk(it, "first", "next")
+				tr.get(s, "a")
+				tr.walkAll(s.NewIterator(nil))
+			},
+			want: storageTrace{
+				"get a: va", "get b: vb", "get bb: not found",
+				"keys: a,b,b1,c,d",
+				"last: b1=vb1", "prev: b=vb", "prev: -",
+				"first: a=va", "next: b=vb",
+				"get a: not found",
+				"keys: b,b1,bb,c,d",
+			},
+		},
+		{
+			name: "batch replay",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				batch := new(Batch)
+				batch.Put([]byte("x"), []byte("1"))
+				batch.Delete([]byte("x"))
+				batch.Put([]byte("y"), []byte("1"))
+				batch.Put([]byte("y"), []byte("2"))
+				batch.Delete([]byte("a"))
+				batch.Delete([]byte("missing"))
+				recorder := &replayRecorder{}
+				batch.Replay(recorder)
+				*tr = append(*tr, recorder.ops...)
+				if err := s.Write(batch); err != nil {
+					t.Fatal(err)
+				}
+				tr.get(s, "x")
+				tr.get(s, "y")
+				tr.walkAll(s.NewIterator(nil))
+
+				// A reset batch can be reused and starts out empty.
+				batch.Reset()
+				batch.Put([]byte("z"), []byte("3"))
+				if err := s.Write(batch); err != nil {
+					t.Fatal(err)
+				}
+				*tr = append(*tr, fmt.Sprintf("len %d", batch.Len()))
+				tr.walkAll(s.NewIterator(nil))
+			},
+			want: storageTrace{
+				"put x=1", "delete x", "put y=1", "put y=2", "delete a", "delete missing",
+				"get x: not found", "get y: 2",
+				"keys: b,b1,c,d,y",
+				"len 1",
+				"keys: b,b1,c,d,y,z",
+			},
+		},
+		{
+			name: "closed",
+			run: func(t *testing.T, s Storage, tr *storageTrace) {
+				if err := s.Close(); err != nil {
+					t.Fatal(err)
+				}
+				tr.get(s, "a")
+				*tr = append(*tr, fmt.Sprintf("put failed %v", s.Put([]byte("a"), nil) != nil))
+				_, err := s.GetSnapshot()
+				*tr = append(*tr, fmt.Sprintf("snapshot failed %v", err != nil))
+			},
+			want: storageTrace{"get a: error", "put failed true", "snapshot failed true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traces := make(map[string]storageTrace)
+			for name, openStorage := range open {
+				s := openStorage(t)
+				batch := new(Batch)
+				for _, key := range []string{"d", "b1", "a", "c", "b"} {
+					batch.Put([]byte(key), []byte("v"+key))
+				}
+				if err := s.Write(batch); err != nil {
+					t.Fatal(err)
+				}
+
+				var tr storageTrace
+				tt.run(t, s, &tr)
+				s.Close()
+				traces[name] = tr
+			}
+
+			if !reflect.DeepEqual(traces["memory"], traces["leveldb"]) {
+				t.Errorf("memory storage differs from LevelDB:\nmemory:  %q\nleveldb: %q", traces["memory"], traces["leveldb"])
+			}
+			if !reflect.DeepEqual(traces["leveldb"], tt.want) {
+				t.Errorf("got %q, want %q", traces["leveldb"], tt.want)
+			}
+		})
+	}
+}
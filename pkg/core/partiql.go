@@ -0,0 +1,1033 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	partiqlMaxBatchStatements = 25
+	partiqlMaxTransactionStatements = 100
+	partiqlMaxPageSize = 1024 * 1024
+)
+
+var (
+	ErrResourceNotFound = errors.New("Requested resource not found")
+	ErrConditionalCheckFailed = errors.New("The conditional request failed")
+	ErrDuplicateItem = errors.New("Duplicate primary key exists in table")
+)
+
+type PartiQLStatementInput struct {
+	Statement string
+	Parameters []model.AttributeValue
+	ConsistentRead bool
+}
+
+type PartiQLResult struct {
+	Items []model.Record
+	NextToken string
+	FullScan bool
+	ConsumedCapacity *model.ConsumedCapacity
+}
+
+type PartiQLBatchResult struct {
+	TableName string
+	Item model.Record
+	ConsumedCapacity *model.ConsumedCapacity
+	Err error
+}
+
+type CancellationReason struct {
+	Code string `json:"Code"`
+	Message string `json:"Message,omitempty"`
+}
+
+type TransactionCanceledError struct {
+	Reasons []CancellationReason
+}
+
+func (e *TransactionCanceledError) Error() string {
+	codes := make([]string, len(e.Reasons))
+	for i, reason := range e.Reasons {
+		codes[i] = reason.Code
+	}
+	return fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))
+}
+
+type partiqlWrite struct {
+	schema model.TableSchema
+	key string
+	oldRecord model.Record
+	newRecord model.Record
+}
+
+func (d *Database) ExecuteStatement(input PartiQLStatementInput, limit int, nextToken string) (*PartiQLResult, error) {
+	stmt, err := compilePartiQL(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.kind == "SELECT" {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		result, err := d.executePartiQLSelect(stmt, input.Parameters, input.ConsistentRead, limit, nextToken)
+		if err != nil {
+			return nil, err
+		}
+		if result.FullScan {
+			log.Printf("PartiQL statement performs a full table scan on %s: %s", stmt.table, input.Statement)
+		}
+		return result, nil
+	}
+
+	if limit > 0 || nextToken != "" || input.ConsistentRead {
+		return nil, fmt.Errorf("Limit, NextToken and ConsistentRead are only supported for SELECT statements")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	change, err := d.planPartiQLWrite(stmt, input.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := NewOperationBatch(OpExecuteStatement, &input)
+	if err := d.ApplyItemChange(batch, change.schema, change.key, change.oldRecord, change.newRecord); err != nil {
+		return nil, err
+	}
+	if err := d.Write(batch); err != nil {
+		return nil, err
+	}
+	return &PartiQLResult{ConsumedCapacity: batch.ConsumedCapacity(stmt.table)}, nil
+}
+
+func (d *Database) BatchExecuteStatement(inputs []PartiQLStatementInput) ([]PartiQLBatchResult, error) {
+	if len(inputs) == 0 || len(inputs) > partiqlMaxBatchStatements {
+		return nil, fmt.Errorf("Member must have length between 1 and %d", partiqlMaxBatchStatements)
+	}
+
+	stmts := make([]*partiqlStatement, len(inputs))
+	compileErrs := make([]error, len(inputs))
+	reads, writes := 0, 0
+	for i, input := range inputs {
+		stmts[i], compileErrs[i] = compilePartiQL(input)
+		if compileErrs[i] != nil {
+			continue
+		}
+		if stmts[i].kind == "SELECT" {
+			reads++
+		} else {
+			writes++
+		}
+	}
+	if reads > 0 && writes > 0 {
+		return nil, fmt.Errorf("Statements in a batch must be either all reads or all writes")
+	}
+
+	results := make([]PartiQLBatchResult, len(inputs))
+	for i, stmt := range stmts {
+		if compileErrs[i] != nil {
+			results[i].Err = compileErrs[i]
+			continue
+		}
+		results[i].TableName = stmt.table
+
+		if stmt.kind == "SELECT" {
+			d.mu.RLock()
+			results[i].Item, results[i].ConsumedCapacity, results[i].Err = d.getPartiQLItem(stmt, inputs[i].Parameters, inputs[i].ConsistentRead)
+			d.mu.RUnlock()
+			continue
+		}
+
+		d.mu.Lock()
+		results[i].ConsumedCapacity, results[i].Err = d.applyPartiQLWrites(stmt, &inputs[i])
+		d.mu.Unlock()
+	}
+	return results, nil
+}
+
+func (d *Database) ExecuteTransaction(inputs []PartiQLStatementInput) ([]model.Record, []*model.ConsumedCapacity, error) {
+	if len(inputs) == 0 || len(inputs) > partiqlMaxTransactionStatements {
+		return nil, nil, fmt.Errorf("Member must have length between 1 and %d", partiqlMaxTransactionStatements)
+	}
+
+	stmts := make([]*partiqlStatement, len(inputs))
+	reads := 0
+	for i, input := range inputs {
+		stmt, err := compilePartiQL(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stmt.kind == "SELECT" {
+			reads++
+		}
+		stmts[i] = stmt
+	}
+	if reads > 0 && reads != len(stmts) {
+		return nil, nil, fmt.Errorf("Transactions must be either all reads or all writes")
+	}
+
+	if reads > 0 {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		items := make([]model.Record, len(stmts))
+		var consumed []*model.ConsumedCapacity
+		for i, stmt := range stmts {
+			item, itemConsumed, err := d.getPartiQLItem(stmt, inputs[i].Parameters, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[i] = item
+			consumed = MergeConsumedCapacity(consumed, itemConsumed)
+		}
+		return items, consumed, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changes := make([]partiqlWrite, len(stmts))
+	reasons := make([]CancellationReason, len(stmts))
+	seen := make(map[string]bool, len(stmts))
+	canceled := false
+
+	for i, stmt := range stmts {
+		change, err := d.planPartiQLWrite(stmt, inputs[i].Parameters)
+		if err != nil {
+			code := partiqlCancellationCode(err)
+			if code == "ValidationError" {
+				return nil, nil, err
+			}
+			reasons[i] = CancellationReason{Code: code, Message: err.Error()}
+			canceled = true
+			continue
+		}
+		if seen[change.key] {
+			return nil, nil, fmt.Errorf("Transaction request cannot include multiple operations on one item")
+		}
+		seen[change.key] = true
+		changes[i] = change
+		reasons[i] = CancellationReason{Code: "None"}
+	}
+
+	if canceled {
+		return nil, nil, &TransactionCanceledError{Reasons: reasons}
+	}
+
+	batch := NewOperationBatch(OpExecuteTransaction, inputs)
+	for _, change := range changes {
+		if err := d.ApplyItemChange(batch, change.schema, change.key, change.oldRecord, change.newRecord); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := d.Write(batch); err != nil {
+		return nil, nil, err
+	}
+	return nil, batch.ConsumedCapacities(), nil
+}
+
+func partiqlCancellationCode(err error) string {
+	switch {
+	case errors.Is(err, ErrConditionalCheckFailed):
+		return "ConditionalCheckFailed"
+	case errors.Is(err, ErrDuplicateItem):
+		return "DuplicateItem"
+	}
+	return "ValidationError"
+}
+
+func compilePartiQL(input PartiQLStatementInput) (*partiqlStatement, error) {
+	if strings.TrimSpace(input.Statement) == "" {
+		return nil, fmt.Errorf("Statement must be specified")
+	}
+
+	stmt, err := parsePartiQL(input.Statement)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.paramCount != len(input.Parameters) {
+		return nil, fmt.Errorf("Number of parameters in request and statement don't match.")
+	}
+	return stmt, nil
+}
+
+func (d *Database) applyPartiQLWrites(stmt *partiqlStatement, input *PartiQLStatementInput) (*model.ConsumedCapacity, error) {
+	change, err := d.planPartiQLWrite(stmt, input.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := NewOperationBatch(OpBatchExecuteStatement, input)
+	if err := d.ApplyItemChange(batch, change.schema, change.key, change.oldRecord, change.newRecord); err != nil {
+		return nil, err
+	}
+	if err := d.Write(batch); err != nil {
+		return nil, err
+	}
+	return batch.ConsumedCapacity(stmt.table), nil
+}
+
+func (d *Database) partiqlSchema(stmt *partiqlStatement) (model.TableSchema, error) {
+	schema, ok := d.Tables[stmt.table]
+	if !ok {
+		return model.TableSchema{}, fmt.Errorf("%w: table %s", ErrResourceNotFound, stmt.table)
+	}
+	return schema, nil
+}
+
+func (d *Database) planPartiQLWrite(stmt *partiqlStatement, params []model.AttributeValue) (partiqlWrite, error) {
+	schema, err := d.partiqlSchema(stmt)
+	if err != nil {
+		return partiqlWrite{}, err
+	}
+
+	if stmt.kind == "INSERT" {
+		value, ok, err := evalPartiQLValue(stmt.item, nil, params)
+		if err != nil {
+			return partiqlWrite{}, err
+		}
+		fields, isMap := value["M"].(map[string]interface{})
+		if !ok || !isMap {
+			return partiqlWrite{}, fmt.Errorf("INSERT VALUE must be a tuple")
+		}
+
+		item := make(model.Record, len(fields))
+		for name, field := range fields {
+			av, ok := toAttributeValue(field)
+			if !ok {
+				return partiqlWrite{}, fmt.Errorf("invalid value for attribute %s", name)
+			}
+			item[name] = av
+		}
+
+		key, err := itemLevelDBKey(schema, item)
+		if err != nil {
+			return partiqlWrite{}, err
+		}
+		if _, err := d.DB.Get([]byte(key)); err == nil {
+			return partiqlWrite{}, ErrDuplicateItem
+		} else if err != ErrNotFound {
+			return partiqlWrite{}, err
+		}
+		return partiqlWrite{schema: schema, key: key, newRecord: item}, nil
+	}
+
+	keyValues, err := partiqlKeyConditions(stmt.where, params)
+	if err != nil {
+		return partiqlWrite{}, err
+	}
+	key, err := itemLevelDBKey(schema, keyValues)
+	if err != nil {
+		return partiqlWrite{}, fmt.Errorf("Where clause does not contain a mandatory equality on all key attributes")
+	}
+
+	var oldRecord model.Record
+	if value, err := d.DB.Get([]byte(key)); err == nil {
+		oldRecord, err = model.UnmarshalRecord(value)
+		if err != nil {
+			return partiqlWrite{}, err
+		}
+	} else if err != ErrNotFound {
+		return partiqlWrite{}, err
+	}
+
+	if oldRecord == nil {
+		return partiqlWrite{}, ErrConditionalCheckFailed
+	}
+	matched, err := evalPartiQLCondition(stmt.where, oldRecord, params)
+	if err != nil {
+		return partiqlWrite{}, err
+	}
+	if !matched {
+		return partiqlWrite{}, ErrConditionalCheckFailed
+	}
+
+	if stmt.kind == "DELETE" {
+		return partiqlWrite{schema: schema, key: key, oldRecord: oldRecord}, nil
+	}
+
+	newRecord := make(model.Record, len(oldRecord))
+	for name, value := range oldRecord {
+		newRecord[name] = value
+	}
+
+	for _, set := range stmt.sets {
+		name, ok := set.path.topLevel()
+		if !ok {
+			return partiqlWrite{}, fmt.Errorf("Nested attribute paths are not supported in SET")
+		}
+		if name == schema.PartitionKey || name == schema.SortKey {
+			return partiqlWrite{}, fmt.Errorf("Cannot update attribute %s. This attribute is part of the key", name)
+		}
+		value, present, err := evalPartiQLValue(set.value, oldRecord, params)
+		if err != nil {
+			return partiqlWrite{}, err
+		}
+		if !present {
+			return partiqlWrite{}, fmt.Errorf("The value assigned to %s is missing", name)
+		}
+		newRecord[name] = value
+	}
+
+	for _, path := range stmt.removes {
+		name, ok := path.topLevel()
+		if !ok {
+			return partiqlWrite{}, fmt.Errorf("Nested attribute paths are not supported in REMOVE")
+		}
+		if name == schema.PartitionKey || name == schema.SortKey {
+			return partiqlWrite{}, fmt.Errorf("Cannot update attribute %s. This attribute is part of the key", name)
+		}
+		delete(newRecord, name)
+	}
+
+	return partiqlWrite{schema: schema, key: key, oldRecord: oldRecord, newRecord: newRecord}, nil
+}
+
+func (d *Database) getPartiQLItem(stmt *partiqlStatement, params []model.AttributeValue, consistentRead bool) (model.Record, *model.ConsumedCapacity, error) {
+	if stmt.kind != "SELECT" {
+		return nil, nil, fmt.Errorf("Only SELECT statements can be read")
+	}
+	if stmt.index != "" {
+		return nil, nil, fmt.Errorf("Index targets are not supported for single item reads")
+	}
+
+	schema, err := d.partiqlSchema(stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyValues, err := partiqlKeyConditions(stmt.where, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := itemLevelDBKey(schema, keyValues)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Where clause does not contain a mandatory equality on all key attributes")
+	}
+	pk, _ := partiqlKeyString(keyValues[schema.PartitionKey])
+	if err := d.CheckReadCapacity(schema, "", pk); err != nil {
+		return nil, nil, err
+	}
+
+	value, err := d.Read([]byte(key), consistentRead)
+	if err == ErrNotFound {
+		return nil, d.ChargeRead(schema, "", pk, 0, consistentRead), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	record, err := model.UnmarshalRecord(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	consumed := d.ChargeRead(schema, "", pk, ItemSize(record), consistentRead)
+	matched, err := evalPartiQLCondition(stmt.where, record, params)
+	if err != nil || !matched {
+		return nil, consumed, err
+	}
+	return projectPartiQL(record, stmt.projection), consumed, nil
+}
+
+func (d *Database) executePartiQLSelect(stmt *partiqlStatement, params []model.AttributeValue, consistentRead bool, limit int, nextToken string) (*PartiQLResult, error) {
+	schema, err := d.partiqlSchema(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	keyValues, err := partiqlKeyConditions(stmt.where, params)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PartiQLResult{Items: []model.Record{}}
+	var prefix, pk string
+
+	if stmt.index != "" {
+		gsi, ok := schema.SecondaryIndex(stmt.index)
+		if !ok {
+			return nil, fmt.Errorf("The table does not have the specified index: %s", stmt.index)
+		}
+		if _, isGSI := schema.GSIs[stmt.index]; isGSI && consistentRead {
+			return nil, fmt.Errorf("Consistent reads are not supported on global secondary indexes")
+		}
+		prefix = model.BuildIndexKeyPrefix(schema.TableName, stmt.index)
+		if indexPK, ok := partiqlKeyString(keyValues[gsi.PartitionKey]); ok {
+			pk = indexPK
+			prefix += pk + model.GSIKeySeparator
+		} else {
+			result.FullScan = true
+		}
+	} else {
+		if _, err := itemLevelDBKey(schema, keyValues); err == nil && nextToken == "" {
+			item, consumed, err := d.getPartiQLItem(stmt, params, consistentRead)
+			if err != nil {
+				return nil, err
+			}
+			result.ConsumedCapacity = consumed
+			if item != nil {
+				result.Items = append(result.Items, item)
+			}
+			return result, nil
+		}
+		prefix = stmt.table + model.KeySeparator
+		if tablePK, ok := partiqlKeyString(keyValues[schema.PartitionKey]); ok {
+			pk = tablePK
+			prefix += pk
+		} else {
+			result.FullScan = true
+		}
+	}
+
+	if err := d.CheckReadCapacity(schema, stmt.index, pk); err != nil {
+		return nil, err
+	}
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(prefix)))
+	defer iter.Release()
+
+	var startKey []byte
+	if nextToken != "" {
+		startKey, err = base64.StdEncoding.DecodeString(nextToken)
+		if err != nil || !bytes.HasPrefix(startKey, []byte(prefix)) {
+			return nil, fmt.Errorf("Invalid NextToken")
+		}
+	}
+
+	ok := iter.First()
+	if startKey != nil {
+		ok = iter.Seek(startKey)
+		if ok && bytes.Equal(iter.Key(), startKey) {
+			ok = iter.Next()
+		}
+	}
+
+	evaluated, size := 0, 0
+	for ; ok; ok = iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			continue
+		}
+		evaluated++
+		size += ItemSize(record)
+
+		matched := true
+		if stmt.where != nil {
+			matched, err = evalPartiQLCondition(stmt.where, record, params)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if matched {
+			result.Items = append(result.Items, projectPartiQL(record, stmt.projection))
+		}
+
+		if (limit > 0 && evaluated >= limit) || size >= partiqlMaxPageSize {
+			if iter.Next() {
+				iter.Prev()
+				result.NextToken = base64.StdEncoding.EncodeToString(iter.Key())
+			}
+			break
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	result.ConsumedCapacity = d.ChargeRead(schema, stmt.index, pk, size, consistentRead)
+	return result, nil
+}
+
+func partiqlKeyString(av model.AttributeValue) (string, bool) {
+	if av == nil {
+		return "", false
+	}
+	if b, ok := av["B"].(string); ok {
+		return b, true
+	}
+	return model.GetAttributeValueString(av)
+}
+
+func itemLevelDBKey(schema model.TableSchema, item map[string]model.AttributeValue) (string, error) {
+	pk, ok := partiqlKeyString(item[schema.PartitionKey])
+	if !ok {
+		return "", fmt.Errorf("One or more parameter values were invalid: Missing the key %s in the item", schema.PartitionKey)
+	}
+
+	var sk string
+	if schema.SortKey != "" {
+		sk, ok = partiqlKeyString(item[schema.SortKey])
+		if !ok {
+			return "", fmt.Errorf("One or more parameter values were invalid: Missing the key %s in the item", schema.SortKey)
+		}
+	}
+	return model.BuildLevelDBKey(schema.TableName, pk, sk), nil
+}
+
+func partiqlKeyConditions(expr interface{}, params []model.AttributeValue) (map[string]model.AttributeValue, error) {
+	keys := make(map[string]model.AttributeValue)
+
+	var walk func(expr interface{}) error
+	walk = func(expr interface{}) error {
+		bin, ok := expr.(*partiqlBinary)
+		if !ok {
+			return nil
+		}
+		if bin.op == "AND" {
+			if err := walk(bin.left); err != nil {
+				return err
+			}
+			return walk(bin.right)
+		}
+		if bin.op != "=" {
+			return nil
+		}
+
+		path, isPath := bin.left.(partiqlPath)
+		operand := bin.right
+		if !isPath {
+			path, isPath = bin.right.(partiqlPath)
+			operand = bin.left
+		}
+		if !isPath {
+			return nil
+		}
+		name, ok := path.topLevel()
+		if !ok {
+			return nil
+		}
+
+		switch operand.(type) {
+		case *partiqlLiteral, *partiqlParam:
+			value, _, err := evalPartiQLValue(operand, nil, params)
+			if err != nil {
+				return err
+			}
+			keys[name] = value
+		}
+		return nil
+	}
+
+	if err := walk(expr); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func projectPartiQL(record model.Record, projection []partiqlPath) model.Record {
+	if projection == nil {
+		return record
+	}
+
+	projected := make(model.Record, len(projection))
+	for _, path := range projection {
+		value, ok := lookupPartiQLPath(record, path)
+		if !ok {
+			continue
+		}
+		last := path.elems[len(path.elems)-1]
+		name := last.name
+		if last.isIndex {
+			name = fmt.Sprintf("_%d", last.index)
+		}
+		projected[name] = value
+	}
+	return projected
+}
+
+func lookupPartiQLPath(record model.Record, path partiqlPath) (model.AttributeValue, bool) {
+	current, ok := record[path.elems[0].name]
+	if !ok {
+		return nil, false
+	}
+
+	for _, elem := range path.elems[1:] {
+		if elem.isIndex {
+			list, ok := current["L"].([]interface{})
+			if !ok || elem.index < 0 || elem.index >= len(list) {
+				return nil, false
+			}
+			current, ok = toAttributeValue(list[elem.index])
+			if !ok {
+				return nil, false
+			}
+			continue
+		}
+
+		fields, ok := current["M"].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = toAttributeValue(fields[elem.name])
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func toAttributeValue(v interface{}) (model.AttributeValue, bool) {
+	switch t := v.(type) {
+	case model.AttributeValue:
+		return t, true
+	case map[string]interface{}:
+		return model.AttributeValue(t), true
+	}
+	return nil, false
+}
+
+func evalPartiQLValue(expr interface{}, record model.Record, params []model.AttributeValue) (model.AttributeValue, bool, error) {
+	switch e := expr.(type) {
+	case *partiqlLiteral:
+		return e.value, true, nil
+
+	case *partiqlParam:
+		if e.index >= len(params) {
+			return nil, false, fmt.Errorf("Number of parameters in request and statement don't match.")
+		}
+		return params[e.index], true, nil
+
+	case partiqlPath:
+		value, ok := lookupPartiQLPath(record, e)
+		return value, ok, nil
+
+	case *partiqlMap:
+		fields := make(map[string]interface{}, len(e.keys))
+		for i, key := range e.keys {
+			value, ok, err := evalPartiQLValue(e.values[i], record, params)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				fields[key] = map[string]interface{}(value)
+			}
+		}
+		return model.AttributeValue{"M": fields}, true, nil
+
+	case *partiqlList:
+		items := make([]interface{}, 0, len(e.values))
+		for _, v := range e.values {
+			value, ok, err := evalPartiQLValue(v, record, params)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				items = append(items, map[string]interface{}(value))
+			}
+		}
+		return model.AttributeValue{"L": items}, true, nil
+
+	case *partiqlSetLiteral:
+		var setType string
+		members := make([]interface{}, 0, len(e.values))
+		for _, v := range e.values {
+			value, ok, err := evalPartiQLValue(v, record, params)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				continue
+			}
+			for _, t := range []string{"S", "N", "B"} {
+				if s, isType := value[t].(string); isType {
+					if setType != "" && setType != t {
+						return nil, false, fmt.Errorf("Set members must all be of the same type")
+					}
+					setType = t
+					members = append(members, s)
+				}
+			}
+		}
+		if setType == "" {
+			return nil, false, fmt.Errorf("Sets must contain at least one string, number or binary value")
+		}
+		return model.AttributeValue{setType + "S": members}, true, nil
+
+	case *partiqlBinary:
+		if e.op == "+" || e.op == "-" {
+			left, lok, err := evalPartiQLValue(e.left, record, params)
+			if err != nil || !lok {
+				return nil, false, err
+			}
+			right, rok, err := evalPartiQLValue(e.right, record, params)
+			if err != nil || !rok {
+				return nil, false, err
+			}
+			return partiqlArithmetic(e.op, left, right)
+		}
+	}
+
+	matched, err := evalPartiQLCondition(expr, record, params)
+	if err != nil {
+		return nil, false, err
+	}
+	return model.AttributeValue{"BOOL": matched}, true, nil
+}
+
+func partiqlArithmetic(op string, left, right model.AttributeValue) (model.AttributeValue, bool, error) {
+	ls, lok := left["N"].(string)
+	rs, rok := right["N"].(string)
+	if !lok || !rok {
+		return nil, false, fmt.Errorf("Arithmetic operands must be numbers")
+	}
+
+	l, err := model.ParseNumber(ls)
+	if err != nil {
+		return nil, false, err
+	}
+	r, err := model.ParseNumber(rs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := new(big.Float).SetPrec(l.Prec())
+	if op == "+" {
+		result.Add(l, r)
+	} else {
+		result.Sub(l, r)
+	}
+
+	if result.IsInt() {
+		i, _ := result.Int(nil)
+		return model.AttributeValue{"N": i.String()}, true, nil
+	}
+	return model.AttributeValue{"N": result.Text('f', -1)}, true, nil
+}
+
+func evalPartiQLCondition(expr interface{}, record model.Record, params []model.AttributeValue) (bool, error) {
+	switch e := expr.(type) {
+	case nil:
+		return true, nil
+
+	case *partiqlNot:
+		matched, err := evalPartiQLCondition(e.expr, record, params)
+		return !matched, err
+
+	case *partiqlBinary:
+		switch e.op {
+		case "AND":
+			matched, err := evalPartiQLCondition(e.left, record, params)
+			if err != nil || !matched {
+				return false, err
+			}
+			return evalPartiQLCondition(e.right, record, params)
+		case "OR":
+			matched, err := evalPartiQLCondition(e.left, record, params)
+			if err != nil || matched {
+				return matched, err
+			}
+			return evalPartiQLCondition(e.right, record, params)
+		}
+
+		left, lok, err := evalPartiQLValue(e.left, record, params)
+		if err != nil {
+			return false, err
+		}
+		right, rok, err := evalPartiQLValue(e.right, record, params)
+		if err != nil {
+			return false, err
+		}
+		if !lok || !rok {
+			return false, nil
+		}
+
+		switch e.op {
+		case "=":
+			return partiqlValuesEqual(left, right), nil
+		case "<>":
+			return !partiqlValuesEqual(left, right), nil
+		}
+		cmp, ok := comparePartiQLValues(left, right)
+		if !ok {
+			return false, nil
+		}
+		switch e.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		}
+		return false, fmt.Errorf("Unsupported operator: %s", e.op)
+
+	case *partiqlBetween:
+		target, ok, err := evalPartiQLValue(e.target, record, params)
+		if err != nil || !ok {
+			return false, err
+		}
+		low, lok, err := evalPartiQLValue(e.low, record, params)
+		if err != nil || !lok {
+			return false, err
+		}
+		high, hok, err := evalPartiQLValue(e.high, record, params)
+		if err != nil || !hok {
+			return false, err
+		}
+		lowCmp, ok1 := comparePartiQLValues(target, low)
+		highCmp, ok2 := comparePartiQLValues(target, high)
+		return ok1 && ok2 && lowCmp >= 0 && highCmp <= 0, nil
+
+	case *partiqlIn:
+		target, ok, err := evalPartiQLValue(e.target, record, params)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		if ok {
+			for _, v := range e.values {
+				value, vok, err := evalPartiQLValue(v, record, params)
+				if err != nil {
+					return false, err
+				}
+				if vok && partiqlValuesEqual(target, value) {
+					found = true
+					break
+				}
+			}
+		}
+		return found != e.negated, nil
+
+	case *partiqlIs:
+		value, present, err := evalPartiQLValue(e.target, record, params)
+		if err != nil {
+			return false, err
+		}
+		var matched bool
+		if e.what == "MISSING" {
+			matched = !present
+		} else {
+			isNull, _ := value["NULL"].(bool)
+			matched = present && isNull
+		}
+		return matched != e.negated, nil
+
+	case *partiqlFunc:
+		return evalPartiQLFunction(e, record, params)
+	}
+
+	value, ok, err := evalPartiQLValue(expr, record, params)
+	if err != nil || !ok {
+		return false, err
+	}
+	b, isBool := value["BOOL"].(bool)
+	if !isBool {
+		return false, fmt.Errorf("Condition must evaluate to a boolean")
+	}
+	return b, nil
+}
+
+func evalPartiQLFunction(fn *partiqlFunc, record model.Record, params []model.AttributeValue) (bool, error) {
+	switch fn.name {
+	case "attribute_exists", "attribute_not_exists":
+		if len(fn.args) != 1 {
+			return false, fmt.Errorf("%s requires exactly one argument", fn.name)
+		}
+		_, present, err := evalPartiQLValue(fn.args[0], record, params)
+		if err != nil {
+			return false, err
+		}
+		return present == (fn.name == "attribute_exists"), nil
+
+	case "begins_with", "contains":
+		if len(fn.args) != 2 {
+			return false, fmt.Errorf("%s requires exactly two arguments", fn.name)
+		}
+		target, ok, err := evalPartiQLValue(fn.args[0], record, params)
+		if err != nil || !ok {
+			return false, err
+		}
+		operand, ok, err := evalPartiQLValue(fn.args[1], record, params)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		if fn.name == "begins_with" {
+			for _, t := range []string{"S", "B"} {
+				if s, ok := target[t].(string); ok {
+					prefix, ok := operand[t].(string)
+					return ok && strings.HasPrefix(s, prefix), nil
+				}
+			}
+			return false, nil
+		}
+
+		if s, ok := target["S"].(string); ok {
+			sub, ok := operand["S"].(string)
+			return ok && strings.Contains(s, sub), nil
+		}
+		for _, t := range []string{"SS", "NS", "BS"} {
+			if members, ok := target[t].([]interface{}); ok {
+				scalar := model.AttributeValue{t[:1]: nil}
+				for _, member := range members {
+					scalar[t[:1]] = member
+					if partiqlValuesEqual(scalar, operand) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+		}
+		if items, ok := target["L"].([]interface{}); ok {
+			for _, item := range items {
+				if av, ok := toAttributeValue(item); ok && partiqlValuesEqual(av, operand) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Unsupported function: %s", fn.name)
+}
+
+func comparePartiQLValues(a, b model.AttributeValue) (int, bool) {
+	if as, ok := a["N"].(string); ok {
+		bs, ok := b["N"].(string)
+		if !ok {
+			return 0, false
+		}
+		an, err := model.ParseNumber(as)
+		if err != nil {
+			return 0, false
+		}
+		bn, err := model.ParseNumber(bs)
+		if err != nil {
+			return 0, false
+		}
+		return an.Cmp(bn), true
+	}
+
+	for _, t := range []string{"S", "B"} {
+		if as, ok := a[t].(string); ok {
+			bs, ok := b[t].(string)
+			if !ok {
+				return 0, false
+			}
+			return strings.Compare(as, bs), true
+		}
+	}
+	return 0, false
+}
+
+func partiqlValuesEqual(a, b model.AttributeValue) bool {
+	if cmp, ok := comparePartiQLValues(a, b); ok {
+		return cmp == 0
+	}
+	aj, err1 := json.Marshal(a)
+	bj, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && bytes.Equal(aj, bj)
+}
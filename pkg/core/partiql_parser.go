@@ -0,0 +1,800 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+type partiqlTokenKind int
+
+const (
+	tokEOF partiqlTokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokParam
+	tokSymbol
+)
+
+type partiqlToken struct {
+	kind partiqlTokenKind
+	text string
+	pos int
+}
+
+func lexPartiQL(input string) ([]partiqlToken, error) {
+	var tokens []partiqlToken
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '\'' || r == '"':
+			quote := r
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == quote {
+					if i+1 < len(runes) && runes[i+1] == quote {
+						sb.WriteRune(quote)
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("Statement wasn't well formed, can't be processed: unterminated quoted text at position %d", start)
+			}
+			kind := tokString
+			if quote == '"' {
+				kind = tokQuotedIdent
+			}
+			tokens = append(tokens, partiqlToken{kind: kind, text: sb.String(), pos: start})
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, partiqlToken{kind: tokNumber, text: string(runes[start:i]), pos: start})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, partiqlToken{kind: tokIdent, text: string(runes[start:i]), pos: start})
+
+		case r == '?':
+			tokens = append(tokens, partiqlToken{kind: tokParam, text: "?", pos: i})
+			i++
+
+		default:
+			start := i
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch two {
+			case "<=", ">=", "<>", "!=", "<<", ">>":
+				tokens = append(tokens, partiqlToken{kind: tokSymbol, text: two, pos: start})
+				i += 2
+				continue
+			}
+			if strings.ContainsRune("=<>()[]{},.:*+-", r) {
+				tokens = append(tokens, partiqlToken{kind: tokSymbol, text: string(r), pos: start})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("Statement wasn't well formed, can't be processed: unexpected character '%c' at position %d", r, start)
+		}
+	}
+
+	tokens = append(tokens, partiqlToken{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type partiqlPathElem struct {
+	name string
+	index int
+	isIndex bool
+}
+
+type partiqlPath struct {
+	elems []partiqlPathElem
+}
+
+func (p partiqlPath) topLevel() (string, bool) {
+	if len(p.elems) != 1 || p.elems[0].isIndex {
+		return "", false
+	}
+	return p.elems[0].name, true
+}
+
+type partiqlLiteral struct {
+	value model.AttributeValue
+}
+
+type partiqlParam struct {
+	index int
+}
+
+type partiqlBinary struct {
+	op string
+	left interface{}
+	right interface{}
+}
+
+type partiqlNot struct {
+	expr interface{}
+}
+
+type partiqlBetween struct {
+	target interface{}
+	low interface{}
+	high interface{}
+}
+
+type partiqlIn struct {
+	target interface{}
+	values []interface{}
+	negated bool
+}
+
+type partiqlIs struct {
+	target interface{}
+	what string
+	negated bool
+}
+
+type partiqlFunc struct {
+	name string
+	args []interface{}
+}
+
+type partiqlMap struct {
+	keys []string
+	values []interface{}
+}
+
+type partiqlList struct {
+	values []interface{}
+}
+
+type partiqlSetLiteral struct {
+	values []interface{}
+}
+
+type partiqlAssignment struct {
+	path partiqlPath
+	value interface{}
+}
+
+type partiqlStatement struct {
+	kind string
+	table string
+	index string
+	projection []partiqlPath
+	where interface{}
+	item interface{}
+	sets []partiqlAssignment
+	removes []partiqlPath
+	paramCount int
+}
+
+type partiqlParser struct {
+	tokens []partiqlToken
+	pos int
+	params int
+}
+
+func parsePartiQL(statement string) (*partiqlStatement, error) {
+	tokens, err := lexPartiQL(statement)
+	if err != nil {
+		return nil, err
+	}
+	p := &partiqlParser{tokens: tokens}
+
+	var stmt *partiqlStatement
+	switch {
+	case p.peekKeyword("SELECT"):
+		stmt, err = p.parseSelect()
+	case p.peekKeyword("INSERT"):
+		stmt, err = p.parseInsert()
+	case p.peekKeyword("UPDATE"):
+		stmt, err = p.parseUpdate()
+	case p.peekKeyword("DELETE"):
+		stmt, err = p.parseDelete()
+	default:
+		return nil, p.errorf("expected SELECT, INSERT, UPDATE or DELETE")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected token '%s'", p.peek().text)
+	}
+	stmt.paramCount = p.params
+	return stmt, nil
+}
+
+func (p *partiqlParser) peek() partiqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *partiqlParser) next() partiqlToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *partiqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Statement wasn't well formed, can't be processed: %s at position %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *partiqlParser) peekKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *partiqlParser) acceptKeyword(keyword string) bool {
+	if p.peekKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *partiqlParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %s", keyword)
+	}
+	return nil
+}
+
+func (p *partiqlParser) peekSymbol(symbol string) bool {
+	tok := p.peek()
+	return tok.kind == tokSymbol && tok.text == symbol
+}
+
+func (p *partiqlParser) acceptSymbol(symbol string) bool {
+	if p.peekSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *partiqlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("expected '%s'", symbol)
+	}
+	return nil
+}
+
+func (p *partiqlParser) parseIdentifier() (string, error) {
+	tok := p.peek()
+	if tok.kind == tokIdent || tok.kind == tokQuotedIdent {
+		p.pos++
+		return tok.text, nil
+	}
+	return "", p.errorf("expected identifier")
+}
+
+func (p *partiqlParser) parseTarget(stmt *partiqlStatement, allowIndex bool) error {
+	table, err := p.parseIdentifier()
+	if err != nil {
+		return err
+	}
+	stmt.table = table
+
+	if p.acceptSymbol(".") {
+		if !allowIndex {
+			return p.errorf("index targets are only supported in SELECT")
+		}
+		index, err := p.parseIdentifier()
+		if err != nil {
+			return err
+		}
+		stmt.index = index
+	}
+	return nil
+}
+
+func (p *partiqlParser) parseSelect() (*partiqlStatement, error) {
+	p.next()
+	stmt := &partiqlStatement{kind: "SELECT"}
+
+	if !p.acceptSymbol("*") {
+		for {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			stmt.projection = append(stmt.projection, path)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if err := p.parseTarget(stmt, true); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.where = where
+	}
+	return stmt, nil
+}
+
+func (p *partiqlParser) parseInsert() (*partiqlStatement, error) {
+	p.next()
+	stmt := &partiqlStatement{kind: "INSERT"}
+
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	if err := p.parseTarget(stmt, false); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("VALUE"); err != nil {
+		return nil, err
+	}
+
+	item, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := item.(*partiqlMap); !ok {
+		if _, ok := item.(*partiqlParam); !ok {
+			return nil, p.errorf("INSERT VALUE must be a tuple")
+		}
+	}
+	stmt.item = item
+	return stmt, nil
+}
+
+func (p *partiqlParser) parseUpdate() (*partiqlStatement, error) {
+	p.next()
+	stmt := &partiqlStatement{kind: "UPDATE"}
+
+	if err := p.parseTarget(stmt, false); err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.acceptKeyword("SET") {
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectSymbol("="); err != nil {
+					return nil, err
+				}
+				value, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				stmt.sets = append(stmt.sets, partiqlAssignment{path: path, value: value})
+				if !p.acceptSymbol(",") {
+					break
+				}
+			}
+			continue
+		}
+		if p.acceptKeyword("REMOVE") {
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				stmt.removes = append(stmt.removes, path)
+				if !p.acceptSymbol(",") {
+					break
+				}
+			}
+			continue
+		}
+		break
+	}
+
+	if len(stmt.sets) == 0 && len(stmt.removes) == 0 {
+		return nil, p.errorf("UPDATE requires at least one SET or REMOVE clause")
+	}
+
+	if err := p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	where, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	stmt.where = where
+	return stmt, nil
+}
+
+func (p *partiqlParser) parseDelete() (*partiqlStatement, error) {
+	p.next()
+	stmt := &partiqlStatement{kind: "DELETE"}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if err := p.parseTarget(stmt, false); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	where, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	stmt.where = where
+	return stmt, nil
+}
+
+func (p *partiqlParser) parsePath() (partiqlPath, error) {
+	name, err := p.parseIdentifier()
+	if err != nil {
+		return partiqlPath{}, err
+	}
+	path := partiqlPath{elems: []partiqlPathElem{{name: name}}}
+
+	for {
+		if p.acceptSymbol(".") {
+			name, err := p.parseIdentifier()
+			if err != nil {
+				return partiqlPath{}, err
+			}
+			path.elems = append(path.elems, partiqlPathElem{name: name})
+			continue
+		}
+		if p.acceptSymbol("[") {
+			tok := p.next()
+			if tok.kind != tokNumber {
+				return partiqlPath{}, p.errorf("expected list index")
+			}
+			var index int
+			if _, err := fmt.Sscanf(tok.text, "%d", &index); err != nil {
+				return partiqlPath{}, p.errorf("invalid list index %s", tok.text)
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return partiqlPath{}, err
+			}
+			path.elems = append(path.elems, partiqlPathElem{index: index, isIndex: true})
+			continue
+		}
+		return path, nil
+	}
+}
+
+func (p *partiqlParser) parseExpr() (interface{}, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &partiqlBinary{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *partiqlParser) parseAnd() (interface{}, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &partiqlBinary{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *partiqlParser) parseNot() (interface{}, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &partiqlNot{expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *partiqlParser) parsePredicate() (interface{}, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind == tokSymbol {
+		switch tok.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := tok.text
+			if op == "!=" {
+				op = "<>"
+			}
+			return &partiqlBinary{op: op, left: left, right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("BETWEEN") {
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &partiqlBetween{target: left, low: low, high: high}, nil
+	}
+
+	negated := false
+	if p.peekKeyword("NOT") && p.pos+1 < len(p.tokens) && strings.EqualFold(p.tokens[p.pos+1].text, "IN") {
+		p.next()
+		negated = true
+	}
+	if p.acceptKeyword("IN") {
+		closer := ")"
+		if p.acceptSymbol("[") {
+			closer = "]"
+		} else if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		in := &partiqlIn{target: left, negated: negated}
+		for !p.peekSymbol(closer) {
+			value, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			in.values = append(in.values, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(closer); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		is := &partiqlIs{target: left}
+		if p.acceptKeyword("NOT") {
+			is.negated = true
+		}
+		switch {
+		case p.acceptKeyword("MISSING"):
+			is.what = "MISSING"
+		case p.acceptKeyword("NULL"):
+			is.what = "NULL"
+		default:
+			return nil, p.errorf("expected MISSING or NULL")
+		}
+		return is, nil
+	}
+
+	return left, nil
+}
+
+func (p *partiqlParser) parseAdditive() (interface{}, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekSymbol("+") || p.peekSymbol("-") {
+		op := p.next().text
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &partiqlBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *partiqlParser) parsePrimary() (interface{}, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return &partiqlLiteral{value: model.AttributeValue{"S": tok.text}}, nil
+
+	case tokNumber:
+		p.next()
+		return &partiqlLiteral{value: model.AttributeValue{"N": tok.text}}, nil
+
+	case tokParam:
+		p.next()
+		param := &partiqlParam{index: p.params}
+		p.params++
+		return param, nil
+
+	case tokQuotedIdent:
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return path, nil
+
+	case tokIdent:
+		upper := strings.ToUpper(tok.text)
+		switch upper {
+		case "TRUE", "FALSE":
+			p.next()
+			return &partiqlLiteral{value: model.AttributeValue{"BOOL": upper == "TRUE"}}, nil
+		case "NULL":
+			p.next()
+			return &partiqlLiteral{value: model.AttributeValue{"NULL": true}}, nil
+		}
+
+		if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokSymbol && p.tokens[p.pos+1].text == "(" {
+			p.next()
+			p.next()
+			fn := &partiqlFunc{name: strings.ToLower(tok.text)}
+			for !p.peekSymbol(")") {
+				arg, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				fn.args = append(fn.args, arg)
+				if !p.acceptSymbol(",") {
+					break
+				}
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return fn, nil
+		}
+
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return path, nil
+
+	case tokSymbol:
+		switch tok.text {
+		case "-":
+			p.next()
+			num := p.next()
+			if num.kind != tokNumber {
+				return nil, p.errorf("expected number after '-'")
+			}
+			return &partiqlLiteral{value: model.AttributeValue{"N": "-" + num.text}}, nil
+
+		case "(":
+			p.next()
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+
+		case "{":
+			p.next()
+			m := &partiqlMap{}
+			for !p.peekSymbol("}") {
+				keyTok := p.next()
+				if keyTok.kind != tokString && keyTok.kind != tokQuotedIdent && keyTok.kind != tokIdent {
+					return nil, p.errorf("expected attribute name in tuple")
+				}
+				if err := p.expectSymbol(":"); err != nil {
+					return nil, err
+				}
+				value, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				m.keys = append(m.keys, keyTok.text)
+				m.values = append(m.values, value)
+				if !p.acceptSymbol(",") {
+					break
+				}
+			}
+			if err := p.expectSymbol("}"); err != nil {
+				return nil, err
+			}
+			return m, nil
+
+		case "[":
+			p.next()
+			l := &partiqlList{}
+			for !p.peekSymbol("]") {
+				value, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				l.values = append(l.values, value)
+				if !p.acceptSymbol(",") {
+					break
+				}
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			return l, nil
+
+		case "<<":
+			p.next()
+			set := &partiqlSetLiteral{}
+			for !p.peekSymbol(">>") {
+				value, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				set.values = append(set.values, value)
+				if !p.acceptSymbol(",") {
+					break
+				}
+			}
+			if err := p.expectSymbol(">>"); err != nil {
+				return nil, err
+			}
+			return set, nil
+		}
+	}
+
+	return nil, p.errorf("unexpected token '%s'", tok.text)
+}
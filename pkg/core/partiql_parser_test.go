@@ -0,0 +1,201 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func testPath(names ...string) partiqlPath {
+	path := partiqlPath{}
+	for _, name := range names {
+		path.elems = append(path.elems, partiqlPathElem{name: name})
+	}
+	return path
+}
+
+func testLiteral(typ string, value interface{}) *partiqlLiteral {
+	return &partiqlLiteral{value: model.AttributeValue{typ: value}}
+}
+
+func TestParsePartiQL(t *testing.T) {
+	tests := []struct {
+		statement string
+		want *partiqlStatement
+	}{
+		{
+			`SELECT * FROM T`,
+			&partiqlStatement{kind: "SELECT", table: "T"},
+		},
+		{
+			`select a, b.c[1] from "T"."Idx" where pk = 'x' and n > ?`,
+			&partiqlStatement{
+				kind: "SELECT",
+				table: "T",
+				index: "Idx",
+				projection: []partiqlPath{
+					testPath("a"),
+					{elems: []partiqlPathElem{{name: "b"}, {name: "c"}, {index: 1, isIndex: true}}},
+				},
+				where: &partiqlBinary{
+					op: "AND",
+					left: &partiqlBinary{op: "=", left: testPath("pk"), right: testLiteral("S", "x")},
+					right: &partiqlBinary{op: ">", left: testPath("n"), right: &partiqlParam{index: 0}},
+				},
+				paramCount: 1,
+			},
+		},
+		{
+			`SELECT * FROM T WHERE s = 'it''s' OR s != "quoted name"`,
+			&partiqlStatement{
+				kind: "SELECT",
+				table: "T",
+				where: &partiqlBinary{
+					op: "OR",
+					left: &partiqlBinary{op: "=", left: testPath("s"), right: testLiteral("S", "it's")},
+					right: &partiqlBinary{op: "<>", left: testPath("s"), right: testPath("quoted name")},
+				},
+			},
+		},
+		{
+			`SELECT * FROM T WHERE n BETWEEN -1 AND 2.5e3 AND s IN ('a', ?) AND s NOT IN ['b'] AND NOT x IS NOT MISSING AND y IS NULL`,
+			&partiqlStatement{
+				kind: "SELECT",
+				table: "T",
+				where: &partiqlBinary{
+					op: "AND",
+					left: &partiqlBinary{
+						op: "AND",
+						left: &partiqlBinary{
+							op: "AND",
+							left: &partiqlBinary{
+								op: "AND",
+								left: &partiqlBetween{target: testPath("n"), low: testLiteral("N", "-1"), high: testLiteral("N", "2.5e3")},
+								right: &partiqlIn{target: testPath("s"), values: []interface{}{testLiteral("S", "a"), &partiqlParam{index: 0}}},
+							},
+							right: &partiqlIn{target: testPath("s"), values: []interface{}{testLiteral("S", "b")}, negated: true},
+						},
+						right: &partiqlNot{expr: &partiqlIs{target: testPath("x"), what: "MISSING", negated: true}},
+					},
+					right: &partiqlIs{target: testPath("y"), what: "NULL"},
+				},
+				paramCount: 1,
+			},
+		},
+		{
+			`SELECT * FROM T WHERE begins_with(s, 'a') AND (attribute_exists(n) OR c = TRUE)`,
+			&partiqlStatement{
+				kind: "SELECT",
+				table: "T",
+				where: &partiqlBinary{
+					op: "AND",
+					left: &partiqlFunc{name: "begins_with", args: []interface{}{testPath("s"), testLiteral("S", "a")}},
+					right: &partiqlBinary{
+						op: "OR",
+						left: &partiqlFunc{name: "attribute_exists", args: []interface{}{testPath("n")}},
+						right: &partiqlBinary{op: "=", left: testPath("c"), right: testLiteral("BOOL", true)},
+					},
+				},
+			},
+		},
+		{
+			`INSERT INTO T VALUE {'pk': 'a', n: 1, 'l': [true, null], 's': <<'x', 'y'>>}`,
+			&partiqlStatement{
+				kind: "INSERT",
+				table: "T",
+				item: &partiqlMap{
+					keys: []string{"pk", "n", "l", "s"},
+					values: []interface{}{
+						testLiteral("S", "a"),
+						testLiteral("N", "1"),
+						&partiqlList{values: []interface{}{testLiteral("BOOL", true), testLiteral("NULL", true)}},
+						&partiqlSetLiteral{values: []interface{}{testLiteral("S", "x"), testLiteral("S", "y")}},
+					},
+				},
+			},
+		},
+		{
+			`INSERT INTO T VALUE ?`,
+			&partiqlStatement{kind: "INSERT", table: "T", item: &partiqlParam{index: 0}, paramCount: 1},
+		},
+		{
+			`UPDATE T SET n = n + 1 SET s = ? REMOVE old, older WHERE pk = ?`,
+			&partiqlStatement{
+				kind: "UPDATE",
+				table: "T",
+				sets: []partiqlAssignment{
+					{path: testPath("n"), value: &partiqlBinary{op: "+", left: testPath("n"), right: testLiteral("N", "1")}},
+					{path: testPath("s"), value: &partiqlParam{index: 0}},
+				},
+				removes: []partiqlPath{testPath("old"), testPath("older")},
+				where: &partiqlBinary{op: "=", left: testPath("pk"), right: &partiqlParam{index: 1}},
+				paramCount: 2,
+			},
+		},
+		{
+			`DELETE FROM T WHERE pk = 'a'`,
+			&partiqlStatement{
+				kind: "DELETE",
+				table: "T",
+				where: &partiqlBinary{op: "=", left: testPath("pk"), right: testLiteral("S", "a")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.statement, func(t *testing.T) {
+			stmt, err := parsePartiQL(tt.statement)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stmt, tt.want) {
+				t.Errorf("got %+v, want %+v", stmt, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePartiQLErrors(t *testing.T) {
+	tests := []struct {
+		statement string
+		want string
+	}{
+		{``, "expected SELECT, INSERT, UPDATE or DELETE"},
+		{`SHOW TABLES`, "expected SELECT, INSERT, UPDATE or DELETE"},
+		{`SELECT * T`, "expected FROM"},
+		{`SELECT FROM T`, "expected FROM"},
+		{`SELECT * FROM T WHERE`, "unexpected token ''"},
+		{`SELECT * FROM T extra`, "unexpected token 'extra'"},
+		{`SELECT * FROM T WHERE s = 'open`, "unterminated quoted text at position 26"},
+		{`SELECT * FROM T WHERE a = 1; DROP`, "unexpected character ';'"},
+		{`SELECT a[x] FROM T`, "expected list index"},
+		{`SELECT * FROM T WHERE a IS EMPTY`, "expected MISSING or NULL"},
+		{`SELECT * FROM T WHERE a = -b`, "expected number after '-'"},
+		{`SELECT * FROM T WHERE a IN (1, 2`, "expected ')'"},
+		{`SELECT * FROM T WHERE a BETWEEN 1 OR 2`, "expected AND"},
+		{`INSERT T VALUE {'a': 1}`, "expected INTO"},
+		{`INSERT INTO T.Idx VALUE {'a': 1}`, "index targets are only supported in SELECT"},
+		{`INSERT INTO T VALUE 1`, "INSERT VALUE must be a tuple"},
+		{`INSERT INTO T VALUE {1: 1}`, "expected attribute name in tuple"},
+		{`INSERT INTO T VALUE {'a' 1}`, "expected ':'"},
+		{`UPDATE T WHERE pk = 'a'`, "UPDATE requires at least one SET or REMOVE clause"},
+		{`UPDATE T SET n = 1`, "expected WHERE"},
+		{`UPDATE T SET n 1 WHERE pk = 'a'`, "expected '='"},
+		{`DELETE FROM T`, "expected WHERE"},
+		{`DELETE T WHERE pk = 'a'`, "expected FROM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.statement, func(t *testing.T) {
+			_, err := parsePartiQL(tt.statement)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.HasPrefix(err.Error(), "Statement wasn't well formed, can't be processed: ") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func newPartiQLTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db, err := NewDatabase(DatabaseOptions{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema := model.TableSchema{
+		TableName: "T",
+		PartitionKey: "pk",
+		SortKey: "sk",
+		GSIs: map[string]model.GsiSchema{
+			"ByN": {IndexName: "ByN", PartitionKey: "n", Projection: model.Projection{ProjectionType: "ALL"}},
+		},
+	}
+	if err := db.CreateTable(schema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestExecuteStatement(t *testing.T) {
+	db := newPartiQLTestDatabase(t)
+
+	item1 := model.Record{"pk": {"S": "a"}, "sk": {"N": "1"}, "s": {"S": "x"}, "n": {"N": "10"}}
+	item2 := model.Record{"pk": {"S": "a"}, "sk": {"N": "2"}, "s": {"S": "y"}, "n": {"N": "20"}}
+	updated := model.Record{"pk": {"S": "a"}, "sk": {"N": "1"}, "n": {"N": "15"}, "tags": {"SS": []interface{}{"p", "q"}}}
+
+	// The steps run in order against the same table.
+	steps := []struct {
+		statement string
+		params []model.AttributeValue
+		want []model.Record
+		wantErr error
+	}{
+		{statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1, 's': 'x', 'n': 10}`},
+		{
+			statement: `INSERT INTO T VALUE ?`,
+			params: []model.AttributeValue{{"M": map[string]interface{}{
+				"pk": map[string]interface{}{"S": "a"},
+				"sk": map[string]interface{}{"N": "2"},
+				"s": map[string]interface{}{"S": "y"},
+				"n": map[string]interface{}{"N": "20"},
+			}}},
+		},
+		{statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1}`, wantErr: ErrDuplicateItem},
+		{statement: `SELECT * FROM T WHERE pk = 'a' AND sk = 1`, want: []model.Record{item1}},
+		{
+			statement: `SELECT n FROM T WHERE pk = ? AND sk = ?`,
+			params: []model.AttributeValue{{"S": "a"}, {"N": "2"}},
+			want: []model.Record{{"n": {"N": "20"}}},
+		},
+		{statement: `SELECT * FROM T WHERE pk = 'a' AND n > 15`, want: []model.Record{item2}},
+		{statement: `SELECT s FROM T WHERE s IN ('x', 'z')`, want: []model.Record{{"s": {"S": "x"}}}},
+		{statement: `UPDATE T SET n = n + 5 SET tags = <<'p', 'q'>> REMOVE s WHERE pk = 'a' AND sk = 1 AND s = 'x'`},
+		{statement: `UPDATE T SET n = 1 WHERE pk = 'a' AND sk = 1 AND s = 'x'`, wantErr: ErrConditionalCheckFailed},
+		{statement: `UPDATE T SET n = 1 WHERE pk = 'a' AND sk = 3`, wantErr: ErrConditionalCheckFailed},
+		{statement: `DELETE FROM T WHERE pk = 'a' AND sk = 2 AND n = 99`, wantErr: ErrConditionalCheckFailed},
+		{statement: `DELETE FROM T WHERE pk = 'a' AND sk = 2`},
+		{statement: `SELECT * FROM T WHERE pk = 'a'`, want: []model.Record{updated}},
+		{statement: `SELECT * FROM "T"."ByN" WHERE n = 15`, want: []model.Record{updated}},
+		{statement: `SELECT * FROM "T"."ByN" WHERE n = 20`, want: []model.Record{}},
+		{statement: `SELECT * FROM Missing`, wantErr: ErrResourceNotFound},
+	}
+
+	for _, step := range steps {
+		result, err := db.ExecuteStatement(PartiQLStatementInput{Statement: step.statement, Parameters: step.params}, 0, "")
+		if step.wantErr != nil {
+			if !errors.Is(err, step.wantErr) {
+				t.Fatalf("%s: got error %v, want %v", step.statement, err, step.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", step.statement, err)
+		}
+		if step.want != nil && !reflect.DeepEqual(result.Items, step.want) {
+			t.Fatalf("%s: got %v, want %v", step.statement, result.Items, step.want)
+		}
+	}
+}
+
+func TestExecuteStatementErrors(t *testing.T) {
+	db := newPartiQLTestDatabase(t)
+	if _, err := db.ExecuteStatement(PartiQLStatementInput{Statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1}`}, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		input PartiQLStatementInput
+		limit int
+		want string
+	}{
+		{"empty statement", PartiQLStatementInput{Statement: " "}, 0, "Statement must be specified"},
+		{"syntax error", PartiQLStatementInput{Statement: `SELECT * FROM`}, 0, "Statement wasn't well formed, can't be processed: expected identifier at position 13"},
+		{"missing parameter", PartiQLStatementInput{Statement: `SELECT * FROM T WHERE pk = ?`}, 0, "Number of parameters in request and statement don't match."},
+		{"extra parameter", PartiQLStatementInput{Statement: `SELECT * FROM T`, Parameters: []model.AttributeValue{{"S": "a"}}}, 0, "Number of parameters in request and statement don't match."},
+		{"write with limit", PartiQLStatementInput{Statement: `DELETE FROM T WHERE pk = 'a' AND sk = 1`}, 1, "Limit, NextToken and ConsistentRead are only supported for SELECT statements"},
+		{"partial key", PartiQLStatementInput{Statement: `DELETE FROM T WHERE pk = 'a'`}, 0, "Where clause does not contain a mandatory equality on all key attributes"},
+		{"key update", PartiQLStatementInput{Statement: `UPDATE T SET sk = 2 WHERE pk = 'a' AND sk = 1`}, 0, "Cannot update attribute sk. This attribute is part of the key"},
+		{"nested set", PartiQLStatementInput{Statement: `UPDATE T SET m.x = 2 WHERE pk = 'a' AND sk = 1`}, 0, "Nested attribute paths are not supported in SET"},
+		{"missing value", PartiQLStatementInput{Statement: `UPDATE T SET n = nope WHERE pk = 'a' AND sk = 1`}, 0, "The value assigned to n is missing"},
+		{"arithmetic", PartiQLStatementInput{Statement: `UPDATE T SET n = pk + 1 WHERE pk = 'a' AND sk = 1`}, 0, "Arithmetic operands must be numbers"},
+		{"mixed set", PartiQLStatementInput{Statement: `UPDATE T SET s = <<'a', 1>> WHERE pk = 'a' AND sk = 1`}, 0, "Set members must all be of the same type"},
+		{"insert without key", PartiQLStatementInput{Statement: `INSERT INTO T VALUE {'pk': 'b'}`}, 0, "One or more parameter values were invalid: Missing the key sk in the item"},
+		{"insert parameter", PartiQLStatementInput{Statement: `INSERT INTO T VALUE ?`, Parameters: []model.AttributeValue{{"S": "a"}}}, 0, "INSERT VALUE must be a tuple"},
+		{"unknown index", PartiQLStatementInput{Statement: `SELECT * FROM T.Nope`}, 0, "The table does not have the specified index: Nope"},
+		{"consistent index read", PartiQLStatementInput{Statement: `SELECT * FROM T.ByN`, ConsistentRead: true}, 0, "Consistent reads are not supported on global secondary indexes"},
+		{"unknown function", PartiQLStatementInput{Statement: `SELECT * FROM T WHERE size(pk) = 1`}, 0, "Unsupported function: size"},
+		{"function arguments", PartiQLStatementInput{Statement: `SELECT * FROM T WHERE begins_with(pk)`}, 0, "begins_with requires exactly two arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.ExecuteStatement(tt.input, tt.limit, "")
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteStatementPagination(t *testing.T) {
+	db := newPartiQLTestDatabase(t)
+	for i := 0; i < 5; i++ {
+		input := PartiQLStatementInput{
+			Statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': ?}`,
+			Parameters: []model.AttributeValue{{"N": string(rune('1' + i))}},
+		}
+		if _, err := db.ExecuteStatement(input, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := PartiQLStatementInput{Statement: `SELECT sk FROM T WHERE pk = 'a' AND sk <> 3`}
+	var got []model.Record
+	nextToken := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination does not terminate")
+		}
+		result, err := db.ExecuteStatement(input, 2, nextToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.FullScan {
+			t.Error("a query on the partition key reported a full scan")
+		}
+		got = append(got, result.Items...)
+		if result.NextToken == "" {
+			break
+		}
+		nextToken = result.NextToken
+	}
+
+	want := []model.Record{{"sk": {"N": "1"}}, {"sk": {"N": "2"}}, {"sk": {"N": "4"}}, {"sk": {"N": "5"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := db.ExecuteStatement(PartiQLStatementInput{Statement: `SELECT * FROM T`}, 1, "bm90IGEga2V5"); err == nil || err.Error() != "Invalid NextToken" {
+		t.Errorf("got error %v for a foreign NextToken", err)
+	}
+	result, err := db.ExecuteStatement(PartiQLStatementInput{Statement: `SELECT * FROM T WHERE sk = 1`}, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.FullScan || len(result.Items) != 1 {
+		t.Errorf("got %d items, full scan %v", len(result.Items), result.FullScan)
+	}
+}
+
+func TestExecuteTransaction(t *testing.T) {
+	db := newPartiQLTestDatabase(t)
+	if _, err := db.ExecuteStatement(PartiQLStatementInput{Statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1, 'n': 1}`}, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := db.ExecuteTransaction([]PartiQLStatementInput{
+		{Statement: `INSERT INTO T VALUE {'pk': 'b', 'sk': 1}`},
+		{Statement: `UPDATE T SET n = 2 WHERE pk = 'a' AND sk = 1 AND n = 5`},
+		{Statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1}`},
+	})
+	var canceled *TransactionCanceledError
+	if !errors.As(err, &canceled) {
+		t.Fatalf("got error %v, want a cancellation", err)
+	}
+	codes := make([]string, len(canceled.Reasons))
+	for i, reason := range canceled.Reasons {
+		codes[i] = reason.Code
+	}
+	if want := []string{"None", "ConditionalCheckFailed", "DuplicateItem"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("got reasons %v, want %v", codes, want)
+	}
+
+	if _, _, err := db.ExecuteTransaction([]PartiQLStatementInput{
+		{Statement: `INSERT INTO T VALUE {'pk': 'b', 'sk': 1}`},
+		{Statement: `UPDATE T SET n = 2 WHERE pk = 'a' AND sk = 1 AND n = 1`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	items, _, err := db.ExecuteTransaction([]PartiQLStatementInput{
+		{Statement: `SELECT n FROM T WHERE pk = 'a' AND sk = 1`},
+		{Statement: `SELECT * FROM T WHERE pk = 'b' AND sk = 1`},
+		{Statement: `SELECT * FROM T WHERE pk = 'c' AND sk = 1`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.Record{{"n": {"N": "2"}}, {"pk": {"S": "b"}, "sk": {"N": "1"}}, nil}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+
+	errorTests := []struct {
+		name string
+		inputs []PartiQLStatementInput
+		want string
+	}{
+		{"empty", nil, "Member must have length between 1 and 100"},
+		{"mixed", []PartiQLStatementInput{
+			{Statement: `SELECT * FROM T WHERE pk = 'a' AND sk = 1`},
+			{Statement: `DELETE FROM T WHERE pk = 'a' AND sk = 1`},
+		}, "Transactions must be either all reads or all writes"},
+		{"same item", []PartiQLStatementInput{
+			{Statement: `UPDATE T SET n = 3 WHERE pk = 'a' AND sk = 1`},
+			{Statement: `DELETE FROM T WHERE pk = 'a' AND sk = 1`},
+		}, "Transaction request cannot include multiple operations on one item"},
+		{"validation", []PartiQLStatementInput{
+			{Statement: `DELETE FROM T WHERE pk = 'b' AND sk = 1`},
+			{Statement: `DELETE FROM T WHERE pk = 'a'`},
+		}, "Where clause does not contain a mandatory equality on all key attributes"},
+		{"partial key read", []PartiQLStatementInput{
+			{Statement: `SELECT * FROM T WHERE pk = 'a'`},
+		}, "Where clause does not contain a mandatory equality on all key attributes"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := db.ExecuteTransaction(tt.inputs)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// None of the failed transactions may have written anything.
+	result, err := db.ExecuteStatement(PartiQLStatementInput{Statement: `SELECT * FROM T`}, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []model.Record{{"pk": {"S": "a"}, "sk": {"N": "1"}, "n": {"N": "2"}}, {"pk": {"S": "b"}, "sk": {"N": "1"}}}
+	if !reflect.DeepEqual(result.Items, want) {
+		t.Errorf("got %v, want %v", result.Items, want)
+	}
+}
+
+func TestBatchExecuteStatement(t *testing.T) {
+	db := newPartiQLTestDatabase(t)
+
+	results, err := db.BatchExecuteStatement([]PartiQLStatementInput{
+		{Statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1}`},
+		{Statement: `INSERT INTO T VALUE {'pk': 'a', 'sk': 1}`},
+		{Statement: `INSERT INTO`},
+		{Statement: `INSERT INTO T VALUE {'pk': 'b', 'sk': 1}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[3].Err != nil {
+		t.Errorf("got errors %v and %v", results[0].Err, results[3].Err)
+	}
+	if !errors.Is(results[1].Err, ErrDuplicateItem) {
+		t.Errorf("got error %v for a duplicate insert", results[1].Err)
+	}
+	if results[2].Err == nil {
+		t.Error("a malformed statement succeeded")
+	}
+
+	results, err = db.BatchExecuteStatement([]PartiQLStatementInput{
+		{Statement: `SELECT * FROM T WHERE pk = 'a' AND sk = 1`},
+		{Statement: `SELECT * FROM T WHERE pk = 'c' AND sk = 1`},
+		{Statement: `SELECT * FROM Missing WHERE pk = 'a' AND sk = 1`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (model.Record{"pk": {"S": "a"}, "sk": {"N": "1"}}); !reflect.DeepEqual(results[0].Item, want) || results[0].TableName != "T" {
+		t.Errorf("got %v from %s, want %v", results[0].Item, results[0].TableName, want)
+	}
+	if results[1].Item != nil || results[1].Err != nil {
+		t.Errorf("got %v, %v for a missing item", results[1].Item, results[1].Err)
+	}
+	if !errors.Is(results[2].Err, ErrResourceNotFound) {
+		t.Errorf("got error %v for a missing table", results[2].Err)
+	}
+
+	if _, err := db.BatchExecuteStatement([]PartiQLStatementInput{
+		{Statement: `SELECT * FROM T WHERE pk = 'a' AND sk = 1`},
+		{Statement: `DELETE FROM T WHERE pk = 'a' AND sk = 1`},
+	}); err == nil {
+		t.Error("a batch mixing reads and writes succeeded")
+	}
+	if _, err := db.BatchExecuteStatement(make([]PartiQLStatementInput, partiqlMaxBatchStatements+1)); err == nil {
+		t.Error("an oversized batch succeeded")
+	}
+}
@@ -0,0 +1,435 @@
+package core
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	partitionReadUnits = 3000
+	partitionWriteUnits = 1000
+
+	defaultPartitionSplitBytes = 10 << 30
+	defaultHeatSplitAfter = 10 * time.Minute
+	// A second counts towards a split for heat when a partition serves at
+	// least this share of its read or write limit.
+	heatSplitFraction = 0.8
+)
+
+const (
+	PartitionCreatedWithTable = "TABLE_CREATION"
+	PartitionCreatedBySizeSplit = "SIZE_SPLIT"
+	PartitionCreatedByHeatSplit = "HEAT_SPLIT"
+	PartitionCreatedByThroughputSplit = "THROUGHPUT_SPLIT"
+)
+
+// PartitionUsage describes one simulated physical partition of a table or
+// global secondary index and the traffic it has served.
+type PartitionUsage struct {
+	PartitionId int `json:"PartitionId"`
+	IndexName string `json:"IndexName,omitempty"`
+	HashRangeStart string `json:"HashRangeStart"`
+	HashRangeEnd string `json:"HashRangeEnd"`
+	CreatedBy string `json:"CreatedBy"`
+	CreationDateTime float64 `json:"CreationDateTime"`
+	SizeBytes int64 `json:"SizeBytes"`
+	ConsumedReadCapacityUnits float64 `json:"ConsumedReadCapacityUnits"`
+	ConsumedWriteCapacityUnits float64 `json:"ConsumedWriteCapacityUnits"`
+	PeakReadCapacityUnitsPerSecond float64 `json:"PeakReadCapacityUnitsPerSecond"`
+	PeakWriteCapacityUnitsPerSecond float64 `json:"PeakWriteCapacityUnitsPerSecond"`
+	ThrottledReadRequests int `json:"ThrottledReadRequests"`
+	ThrottledWriteRequests int `json:"ThrottledWriteRequests"`
+	HottestKey string `json:"HottestKey,omitempty"`
+	HottestKeyUnitsPerSecond float64 `json:"HottestKeyUnitsPerSecond,omitempty"`
+}
+
+// partitionSet splits the 64-bit hash space of partition keys into
+// contiguous ranges, ordered by where they start.
+type partitionSet struct {
+	partitions []*partition
+	nextID int
+}
+
+type partition struct {
+	id int
+	start uint64
+	end uint64
+	createdBy string
+	createdAt time.Time
+	size int64
+
+	read throughputMeter
+	write throughputMeter
+
+	second time.Time
+	keyUnits map[string]float64
+	hottestKey string
+	hottestKeyUnits float64
+
+	hotSince time.Time
+	hotLast time.Time
+}
+
+// partitionCharge is what an item change costs the partition holding pk in
+// the table, when indexName is empty, or in a global secondary index.
+type partitionCharge struct {
+	indexName string
+	pk string
+	units float64
+	sizeDelta int64
+}
+
+// partitionHash spreads partition keys evenly over the hash space. FNV alone
+// leaves the high bits of short keys nearly constant, so the result is mixed
+// with the MurmurHash3 finalizer.
+func partitionHash(pk string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(pk))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// ScanSegment is the segment of a parallel scan over totalSegments segments
+// that holds the items with partition key pk. Like partitions, segments cover
+// contiguous ranges of the partition key hash.
+func ScanSegment(pk string, totalSegments int) int {
+	segment, _ := bits.Mul64(partitionHash(pk), uint64(totalSegments))
+	return int(segment)
+}
+
+// roll starts a new second, remembering whether the last one was hot enough
+// to count towards a split for heat.
+func (p *partition) roll(now time.Time) {
+	second := now.Truncate(time.Second)
+	if !second.Equal(p.second) {
+		if p.read.secondUnits >= heatSplitFraction*partitionReadUnits || p.write.secondUnits >= heatSplitFraction*partitionWriteUnits {
+			if p.hotSince.IsZero() || p.second.Sub(p.hotLast) > time.Second {
+				p.hotSince = p.second
+			}
+			p.hotLast = p.second
+		}
+		p.second = second
+		p.keyUnits = nil
+	}
+	p.read.roll(now)
+	p.write.roll(now)
+}
+
+// sustainedHeat is how long the partition has been hot without a break.
+func (p *partition) sustainedHeat() time.Duration {
+	if p.hotSince.IsZero() {
+		return 0
+	}
+	return p.hotLast.Sub(p.hotSince) + time.Second
+}
+
+func (p *partition) meter(write bool) (*throughputMeter, float64) {
+	if write {
+		return &p.write, partitionWriteUnits
+	}
+	return &p.read, partitionReadUnits
+}
+
+func (p *partition) addKeyUnits(pk string, units float64) {
+	if p.keyUnits == nil {
+		p.keyUnits = make(map[string]float64)
+	}
+	p.keyUnits[pk] += units
+	if p.keyUnits[pk] > p.hottestKeyUnits {
+		p.hottestKey = pk
+		p.hottestKeyUnits = p.keyUnits[pk]
+	}
+}
+
+func (s *partitionSet) find(pk string) *partition {
+	h := partitionHash(pk)
+	i := sort.Search(len(s.partitions), func(i int) bool { return s.partitions[i].end >= h })
+	return s.partitions[i]
+}
+
+func (s *partitionSet) add(start, end uint64, createdBy string, now time.Time) *partition {
+	s.nextID++
+	return &partition{id: s.nextID, start: start, end: end, createdBy: createdBy, createdAt: now}
+}
+
+// requiredPartitions is how many partitions the provisioned or, for on-demand
+// tables, initial throughput of a table or index needs.
+func requiredPartitions(schema model.TableSchema, indexName string) int {
+	read, write := float64(2*onDemandInitialReadPeak), float64(2*onDemandInitialWritePeak)
+	if schema.IsProvisioned() {
+		throughput := schema.ProvisionedThroughput
+		if indexName != "" {
+			throughput = schema.GSIs[indexName].ProvisionedThroughput
+		}
+		read, write = float64(throughput.ReadCapacityUnits), float64(throughput.WriteCapacityUnits)
+	}
+	return int(math.Max(1, math.Ceil(read/partitionReadUnits+write/partitionWriteUnits)))
+}
+
+// partitionsFor returns the partitions of a table or global secondary index,
+// laying them out and measuring the stored items on first use and splitting
+// them when the provisioned throughput has grown. The caller must hold
+// capacityMu.
+func (d *Database) partitionsFor(schema model.TableSchema, indexName string) *partitionSet {
+	key := capacityKey{schema.TableName, indexName}
+	now := d.Clock.Now()
+
+	set := d.partitionSets[key]
+	if set == nil {
+		set = &partitionSet{}
+		n := uint64(requiredPartitions(schema, indexName))
+		width := math.MaxUint64 / n
+		for i := uint64(0); i < n; i++ {
+			end := (i+1)*width - 1
+			if i == n-1 {
+				end = math.MaxUint64
+			}
+			set.partitions = append(set.partitions, set.add(i*width, end, PartitionCreatedWithTable, now))
+		}
+		d.measurePartitions(schema, indexName, set.partitions)
+		d.partitionSets[key] = set
+	}
+
+	for len(set.partitions) < requiredPartitions(schema, indexName) {
+		widest := set.partitions[0]
+		for _, p := range set.partitions {
+			if p.end-p.start > widest.end-widest.start {
+				widest = p
+			}
+		}
+		if !d.splitPartition(schema, indexName, set, widest, PartitionCreatedByThroughputSplit) {
+			break
+		}
+	}
+	return set
+}
+
+// measurePartitions recomputes the size of the given partitions from the
+// items stored in them.
+func (d *Database) measurePartitions(schema model.TableSchema, indexName string, partitions []*partition) {
+	prefix := schema.TableName + model.KeySeparator
+	pkName := schema.PartitionKey
+	if indexName != "" {
+		prefix = model.BuildIndexKeyPrefix(schema.TableName, indexName)
+		pkName = schema.GSIs[indexName].PartitionKey
+	}
+
+	for _, p := range partitions {
+		p.size = 0
+	}
+	iter := d.DB.NewIterator(PrefixRange([]byte(prefix)))
+	defer iter.Release()
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			continue
+		}
+		pk, ok := model.GetAttributeValueString(record[pkName])
+		if !ok {
+			continue
+		}
+		h := partitionHash(pk)
+		for _, p := range partitions {
+			if h >= p.start && h <= p.end {
+				p.size += int64(ItemSize(record))
+				break
+			}
+		}
+	}
+}
+
+// splitPartition replaces p by two partitions each covering half its hash
+// range. A partition covering a single hash cannot be split.
+func (d *Database) splitPartition(schema model.TableSchema, indexName string, set *partitionSet, p *partition, createdBy string) bool {
+	if p.start == p.end {
+		return false
+	}
+	now := d.Clock.Now()
+	mid := p.start + (p.end-p.start)/2
+	left := set.add(p.start, mid, createdBy, now)
+	right := set.add(mid+1, p.end, createdBy, now)
+
+	for i, existing := range set.partitions {
+		if existing == p {
+			set.partitions = append(set.partitions[:i], append([]*partition{left, right}, set.partitions[i+1:]...)...)
+			break
+		}
+	}
+	d.measurePartitions(schema, indexName, []*partition{left, right})
+	return true
+}
+
+func (d *Database) partitionSplitBytes() int64 {
+	if d.Capacity.PartitionSplitBytes > 0 {
+		return d.Capacity.PartitionSplitBytes
+	}
+	return defaultPartitionSplitBytes
+}
+
+func (d *Database) heatSplitAfter() time.Duration {
+	if d.Capacity.HeatSplitAfter > 0 {
+		return d.Capacity.HeatSplitAfter
+	}
+	return defaultHeatSplitAfter
+}
+
+// resetPartitions forgets every partition layout once the stored items have
+// been replaced, so that they are laid out and measured again.
+func (d *Database) resetPartitions() {
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+	d.partitionSets = make(map[capacityKey]*partitionSet)
+}
+
+// checkPartition fails with a *ThroughputExceededError when the partition
+// holding pk has used up its share of the current second, counting pending
+// units staged but not yet consumed. The caller must hold capacityMu.
+func (d *Database) checkPartition(schema model.TableSchema, indexName string, pk string, write bool, pending float64) error {
+	if !d.Capacity.Partitions || pk == "" {
+		return nil
+	}
+	p := d.partitionsFor(schema, indexName).find(pk)
+	p.roll(d.Clock.Now())
+	meter, limit := p.meter(write)
+	if !d.Capacity.Throttle || meter.secondUnits+pending < limit {
+		return nil
+	}
+
+	meter.throttled++
+	tableMeter, _, _ := d.meter(schema, indexName, write)
+	tableMeter.throttled++
+	return &ThroughputExceededError{TableName: schema.TableName, IndexName: indexName, OnDemand: !schema.IsProvisioned()}
+}
+
+// consumePartition records traffic against the partition holding pk and
+// splits the partition once it is too large or has been hot for too long.
+// The caller must hold capacityMu.
+func (d *Database) consumePartition(schema model.TableSchema, indexName string, pk string, write bool, units float64, sizeDelta int64) {
+	if !d.Capacity.Partitions || pk == "" {
+		return
+	}
+	set := d.partitionsFor(schema, indexName)
+	p := set.find(pk)
+	now := d.Clock.Now()
+	p.roll(now)
+
+	meter, _ := p.meter(write)
+	meter.consume(now, false, 0, 0, units)
+	p.size += sizeDelta
+	if units > 0 {
+		p.addKeyUnits(pk, units)
+	}
+
+	switch {
+	case p.size > d.partitionSplitBytes():
+		d.splitPartition(schema, indexName, set, p, PartitionCreatedBySizeSplit)
+	case p.sustainedHeat() >= d.heatSplitAfter():
+		d.splitPartition(schema, indexName, set, p, PartitionCreatedByHeatSplit)
+	}
+}
+
+// partitionWriteCharges works out which partitions of the table and its
+// global secondary indexes an item change touches. Local secondary index
+// entries live in the table's partitions.
+func partitionWriteCharges(schema model.TableSchema, oldRecord model.Record, newRecord model.Record, charges []capacityCharge) []partitionCharge {
+	item := newRecord
+	if item == nil {
+		item = oldRecord
+	}
+	pk, _ := model.GetAttributeValueString(item[schema.PartitionKey])
+
+	tableCharge := partitionCharge{pk: pk, sizeDelta: int64(ItemSize(newRecord) - ItemSize(oldRecord))}
+	partitions := []partitionCharge{}
+	for _, charge := range charges {
+		if charge.indexName == "" || charge.local {
+			tableCharge.units += charge.units
+			continue
+		}
+
+		gsi := schema.GSIs[charge.indexName]
+		oldPK, _, oldExists := getGSIKeyValues(oldRecord, gsi)
+		newPK, _, newExists := getGSIKeyValues(newRecord, gsi)
+		switch {
+		case oldExists && newExists && oldPK != newPK:
+			oldSize, newSize := ItemSize(oldRecord), ItemSize(newRecord)
+			oldUnits := charge.units * float64(oldSize) / float64(oldSize+newSize)
+			partitions = append(partitions,
+				partitionCharge{indexName: gsi.IndexName, pk: oldPK, units: oldUnits, sizeDelta: -int64(oldSize)},
+				partitionCharge{indexName: gsi.IndexName, pk: newPK, units: charge.units - oldUnits, sizeDelta: int64(newSize)})
+		case newExists:
+			sizeDelta := int64(ItemSize(newRecord))
+			if oldExists {
+				sizeDelta -= int64(ItemSize(oldRecord))
+			}
+			partitions = append(partitions, partitionCharge{indexName: gsi.IndexName, pk: newPK, units: charge.units, sizeDelta: sizeDelta})
+		case oldExists:
+			partitions = append(partitions, partitionCharge{indexName: gsi.IndexName, pk: oldPK, units: charge.units, sizeDelta: -int64(ItemSize(oldRecord))})
+		}
+	}
+	return append([]partitionCharge{tableCharge}, partitions...)
+}
+
+// DescribePartitions reports the simulated partitions of a table and its
+// global secondary indexes, or of one index when indexName is set.
+func (d *Database) DescribePartitions(tableName string, indexName string) ([]PartitionUsage, error) {
+	d.mu.RLock()
+	schema, ok := d.Tables[tableName]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	indexNames := []string{""}
+	if indexName != "" {
+		if _, ok := schema.GSIs[indexName]; !ok {
+			return nil, fmt.Errorf("Requested resource not found: Index %s does not exist on table %s", indexName, tableName)
+		}
+		indexNames = []string{indexName}
+	} else {
+		for name := range schema.GSIs {
+			indexNames = append(indexNames, name)
+		}
+		sort.Strings(indexNames[1:])
+	}
+
+	d.capacityMu.Lock()
+	defer d.capacityMu.Unlock()
+
+	if !d.Capacity.Partitions {
+		return nil, fmt.Errorf("Partition simulation is not enabled")
+	}
+
+	now := d.Clock.Now()
+	var usage []PartitionUsage
+	for _, name := range indexNames {
+		for _, p := range d.partitionsFor(schema, name).partitions {
+			p.roll(now)
+			u := PartitionUsage{
+				PartitionId: p.id,
+				IndexName: name,
+				HashRangeStart: fmt.Sprintf("%016x", p.start),
+				HashRangeEnd: fmt.Sprintf("%016x", p.end),
+				CreatedBy: p.createdBy,
+				CreationDateTime: float64(p.createdAt.UnixNano()) / float64(time.Second),
+				SizeBytes: p.size,
+				HottestKey: p.hottestKey,
+				HottestKeyUnitsPerSecond: p.hottestKeyUnits,
+			}
+			u.ConsumedReadCapacityUnits, u.PeakReadCapacityUnitsPerSecond, u.ThrottledReadRequests = p.read.usage()
+			u.ConsumedWriteCapacityUnits, u.PeakWriteCapacityUnitsPerSecond, u.ThrottledWriteRequests = p.write.usage()
+			usage = append(usage, u)
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,394 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	changeLogPrefix = "__PITR__" + model.KeySeparator
+
+	defaultRecoveryPeriodDays = 35
+)
+
+var (
+	ErrPointInTimeRecoveryUnavailable = errors.New("point in time recovery is not enabled for the table")
+	ErrInvalidRestoreTime = errors.New("restore time is outside the restorable window")
+)
+
+type itemVersion struct {
+	Key string `json:"k"`
+	Time int64 `json:"t"`
+	Record model.Record `json:"r,omitempty"`
+}
+
+type ContinuousBackupsStatus struct {
+	Enabled bool
+	EarliestRestorableTime time.Time
+	LatestRestorableTime time.Time
+	RecoveryPeriodInDays int
+}
+
+func buildChangeLogTablePrefix(tableName string) string {
+	return changeLogPrefix + tableName + model.KeySeparator
+}
+
+// Item keys are base64 encoded so that all versions of one item sort together.
+func buildChangeLogItemPrefix(tableName string, itemKey string) string {
+	return buildChangeLogTablePrefix(tableName) + base64.RawURLEncoding.EncodeToString([]byte(itemKey)) + model.KeySeparator
+}
+
+func (d *Database) appendItemVersion(batch *Batch, schema model.TableSchema, levelDBKey string, newRecord model.Record) error {
+	if !schema.PITREnabled {
+		return nil
+	}
+
+	d.changeSeq++
+	now := d.Now().UnixNano()
+	version := itemVersion{Key: levelDBKey, Time: now, Record: newRecord}
+
+	value, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item version: %w", err)
+	}
+
+	key := fmt.Sprintf("%s%020d%s%020d", buildChangeLogItemPrefix(schema.TableName, levelDBKey), now, model.KeySeparator, d.changeSeq)
+	batch.Put([]byte(key), value)
+	return nil
+}
+
+func (d *Database) UpdateContinuousBackups(tableName string, enabled bool, recoveryPeriodDays int) (ContinuousBackupsStatus, error) {
+	if recoveryPeriodDays == 0 {
+		recoveryPeriodDays = defaultRecoveryPeriodDays
+	}
+	if recoveryPeriodDays < 1 || recoveryPeriodDays > defaultRecoveryPeriodDays {
+		return ContinuousBackupsStatus{}, fmt.Errorf("RecoveryPeriodInDays must be between 1 and %d", defaultRecoveryPeriodDays)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return ContinuousBackupsStatus{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	switch {
+	case enabled && !schema.PITREnabled:
+		schema.PITREnabled = true
+		schema.PITREnabledAt = d.Now().UnixNano()
+		schema.PITRRecoveryPeriodDays = recoveryPeriodDays
+		if err := d.recordBaselineVersions(schema); err != nil {
+			return ContinuousBackupsStatus{}, err
+		}
+	case enabled:
+		schema.PITRRecoveryPeriodDays = recoveryPeriodDays
+	case schema.PITREnabled:
+		if err := d.deleteChangeLog(tableName); err != nil {
+			return ContinuousBackupsStatus{}, err
+		}
+		schema.PITREnabled = false
+		schema.PITREnabledAt = 0
+		schema.PITRRecoveryPeriodDays = 0
+	}
+
+	if err := d.putTableSchema(schema); err != nil {
+		return ContinuousBackupsStatus{}, err
+	}
+	return d.continuousBackupsStatus(schema), nil
+}
+
+func (d *Database) DescribeContinuousBackups(tableName string) (ContinuousBackupsStatus, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return ContinuousBackupsStatus{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	return d.continuousBackupsStatus(schema), nil
+}
+
+func (d *Database) continuousBackupsStatus(schema model.TableSchema) ContinuousBackupsStatus {
+	if !schema.PITREnabled {
+		return ContinuousBackupsStatus{}
+	}
+
+	now := d.Now()
+	earliest := time.Unix(0, schema.PITREnabledAt)
+	if windowStart := now.Add(-recoveryPeriod(schema)); windowStart.After(earliest) {
+		earliest = windowStart
+	}
+
+	return ContinuousBackupsStatus{
+		Enabled: true,
+		EarliestRestorableTime: earliest,
+		LatestRestorableTime: now,
+		RecoveryPeriodInDays: schema.PITRRecoveryPeriodDays,
+	}
+}
+
+func recoveryPeriod(schema model.TableSchema) time.Duration {
+	return time.Duration(schema.PITRRecoveryPeriodDays) * 24 * time.Hour
+}
+
+func (d *Database) RestoreTableToPointInTime(sourceTableName string, targetTableName string, restoreTime time.Time, useLatest bool, opts RestoreOptions) (model.TableSchema, error) {
+	if targetTableName == "" {
+		return model.TableSchema{}, fmt.Errorf("TargetTableName must be specified")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	source, ok := d.Tables[sourceTableName]
+	if !ok {
+		return model.TableSchema{}, fmt.Errorf("%w: %s", ErrTableNotFound, sourceTableName)
+	}
+	if !source.PITREnabled {
+		return model.TableSchema{}, fmt.Errorf("%w: %s", ErrPointInTimeRecoveryUnavailable, sourceTableName)
+	}
+	if _, exists := d.Tables[targetTableName]; exists {
+		return model.TableSchema{}, fmt.Errorf("%w: %s", ErrTableAlreadyExists, targetTableName)
+	}
+
+	status := d.continuousBackupsStatus(source)
+	if useLatest {
+		restoreTime = status.LatestRestorableTime
+	}
+	if restoreTime.Before(status.EarliestRestorableTime) || restoreTime.After(status.LatestRestorableTime) {
+		return model.TableSchema{}, fmt.Errorf("%w: %s is not between %s and %s", ErrInvalidRestoreTime,
+			restoreTime.UTC().Format(time.RFC3339), status.EarliestRestorableTime.UTC().Format(time.RFC3339), status.LatestRestorableTime.UTC().Format(time.RFC3339))
+	}
+
+	schema, err := restoredSchema(source, targetTableName, opts)
+	if err != nil {
+		return model.TableSchema{}, err
+	}
+
+	writer := newRestoreWriter(d, schema)
+	asOf := restoreTime.UnixNano()
+
+	err = d.forEachItemHistory(sourceTableName, func(versions []itemVersion) error {
+		if version := versionAsOf(versions, asOf); version != nil {
+			return writer.add(version.Record)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.TableSchema{}, err
+	}
+	if err := writer.flush(); err != nil {
+		return model.TableSchema{}, err
+	}
+
+	if err := d.putTableSchema(schema); err != nil {
+		return model.TableSchema{}, err
+	}
+	return schema, nil
+}
+
+// forEachItemHistory calls fn once per item in the table's change log with
+// all of its recorded versions, oldest first.
+func (d *Database) forEachItemHistory(tableName string, fn func(versions []itemVersion) error) error {
+	var versions []itemVersion
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(buildChangeLogTablePrefix(tableName))))
+	defer iter.Release()
+
+	for iter.Next() {
+		var version itemVersion
+		if err := json.Unmarshal(iter.Value(), &version); err != nil {
+			return fmt.Errorf("failed to decode item version: %w", err)
+		}
+		if len(versions) > 0 && versions[0].Key != version.Key {
+			if err := fn(versions); err != nil {
+				return err
+			}
+			versions = nil
+		}
+		versions = append(versions, version)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		return fn(versions)
+	}
+	return nil
+}
+
+func versionAsOf(versions []itemVersion, asOf int64) *itemVersion {
+	var current *itemVersion
+	for i := range versions {
+		if versions[i].Time <= asOf {
+			current = &versions[i]
+		}
+	}
+	return current
+}
+
+func (d *Database) recordBaselineVersions(schema model.TableSchema) error {
+	batch := new(Batch)
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(schema.TableName+model.KeySeparator)))
+	defer iter.Release()
+
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			continue
+		}
+		if err := d.appendItemVersion(batch, schema, string(iter.Key()), record); err != nil {
+			return err
+		}
+		if batch.Len() >= backupCopyBatchSize {
+			if err := d.DB.Write(batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return d.DB.Write(batch)
+}
+
+func (d *Database) deleteChangeLog(tableName string) error {
+	batch := new(Batch)
+	if err := d.stageChangeLogDelete(batch, tableName); err != nil {
+		return err
+	}
+	return d.DB.Write(batch)
+}
+
+func (d *Database) stageChangeLogDelete(batch *Batch, tableName string) error {
+	iter := d.DB.NewIterator(PrefixRange([]byte(buildChangeLogTablePrefix(tableName))))
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	return iter.Error()
+}
+
+// TrimChangeLogs drops item versions that fall out of each table's recovery
+// period, keeping the newest version older than the window so the item's
+// state at the start of the window can still be restored.
+func (d *Database) TrimChangeLogs() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.Now()
+	trimmed := 0
+
+	for _, schema := range d.Tables {
+		if !schema.PITREnabled {
+			continue
+		}
+		cutoff := now.Add(-recoveryPeriod(schema)).UnixNano()
+
+		batch := new(Batch)
+		var pendingKey []byte
+		var pendingDeleted bool
+		currentItem := ""
+
+		flushItem := func() {
+			if pendingKey != nil && pendingDeleted {
+				batch.Delete(pendingKey)
+				trimmed++
+			}
+			pendingKey = nil
+		}
+
+		iter := d.DB.NewIterator(PrefixRange([]byte(buildChangeLogTablePrefix(schema.TableName))))
+		for iter.Next() {
+			key := string(iter.Key())
+			sep := strings.LastIndex(key, model.KeySeparator)
+			tsStart := strings.LastIndex(key[:sep], model.KeySeparator)
+			itemPrefix := key[:tsStart]
+			ts, err := strconv.ParseInt(key[tsStart+1:sep], 10, 64)
+			if err != nil {
+				continue
+			}
+
+			if itemPrefix != currentItem {
+				flushItem()
+				currentItem = itemPrefix
+			}
+			if ts >= cutoff {
+				pendingKey = nil
+				continue
+			}
+
+			if pendingKey != nil {
+				batch.Delete(pendingKey)
+				trimmed++
+			}
+			pendingKey = append([]byte(nil), iter.Key()...)
+			pendingDeleted = isDeletionVersion(iter.Value())
+		}
+		flushItem()
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return trimmed, err
+		}
+
+		if err := d.DB.Write(batch); err != nil {
+			return trimmed, err
+		}
+	}
+
+	return trimmed, nil
+}
+
+func isDeletionVersion(value []byte) bool {
+	var version itemVersion
+	if err := json.Unmarshal(value, &version); err != nil {
+		return false
+	}
+	return version.Record == nil
+}
+
+type restoreWriter struct {
+	db *Database
+	schema model.TableSchema
+	batch *Batch
+}
+
+func newRestoreWriter(db *Database, schema model.TableSchema) *restoreWriter {
+	return &restoreWriter{db: db, schema: schema, batch: new(Batch)}
+}
+
+func (w *restoreWriter) add(record model.Record) error {
+	if record == nil {
+		return nil
+	}
+
+	key, err := itemLevelDBKey(w.schema, record)
+	if err != nil {
+		return err
+	}
+	if err := w.db.ApplyItemChange(w.batch, w.schema, key, nil, record); err != nil {
+		return err
+	}
+
+	if w.batch.Len() >= backupCopyBatchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *restoreWriter) flush() error {
+	if err := w.db.Write(w.batch); err != nil {
+		return fmt.Errorf("failed to write restored items: %w", err)
+	}
+	w.batch.Reset()
+	return nil
+}
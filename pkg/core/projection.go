@@ -0,0 +1,197 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+// Projection is a parsed ProjectionExpression.
+type Projection struct {
+	paths []partiqlPath
+}
+
+// ParseProjectionExpression parses a comma separated list of document paths
+// such as a, #b.c and d[2].e, resolving #name placeholders from names.
+func ParseProjectionExpression(expression string, names map[string]string) (*Projection, error) {
+	projection := &Projection{}
+	for _, raw := range strings.Split(expression, ",") {
+		path, err := parseDocumentPath(strings.TrimSpace(raw), names)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ProjectionExpression: %v", err)
+		}
+		for _, other := range projection.paths {
+			if err := checkPathsDisjoint(other, path); err != nil {
+				return nil, fmt.Errorf("Invalid ProjectionExpression: %v", err)
+			}
+		}
+		projection.paths = append(projection.paths, path)
+	}
+	return projection, nil
+}
+
+func parseDocumentPath(raw string, names map[string]string) (partiqlPath, error) {
+	if raw == "" {
+		return partiqlPath{}, fmt.Errorf("Syntax error; token: <EOF>")
+	}
+
+	var path partiqlPath
+	for _, segment := range strings.Split(raw, ".") {
+		name := segment
+		indexes := ""
+		if i := strings.IndexByte(segment, '['); i >= 0 {
+			name, indexes = segment[:i], segment[i:]
+		}
+
+		switch {
+		case name == "":
+			return partiqlPath{}, fmt.Errorf("Syntax error; token: %s", raw)
+		case strings.HasPrefix(name, "#"):
+			resolved, ok := names[name]
+			if !ok {
+				return partiqlPath{}, fmt.Errorf("An expression attribute name used in the document path is not defined; attribute name: %s", name)
+			}
+			name = resolved
+		case strings.IndexFunc(name, func(r rune) bool { return !isPathNameRune(r) }) >= 0:
+			return partiqlPath{}, fmt.Errorf("Syntax error; token: %s", name)
+		}
+		path.elems = append(path.elems, partiqlPathElem{name: name})
+
+		for indexes != "" {
+			end := strings.IndexByte(indexes, ']')
+			if indexes[0] != '[' || end < 0 {
+				return partiqlPath{}, fmt.Errorf("Syntax error; token: %s", indexes)
+			}
+			index, err := strconv.Atoi(indexes[1:end])
+			if err != nil || index < 0 {
+				return partiqlPath{}, fmt.Errorf("Syntax error; token: %s", indexes[:end+1])
+			}
+			path.elems = append(path.elems, partiqlPathElem{index: index, isIndex: true})
+			indexes = indexes[end+1:]
+		}
+	}
+	return path, nil
+}
+
+func isPathNameRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// checkPathsDisjoint rejects paths where one contains the other, or that
+// treat the same attribute as both a map and a list.
+func checkPathsDisjoint(a, b partiqlPath) error {
+	for i := 0; i < len(a.elems) && i < len(b.elems); i++ {
+		x, y := a.elems[i], b.elems[i]
+		if x.isIndex != y.isIndex {
+			return fmt.Errorf("Two document paths conflict with each other; must remove or rewrite one of these paths; path one: %s, path two: %s", a, b)
+		}
+		if x != y {
+			return nil
+		}
+	}
+	return fmt.Errorf("Two document paths overlap with each other; must remove or rewrite one of these paths; path one: %s, path two: %s", a, b)
+}
+
+func (p partiqlPath) String() string {
+	parts := make([]string, len(p.elems))
+	for i, elem := range p.elems {
+		if elem.isIndex {
+			parts[i] = fmt.Sprintf("[%d]", elem.index)
+		} else {
+			parts[i] = elem.name
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// Apply keeps only the projected paths of record, nested the way they are
+// in the record. Elements picked out of a list keep their relative order.
+func (p *Projection) Apply(record model.Record) model.Record {
+	root := &projectionNode{}
+	for _, path := range p.paths {
+		value, ok := lookupPartiQLPath(record, path)
+		if !ok {
+			continue
+		}
+		node := root
+		for _, elem := range path.elems {
+			node = node.child(elem)
+		}
+		node.value = value
+	}
+
+	projected := make(model.Record, len(root.fields))
+	for name, child := range root.fields {
+		projected[name] = child.attributeValue()
+	}
+	return projected
+}
+
+type projectionNode struct {
+	value model.AttributeValue
+	fields map[string]*projectionNode
+	items map[int]*projectionNode
+}
+
+func (n *projectionNode) child(elem partiqlPathElem) *projectionNode {
+	if elem.isIndex {
+		if n.items == nil {
+			n.items = make(map[int]*projectionNode)
+		}
+		if n.items[elem.index] == nil {
+			n.items[elem.index] = &projectionNode{}
+		}
+		return n.items[elem.index]
+	}
+	if n.fields == nil {
+		n.fields = make(map[string]*projectionNode)
+	}
+	if n.fields[elem.name] == nil {
+		n.fields[elem.name] = &projectionNode{}
+	}
+	return n.fields[elem.name]
+}
+
+func (n *projectionNode) attributeValue() model.AttributeValue {
+	switch {
+	case n.value != nil:
+		return n.value
+	case n.items != nil:
+		indexes := make([]int, 0, len(n.items))
+		for index := range n.items {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		list := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			list[i] = n.items[index].attributeValue()
+		}
+		return model.AttributeValue{"L": list}
+	}
+	fields := make(map[string]interface{}, len(n.fields))
+	for name, child := range n.fields {
+		fields[name] = child.attributeValue()
+	}
+	return model.AttributeValue{"M": fields}
+}
+
+// ValidateProjection checks an index projection as CreateTable receives it.
+// An empty projection type is accepted and means ALL.
+func ValidateProjection(indexName string, projection model.Projection) error {
+	switch projection.ProjectionType {
+	case "", model.ProjectionTypeAll, model.ProjectionTypeKeysOnly:
+		if len(projection.NonKeyAttributes) > 0 {
+			return fmt.Errorf("One or more parameter values were invalid: NonKeyAttributes can only be specified for index %s when ProjectionType is INCLUDE", indexName)
+		}
+	case model.ProjectionTypeInclude:
+		if len(projection.NonKeyAttributes) == 0 {
+			return fmt.Errorf("One or more parameter values were invalid: NonKeyAttributes must be specified for index %s when ProjectionType is INCLUDE", indexName)
+		}
+	default:
+		return fmt.Errorf("1 validation error detected: Value '%s' at 'projection.projectionType' failed to satisfy constraint: Member must satisfy enum value set: [ALL, INCLUDE, KEYS_ONLY]", projection.ProjectionType)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"log"
+	"time"
+)
+
+const reaperInterval = time.Second
+
+type backgroundReaper struct {
+	db *Database
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newBackgroundReaper(db *Database, interval time.Duration) *backgroundReaper {
+	r := &backgroundReaper{
+		db: db,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go r.run(interval)
+	return r
+}
+
+func (r *backgroundReaper) run(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if _, err := r.db.ReapExpiredItems(); err != nil {
+				log.Printf("TTL reaper failed: %v", err)
+			}
+			if _, err := r.db.TrimStreamRecords(); err != nil {
+				log.Printf("Stream trimming failed: %v", err)
+			}
+			if _, err := r.db.TrimChangeLogs(); err != nil {
+				log.Printf("Change log trimming failed: %v", err)
+			}
+		}
+	}
+}
+
+func (r *backgroundReaper) close() {
+	close(r.stop)
+	<-r.done
+}
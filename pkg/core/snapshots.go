@@ -0,0 +1,665 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+const (
+	snapshotMetadataFile = "snapshot.json"
+	snapshotManifestEntry = "manifest.json"
+	snapshotStagingSuffix = ".tmp"
+)
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSnapshotAlreadyExists = errors.New("snapshot already exists")
+	ErrInvalidSnapshotName = errors.New("invalid snapshot name")
+	ErrInvalidSnapshotArchive = errors.New("invalid snapshot archive")
+	ErrInvalidArchivePath = errors.New("invalid archive path")
+)
+
+func validateSnapshotName(snapshotName string) error {
+	if snapshotName == "" || snapshotName == "." || snapshotName == ".." ||
+		strings.ContainsAny(snapshotName, `/\`) || strings.HasSuffix(snapshotName, snapshotStagingSuffix) {
+		return fmt.Errorf("%w: %s", ErrInvalidSnapshotName, snapshotName)
+	}
+	return nil
+}
+
+func (d *Database) snapshotPath(snapshotName string) string {
+	return filepath.Join(d.options.SnapshotDir, snapshotName)
+}
+
+// archivePath resolves a client supplied archive path under ArchiveDir, so
+// that exports and imports cannot reach any other file on the host.
+func (d *Database) archivePath(archivePath string) (string, error) {
+	if archivePath == "" {
+		return "", fmt.Errorf("ArchivePath must be specified")
+	}
+	if filepath.IsAbs(archivePath) || strings.HasPrefix(archivePath, "/") || strings.Contains(archivePath, `\`) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidArchivePath, archivePath)
+	}
+	for _, segment := range strings.Split(archivePath, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%w: %s", ErrInvalidArchivePath, archivePath)
+		}
+	}
+	return filepath.Join(d.options.ArchiveDir, filepath.FromSlash(archivePath)), nil
+}
+
+func (d *Database) tableNames() []string {
+	names := make([]string, 0, len(d.Tables))
+	for name := range d.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func uniqueSortedNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var unique []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+func (d *Database) ListSnapshots() ([]model.SnapshotDescriptor, error) {
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	entries, err := os.ReadDir(d.options.SnapshotDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	var snapshots []model.SnapshotDescriptor
+	for _, entry := range entries {
+		if !entry.IsDir() || validateSnapshotName(entry.Name()) != nil {
+			continue
+		}
+		descriptor, err := d.describeSnapshotDir(entry.Name())
+		if err != nil {
+			log.Printf("Skipping unreadable snapshot %s: %v", entry.Name(), err)
+			continue
+		}
+		snapshots = append(snapshots, descriptor)
+	}
+	return snapshots, nil
+}
+
+func (d *Database) DescribeSnapshot(snapshotName string) (model.SnapshotDescriptor, error) {
+	if err := validateSnapshotName(snapshotName); err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	return d.describeSnapshotDir(snapshotName)
+}
+
+func (d *Database) DeleteSnapshot(snapshotName string) (model.SnapshotDescriptor, error) {
+	if err := validateSnapshotName(snapshotName); err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	descriptor, err := d.describeSnapshotDir(snapshotName)
+	if err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+	if err := os.RemoveAll(d.snapshotPath(snapshotName)); err != nil {
+		return model.SnapshotDescriptor{}, fmt.Errorf("failed to delete snapshot %s: %w", snapshotName, err)
+	}
+	return descriptor, nil
+}
+
+// ExportSnapshot packs a snapshot into a gzipped tar archive. The manifest is
+// written as the last entry so every file is read only once.
+func (d *Database) ExportSnapshot(snapshotName string, archivePath string) (model.SnapshotManifest, error) {
+	if err := validateSnapshotName(snapshotName); err != nil {
+		return model.SnapshotManifest{}, err
+	}
+	archivePath, err := d.archivePath(archivePath)
+	if err != nil {
+		return model.SnapshotManifest{}, err
+	}
+
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	descriptor, err := d.describeSnapshotDir(snapshotName)
+	if err != nil {
+		return model.SnapshotManifest{}, err
+	}
+	manifest := model.SnapshotManifest{
+		FormatVersion: model.SnapshotArchiveFormatVersion,
+		Snapshot: descriptor,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	stagingPath := archivePath + snapshotStagingSuffix
+	out, err := os.Create(stagingPath)
+	if err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(stagingPath)
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	files, err := os.ReadDir(d.snapshotPath(snapshotName))
+	if err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to read snapshot %s: %w", snapshotName, err)
+	}
+	for _, file := range files {
+		if file.IsDir() || isLevelDBRuntimeFile(file.Name()) || file.Name() == snapshotMetadataFile {
+			continue
+		}
+		entry, err := addArchiveFile(tw, filepath.Join(d.snapshotPath(snapshotName), file.Name()))
+		if err != nil {
+			return model.SnapshotManifest{}, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to marshal snapshot manifest: %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: snapshotManifestEntry, Mode: 0644, Size: int64(len(manifestBytes)), ModTime: descriptor.CreationTime}); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+	if _, err := tw.Write(manifestBytes); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := os.Rename(stagingPath, archivePath); err != nil {
+		return model.SnapshotManifest{}, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// ImportSnapshot unpacks an archive written by ExportSnapshot into a staging
+// directory and only publishes it once every file matches the manifest. An
+// empty snapshotName keeps the name recorded in the archive.
+func (d *Database) ImportSnapshot(archivePath string, snapshotName string) (model.SnapshotDescriptor, error) {
+	if snapshotName != "" {
+		if err := validateSnapshotName(snapshotName); err != nil {
+			return model.SnapshotDescriptor{}, err
+		}
+	}
+
+	archivePath, err := d.archivePath(archivePath)
+	if err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+	in, err := os.Open(archivePath)
+	if err != nil {
+		return model.SnapshotDescriptor{}, fmt.Errorf("%w: %v", ErrInvalidSnapshotArchive, err)
+	}
+	defer in.Close()
+
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	if err := os.MkdirAll(d.options.SnapshotDir, 0755); err != nil {
+		return model.SnapshotDescriptor{}, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	stagingDir, err := os.MkdirTemp(d.options.SnapshotDir, "import-*"+snapshotStagingSuffix)
+	if err != nil {
+		return model.SnapshotDescriptor{}, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	manifest, extracted, err := extractSnapshotArchive(in, stagingDir)
+	if err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+	if err := verifySnapshotFiles(manifest, extracted); err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+
+	if snapshotName == "" {
+		snapshotName = manifest.Snapshot.SnapshotName
+		if err := validateSnapshotName(snapshotName); err != nil {
+			return model.SnapshotDescriptor{}, fmt.Errorf("%w: %v", ErrInvalidSnapshotArchive, err)
+		}
+	}
+	if _, err := os.Stat(d.snapshotPath(snapshotName)); err == nil {
+		return model.SnapshotDescriptor{}, fmt.Errorf("%w: %s", ErrSnapshotAlreadyExists, snapshotName)
+	}
+
+	metadata := manifest.Snapshot
+	metadata.SnapshotName = snapshotName
+	if err := writeSnapshotMetadata(stagingDir, metadata); err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+	if err := os.Rename(stagingDir, d.snapshotPath(snapshotName)); err != nil {
+		return model.SnapshotDescriptor{}, fmt.Errorf("failed to finalize snapshot %s: %w", snapshotName, err)
+	}
+	return d.describeSnapshotDir(snapshotName)
+}
+
+// RestoreTablesFromSnapshot restores tables from a snapshot without touching
+// any other table. targets maps table names in the snapshot to the names they
+// are restored under; an empty target restores in place, replacing the live
+// table, and a nil map restores every table in the snapshot in place.
+func (d *Database) RestoreTablesFromSnapshot(snapshotName string, targets map[string]string) ([]model.TableSchema, error) {
+	if err := validateSnapshotName(snapshotName); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.snapshotMu.Lock()
+	defer d.snapshotMu.Unlock()
+
+	return d.restoreTablesFromSnapshot(snapshotName, targets)
+}
+
+func (d *Database) restoreTablesFromSnapshot(snapshotName string, targets map[string]string) ([]model.TableSchema, error) {
+	if _, err := d.describeSnapshotDir(snapshotName); err != nil {
+		return nil, err
+	}
+
+	snapshotDB, err := d.openSnapshotStorage(snapshotName)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshotDB.Close()
+
+	sources, err := readTableSchemas(snapshotDB)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]string)
+	if len(targets) == 0 {
+		for name := range sources {
+			resolved[name] = name
+		}
+	}
+	for source, target := range targets {
+		if target == "" {
+			target = source
+		}
+		resolved[source] = target
+	}
+
+	claimed := make(map[string]bool)
+	for source, target := range resolved {
+		if _, ok := sources[source]; !ok {
+			return nil, fmt.Errorf("%w: %s is not in snapshot %s", ErrTableNotFound, source, snapshotName)
+		}
+		if claimed[target] {
+			return nil, fmt.Errorf("%w: %s is restored more than once", ErrTableAlreadyExists, target)
+		}
+		claimed[target] = true
+		if _, exists := d.Tables[target]; exists && target != source {
+			return nil, fmt.Errorf("%w: %s", ErrTableAlreadyExists, target)
+		}
+	}
+
+	d.flushGSIQueue()
+
+	var restored []model.TableSchema
+	for _, source := range sortedKeys(resolved) {
+		schema, err := d.restoreSnapshotTable(snapshotDB, sources[source], resolved[source])
+		if err != nil {
+			return restored, err
+		}
+		restored = append(restored, schema)
+	}
+	return restored, nil
+}
+
+// restoreSnapshotTable restores one table from a snapshot. The live table an
+// in-place restore replaces is deleted in the same batch that writes the
+// restored items and schema, so a restore that fails leaves it untouched.
+func (d *Database) restoreSnapshotTable(snapshotDB storageReader, source model.TableSchema, targetTableName string) (model.TableSchema, error) {
+	schema := source
+	schema.TableName = targetTableName
+	schema.StreamViewType = ""
+	schema.StreamLabel = ""
+	if schema.PITREnabled {
+		schema.PITREnabledAt = d.Now().UnixNano()
+	}
+
+	batch := new(Batch)
+	existing, replacing := d.Tables[targetTableName]
+	if replacing {
+		if err := d.stageTableDelete(batch, existing); err != nil {
+			return model.TableSchema{}, err
+		}
+		if err := d.stageChangeLogDelete(batch, targetTableName); err != nil {
+			return model.TableSchema{}, err
+		}
+	}
+
+	iter := snapshotDB.NewIterator(PrefixRange([]byte(source.TableName+model.KeySeparator)))
+	defer iter.Release()
+
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			return model.TableSchema{}, fmt.Errorf("failed to decode snapshot item: %w", err)
+		}
+		key, err := itemLevelDBKey(schema, record)
+		if err != nil {
+			return model.TableSchema{}, err
+		}
+		if err := d.ApplyItemChange(batch, schema, key, nil, record); err != nil {
+			return model.TableSchema{}, err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return model.TableSchema{}, err
+	}
+
+	if source.StreamViewType != "" {
+		if err := d.enableStream(&schema, source.StreamViewType); err != nil {
+			return model.TableSchema{}, err
+		}
+	}
+	schemaBytes, err := json.Marshal(schema)
+	if err != nil {
+		return model.TableSchema{}, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	batch.Put([]byte(d.buildSchemaKey(targetTableName)), schemaBytes)
+
+	if err := d.Write(batch); err != nil {
+		if schema.StreamViewType != "" {
+			d.disableStream(&schema)
+		}
+		return model.TableSchema{}, fmt.Errorf("failed to write restored items: %w", err)
+	}
+
+	if replacing {
+		d.resetCapacity(targetTableName)
+		if existing.StreamViewType != "" {
+			if err := d.disableStream(&existing); err != nil {
+				return model.TableSchema{}, err
+			}
+		}
+	}
+	d.Tables[targetTableName] = schema
+	return schema, nil
+}
+
+func (d *Database) openSnapshotStorage(snapshotName string) (*levelDBStorage, error) {
+	snapshotDB, err := openLevelDBStorage(d.snapshotPath(snapshotName), &opt.Options{ReadOnly: true, ErrorIfMissing: true, Strict: opt.StrictAll})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot %s: %w", snapshotName, err)
+	}
+	return snapshotDB, nil
+}
+
+func (d *Database) writeTableSnapshot(dir string, tableNames []string) error {
+	snapshotDB, err := openLevelDBStorage(dir, &opt.Options{Strict: opt.StrictAll})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot database: %w", err)
+	}
+	defer snapshotDB.Close()
+
+	batch := new(Batch)
+	for _, tableName := range tableNames {
+		schemaKey := []byte(d.buildSchemaKey(tableName))
+		value, err := d.DB.Get(schemaKey)
+		if err != nil {
+			return fmt.Errorf("failed to read schema of %s: %w", tableName, err)
+		}
+		batch.Put(schemaKey, value)
+
+		if err := copyStorageRange(snapshotDB, d.DB, PrefixRange([]byte(tableName+model.KeySeparator)), batch); err != nil {
+			return err
+		}
+	}
+	if err := snapshotDB.Write(batch); err != nil {
+		return fmt.Errorf("failed to write snapshot items: %w", err)
+	}
+	return snapshotDB.Close()
+}
+
+// writeStorageSnapshot writes a full snapshot for stores that have no
+// LevelDB directory to clone, so snapshots stay portable between backends.
+func (d *Database) writeStorageSnapshot(dir string) error {
+	snapshotDB, err := openLevelDBStorage(dir, &opt.Options{Strict: opt.StrictAll})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot database: %w", err)
+	}
+	defer snapshotDB.Close()
+
+	source, err := d.DB.GetSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	defer source.Release()
+
+	batch := new(Batch)
+	if err := copyStorageRange(snapshotDB, source, nil, batch); err != nil {
+		return err
+	}
+	if err := snapshotDB.Write(batch); err != nil {
+		return fmt.Errorf("failed to write snapshot items: %w", err)
+	}
+	return snapshotDB.Close()
+}
+
+func copyStorageRange(dst Storage, src storageReader, keyRange *KeyRange, batch *Batch) error {
+	iter := src.NewIterator(keyRange)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		if batch.Len() >= backupCopyBatchSize {
+			if err := dst.Write(batch); err != nil {
+				return fmt.Errorf("failed to write snapshot items: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	return iter.Error()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *Database) describeSnapshotDir(snapshotName string) (model.SnapshotDescriptor, error) {
+	dir := d.snapshotPath(snapshotName)
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+		return model.SnapshotDescriptor{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, snapshotName)
+	}
+	if err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+
+	descriptor := model.SnapshotDescriptor{SnapshotName: snapshotName, CreationTime: info.ModTime()}
+
+	metadata, err := os.ReadFile(filepath.Join(dir, snapshotMetadataFile))
+	if err == nil {
+		var recorded model.SnapshotDescriptor
+		if err := json.Unmarshal(metadata, &recorded); err != nil {
+			return model.SnapshotDescriptor{}, fmt.Errorf("failed to decode snapshot metadata: %w", err)
+		}
+		descriptor.CreationTime = recorded.CreationTime
+		descriptor.TableNames = recorded.TableNames
+		descriptor.Partial = recorded.Partial
+	} else if !os.IsNotExist(err) {
+		return model.SnapshotDescriptor{}, err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return model.SnapshotDescriptor{}, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		fileInfo, err := file.Info()
+		if err != nil {
+			return model.SnapshotDescriptor{}, err
+		}
+		descriptor.SizeBytes += fileInfo.Size()
+	}
+	return descriptor, nil
+}
+
+func writeSnapshotMetadata(dir string, descriptor model.SnapshotDescriptor) error {
+	descriptor.SizeBytes = 0
+	value, err := json.Marshal(descriptor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotMetadataFile), value, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot metadata: %w", err)
+	}
+	return nil
+}
+
+func addArchiveFile(tw *tar.Writer, path string) (model.SnapshotFile, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return model.SnapshotFile{}, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return model.SnapshotFile{}, err
+	}
+
+	header := &tar.Header{Name: filepath.Base(path), Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return model.SnapshotFile{}, fmt.Errorf("failed to archive %s: %w", header.Name, err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(tw, io.TeeReader(in, hash), info.Size()); err != nil {
+		return model.SnapshotFile{}, fmt.Errorf("failed to archive %s: %w", header.Name, err)
+	}
+
+	return model.SnapshotFile{Name: header.Name, SizeBytes: info.Size(), SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func extractSnapshotArchive(r io.Reader, dir string) (model.SnapshotManifest, map[string]model.SnapshotFile, error) {
+	var manifest model.SnapshotManifest
+	manifestFound := false
+	extracted := make(map[string]model.SnapshotFile)
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidSnapshotArchive, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidSnapshotArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg || header.Name != filepath.Base(header.Name) || strings.ContainsAny(header.Name, `/\`) {
+			return manifest, nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidSnapshotArchive, header.Name)
+		}
+
+		if header.Name == snapshotManifestEntry {
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return manifest, nil, fmt.Errorf("%w: failed to decode manifest: %v", ErrInvalidSnapshotArchive, err)
+			}
+			manifestFound = true
+			continue
+		}
+		if header.Name == snapshotMetadataFile {
+			continue
+		}
+
+		out, err := os.Create(filepath.Join(dir, header.Name))
+		if err != nil {
+			return manifest, nil, err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(out, hash), tr)
+		closeErr := out.Close()
+		if err != nil {
+			return manifest, nil, fmt.Errorf("%w: %v", ErrInvalidSnapshotArchive, err)
+		}
+		if closeErr != nil {
+			return manifest, nil, closeErr
+		}
+		extracted[header.Name] = model.SnapshotFile{Name: header.Name, SizeBytes: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+
+	if !manifestFound {
+		return manifest, nil, fmt.Errorf("%w: missing %s", ErrInvalidSnapshotArchive, snapshotManifestEntry)
+	}
+	return manifest, extracted, nil
+}
+
+func verifySnapshotFiles(manifest model.SnapshotManifest, extracted map[string]model.SnapshotFile) error {
+	if manifest.FormatVersion != model.SnapshotArchiveFormatVersion {
+		return fmt.Errorf("%w: unsupported format version %d", ErrInvalidSnapshotArchive, manifest.FormatVersion)
+	}
+	if len(manifest.Files) != len(extracted) {
+		return fmt.Errorf("%w: manifest lists %d files but archive contains %d", ErrInvalidSnapshotArchive, len(manifest.Files), len(extracted))
+	}
+	for _, expected := range manifest.Files {
+		actual, ok := extracted[expected.Name]
+		if !ok {
+			return fmt.Errorf("%w: missing file %s", ErrInvalidSnapshotArchive, expected.Name)
+		}
+		if actual.SizeBytes != expected.SizeBytes || actual.SHA256 != expected.SHA256 {
+			return fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidSnapshotArchive, expected.Name)
+		}
+	}
+	return nil
+}
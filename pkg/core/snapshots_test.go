@@ -0,0 +1,357 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+func newSnapshotTestDatabase(t *testing.T, inMemory bool) *Database {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := NewDatabase(DatabaseOptions{
+		InMemory: inMemory,
+		DataDir: filepath.Join(dir, "data"),
+		SnapshotDir: filepath.Join(dir, "snapshots"),
+		ArchiveDir: filepath.Join(dir, "archives"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func storageKinds(t *testing.T, fn func(t *testing.T, inMemory bool)) {
+	t.Run("leveldb", func(t *testing.T) { fn(t, false) })
+	t.Run("memory", func(t *testing.T) { fn(t, true) })
+}
+
+func execPartiQL(t *testing.T, db *Database, statement string) []model.Record {
+	t.Helper()
+	result, err := db.ExecuteStatement(PartiQLStatementInput{Statement: statement}, 0, "")
+	if err != nil {
+		t.Fatalf("%s: %v", statement, err)
+	}
+	return result.Items
+}
+
+func TestLoadSnapshotMigratesIndexKeys(t *testing.T) {
+	storageKinds(t, func(t *testing.T, inMemory bool) {
+		db := newSnapshotTestDatabase(t, inMemory)
+		schema := model.TableSchema{
+			TableName: "T",
+			PartitionKey: "pk",
+			GSIs: map[string]model.GsiSchema{
+				"G": {IndexName: "G", PartitionKey: "g", Projection: model.Projection{ProjectionType: "ALL"}},
+			},
+		}
+		if err := db.CreateTable(schema); err != nil {
+			t.Fatal(err)
+		}
+		execPartiQL(t, db, `INSERT INTO T VALUE {'pk': 'a', 'g': 'x'}`)
+
+		// Rewrite the index entry the way it was stored before index keys
+		// were scoped by table, then take the snapshot.
+		scoped := model.BuildGSILevelDBKey("T", "G", "x", "", "a")
+		value, err := db.DB.Get([]byte(scoped))
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy := "G" + model.GSIKeySeparator + "x" + model.GSIKeySeparator + "a"
+		batch := new(Batch)
+		batch.Delete([]byte(scoped))
+		batch.Put([]byte(legacy), value)
+		if err := db.DB.Write(batch); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CreateSnapshot("old"); err != nil {
+			t.Fatal(err)
+		}
+
+		execPartiQL(t, db, `DELETE FROM T WHERE pk = 'a'`)
+		if err := db.LoadSnapshot("old"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.DB.Get([]byte(legacy)); err != ErrNotFound {
+			t.Errorf("legacy index key kept: %v", err)
+		}
+		want := []model.Record{{"pk": {"S": "a"}, "g": {"S": "x"}}}
+		if got := execPartiQL(t, db, `SELECT * FROM "T"."G" WHERE g = 'x'`); !reflect.DeepEqual(got, want) {
+			t.Errorf("index returned %v, want %v", got, want)
+		}
+	})
+}
+
+// newSwapTestDatabase returns a LevelDB backed database holding one item in
+// table T and a good snapshot of it named "good".
+func newSwapTestDatabase(t *testing.T) (*Database, *levelDBStorage) {
+	t.Helper()
+	db := newSnapshotTestDatabase(t, false)
+	schema := model.TableSchema{TableName: "T", PartitionKey: "pk", GSIs: map[string]model.GsiSchema{}}
+	if err := db.CreateTable(schema); err != nil {
+		t.Fatal(err)
+	}
+	execPartiQL(t, db, `INSERT INTO T VALUE {'pk': 'a'}`)
+	if err := db.CreateSnapshot("good"); err != nil {
+		t.Fatal(err)
+	}
+	execPartiQL(t, db, `INSERT INTO T VALUE {'pk': 'b'}`)
+	return db, db.DB.(*levelDBStorage)
+}
+
+func assertLiveData(t *testing.T, db *Database, want ...string) {
+	t.Helper()
+	var got []string
+	for _, item := range execPartiQL(t, db, `SELECT pk FROM T`) {
+		got = append(got, item["pk"]["S"].(string))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("live table holds %v, want %v", got, want)
+	}
+}
+
+func assertNoSwapLeftovers(t *testing.T, live string) {
+	t.Helper()
+	for _, dir := range []string{live + stagingDirSuffix, live + previousDirSuffix} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", dir, err)
+		}
+	}
+}
+
+func TestLoadSnapshotFailureKeepsLiveData(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage breaks the snapshot in dir.
+		damage func(t *testing.T, dir string)
+	}{
+		{
+			name: "missing CURRENT",
+			damage: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "CURRENT")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "corrupt manifest",
+			damage: func(t *testing.T, dir string) {
+				manifests, err := filepath.Glob(filepath.Join(dir, "MANIFEST-*"))
+				if err != nil || len(manifests) == 0 {
+					t.Fatalf("no manifest in %s: %v", dir, err)
+				}
+				if err := os.WriteFile(manifests[0], []byte("not a manifest"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "unreadable schema",
+			damage: func(t *testing.T, dir string) {
+				snapshot, err := leveldb.OpenFile(dir, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer snapshot.Close()
+				if err := snapshot.Put([]byte(schemaPrefix+"T"), []byte("{"), nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, live := newSwapTestDatabase(t)
+			if err := db.CreateSnapshot("bad"); err != nil {
+				t.Fatal(err)
+			}
+			tt.damage(t, db.snapshotPath("bad"))
+
+			if err := db.LoadSnapshot("bad"); err == nil {
+				t.Fatal("loading a damaged snapshot succeeded")
+			}
+			assertLiveData(t, db, "a", "b")
+			assertNoSwapLeftovers(t, live.path)
+
+			// The database still takes writes and can load a good snapshot.
+			execPartiQL(t, db, `INSERT INTO T VALUE {'pk': 'c'}`)
+			assertLiveData(t, db, "a", "b", "c")
+			if err := db.LoadSnapshot("good"); err != nil {
+				t.Fatal(err)
+			}
+			assertLiveData(t, db, "a")
+		})
+	}
+
+	t.Run("missing snapshot", func(t *testing.T) {
+		db, live := newSwapTestDatabase(t)
+		if err := db.LoadSnapshot("nope"); err == nil {
+			t.Fatal("loading a missing snapshot succeeded")
+		}
+		assertLiveData(t, db, "a", "b")
+		assertNoSwapLeftovers(t, live.path)
+	})
+}
+
+func TestLoadSnapshotClearsLeftoverDirs(t *testing.T) {
+	db, live := newSwapTestDatabase(t)
+
+	// A crash in the middle of an earlier swap leaves these behind.
+	for _, dir := range []string{live.path + stagingDirSuffix, live.path + previousDirSuffix} {
+		if err := os.MkdirAll(filepath.Join(dir, "junk"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "CURRENT"), []byte("garbage"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.LoadSnapshot("good"); err != nil {
+		t.Fatal(err)
+	}
+	assertLiveData(t, db, "a")
+	assertNoSwapLeftovers(t, db.DB.(*levelDBStorage).path)
+
+	if err := db.DeleteAllData(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Tables) != 0 {
+		t.Errorf("tables left after DeleteAllData: %v", db.Tables)
+	}
+	assertNoSwapLeftovers(t, live.path)
+}
+
+func TestRollbackDatabaseDir(t *testing.T) {
+	db, live := newSwapTestDatabase(t)
+
+	// Fail the swap after the live directory has been moved aside and a
+	// broken database has taken its place.
+	previousDir := live.path + previousDirSuffix
+	if err := live.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(live.path, previousDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(live.path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(live.path, "CURRENT"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cause := errors.New("open failed")
+	if err := db.rollbackDatabaseDir(live, previousDir, cause); err != cause {
+		t.Fatalf("got %v, want the original cause", err)
+	}
+	assertLiveData(t, db, "a", "b")
+	assertNoSwapLeftovers(t, live.path)
+	if _, ok := db.Tables["T"]; !ok {
+		t.Error("table T lost its schema")
+	}
+	execPartiQL(t, db, `INSERT INTO T VALUE {'pk': 'c'}`)
+}
+
+func TestCreateSnapshotDuringWrites(t *testing.T) {
+	db := newSnapshotTestDatabase(t, false)
+	schema := model.TableSchema{TableName: "T", PartitionKey: "pk", GSIs: map[string]model.GsiSchema{}}
+	if err := db.CreateTable(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write straight to the store, which the database lock held by
+	// CreateSnapshot does not block, in batches big enough to flush and
+	// compact table files while the directory is cloned. Keys go in order,
+	// so every snapshot must hold an unbroken run of them.
+	storage := db.DB
+	key := func(i int) []byte { return []byte(model.BuildLevelDBKey("T", fmt.Sprintf("%08d", i), "")) }
+	padding := strings.Repeat("x", 1024)
+	var written atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			batch := new(Batch)
+			for end := i + 100; i < end; i++ {
+				value, err := model.MarshalRecord(model.Record{"pk": {"S": fmt.Sprintf("%08d", i)}, "d": {"S": padding}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				batch.Put(key(i), value)
+			}
+			if err := storage.Write(batch); err != nil {
+				t.Error(err)
+				return
+			}
+			written.Store(int64(i))
+		}
+	}()
+
+	const snapshots = 5
+	for i := 0; i < snapshots; i++ {
+		for target := written.Load() + 1000; written.Load() < target; {
+			time.Sleep(time.Millisecond)
+		}
+		if err := db.CreateSnapshot(fmt.Sprintf("s%d", i)); err != nil {
+			close(stop)
+			wg.Wait()
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	for i := 0; i < snapshots; i++ {
+		name := fmt.Sprintf("s%d", i)
+		snapshot, err := db.openSnapshotStorage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		iter := snapshot.NewIterator(PrefixRange([]byte(model.BuildLevelDBKey("T", "", ""))))
+		for iter.Next() {
+			if string(iter.Key()) != string(key(count)) {
+				t.Errorf("%s: got key %q at position %d, want %q", name, iter.Key(), count, key(count))
+				break
+			}
+			if _, err := model.UnmarshalRecord(iter.Value()); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+			count++
+		}
+		if err := iter.Error(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		iter.Release()
+		snapshot.Close()
+	}
+
+	if err := db.LoadSnapshot(fmt.Sprintf("s%d", snapshots-1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Tables["T"]; !ok {
+		t.Error("loaded snapshot lost table T")
+	}
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	ErrNotFound = errors.New("storage: key not found")
+	ErrStorageClosed = errors.New("storage: closed")
+)
+
+// Storage is the ordered key/value store the database keeps tables, indexes
+// and metadata in. Writes of a single Batch must be applied atomically, and
+// iterators and snapshots must present a consistent view that later writes
+// do not change.
+type Storage interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Write(batch *Batch) error
+	NewIterator(keyRange *KeyRange) Iterator
+	GetSnapshot() (StorageSnapshot, error)
+	Close() error
+}
+
+type StorageSnapshot interface {
+	Get(key []byte) ([]byte, error)
+	NewIterator(keyRange *KeyRange) Iterator
+	Release()
+}
+
+// Iterator walks keys in ascending byte order. A fresh iterator is positioned
+// before the first key, so Next moves to the first key and Prev finds nothing;
+// once Next or Seek has run past the last key, Prev moves back to it.
+type Iterator interface {
+	First() bool
+	Last() bool
+	Seek(key []byte) bool
+	Next() bool
+	Prev() bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
+
+// KeyRange covers keys from Start inclusive to Limit exclusive. A nil bound
+// leaves that side open.
+type KeyRange struct {
+	Start []byte
+	Limit []byte
+}
+
+func PrefixRange(prefix []byte) *KeyRange {
+	r := util.BytesPrefix(prefix)
+	return &KeyRange{Start: r.Start, Limit: r.Limit}
+}
+
+type BatchReplay interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+}
+
+type batchOp struct {
+	key []byte
+	value []byte
+	delete bool
+}
+
+// Batch collects writes that are applied together by Storage.Write.
+type Batch struct {
+	ops []batchOp
+
+	operation Operation
+	input interface{}
+	changes []*HookContext
+	capacity map[string]*stagedCapacity
+	gsiUpdates []*Batch
+}
+
+func (b *Batch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+}
+
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: append([]byte(nil), key...), delete: true})
+}
+
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+	b.changes = nil
+	b.capacity = nil
+	b.gsiUpdates = nil
+}
+
+func (b *Batch) Replay(r BatchReplay) {
+	for _, op := range b.ops {
+		if op.delete {
+			r.Delete(op.key)
+		} else {
+			r.Put(op.key, op.value)
+		}
+	}
+}
+
+type levelDBStorage struct {
+	db *leveldb.DB
+	path string
+	options *opt.Options
+}
+
+func OpenLevelDBStorage(path string) (Storage, error) {
+	return openLevelDBStorage(path, &opt.Options{Strict: opt.StrictAll})
+}
+
+func openLevelDBStorage(path string, options *opt.Options) (*levelDBStorage, error) {
+	db, err := leveldb.OpenFile(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBStorage{db: db, path: path, options: options}, nil
+}
+
+func (s *levelDBStorage) Get(key []byte) ([]byte, error) {
+	value, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *levelDBStorage) Put(key, value []byte) error {
+	return s.db.Put(key, value, nil)
+}
+
+func (s *levelDBStorage) Write(batch *Batch) error {
+	levelBatch := new(leveldb.Batch)
+	batch.Replay(levelBatch)
+	return s.db.Write(levelBatch, nil)
+}
+
+func (s *levelDBStorage) NewIterator(keyRange *KeyRange) Iterator {
+	return s.db.NewIterator(levelDBRange(keyRange), nil)
+}
+
+func (s *levelDBStorage) GetSnapshot() (StorageSnapshot, error) {
+	snapshot, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBSnapshot{snapshot: snapshot}, nil
+}
+
+func (s *levelDBStorage) Close() error {
+	return s.db.Close()
+}
+
+type levelDBSnapshot struct {
+	snapshot *leveldb.Snapshot
+}
+
+func (s *levelDBSnapshot) Get(key []byte) ([]byte, error) {
+	value, err := s.snapshot.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *levelDBSnapshot) NewIterator(keyRange *KeyRange) Iterator {
+	return s.snapshot.NewIterator(levelDBRange(keyRange), nil)
+}
+
+func (s *levelDBSnapshot) Release() {
+	s.snapshot.Release()
+}
+
+func levelDBRange(keyRange *KeyRange) *util.Range {
+	if keyRange == nil {
+		return nil
+	}
+	return &util.Range{Start: keyRange.Start, Limit: keyRange.Limit}
+}
+
+// storageReader is what copying and restoring need from either a live store
+// or one of its snapshots.
+type storageReader interface {
+	Get(key []byte) ([]byte, error)
+	NewIterator(keyRange *KeyRange) Iterator
+}
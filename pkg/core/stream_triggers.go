@@ -0,0 +1,360 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	triggerPollInterval = 250 * time.Millisecond
+	triggerRetryBackoff = 100 * time.Millisecond
+	triggerMaxBatchSize = 10000
+)
+
+type StreamHandlerFunc func(ctx context.Context, event model.StreamEvent) error
+
+// StreamTriggerConfig configures a trigger that passes batches of stream
+// records to Handler. Endpoint only describes where Handler delivers them and
+// is reported back in the trigger's status.
+type StreamTriggerConfig struct {
+	Name string
+	TableName string
+	Endpoint string
+	Handler StreamHandlerFunc
+	BatchSize int
+	BatchingWindow time.Duration
+	MaximumRetryAttempts int
+	BisectBatchOnFunctionError bool
+	DeadLetterFile string
+	StartingPosition string
+}
+
+type StreamTriggerStatus struct {
+	Name string
+	TableName string
+	Endpoint string
+	StreamArn string
+	LastProcessedSequenceNumber string
+	Invocations int
+	Failures int
+	DeadLettered int
+}
+
+type streamTrigger struct {
+	db *Database
+	cfg StreamTriggerConfig
+
+	mu sync.Mutex
+	streamArn string
+	position uint64
+	invocations int
+	failures int
+	deadLettered int
+
+	cancel context.CancelFunc
+	done chan struct{}
+}
+
+type deadLetterEntry struct {
+	Trigger string `json:"trigger"`
+	Timestamp string `json:"timestamp"`
+	Error string `json:"error"`
+	DDBStreamBatchInfo struct {
+		StreamArn string `json:"streamArn"`
+		StartSequenceNumber string `json:"startSequenceNumber"`
+		EndSequenceNumber string `json:"endSequenceNumber"`
+		BatchSize int `json:"batchSize"`
+	} `json:"DDBStreamBatchInfo"`
+	Records []model.StreamEventRecord `json:"records"`
+}
+
+func (d *Database) AddStreamTrigger(cfg StreamTriggerConfig) error {
+	if cfg.Name == "" {
+		return fmt.Errorf("trigger name must be specified")
+	}
+	if cfg.TableName == "" {
+		return fmt.Errorf("trigger table name must be specified")
+	}
+	if cfg.Handler == nil {
+		return fmt.Errorf("trigger handler must be specified")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.BatchSize > triggerMaxBatchSize {
+		return fmt.Errorf("BatchSize must be at most %d", triggerMaxBatchSize)
+	}
+	if cfg.StartingPosition == "" {
+		cfg.StartingPosition = "LATEST"
+	}
+	if cfg.StartingPosition != "LATEST" && cfg.StartingPosition != "TRIM_HORIZON" {
+		return fmt.Errorf("StartingPosition must be LATEST or TRIM_HORIZON")
+	}
+
+	d.triggersMu.Lock()
+	defer d.triggersMu.Unlock()
+
+	if _, exists := d.triggers[cfg.Name]; exists {
+		return fmt.Errorf("stream trigger already exists: %s", cfg.Name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &streamTrigger{
+		db: d,
+		cfg: cfg,
+		cancel: cancel,
+		done: make(chan struct{}),
+	}
+
+	d.mu.RLock()
+	schema, ok := d.Tables[cfg.TableName]
+	if ok && schema.StreamLabel != "" {
+		t.streamArn = StreamArn(schema.TableName, schema.StreamLabel)
+		if cfg.StartingPosition == "LATEST" {
+			_, last, err := d.streamSequenceRange(t.streamArn)
+			if err != nil {
+				d.mu.RUnlock()
+				cancel()
+				return err
+			}
+			t.position = last
+		}
+	}
+	d.mu.RUnlock()
+
+	d.triggers[cfg.Name] = t
+	go t.run(ctx)
+	return nil
+}
+
+func (d *Database) RemoveStreamTrigger(name string) error {
+	d.triggersMu.Lock()
+	t, ok := d.triggers[name]
+	delete(d.triggers, name)
+	d.triggersMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("stream trigger not found: %s", name)
+	}
+	t.stop()
+	return nil
+}
+
+func (d *Database) ListStreamTriggers() []StreamTriggerStatus {
+	d.triggersMu.Lock()
+	defer d.triggersMu.Unlock()
+
+	statuses := make([]StreamTriggerStatus, 0, len(d.triggers))
+	for _, t := range d.triggers {
+		statuses = append(statuses, t.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (d *Database) stopStreamTriggers() {
+	d.triggersMu.Lock()
+	triggers := d.triggers
+	d.triggers = make(map[string]*streamTrigger)
+	d.triggersMu.Unlock()
+
+	for _, t := range triggers {
+		t.stop()
+	}
+}
+
+func (t *streamTrigger) stop() {
+	t.cancel()
+	<-t.done
+}
+
+func (t *streamTrigger) status() StreamTriggerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := StreamTriggerStatus{
+		Name: t.cfg.Name,
+		TableName: t.cfg.TableName,
+		Endpoint: t.cfg.Endpoint,
+		StreamArn: t.streamArn,
+		Invocations: t.invocations,
+		Failures: t.failures,
+		DeadLettered: t.deadLettered,
+	}
+	if t.position > 0 {
+		status.LastProcessedSequenceNumber = formatSequenceNumber(t.position)
+	}
+	return status
+}
+
+func (t *streamTrigger) run(ctx context.Context) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(triggerPollInterval)
+	defer ticker.Stop()
+
+	var windowStart time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		records, last, err := t.poll()
+		if err != nil {
+			log.Printf("Stream trigger %s failed to read records: %v", t.cfg.Name, err)
+			continue
+		}
+		if len(records) == 0 {
+			windowStart = time.Time{}
+			continue
+		}
+
+		if len(records) < t.cfg.BatchSize && t.cfg.BatchingWindow > 0 {
+			if windowStart.IsZero() {
+				windowStart = time.Now()
+			}
+			if time.Since(windowStart) < t.cfg.BatchingWindow {
+				continue
+			}
+		}
+		windowStart = time.Time{}
+
+		t.deliver(ctx, records)
+		if ctx.Err() != nil {
+			return
+		}
+
+		t.mu.Lock()
+		t.position = last
+		t.mu.Unlock()
+	}
+}
+
+func (t *streamTrigger) poll() ([]model.StreamEventRecord, uint64, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+
+	schema, ok := t.db.Tables[t.cfg.TableName]
+	if !ok || schema.StreamLabel == "" {
+		return nil, 0, nil
+	}
+
+	streamArn := StreamArn(schema.TableName, schema.StreamLabel)
+
+	t.mu.Lock()
+	if t.streamArn != streamArn {
+		t.streamArn = streamArn
+		t.position = 0
+	}
+	position := t.position
+	t.mu.Unlock()
+
+	records, last, err := t.db.readStreamRecords(streamArn, position, t.cfg.BatchSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	eventRecords := make([]model.StreamEventRecord, 0, len(records))
+	for _, record := range records {
+		eventRecords = append(eventRecords, model.StreamEventRecord{StreamRecord: record, EventSourceARN: streamArn})
+	}
+	return eventRecords, last, nil
+}
+
+func (t *streamTrigger) deliver(ctx context.Context, records []model.StreamEventRecord) {
+	err := t.invokeWithRetry(ctx, records)
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	if t.cfg.BisectBatchOnFunctionError && len(records) > 1 {
+		mid := len(records) / 2
+		t.deliver(ctx, records[:mid])
+		t.deliver(ctx, records[mid:])
+		return
+	}
+
+	t.deadLetter(records, err)
+}
+
+func (t *streamTrigger) invokeWithRetry(ctx context.Context, records []model.StreamEventRecord) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = t.invoke(ctx, records)
+
+		t.mu.Lock()
+		t.invocations++
+		if err != nil {
+			t.failures++
+		}
+		t.mu.Unlock()
+
+		if err == nil {
+			return nil
+		}
+		if t.cfg.MaximumRetryAttempts >= 0 && attempt >= t.cfg.MaximumRetryAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(triggerRetryBackoff << uint(min(attempt, 6))):
+		}
+	}
+}
+
+func (t *streamTrigger) invoke(ctx context.Context, records []model.StreamEventRecord) error {
+	return t.cfg.Handler(ctx, model.StreamEvent{Records: records})
+}
+
+func (t *streamTrigger) deadLetter(records []model.StreamEventRecord, cause error) {
+	t.mu.Lock()
+	t.deadLettered += len(records)
+	streamArn := t.streamArn
+	t.mu.Unlock()
+
+	log.Printf("Stream trigger %s discarded %d records after retries: %v", t.cfg.Name, len(records), cause)
+
+	if t.cfg.DeadLetterFile == "" {
+		return
+	}
+
+	entry := deadLetterEntry{
+		Trigger: t.cfg.Name,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error: cause.Error(),
+		Records: records,
+	}
+	entry.DDBStreamBatchInfo.StreamArn = streamArn
+	entry.DDBStreamBatchInfo.StartSequenceNumber = records[0].Dynamodb.SequenceNumber
+	entry.DDBStreamBatchInfo.EndSequenceNumber = records[len(records)-1].Dynamodb.SequenceNumber
+	entry.DDBStreamBatchInfo.BatchSize = len(records)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal dead-letter entry: %v", err)
+		return
+	}
+
+	f, err := os.OpenFile(t.cfg.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to open dead-letter file %s: %v", t.cfg.DeadLetterFile, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write dead-letter file %s: %v", t.cfg.DeadLetterFile, err)
+	}
+}
@@ -0,0 +1,498 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+const (
+	streamRecordPrefix = "__STREAM__" + model.KeySeparator
+	streamMetaPrefix = "__STREAMMETA__" + model.KeySeparator
+	streamSequenceKey = "__STREAMSEQ__"
+
+	StreamRegion = "ddblocal"
+	StreamAccountID = "000000000000"
+
+	streamRetention = 24 * time.Hour
+	shardIteratorTTL = 15 * time.Minute
+)
+
+var (
+	ErrStreamNotFound = fmt.Errorf("stream not found")
+	ErrExpiredIterator = fmt.Errorf("shard iterator has expired")
+	ErrTrimmedData = fmt.Errorf("requested records are beyond the stream retention period")
+)
+
+var ttlServiceIdentity = &model.StreamUserIdentity{
+	PrincipalId: "dynamodb.amazonaws.com",
+	Type: "Service",
+}
+
+type ShardIterator struct {
+	StreamArn string `json:"a"`
+	ShardId string `json:"s"`
+	After uint64 `json:"p"`
+	IssuedAt int64 `json:"t"`
+}
+
+func StreamArn(tableName, label string) string {
+	return fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s/stream/%s", StreamRegion, StreamAccountID, tableName, label)
+}
+
+func formatSequenceNumber(seq uint64) string {
+	return fmt.Sprintf("%021d", seq)
+}
+
+func buildStreamRecordKey(streamArn string, seq uint64) string {
+	return streamRecordPrefix + streamArn + model.KeySeparator + formatSequenceNumber(seq)
+}
+
+func (d *Database) loadStreamSequence() error {
+	value, err := d.DB.Get([]byte(streamSequenceKey))
+	if err == ErrNotFound {
+		d.streamSeq = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	seq, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid stream sequence number: %w", err)
+	}
+	d.streamSeq = seq
+	return nil
+}
+
+func (d *Database) enableStream(schema *model.TableSchema, viewType string) error {
+	if !model.IsValidStreamViewType(viewType) {
+		return fmt.Errorf("StreamViewType must be one of KEYS_ONLY, NEW_IMAGE, OLD_IMAGE, NEW_AND_OLD_IMAGES")
+	}
+
+	now := d.Now()
+	label := now.UTC().Format("2006-01-02T15:04:05.000")
+
+	keySchema := []model.KeySchemaElement{{AttributeName: schema.PartitionKey, KeyType: "HASH"}}
+	if schema.SortKey != "" {
+		keySchema = append(keySchema, model.KeySchemaElement{AttributeName: schema.SortKey, KeyType: "RANGE"})
+	}
+
+	descriptor := model.StreamDescriptor{
+		StreamArn: StreamArn(schema.TableName, label),
+		StreamLabel: label,
+		TableName: schema.TableName,
+		StreamViewType: viewType,
+		StreamStatus: "ENABLED",
+		KeySchema: keySchema,
+		ShardId: fmt.Sprintf("shardId-%020d-%08x", now.UnixMilli(), now.UnixNano()&0xffffffff),
+		CreationTime: now.Unix(),
+	}
+	if err := d.putStreamDescriptor(descriptor); err != nil {
+		return err
+	}
+
+	schema.StreamViewType = viewType
+	schema.StreamLabel = label
+	return nil
+}
+
+func (d *Database) disableStream(schema *model.TableSchema) error {
+	if schema.StreamLabel != "" {
+		descriptor, err := d.getStreamDescriptor(StreamArn(schema.TableName, schema.StreamLabel))
+		if err != nil && err != ErrStreamNotFound {
+			return err
+		}
+		if err == nil {
+			descriptor.StreamStatus = "DISABLED"
+			descriptor.DisabledTime = d.Now().Unix()
+			if err := d.putStreamDescriptor(descriptor); err != nil {
+				return err
+			}
+		}
+	}
+	schema.StreamViewType = ""
+	return nil
+}
+
+func (d *Database) UpdateStreamSpecification(tableName string, enabled bool, viewType string) (model.TableSchema, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return model.TableSchema{}, fmt.Errorf("table not found: %s", tableName)
+	}
+
+	if enabled {
+		if schema.StreamViewType != "" {
+			return model.TableSchema{}, fmt.Errorf("Table already has an enabled stream: %s", StreamArn(tableName, schema.StreamLabel))
+		}
+		if err := d.enableStream(&schema, viewType); err != nil {
+			return model.TableSchema{}, err
+		}
+	} else {
+		if schema.StreamViewType == "" {
+			return model.TableSchema{}, fmt.Errorf("Table %s does not have an enabled stream", tableName)
+		}
+		if err := d.disableStream(&schema); err != nil {
+			return model.TableSchema{}, err
+		}
+	}
+
+	if err := d.putTableSchema(schema); err != nil {
+		return model.TableSchema{}, err
+	}
+	return schema, nil
+}
+
+func (d *Database) putStreamDescriptor(descriptor model.StreamDescriptor) error {
+	value, err := json.Marshal(descriptor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream descriptor: %w", err)
+	}
+	return d.DB.Put([]byte(streamMetaPrefix+descriptor.StreamArn), value)
+}
+
+func (d *Database) getStreamDescriptor(streamArn string) (model.StreamDescriptor, error) {
+	var descriptor model.StreamDescriptor
+	value, err := d.DB.Get([]byte(streamMetaPrefix+streamArn))
+	if err == ErrNotFound {
+		return descriptor, ErrStreamNotFound
+	}
+	if err != nil {
+		return descriptor, err
+	}
+	if err := json.Unmarshal(value, &descriptor); err != nil {
+		return descriptor, fmt.Errorf("failed to unmarshal stream descriptor: %w", err)
+	}
+	return descriptor, nil
+}
+
+func (d *Database) appendStreamRecord(batch *Batch, schema model.TableSchema, oldRecord model.Record, newRecord model.Record, identity *model.StreamUserIdentity) error {
+	if schema.StreamViewType == "" {
+		return nil
+	}
+	if oldRecord == nil && newRecord == nil {
+		return nil
+	}
+	if reflect.DeepEqual(oldRecord, newRecord) {
+		return nil
+	}
+
+	eventName := "MODIFY"
+	keySource := newRecord
+	if oldRecord == nil {
+		eventName = "INSERT"
+	} else if newRecord == nil {
+		eventName = "REMOVE"
+		keySource = oldRecord
+	}
+
+	d.streamSeq++
+	seq := d.streamSeq
+	now := d.Now()
+
+	data := model.StreamRecordData{
+		ApproximateCreationDateTime: float64(now.Unix()),
+		Keys: model.Record(GetItemKey(keySource, schema)),
+		SequenceNumber: formatSequenceNumber(seq),
+		StreamViewType: schema.StreamViewType,
+	}
+	switch schema.StreamViewType {
+	case model.StreamViewNewImage:
+		data.NewImage = newRecord
+	case model.StreamViewOldImage:
+		data.OldImage = oldRecord
+	case model.StreamViewNewAndOldImages:
+		data.NewImage = newRecord
+		data.OldImage = oldRecord
+	}
+	data.SizeBytes = ItemSize(data.Keys) + ItemSize(data.NewImage) + ItemSize(data.OldImage)
+
+	record := model.StreamRecord{
+		AwsRegion: StreamRegion,
+		Dynamodb: data,
+		EventID: fmt.Sprintf("%032x", seq),
+		EventName: eventName,
+		EventSource: "aws:dynamodb",
+		EventVersion: "1.1",
+		UserIdentity: identity,
+	}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream record: %w", err)
+	}
+
+	streamArn := StreamArn(schema.TableName, schema.StreamLabel)
+	batch.Put([]byte(buildStreamRecordKey(streamArn, seq)), value)
+	batch.Put([]byte(streamSequenceKey), []byte(strconv.FormatUint(seq, 10)))
+	return nil
+}
+
+func (d *Database) ListStreams(tableName string, exclusiveStartStreamArn string, limit int) ([]model.StreamDescriptor, string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(streamMetaPrefix)))
+	defer iter.Release()
+
+	streams := make([]model.StreamDescriptor, 0)
+	lastEvaluated := ""
+	for iter.Next() {
+		var descriptor model.StreamDescriptor
+		if err := json.Unmarshal(iter.Value(), &descriptor); err != nil {
+			continue
+		}
+		if tableName != "" && descriptor.TableName != tableName {
+			continue
+		}
+		if exclusiveStartStreamArn != "" && descriptor.StreamArn <= exclusiveStartStreamArn {
+			continue
+		}
+		if limit > 0 && len(streams) >= limit {
+			lastEvaluated = streams[len(streams)-1].StreamArn
+			break
+		}
+		streams = append(streams, descriptor)
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, "", err
+	}
+	return streams, lastEvaluated, nil
+}
+
+func (d *Database) DescribeStream(streamArn string) (model.StreamDescriptor, string, string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	descriptor, err := d.getStreamDescriptor(streamArn)
+	if err != nil {
+		return descriptor, "", "", err
+	}
+
+	first, last, err := d.streamSequenceRange(streamArn)
+	if err != nil {
+		return descriptor, "", "", err
+	}
+
+	startingSeq := ""
+	if first > 0 {
+		startingSeq = formatSequenceNumber(first)
+	}
+	endingSeq := ""
+	if descriptor.StreamStatus == "DISABLED" && last > 0 {
+		endingSeq = formatSequenceNumber(last)
+	}
+	return descriptor, startingSeq, endingSeq, nil
+}
+
+func (d *Database) streamSequenceRange(streamArn string) (uint64, uint64, error) {
+	prefix := []byte(streamRecordPrefix + streamArn + model.KeySeparator)
+	iter := d.DB.NewIterator(PrefixRange(prefix))
+	defer iter.Release()
+
+	var first, last uint64
+	if iter.First() {
+		first = parseStreamRecordSequence(iter.Key())
+	}
+	if iter.Last() {
+		last = parseStreamRecordSequence(iter.Key())
+	}
+	return first, last, iter.Error()
+}
+
+func parseStreamRecordSequence(key []byte) uint64 {
+	k := string(key)
+	idx := strings.LastIndex(k, model.KeySeparator)
+	if idx < 0 {
+		return 0
+	}
+	seq, _ := strconv.ParseUint(k[idx+1:], 10, 64)
+	return seq
+}
+
+func (d *Database) GetShardIterator(streamArn, shardId, iteratorType, sequenceNumber string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	descriptor, err := d.getStreamDescriptor(streamArn)
+	if err != nil {
+		return "", err
+	}
+	if descriptor.ShardId != shardId {
+		return "", fmt.Errorf("%w: shard %s", ErrStreamNotFound, shardId)
+	}
+
+	it := ShardIterator{StreamArn: streamArn, ShardId: shardId, IssuedAt: d.Now().Unix()}
+
+	switch iteratorType {
+	case "TRIM_HORIZON":
+		it.After = 0
+	case "LATEST":
+		_, last, err := d.streamSequenceRange(streamArn)
+		if err != nil {
+			return "", err
+		}
+		it.After = last
+	case "AT_SEQUENCE_NUMBER", "AFTER_SEQUENCE_NUMBER":
+		if sequenceNumber == "" {
+			return "", fmt.Errorf("SequenceNumber is required for ShardIteratorType %s", iteratorType)
+		}
+		seq, err := strconv.ParseUint(sequenceNumber, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("Invalid SequenceNumber: %s", sequenceNumber)
+		}
+		first, _, err := d.streamSequenceRange(streamArn)
+		if err != nil {
+			return "", err
+		}
+		if first > 0 && seq < first {
+			return "", ErrTrimmedData
+		}
+		it.After = seq
+		if iteratorType == "AT_SEQUENCE_NUMBER" && seq > 0 {
+			it.After = seq - 1
+		}
+	default:
+		return "", fmt.Errorf("Invalid ShardIteratorType: %s", iteratorType)
+	}
+
+	return encodeShardIterator(it)
+}
+
+func encodeShardIterator(it ShardIterator) (string, error) {
+	raw, err := json.Marshal(it)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func DecodeShardIterator(token string) (ShardIterator, error) {
+	var it ShardIterator
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return it, fmt.Errorf("Invalid ShardIterator")
+	}
+	if err := json.Unmarshal(raw, &it); err != nil {
+		return it, fmt.Errorf("Invalid ShardIterator")
+	}
+	return it, nil
+}
+
+func (d *Database) GetRecords(shardIterator string, limit int) ([]model.StreamRecord, string, error) {
+	it, err := DecodeShardIterator(shardIterator)
+	if err != nil {
+		return nil, "", err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.Now().Sub(time.Unix(it.IssuedAt, 0)) > shardIteratorTTL {
+		return nil, "", ErrExpiredIterator
+	}
+
+	descriptor, err := d.getStreamDescriptor(it.StreamArn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	records, last, err := d.readStreamRecords(it.StreamArn, it.After, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A disabled stream's shard is closed once every record has been read.
+	if descriptor.StreamStatus == "DISABLED" && len(records) == 0 {
+		return records, "", nil
+	}
+
+	next, err := encodeShardIterator(ShardIterator{StreamArn: it.StreamArn, ShardId: it.ShardId, After: last, IssuedAt: d.Now().Unix()})
+	if err != nil {
+		return nil, "", err
+	}
+	return records, next, nil
+}
+
+func (d *Database) readStreamRecords(streamArn string, after uint64, limit int) ([]model.StreamRecord, uint64, error) {
+	prefix := streamRecordPrefix + streamArn + model.KeySeparator
+	iter := d.DB.NewIterator(PrefixRange([]byte(prefix)))
+	defer iter.Release()
+
+	records := make([]model.StreamRecord, 0)
+	last := after
+	for ok := iter.Seek([]byte(buildStreamRecordKey(streamArn, after+1))); ok; ok = iter.Next() {
+		if len(records) >= limit {
+			break
+		}
+		var record model.StreamRecord
+		if err := json.Unmarshal(iter.Value(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+		last = parseStreamRecordSequence(iter.Key())
+	}
+	if err := iter.Error(); err != nil {
+		return nil, after, err
+	}
+	return records, last, nil
+}
+
+func (d *Database) TrimStreamRecords() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := d.Now().Add(-streamRetention)
+	batch := new(Batch)
+	trimmed := 0
+
+	iter := d.DB.NewIterator(PrefixRange([]byte(streamRecordPrefix)))
+	for iter.Next() {
+		var record model.StreamRecord
+		if err := json.Unmarshal(iter.Value(), &record); err != nil {
+			continue
+		}
+		if int64(record.Dynamodb.ApproximateCreationDateTime) < cutoff.Unix() {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+			trimmed++
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	metaIter := d.DB.NewIterator(PrefixRange([]byte(streamMetaPrefix)))
+	for metaIter.Next() {
+		var descriptor model.StreamDescriptor
+		if err := json.Unmarshal(metaIter.Value(), &descriptor); err != nil {
+			continue
+		}
+		if descriptor.StreamStatus == "DISABLED" && descriptor.DisabledTime < cutoff.Unix() {
+			batch.Delete(append([]byte(nil), metaIter.Key()...))
+		}
+	}
+	metaIter.Release()
+	if err := metaIter.Error(); err != nil {
+		return 0, err
+	}
+
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+	return trimmed, d.DB.Write(batch)
+}
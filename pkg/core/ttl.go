@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/model"
+)
+
+// DynamoDB ignores TTL values more than five years in the past.
+const ttlMaxAge = 5 * 365 * 24 * time.Hour
+
+func (d *Database) UpdateTimeToLive(tableName string, attributeName string, enabled bool) (model.TableSchema, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	schema, ok := d.Tables[tableName]
+	if !ok {
+		return model.TableSchema{}, fmt.Errorf("table not found: %s", tableName)
+	}
+
+	if attributeName == "" {
+		return model.TableSchema{}, fmt.Errorf("TimeToLiveSpecification.AttributeName must be specified")
+	}
+
+	if enabled {
+		if schema.TTLAttribute != "" {
+			return model.TableSchema{}, fmt.Errorf("TimeToLive is already enabled")
+		}
+		schema.TTLAttribute = attributeName
+	} else {
+		if schema.TTLAttribute == "" {
+			return model.TableSchema{}, fmt.Errorf("TimeToLive is already disabled")
+		}
+		if schema.TTLAttribute != attributeName {
+			return model.TableSchema{}, fmt.Errorf("TimeToLive attribute name %s does not match the enabled attribute %s", attributeName, schema.TTLAttribute)
+		}
+		schema.TTLAttribute = ""
+	}
+
+	if err := d.putTableSchema(schema); err != nil {
+		return model.TableSchema{}, err
+	}
+	return schema, nil
+}
+
+func (d *Database) ReapExpiredItems() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.Now()
+	deleted := 0
+
+	for _, schema := range d.Tables {
+		if schema.TTLAttribute == "" {
+			continue
+		}
+
+		n, err := d.reapTable(schema, now)
+		deleted += n
+		if err != nil {
+			return deleted, fmt.Errorf("failed to reap expired items in %s: %w", schema.TableName, err)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (d *Database) reapTable(schema model.TableSchema, now time.Time) (int, error) {
+	prefix := []byte(schema.TableName + model.KeySeparator)
+
+	type expiredItem struct {
+		key []byte
+		record model.Record
+	}
+	var expired []expiredItem
+
+	iter := d.DB.NewIterator(PrefixRange(prefix))
+	for iter.Next() {
+		record, err := model.UnmarshalRecord(iter.Value())
+		if err != nil {
+			continue
+		}
+		if IsItemExpired(record, schema.TTLAttribute, now) {
+			key := append([]byte(nil), iter.Key()...)
+			expired = append(expired, expiredItem{key: key, record: record})
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	for i, item := range expired {
+		batch := NewOperationBatch(OpTimeToLive, nil)
+		if err := d.applyItemChange(batch, schema, string(item.key), item.record, nil, ttlServiceIdentity); err != nil {
+			return i, err
+		}
+
+		if err := d.Write(batch); err != nil {
+			return i, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+func IsItemExpired(record model.Record, ttlAttribute string, now time.Time) bool {
+	av, ok := record[ttlAttribute]
+	if !ok {
+		return false
+	}
+	numStr, ok := av["N"].(string)
+	if !ok {
+		return false
+	}
+	n, err := model.ParseNumber(numStr)
+	if err != nil {
+		return false
+	}
+	epoch, _ := n.Int64()
+
+	expiresAt := time.Unix(epoch, 0)
+	if expiresAt.After(now) {
+		return false
+	}
+	return now.Sub(expiresAt) <= ttlMaxAge
+}
@@ -0,0 +1,160 @@
+// Package emulator runs the DynamoDB emulator inside the current process, so
+// Go tests can point an AWS SDK client at it without starting a binary.
+package emulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/api"
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+)
+
+const defaultAddr = "127.0.0.1:0"
+
+type Options struct {
+	Database core.DatabaseOptions
+	// Addr is where New listens. The default picks a free port on 127.0.0.1.
+	Addr string
+	// Clock replaces the system clock, e.g. with a core.ManualClock.
+	Clock core.Clock
+	Consistency *core.ConsistencyConfig
+	Capacity *core.CapacityConfig
+}
+
+type Emulator struct {
+	db *core.Database
+	server *api.Server
+	endpoint string
+
+	httpServer *http.Server
+	testServer *httptest.Server
+	closeOnce sync.Once
+	closeErr error
+}
+
+func newEmulator(opts Options) (*Emulator, error) {
+	db, err := core.NewDatabase(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Clock != nil {
+		db.SetClock(opts.Clock)
+	}
+	if opts.Consistency != nil {
+		db.SetConsistencyConfig(*opts.Consistency)
+	}
+	if opts.Capacity != nil {
+		db.SetCapacityConfig(*opts.Capacity)
+	}
+	return &Emulator{db: db, server: api.NewServer(db)}, nil
+}
+
+// New opens a database and serves it on opts.Addr until Close is called.
+func New(opts Options) (*Emulator, error) {
+	e, err := newEmulator(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		e.db.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	e.endpoint = "http://" + listener.Addr().String()
+	e.httpServer = &http.Server{Handler: e.Handler()}
+	go e.httpServer.Serve(listener)
+	return e, nil
+}
+
+// Start runs an in-memory emulator on an httptest server for the duration of
+// a test. Every file it writes goes under t.TempDir(), so parallel tests never
+// share state.
+func Start(t testing.TB) *Emulator {
+	return StartWithOptions(t, Options{Database: core.DatabaseOptions{InMemory: true}})
+}
+
+// StartWithOptions is Start with explicit options. Directories left empty in
+// opts.Database are placed under t.TempDir(); opts.Addr is ignored.
+func StartWithOptions(t testing.TB, opts Options) *Emulator {
+	t.Helper()
+
+	dir := t.TempDir()
+	if opts.Database.DataDir == "" {
+		opts.Database.DataDir = filepath.Join(dir, "data")
+	}
+	if opts.Database.SnapshotDir == "" {
+		opts.Database.SnapshotDir = filepath.Join(dir, "snapshots")
+	}
+	if opts.Database.S3Dir == "" {
+		opts.Database.S3Dir = filepath.Join(dir, "s3")
+	}
+	if opts.Database.ImportLogDir == "" {
+		opts.Database.ImportLogDir = filepath.Join(dir, "import_logs")
+	}
+	if opts.Database.ArchiveDir == "" {
+		opts.Database.ArchiveDir = filepath.Join(dir, "archives")
+	}
+
+	e, err := newEmulator(opts)
+	if err != nil {
+		t.Fatalf("failed to start emulator: %v", err)
+	}
+	e.testServer = httptest.NewServer(e.Handler())
+	e.endpoint = e.testServer.URL
+
+	t.Cleanup(func() {
+		if err := e.Close(); err != nil {
+			t.Errorf("failed to close emulator: %v", err)
+		}
+	})
+	return e
+}
+
+// Endpoint is the base URL to give an SDK client, e.g. as BaseEndpoint.
+func (e *Emulator) Endpoint() string {
+	return e.endpoint
+}
+
+func (e *Emulator) Handler() http.Handler {
+	return e.server.Mux
+}
+
+func (e *Emulator) Database() *core.Database {
+	return e.db
+}
+
+// Close stops serving and closes the database. It is safe to call more than
+// once.
+func (e *Emulator) Close() error {
+	e.closeOnce.Do(func() {
+		if e.testServer != nil {
+			e.testServer.Close()
+		}
+		if e.httpServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := e.httpServer.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				e.closeErr = err
+			}
+		}
+		if err := e.db.Close(); err != nil && e.closeErr == nil {
+			e.closeErr = err
+		}
+	})
+	return e.closeErr
+}
@@ -0,0 +1,154 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"Emulator-fr-virtuelle-Datenbanken-gobes/pkg/core"
+)
+
+func call(t *testing.T, endpoint, operation, body string) map[string]interface{} {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+operation)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s: %v", operation, err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s: failed to decode response: %v", operation, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: status %d: %v", operation, resp.StatusCode, out)
+	}
+	return out
+}
+
+func createTable(t *testing.T, endpoint string) {
+	t.Helper()
+	call(t, endpoint, "CreateTable", `{"TableName":"T","KeySchema":[{"AttributeName":"pk","KeyType":"HASH"}],"AttributeDefinitions":[{"AttributeName":"pk","AttributeType":"S"}],"BillingMode":"PAY_PER_REQUEST"}`)
+}
+
+func putItem(t *testing.T, endpoint, pk string) {
+	t.Helper()
+	call(t, endpoint, "PutItem", `{"TableName":"T","Item":{"pk":{"S":"`+pk+`"},"n":{"N":"1"}}}`)
+}
+
+func getItem(t *testing.T, endpoint, pk string) map[string]interface{} {
+	t.Helper()
+	item, _ := call(t, endpoint, "GetItem", `{"TableName":"T","Key":{"pk":{"S":"`+pk+`"}},"ConsistentRead":true}`)["Item"].(map[string]interface{})
+	return item
+}
+
+func wantItem(t *testing.T, endpoint, pk string) {
+	t.Helper()
+	want := map[string]interface{}{"pk": map[string]interface{}{"S": pk}, "n": map[string]interface{}{"N": "1"}}
+	if got := getItem(t, endpoint, pk); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetItem returned %v, want %v", got, want)
+	}
+}
+
+func tableNames(t *testing.T, endpoint string) []interface{} {
+	t.Helper()
+	names, _ := call(t, endpoint, "ListTables", `{}`)["TableNames"].([]interface{})
+	return names
+}
+
+func TestStart(t *testing.T) {
+	first := Start(t)
+	createTable(t, first.Endpoint())
+	putItem(t, first.Endpoint(), "a")
+	wantItem(t, first.Endpoint(), "a")
+
+	// A second emulator in the same test shares nothing with the first.
+	second := Start(t)
+	if second.Endpoint() == first.Endpoint() {
+		t.Fatalf("both emulators serve %s", first.Endpoint())
+	}
+	if names := tableNames(t, second.Endpoint()); len(names) != 0 {
+		t.Errorf("second emulator sees tables %v", names)
+	}
+	createTable(t, second.Endpoint())
+	putItem(t, second.Endpoint(), "b")
+	wantItem(t, second.Endpoint(), "b")
+	if item := getItem(t, first.Endpoint(), "b"); item != nil {
+		t.Errorf("first emulator sees the second's item %v", item)
+	}
+}
+
+func TestStartWithOptions(t *testing.T) {
+	clock := core.NewManualClock(time.Unix(1700000000, 0))
+	dataDir := filepath.Join(t.TempDir(), "data")
+
+	t.Run("write", func(t *testing.T) {
+		e := StartWithOptions(t, Options{Database: core.DatabaseOptions{DataDir: dataDir}, Clock: clock})
+		if !e.Database().Now().Equal(clock.Now()) {
+			t.Errorf("database clock at %v, want %v", e.Database().Now(), clock.Now())
+		}
+		createTable(t, e.Endpoint())
+		putItem(t, e.Endpoint(), "a")
+	})
+
+	// The first emulator's cleanup has run, so its LevelDB lock is released
+	// and the data directory opens again with the item in it.
+	e := StartWithOptions(t, Options{Database: core.DatabaseOptions{DataDir: dataDir}})
+	wantItem(t, e.Endpoint(), "a")
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Database: core.DatabaseOptions{
+		DataDir: filepath.Join(dir, "data"),
+		SnapshotDir: filepath.Join(dir, "snapshots"),
+		S3Dir: filepath.Join(dir, "s3"),
+		ImportLogDir: filepath.Join(dir, "import_logs"),
+		ArchiveDir: filepath.Join(dir, "archives"),
+	}}
+
+	e, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTable(t, e.Endpoint())
+	putItem(t, e.Endpoint(), "a")
+
+	// Handler serves the same database without a listener of its own.
+	server := httptest.NewServer(e.Handler())
+	wantItem(t, server.URL, "a")
+	server.Close()
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if resp, err := http.Post(e.Endpoint(), "application/x-amz-json-1.0", nil); err == nil {
+		resp.Body.Close()
+		t.Error("emulator still serving after Close")
+	}
+
+	reopened, err := New(opts)
+	if err != nil {
+		t.Fatalf("reopening the data directory after Close: %v", err)
+	}
+	defer reopened.Close()
+	wantItem(t, reopened.Endpoint(), "a")
+
+	if _, err := New(opts); err == nil {
+		t.Error("opened a data directory that is already in use")
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+const (
+	BackupStatusCreating = "CREATING"
+	BackupStatusAvailable = "AVAILABLE"
+	BackupStatusDeleted = "DELETED"
+	BackupTypeUser = "USER"
+)
+
+type BackupDescriptor struct {
+	BackupArn string
+	BackupName string
+	BackupStatus string
+	BackupType string
+	CreationTime time.Time
+	SizeBytes int64
+	ItemCount int64
+	TableName string
+	TableArn string
+	Schema TableSchema
+}
@@ -0,0 +1,96 @@
+package model
+
+const (
+	BillingModeProvisioned = "PROVISIONED"
+	BillingModePayPerRequest = "PAY_PER_REQUEST"
+)
+
+type ProvisionedThroughput struct {
+	ReadCapacityUnits int64 `json:"ReadCapacityUnits"`
+	WriteCapacityUnits int64 `json:"WriteCapacityUnits"`
+}
+
+// IsProvisioned reports whether the table is billed by provisioned capacity.
+// Tables created before billing modes were tracked are on-demand.
+func (s TableSchema) IsProvisioned() bool {
+	return s.BillingMode == BillingModeProvisioned
+}
+
+func (s TableSchema) EffectiveBillingMode() string {
+	if s.IsProvisioned() {
+		return BillingModeProvisioned
+	}
+	return BillingModePayPerRequest
+}
+
+type Capacity struct {
+	CapacityUnits float64 `json:"CapacityUnits"`
+	ReadCapacityUnits float64 `json:"ReadCapacityUnits,omitempty"`
+	WriteCapacityUnits float64 `json:"WriteCapacityUnits,omitempty"`
+}
+
+func (c *Capacity) Add(read, write float64) {
+	c.ReadCapacityUnits += read
+	c.WriteCapacityUnits += write
+	c.CapacityUnits += read + write
+}
+
+// ConsumedCapacity is what one request consumed from one table, in the shape
+// DynamoDB returns it.
+type ConsumedCapacity struct {
+	TableName string `json:"TableName"`
+	CapacityUnits float64 `json:"CapacityUnits"`
+	ReadCapacityUnits float64 `json:"ReadCapacityUnits,omitempty"`
+	WriteCapacityUnits float64 `json:"WriteCapacityUnits,omitempty"`
+	Table *Capacity `json:"Table,omitempty"`
+	GlobalSecondaryIndexes map[string]*Capacity `json:"GlobalSecondaryIndexes,omitempty"`
+	LocalSecondaryIndexes map[string]*Capacity `json:"LocalSecondaryIndexes,omitempty"`
+}
+
+// Add records read and write units against the table itself when indexName
+// is empty, or against one of its indexes.
+func (c *ConsumedCapacity) Add(indexName string, local bool, read, write float64) {
+	c.ReadCapacityUnits += read
+	c.WriteCapacityUnits += write
+	c.CapacityUnits += read + write
+
+	if indexName == "" {
+		if c.Table == nil {
+			c.Table = &Capacity{}
+		}
+		c.Table.Add(read, write)
+		return
+	}
+
+	indexes := &c.GlobalSecondaryIndexes
+	if local {
+		indexes = &c.LocalSecondaryIndexes
+	}
+	if *indexes == nil {
+		*indexes = make(map[string]*Capacity)
+	}
+	if (*indexes)[indexName] == nil {
+		(*indexes)[indexName] = &Capacity{}
+	}
+	(*indexes)[indexName].Add(read, write)
+}
+
+// Merge adds the units other consumed, keeping its table and index breakdown.
+func (c *ConsumedCapacity) Merge(other *ConsumedCapacity) {
+	if other.Table != nil {
+		c.Add("", false, other.Table.ReadCapacityUnits, other.Table.WriteCapacityUnits)
+	}
+	for name, units := range other.GlobalSecondaryIndexes {
+		c.Add(name, false, units.ReadCapacityUnits, units.WriteCapacityUnits)
+	}
+	for name, units := range other.LocalSecondaryIndexes {
+		c.Add(name, true, units.ReadCapacityUnits, units.WriteCapacityUnits)
+	}
+}
+
+// ItemCollectionMetrics estimates the size of the item collection, the items
+// sharing a partition key together with their local secondary index entries.
+type ItemCollectionMetrics struct {
+	ItemCollectionKey map[string]AttributeValue `json:"ItemCollectionKey"`
+	SizeEstimateRangeGB []float64 `json:"SizeEstimateRangeGB"`
+}
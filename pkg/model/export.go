@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+const (
+	ExportStatusCompleted = "COMPLETED"
+
+	ExportFormatDynamoDBJSON = "DYNAMODB_JSON"
+	ExportFormatIon = "ION"
+
+	ExportTypeFull = "FULL_EXPORT"
+	ExportTypeIncremental = "INCREMENTAL_EXPORT"
+
+	ExportViewNewAndOldImages = "NEW_AND_OLD_IMAGES"
+	ExportViewNewImage = "NEW_IMAGE"
+)
+
+type ExportDescriptor struct {
+	ExportArn string
+	ExportStatus string
+	ExportType string
+	ExportFormat string
+	ExportManifest string
+	TableName string
+	TableArn string
+	TableId string
+	ClientToken string
+	S3Bucket string
+	S3BucketOwner string
+	S3Prefix string
+	S3SseAlgorithm string
+	StartTime time.Time
+	EndTime time.Time
+	ExportTime time.Time
+	ExportFromTime time.Time
+	ExportToTime time.Time
+	ExportViewType string
+	ItemCount int64
+	BilledSizeBytes int64
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+const (
+	ImportStatusCompleted = "COMPLETED"
+	ImportStatusFailed = "FAILED"
+
+	InputFormatDynamoDBJSON = "DYNAMODB_JSON"
+	InputFormatIon = "ION"
+	InputFormatCSV = "CSV"
+
+	InputCompressionNone = "NONE"
+	InputCompressionGzip = "GZIP"
+	InputCompressionZstd = "ZSTD"
+)
+
+type ImportDescriptor struct {
+	ImportArn string
+	ImportStatus string
+	TableName string
+	TableArn string
+	TableId string
+	ClientToken string
+	S3Bucket string
+	S3BucketOwner string
+	S3KeyPrefix string
+	InputFormat string
+	CsvDelimiter string
+	CsvHeaderList []string
+	InputCompressionType string
+	TableSchema TableSchema
+	AttributeTypes map[string]string
+	StartTime time.Time
+	EndTime time.Time
+	ProcessedSizeBytes int64
+	ProcessedItemCount int64
+	ImportedItemCount int64
+	ErrorCount int64
+	ErrorLog string
+	FailureCode string
+	FailureMessage string
+}
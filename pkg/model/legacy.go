@@ -0,0 +1,43 @@
+package model
+
+// Parameter types of the legacy (pre-expression) API. Handlers translate
+// them into expressions before evaluating anything.
+
+const (
+	ComparisonEQ = "EQ"
+	ComparisonNE = "NE"
+	ComparisonLE = "LE"
+	ComparisonLT = "LT"
+	ComparisonGE = "GE"
+	ComparisonGT = "GT"
+	ComparisonNotNull = "NOT_NULL"
+	ComparisonNull = "NULL"
+	ComparisonContains = "CONTAINS"
+	ComparisonNotContains = "NOT_CONTAINS"
+	ComparisonBeginsWith = "BEGINS_WITH"
+	ComparisonIn = "IN"
+	ComparisonBetween = "BETWEEN"
+)
+
+const (
+	AttributeActionPut = "PUT"
+	AttributeActionAdd = "ADD"
+	AttributeActionDelete = "DELETE"
+)
+
+type ExpectedAttributeValue struct {
+	Value AttributeValue `json:"Value,omitempty"`
+	Exists *bool `json:"Exists,omitempty"`
+	ComparisonOperator string `json:"ComparisonOperator,omitempty"`
+	AttributeValueList []AttributeValue `json:"AttributeValueList,omitempty"`
+}
+
+type LegacyCondition struct {
+	ComparisonOperator string `json:"ComparisonOperator"`
+	AttributeValueList []AttributeValue `json:"AttributeValueList,omitempty"`
+}
+
+type AttributeValueUpdate struct {
+	Value AttributeValue `json:"Value,omitempty"`
+	Action string `json:"Action,omitempty"`
+}
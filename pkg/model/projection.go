@@ -0,0 +1,49 @@
+package model
+
+const (
+	ProjectionTypeAll = "ALL"
+	ProjectionTypeKeysOnly = "KEYS_ONLY"
+	ProjectionTypeInclude = "INCLUDE"
+)
+
+type Projection struct {
+	ProjectionType string `json:"ProjectionType"`
+	NonKeyAttributes []string `json:"NonKeyAttributes,omitempty"`
+}
+
+// ProjectsAll reports whether the index holds every attribute of its items.
+// Indexes created before projections were tracked project everything.
+func (g GsiSchema) ProjectsAll() bool {
+	return g.Projection.ProjectionType == "" || g.Projection.ProjectionType == ProjectionTypeAll
+}
+
+// EffectiveProjection is the projection the index was created with, ALL for
+// indexes created before projections were tracked.
+func (g GsiSchema) EffectiveProjection() Projection {
+	if g.Projection.ProjectionType == "" {
+		return Projection{ProjectionType: ProjectionTypeAll}
+	}
+	return g.Projection
+}
+
+// ProjectIndexItem restricts item to what the index projects: the table and
+// index keys plus, for INCLUDE, the index's non-key attributes.
+func (s TableSchema) ProjectIndexItem(indexName string, item Record) Record {
+	index, ok := s.SecondaryIndex(indexName)
+	if !ok || index.ProjectsAll() {
+		return item
+	}
+
+	names := []string{s.PartitionKey, s.SortKey, index.PartitionKey, index.SortKey}
+	if index.Projection.ProjectionType == ProjectionTypeInclude {
+		names = append(names, index.Projection.NonKeyAttributes...)
+	}
+
+	projected := make(Record, len(names))
+	for _, name := range names {
+		if av, ok := item[name]; ok && name != "" {
+			projected[name] = av
+		}
+	}
+	return projected
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const SnapshotArchiveFormatVersion = 1
+
+type SnapshotDescriptor struct {
+	SnapshotName string
+	CreationTime time.Time
+	SizeBytes int64
+	TableNames []string
+	Partial bool
+}
+
+type SnapshotFile struct {
+	Name string
+	SizeBytes int64
+	SHA256 string
+}
+
+type SnapshotManifest struct {
+	FormatVersion int
+	Snapshot SnapshotDescriptor
+	Files []SnapshotFile
+}
@@ -0,0 +1,67 @@
+package model
+
+const (
+	StreamViewKeysOnly = "KEYS_ONLY"
+	StreamViewNewImage = "NEW_IMAGE"
+	StreamViewOldImage = "OLD_IMAGE"
+	StreamViewNewAndOldImages = "NEW_AND_OLD_IMAGES"
+)
+
+type StreamUserIdentity struct {
+	PrincipalId string `json:"PrincipalId"`
+	Type string `json:"Type"`
+}
+
+type StreamRecordData struct {
+	ApproximateCreationDateTime float64 `json:"ApproximateCreationDateTime"`
+	Keys Record `json:"Keys"`
+	NewImage Record `json:"NewImage,omitempty"`
+	OldImage Record `json:"OldImage,omitempty"`
+	SequenceNumber string `json:"SequenceNumber"`
+	SizeBytes int `json:"SizeBytes"`
+	StreamViewType string `json:"StreamViewType"`
+}
+
+type StreamRecord struct {
+	AwsRegion string `json:"awsRegion"`
+	Dynamodb StreamRecordData `json:"dynamodb"`
+	EventID string `json:"eventID"`
+	EventName string `json:"eventName"`
+	EventSource string `json:"eventSource"`
+	EventVersion string `json:"eventVersion"`
+	UserIdentity *StreamUserIdentity `json:"userIdentity,omitempty"`
+}
+
+type StreamEventRecord struct {
+	StreamRecord
+	EventSourceARN string `json:"eventSourceARN"`
+}
+
+type StreamEvent struct {
+	Records []StreamEventRecord `json:"Records"`
+}
+
+type KeySchemaElement struct {
+	AttributeName string `json:"AttributeName"`
+	KeyType string `json:"KeyType"`
+}
+
+type StreamDescriptor struct {
+	StreamArn string
+	StreamLabel string
+	TableName string
+	StreamViewType string
+	StreamStatus string
+	KeySchema []KeySchemaElement
+	ShardId string
+	CreationTime int64
+	DisabledTime int64
+}
+
+func IsValidStreamViewType(viewType string) bool {
+	switch viewType {
+	case StreamViewKeysOnly, StreamViewNewImage, StreamViewOldImage, StreamViewNewAndOldImages:
+		return true
+	}
+	return false
+}
@@ -10,6 +10,8 @@ type GsiSchema struct {
 	IndexName string
 	PartitionKey string
 	SortKey string
+	ProvisionedThroughput ProvisionedThroughput
+	Projection Projection
 }
 
 type TableSchema struct {
@@ -17,7 +19,15 @@ type TableSchema struct {
 	PartitionKey string
 	SortKey string
 	GSIs map[string]GsiSchema
+	LSIs map[string]GsiSchema
 	TTLAttribute string 
+	StreamViewType string
+	StreamLabel string
+	PITREnabled bool
+	PITREnabledAt int64
+	PITRRecoveryPeriodDays int
+	BillingMode string
+	ProvisionedThroughput ProvisionedThroughput
 }
 
 type PutItemInput struct {
@@ -27,6 +37,10 @@ type PutItemInput struct {
 	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
 	ExpressionAttributeValues map[string]AttributeValue `json:"ExpressionAttributeValues,omitempty"`
 	ReturnValues string `json:"ReturnValues,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	ReturnItemCollectionMetrics string `json:"ReturnItemCollectionMetrics,omitempty"`
+	Expected map[string]ExpectedAttributeValue `json:"Expected,omitempty"`
+	ConditionalOperator string `json:"ConditionalOperator,omitempty"`
 }
 
 type QueryInput struct {
@@ -38,6 +52,15 @@ type QueryInput struct {
 	Limit int64 `json:"Limit"`
 	ScanIndexForward bool `json:"ScanIndexForward"`
 	ExclusiveStartKey Record `json:"ExclusiveStartKey,omitempty"`
+	ConsistentRead bool `json:"ConsistentRead,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	Select string `json:"Select,omitempty"`
+	ProjectionExpression string `json:"ProjectionExpression,omitempty"`
+	FilterExpression string `json:"FilterExpression,omitempty"`
+	KeyConditions map[string]LegacyCondition `json:"KeyConditions,omitempty"`
+	QueryFilter map[string]LegacyCondition `json:"QueryFilter,omitempty"`
+	ConditionalOperator string `json:"ConditionalOperator,omitempty"`
+	AttributesToGet []string `json:"AttributesToGet,omitempty"`
 }
 
 type UpdateItemInput struct {
@@ -48,6 +71,11 @@ type UpdateItemInput struct {
 	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames,omitempty"`
 	ExpressionAttributeValues map[string]AttributeValue `json:"ExpressionAttributeValues,omitempty"`
 	ReturnValues string `json:"ReturnValues,omitempty"`
+	ReturnConsumedCapacity string `json:"ReturnConsumedCapacity,omitempty"`
+	ReturnItemCollectionMetrics string `json:"ReturnItemCollectionMetrics,omitempty"`
+	Expected map[string]ExpectedAttributeValue `json:"Expected,omitempty"`
+	ConditionalOperator string `json:"ConditionalOperator,omitempty"`
+	AttributeUpdates map[string]AttributeValueUpdate `json:"AttributeUpdates,omitempty"`
 }
 
 type ConditionInput struct {
@@ -10,6 +10,9 @@ import (
 const KeySeparator = "#"
 const GSIKeySeparator = "$"
 const SnapshotDir = "dynamodb_snapshots"
+const S3Dir = "dynamodb_s3"
+const ImportLogDir = "dynamodb_import_logs"
+const ArchiveDir = "dynamodb_archives"
 
 func BuildLevelDBKey(tableName string, pkVal string, skVal string) string {
 	if skVal == "" {
@@ -18,11 +21,28 @@ func BuildLevelDBKey(tableName string, pkVal string, skVal string) string {
 	return fmt.Sprintf("%s%s%s%s%s", tableName, KeySeparator, pkVal, KeySeparator, skVal)
 }
 
-func BuildGSILevelDBKey(indexName string, gpkVal string, gskVal string, basePkVal string) string {
+// IndexKeyPrefix starts every secondary index entry. Entries are scoped by
+// table, so tables sharing an index name never see each other's entries.
+const IndexKeyPrefix = "__INDEX__" + KeySeparator
+
+func BuildIndexKeyPrefix(tableName string, indexName string) string {
+	return IndexKeyPrefix + tableName + KeySeparator + indexName + GSIKeySeparator
+}
+
+func BuildGSILevelDBKey(tableName string, indexName string, gpkVal string, gskVal string, basePkVal string) string {
+	prefix := BuildIndexKeyPrefix(tableName, indexName)
 	if gskVal == "" {
-		return fmt.Sprintf("%s%s%s%s%s", indexName, GSIKeySeparator, gpkVal, GSIKeySeparator, basePkVal)
+		return fmt.Sprintf("%s%s%s%s", prefix, gpkVal, GSIKeySeparator, basePkVal)
+	}
+	return fmt.Sprintf("%s%s%s%s%s%s", prefix, gpkVal, GSIKeySeparator, gskVal, GSIKeySeparator, basePkVal)
+}
+
+func (s TableSchema) SecondaryIndex(indexName string) (GsiSchema, bool) {
+	if lsi, ok := s.LSIs[indexName]; ok {
+		return lsi, true
 	}
-	return fmt.Sprintf("%s%s%s%s%s%s%s", indexName, GSIKeySeparator, gpkVal, GSIKeySeparator, gskVal, GSIKeySeparator, basePkVal)
+	gsi, ok := s.GSIs[indexName]
+	return gsi, ok
 }
 
 func MarshalRecord(r Record) ([]byte, error) {